@@ -0,0 +1,345 @@
+package faiss
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AutoTrainIndex lets an index that requires training, such as one created
+// with IndexFactory(d, "IVF100,Flat", metric), be filled with Add right away.
+// Added vectors are buffered until minTrainVectors are available, or
+// Finalize is called; the index is then trained on the buffer, the buffer is
+// added to it and released, and later adds pass through directly.
+//
+// Until then, Search, SearchBatch, SearchWithDeadline, RangeSearchBatch and
+// KthNeighborDistance fail with an error matching ErrIndexNotTrained that
+// reports the number of buffered vectors. Other searches, such as
+// SearchWithOptions or SearchOne, reach the untrained index and fail with
+// ErrIndexNotTrained alone. IDs given to AddWithIDs are kept, and vectors
+// added with Add get the sequential IDs they would have had without
+// buffering.
+//
+// If adding the buffer fails after training, the vectors added so far leave
+// the buffer and the rest stay buffered; the next Add, Finalize or Train
+// retries adding them without training again.
+type AutoTrainIndex struct {
+	Index
+
+	minTrainVectors int
+
+	mu       sync.Mutex
+	trained  bool
+	buffer   []autoTrainRun
+	buffered int // Number of vectors in buffer
+}
+
+// autoTrainRun is a run of buffered vectors added the same way: with ids, or
+// with sequential IDs if ids is nil.
+type autoTrainRun struct {
+	vectors []float32
+	ids     []int64
+}
+
+// NewAutoTrainIndex wraps inner, which is trained automatically once
+// minTrainVectors vectors were added. If inner doesn't need training, adds
+// pass through from the start.
+func NewAutoTrainIndex(inner Index, minTrainVectors int) (*AutoTrainIndex, error) {
+	if inner == nil || inner.cPtr() == nil {
+		return nil, ErrNullPointer
+	}
+	if minTrainVectors <= 0 {
+		return nil, fmt.Errorf("minTrainVectors must be positive, got %d", minTrainVectors)
+	}
+
+	return &AutoTrainIndex{
+		Index:           inner,
+		minTrainVectors: minTrainVectors,
+		trained:         inner.IsTrained(),
+	}, nil
+}
+
+// Buffered returns the number of vectors waiting for training.
+func (a *AutoTrainIndex) Buffered() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.buffered
+}
+
+// IsTrained reports whether the index was trained and adds pass through.
+func (a *AutoTrainIndex) IsTrained() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.trained
+}
+
+// bufferVectors appends x to the buffer, with ids if not nil, and trains once enough
+// vectors are buffered. It returns false if the index is already trained and
+// x must be added directly. a.mu must be held.
+func (a *AutoTrainIndex) bufferVectors(x []float32, ids []int64) (bool, error) {
+	if a.trained {
+		return false, nil
+	}
+
+	d := a.Index.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return true, wrapError(err, "add vectors validation")
+	}
+	n := len(x) / d
+	if ids != nil && len(ids) != n {
+		return true, fmt.Errorf("number of IDs (%d) doesn't match number of vectors (%d)", len(ids), n)
+	}
+
+	// Copy, as the caller may reuse its slices after Add returns.
+	vectors := append([]float32(nil), x...)
+	if ids != nil {
+		ids = append([]int64(nil), ids...)
+	}
+
+	last := len(a.buffer) - 1
+	if last >= 0 && (a.buffer[last].ids == nil) == (ids == nil) {
+		a.buffer[last].vectors = append(a.buffer[last].vectors, vectors...)
+		a.buffer[last].ids = append(a.buffer[last].ids, ids...)
+	} else {
+		a.buffer = append(a.buffer, autoTrainRun{vectors: vectors, ids: ids})
+	}
+	a.buffered += n
+
+	if a.buffered >= a.minTrainVectors {
+		return true, a.trainBuffer(nil)
+	}
+	return true, nil
+}
+
+// trainBuffer trains the index on x, or on the buffer if x is nil, then adds
+// the buffer to the index and releases it. Training is skipped if a previous
+// call trained the index but failed to add the whole buffer. a.mu must be
+// held.
+func (a *AutoTrainIndex) trainBuffer(x []float32) error {
+	if !a.Index.IsTrained() {
+		if x == nil {
+			x = make([]float32, 0, a.buffered*a.Index.D())
+			for _, run := range a.buffer {
+				x = append(x, run.vectors...)
+			}
+		}
+		if err := a.Index.Train(x); err != nil {
+			return wrapError(err, "auto train")
+		}
+	}
+
+	// Drop each run once added, so that a retry doesn't add it again.
+	d := a.Index.D()
+	for len(a.buffer) > 0 {
+		run := a.buffer[0]
+		var err error
+		if run.ids == nil {
+			err = a.Index.Add(run.vectors)
+		} else {
+			err = a.Index.AddWithIDs(run.vectors, run.ids)
+		}
+		if err != nil {
+			return wrapError(err, "auto train flush buffer")
+		}
+		a.buffer = a.buffer[1:]
+		a.buffered -= len(run.vectors) / d
+	}
+
+	a.trained = true
+	a.buffer = nil
+	return nil
+}
+
+// Finalize trains the index on the vectors buffered so far, even if fewer
+// than minTrainVectors, and adds them. It does nothing if the index is
+// already trained.
+func (a *AutoTrainIndex) Finalize() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.trained {
+		return nil
+	}
+	if a.buffered == 0 {
+		return wrapError(ErrEmptyVectors, "finalize")
+	}
+	return a.trainBuffer(nil)
+}
+
+// Train trains the index on x instead of the buffer, then adds the buffer.
+func (a *AutoTrainIndex) Train(x []float32) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.trained {
+		return a.Index.Train(x)
+	}
+	if err := ValidateVectors(x, a.Index.D()); err != nil {
+		return wrapError(err, "train vectors validation")
+	}
+	return a.trainBuffer(x)
+}
+
+func (a *AutoTrainIndex) Add(x []float32) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if buffered, err := a.bufferVectors(x, nil); buffered {
+		return err
+	}
+	return a.Index.Add(x)
+}
+
+func (a *AutoTrainIndex) AddReturningIDs(x []float32) ([]int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.trained {
+		return a.Index.AddReturningIDs(x)
+	}
+
+	start := a.Index.Ntotal() + int64(a.buffered)
+	if _, err := a.bufferVectors(x, nil); err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(x)/a.Index.D())
+	for i := range ids {
+		ids[i] = start + int64(i)
+	}
+	return ids, nil
+}
+
+func (a *AutoTrainIndex) AddVectors2D(vectors [][]float32) error {
+	d := a.Index.D()
+	flat := make([]float32, 0, len(vectors)*d)
+	for i, row := range vectors {
+		if len(row) != d {
+			return fmt.Errorf("row %d: %w", i, &DimensionMismatchError{Got: len(row), Want: d})
+		}
+		flat = append(flat, row...)
+	}
+	return a.Add(flat)
+}
+
+func (a *AutoTrainIndex) AddWithIDs(x []float32, xids []int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if buffered, err := a.bufferVectors(x, xids); buffered {
+		return err
+	}
+	return a.Index.AddWithIDs(x, xids)
+}
+
+func (a *AutoTrainIndex) AddBatch(vectors []float32, batchSize int, opts ...BatchOption) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if buffered, err := a.bufferVectors(vectors, nil); buffered {
+		return err
+	}
+	return a.Index.AddBatch(vectors, batchSize, opts...)
+}
+
+func (a *AutoTrainIndex) AddWithIDsBatch(x []float32, xids []int64, batchSize int, opts ...BatchOption) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if buffered, err := a.bufferVectors(x, xids); buffered {
+		return err
+	}
+	return a.Index.AddWithIDsBatch(x, xids, batchSize, opts...)
+}
+
+func (a *AutoTrainIndex) AddFloat64(x []float64) error {
+	buf := toFloat32(x)
+	defer float32Buffers.Put(buf)
+
+	return a.Add(*buf)
+}
+
+func (a *AutoTrainIndex) AddFloat16(x []uint16) error {
+	return addFloat16(x, a.Index.D(), a.Add)
+}
+
+// AddFromMmap adds from the mapped file directly, which can't be buffered:
+// the index must be trained, by Train or Finalize, beforehand.
+func (a *AutoTrainIndex) AddFromMmap(path string, offsetVectors, countVectors int64) error {
+	if err := a.notTrained(); err != nil {
+		return err
+	}
+	return a.Index.AddFromMmap(path, offsetVectors, countVectors)
+}
+
+// notTrained returns the error of searches before training, nil once
+// trained.
+func (a *AutoTrainIndex) notTrained() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.trained {
+		return nil
+	}
+	return fmt.Errorf("%w: %d vectors buffered, training starts at %d", ErrIndexNotTrained, a.buffered, a.minTrainVectors)
+}
+
+func (a *AutoTrainIndex) Search(x []float32, k int64) (distances []float32, labels []int64, err error) {
+	if err := a.notTrained(); err != nil {
+		return nil, nil, err
+	}
+	return a.Index.Search(x, k)
+}
+
+func (a *AutoTrainIndex) KthNeighborDistance(x []float32, k int64) ([]float32, error) {
+	if err := a.notTrained(); err != nil {
+		return nil, err
+	}
+	return a.Index.KthNeighborDistance(x, k)
+}
+
+func (a *AutoTrainIndex) SearchBatch(queries []float32, k int64, batchSize int, opts ...BatchOption) (distances [][]float32, labels [][]int64, err error) {
+	if err := a.notTrained(); err != nil {
+		return nil, nil, err
+	}
+	return a.Index.SearchBatch(queries, k, batchSize, opts...)
+}
+
+func (a *AutoTrainIndex) SearchWithDeadline(x []float32, k int64, deadline time.Time) (distances []float32, labels []int64, completed int, err error) {
+	if err := a.notTrained(); err != nil {
+		return nil, nil, 0, err
+	}
+	return a.Index.SearchWithDeadline(x, k, deadline)
+}
+
+func (a *AutoTrainIndex) RangeSearchBatch(queries []float32, radius float32, batchSize int) ([]RangeResult, error) {
+	if err := a.notTrained(); err != nil {
+		return nil, err
+	}
+	return a.Index.RangeSearchBatch(queries, radius, batchSize)
+}
+
+func (a *AutoTrainIndex) SearchFloat64(x []float64, k int64) (distances []float32, labels []int64, err error) {
+	buf := toFloat32(x)
+	defer float32Buffers.Put(buf)
+
+	return a.Search(*buf, k)
+}
+
+func (a *AutoTrainIndex) SearchFloat16(x []uint16, k int64) (distances []float32, labels []int64, err error) {
+	if err := a.notTrained(); err != nil {
+		return nil, nil, err
+	}
+	return searchFloat16(x, a.Index.D(), k, a.Search)
+}
+
+// Reset removes all vectors from the index and drops the buffer.
+func (a *AutoTrainIndex) Reset() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.buffer = nil
+	a.buffered = 0
+	return a.Index.Reset()
+}
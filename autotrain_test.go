@@ -0,0 +1,97 @@
+package faiss
+
+import (
+	"errors"
+	"testing"
+)
+
+func newAutoTrain(t *testing.T, d int, description string, minTrainVectors int) *AutoTrainIndex {
+	t.Helper()
+
+	inner, err := IndexFactory(d, description, MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory(%q): %v", description, err)
+	}
+	t.Cleanup(func() { inner.Delete() })
+
+	a, err := NewAutoTrainIndex(inner, minTrainVectors)
+	if err != nil {
+		t.Fatalf("NewAutoTrainIndex: %v", err)
+	}
+	return a
+}
+
+func TestAutoTrainIndex(t *testing.T) {
+	const d = 8
+	x := clusteredVectors(300, d, 4, 1)
+	a := newAutoTrain(t, d, "IVF4,Flat", 200)
+
+	if err := a.Add(x[:150*d]); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if a.IsTrained() || a.Buffered() != 150 {
+		t.Fatalf("IsTrained %v with %d buffered, want false and 150", a.IsTrained(), a.Buffered())
+	}
+	if _, _, err := a.Search(x[:d], 1); !errors.Is(err, ErrIndexNotTrained) {
+		t.Errorf("Search before training = %v, want ErrIndexNotTrained", err)
+	}
+	if _, err := a.SearchOne(x[:d], 1); !errors.Is(err, ErrIndexNotTrained) {
+		t.Errorf("SearchOne before training = %v, want ErrIndexNotTrained", err)
+	}
+
+	ids, err := a.AddReturningIDs(x[150*d:])
+	if err != nil {
+		t.Fatalf("AddReturningIDs: %v", err)
+	}
+	if ids[0] != 150 || ids[len(ids)-1] != 299 {
+		t.Errorf("AddReturningIDs = %d..%d, want 150..299", ids[0], ids[len(ids)-1])
+	}
+	if !a.IsTrained() || a.Buffered() != 0 || a.Ntotal() != 300 {
+		t.Fatalf("IsTrained %v with %d buffered and Ntotal %d, want true, 0 and 300", a.IsTrained(), a.Buffered(), a.Ntotal())
+	}
+
+	// The query's own list is probed, as it was added to its nearest list
+	_, labels, err := a.Search(x[170*d:171*d], 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if labels[0] != 170 {
+		t.Errorf("nearest label = %d, want 170", labels[0])
+	}
+}
+
+func TestAutoTrainIndexFlushFailure(t *testing.T) {
+	const d = 8
+	x := clusteredVectors(300, d, 4, 2)
+	ids := make([]int64, 200)
+	for i := range ids {
+		ids[i] = int64(1000 + i)
+	}
+	// IDMap indexes reject plain adds, so flushing the second run fails
+	a := newAutoTrain(t, d, "IDMap,IVF4,Flat", 250)
+
+	if err := a.AddWithIDs(x[:200*d], ids); err != nil {
+		t.Fatalf("AddWithIDs: %v", err)
+	}
+	if err := a.Add(x[200*d:]); err == nil {
+		t.Fatal("flushing a plain add into an IDMap index succeeded")
+	}
+	if a.IsTrained() || a.Buffered() != 100 || a.Ntotal() != 200 {
+		t.Fatalf("IsTrained %v with %d buffered and Ntotal %d, want false, 100 and 200", a.IsTrained(), a.Buffered(), a.Ntotal())
+	}
+
+	// A retry doesn't add the flushed run again
+	if err := a.Finalize(); err == nil {
+		t.Fatal("Finalize retried the failing run successfully")
+	}
+	if a.Buffered() != 100 || a.Ntotal() != 200 {
+		t.Errorf("%d buffered and Ntotal %d after a retry, want 100 and 200", a.Buffered(), a.Ntotal())
+	}
+
+	if err := a.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if a.Buffered() != 0 || a.Ntotal() != 0 {
+		t.Errorf("%d buffered and Ntotal %d after Reset, want 0 and 0", a.Buffered(), a.Ntotal())
+	}
+}
@@ -0,0 +1,261 @@
+package faiss
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Tunable search parameters
+const (
+	ParamNProbe   = "nprobe"   // Number of IVF clusters visited during search
+	ParamEfSearch = "efSearch" // Size of the HNSW dynamic candidate list
+)
+
+// nprobeTuner is implemented by IVF wrappers that expose nprobe.
+type nprobeTuner interface {
+	GetNList() (int, error)
+	GetNProbe() (int, error)
+	SetNProbe(nprobe int) error
+}
+
+// efSearchTuner is implemented by HNSW wrappers that expose efSearch.
+type efSearchTuner interface {
+	GetEfSearch() (int, error)
+	SetEfSearch(efSearch int) error
+}
+
+// AutoTuneOptions configures AutoTune.
+type AutoTuneOptions struct {
+	// K is the number of neighbors used to compute recall@k. Searches clamp
+	// it to Ntotal.
+	K int64
+	// TargetRecall is the required recall@k in the range (0, 1].
+	TargetRecall float64
+	// LatencyBudget is the maximum mean latency per query. Zero disables the check.
+	LatencyBudget time.Duration
+	// Values are the parameter values to sweep in increasing order.
+	// If empty, a default sweep is derived from the index.
+	Values []int
+	// Reference is used to compute ground truth when none is passed to AutoTune.
+	// Usually an IndexFlat holding the same vectors as the tuned index.
+	Reference Index
+}
+
+// AutoTunePoint is a single measurement of the parameter sweep.
+type AutoTunePoint struct {
+	Value       int           // Parameter value
+	Recall      float64       // Measured recall@k
+	MeanLatency time.Duration // Mean search latency per query
+}
+
+// AutoTuneResult holds the outcome of AutoTune.
+type AutoTuneResult struct {
+	Parameter string          // Name of the swept parameter (ParamNProbe or ParamEfSearch)
+	Best      int             // Smallest value meeting the target, valid if Found
+	Found     bool            // Whether any value met the recall target and latency budget
+	Sweep     []AutoTunePoint // All measurements, in sweep order
+}
+
+// AutoTune sweeps the search parameter of idx (nprobe for IVF, efSearch for
+// HNSW) and returns the smallest value whose recall@k on queries reaches
+// opts.TargetRecall within opts.LatencyBudget.
+// groundTruth holds the k true nearest neighbors of each query; if nil, it is
+// computed by searching opts.Reference.
+// On success the index is left configured with the best value; otherwise the
+// original setting is restored.
+func AutoTune(idx Index, queries []float32, groundTruth []int64, opts AutoTuneOptions) (*AutoTuneResult, error) {
+	if idx == nil {
+		return nil, errors.New("index is nil")
+	}
+
+	if err := ValidateK(opts.K); err != nil {
+		return nil, wrapError(err, "autotune k validation")
+	}
+
+	if opts.TargetRecall <= 0 || opts.TargetRecall > 1 {
+		return nil, fmt.Errorf("target recall must be in (0, 1], got %v", opts.TargetRecall)
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(queries, d); err != nil {
+		return nil, wrapError(err, "autotune queries validation")
+	}
+	nq := len(queries) / d
+
+	if groundTruth == nil {
+		if opts.Reference == nil {
+			return nil, errors.New("either ground truth or a reference index is required")
+		}
+		_, gt, err := opts.Reference.Search(queries, opts.K)
+		if err != nil {
+			return nil, wrapError(err, "compute ground truth")
+		}
+		groundTruth = gt
+	}
+
+	// Ground truth computed by a search holds min(K, Ntotal) labels per query
+	if len(groundTruth)%nq != 0 || int64(len(groundTruth)/nq) > opts.K {
+		return nil, fmt.Errorf("ground truth length %d doesn't match %d queries * k=%d", len(groundTruth), nq, opts.K)
+	}
+
+	var (
+		param  string
+		get    func() (int, error)
+		set    func(int) error
+		values = opts.Values
+	)
+
+	switch t := idx.(type) {
+	case nprobeTuner:
+		param, get, set = ParamNProbe, t.GetNProbe, t.SetNProbe
+		if len(values) == 0 {
+			nlist, err := t.GetNList()
+			if err != nil {
+				return nil, wrapError(err, "autotune get nlist")
+			}
+			values = powersOfTwo(nlist)
+		}
+	case efSearchTuner:
+		param, get, set = ParamEfSearch, t.GetEfSearch, t.SetEfSearch
+		if len(values) == 0 {
+			values = powersOfTwo(1024)
+		}
+	default:
+		return nil, fmt.Errorf("index type %T has no tunable search parameter", idx)
+	}
+
+	original, err := get()
+	if err != nil {
+		return nil, wrapError(err, fmt.Sprintf("autotune get %s", param))
+	}
+
+	result := &AutoTuneResult{Parameter: param, Sweep: make([]AutoTunePoint, 0, len(values))}
+
+	for _, v := range values {
+		if err := set(v); err != nil {
+			_ = set(original)
+			return nil, wrapError(err, fmt.Sprintf("autotune set %s=%d", param, v))
+		}
+
+		start := time.Now()
+		_, labels, err := idx.Search(queries, opts.K)
+		elapsed := time.Since(start)
+		if err != nil {
+			_ = set(original)
+			return nil, wrapError(err, fmt.Sprintf("autotune search %s=%d", param, v))
+		}
+
+		point := AutoTunePoint{
+			Value:       v,
+			Recall:      recallAtK(groundTruth, labels, nq),
+			MeanLatency: elapsed / time.Duration(nq),
+		}
+		result.Sweep = append(result.Sweep, point)
+
+		if !result.Found && point.Recall >= opts.TargetRecall &&
+			(opts.LatencyBudget == 0 || point.MeanLatency <= opts.LatencyBudget) {
+			result.Best = v
+			result.Found = true
+		}
+	}
+
+	if result.Found {
+		err = set(result.Best)
+	} else {
+		err = set(original)
+	}
+	if err != nil {
+		return nil, wrapError(err, fmt.Sprintf("autotune apply %s", param))
+	}
+
+	return result, nil
+}
+
+// RecallAtK searches queries on both indexes and returns the fraction of the
+// exact top-k labels that approx also returns in its top-k, over all
+// queries. exact is typically an IndexFlat holding the same vectors as
+// approx. When exact holds fewer than k vectors, recall is computed over the
+// labels it returns.
+func RecallAtK(approx, exact Index, queries []float32, k int64) (float64, error) {
+	if approx == nil || exact == nil {
+		return 0, errors.New("index is nil")
+	}
+	if err := ValidateK(k); err != nil {
+		return 0, wrapError(err, "recall k validation")
+	}
+	if approx.D() != exact.D() {
+		return 0, &DimensionMismatchError{Got: approx.D(), Want: exact.D()}
+	}
+
+	d := exact.D()
+	if err := ValidateVectors(queries, d); err != nil {
+		return 0, wrapError(err, "recall queries validation")
+	}
+	nq := len(queries) / d
+
+	_, groundTruth, err := exact.Search(queries, k)
+	if err != nil {
+		return 0, wrapError(err, "recall exact search")
+	}
+	_, labels, err := approx.Search(queries, k)
+	if err != nil {
+		return 0, wrapError(err, "recall approximate search")
+	}
+
+	return recallAtK(groundTruth, labels, nq), nil
+}
+
+// Recall returns the fraction of the ground truth neighbors of nq queries
+// found in labels, each holding the same number of labels per query as
+// returned by Search. It computes RecallAtK from precomputed results, e.g.
+// to reuse the exact search across several measurements.
+func Recall(groundTruth, labels []int64, nq int) float64 {
+	return recallAtK(groundTruth, labels, nq)
+}
+
+// recallAtK returns the fraction of ground truth neighbors found in the
+// results. Each slice holds the same number of labels for each of the nq
+// queries.
+func recallAtK(groundTruth, labels []int64, nq int) float64 {
+	if nq <= 0 || len(groundTruth) == 0 || len(labels) == 0 {
+		return 0
+	}
+
+	// Both may hold fewer than k labels per query when k exceeds Ntotal
+	gtK, k := len(groundTruth)/nq, len(labels)/nq
+
+	var hits, total int64
+	for q := 0; q < nq; q++ {
+		found := make(map[int64]struct{}, k)
+		for _, l := range labels[q*k : (q+1)*k] {
+			found[l] = struct{}{}
+		}
+		for _, gt := range groundTruth[q*gtK : (q+1)*gtK] {
+			if gt < 0 {
+				continue
+			}
+			total++
+			if _, ok := found[gt]; ok {
+				hits++
+			}
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+// powersOfTwo returns 1, 2, 4, ... up to and including max.
+func powersOfTwo(max int) []int {
+	values := make([]int, 0)
+	for v := 1; v < max; v *= 2 {
+		values = append(values, v)
+	}
+	if max > 0 {
+		values = append(values, max)
+	}
+	return values
+}
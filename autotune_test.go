@@ -0,0 +1,118 @@
+package faiss
+
+import "testing"
+
+func TestAutoTuneRecallIncreasesWithNProbe(t *testing.T) {
+	const d, n, nlist, nq, k = 16, 4000, 32, 100, 10
+	x := clusteredVectors(n, d, 64, 1)
+	ivf := newIVFFlatL2(t, d, nlist, x)
+	flat := newFlatL2(t, d, x)
+	queries := clusteredVectors(nq, d, 64, 2)
+
+	result, err := AutoTune(ivf, queries, nil, AutoTuneOptions{
+		K:            k,
+		TargetRecall: 0.95,
+		Values:       []int{1, 2, 4, 8, 16, 32},
+		Reference:    flat,
+	})
+	if err != nil {
+		t.Fatalf("AutoTune: %v", err)
+	}
+	if result.Parameter != ParamNProbe {
+		t.Fatalf("Parameter = %q, want %q", result.Parameter, ParamNProbe)
+	}
+	if len(result.Sweep) != 6 {
+		t.Fatalf("sweep has %d points, want 6", len(result.Sweep))
+	}
+
+	// Visiting more lists only adds candidates, so recall can't decrease.
+	for i := 1; i < len(result.Sweep); i++ {
+		if result.Sweep[i].Recall < result.Sweep[i-1].Recall {
+			t.Fatalf("recall decreased from nprobe=%d to nprobe=%d: %+v",
+				result.Sweep[i-1].Value, result.Sweep[i].Value, result.Sweep)
+		}
+	}
+	// nprobe=nlist is an exhaustive search.
+	if last := result.Sweep[len(result.Sweep)-1]; last.Recall != 1 {
+		t.Fatalf("recall at nprobe=nlist = %v, want 1", last.Recall)
+	}
+
+	if !result.Found {
+		t.Fatalf("no nprobe reached the target: %+v", result.Sweep)
+	}
+	nprobe, err := ivf.GetNProbe()
+	if err != nil {
+		t.Fatalf("GetNProbe: %v", err)
+	}
+	if nprobe != result.Best {
+		t.Fatalf("nprobe left at %d, want the best value %d", nprobe, result.Best)
+	}
+}
+
+func TestAutoTuneRestoresSettingWhenTargetMissed(t *testing.T) {
+	const d, n, nlist, nq, k = 16, 2000, 32, 50, 10
+	x := randomVectors(n, d, 1)
+	ivf := newIVFFlatL2(t, d, nlist, x)
+	flat := newFlatL2(t, d, x)
+	if err := ivf.SetNProbe(3); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+
+	// Uniform data spreads neighbors over many lists, so one list can't
+	// reach perfect recall.
+	result, err := AutoTune(ivf, randomVectors(nq, d, 2), nil, AutoTuneOptions{
+		K:            k,
+		TargetRecall: 1,
+		Values:       []int{1},
+		Reference:    flat,
+	})
+	if err != nil {
+		t.Fatalf("AutoTune: %v", err)
+	}
+	if result.Found {
+		t.Fatalf("target unexpectedly met: %+v", result.Sweep)
+	}
+	if nprobe, _ := ivf.GetNProbe(); nprobe != 3 {
+		t.Fatalf("nprobe = %d after a failed sweep, want the original 3", nprobe)
+	}
+}
+
+func TestRecallAtK(t *testing.T) {
+	const d, n, nq, k = 16, 2000, 50, 10
+	x := clusteredVectors(n, d, 64, 1)
+	queries := clusteredVectors(nq, d, 64, 2)
+	exact := newFlatL2(t, d, x)
+	copied := newFlatL2(t, d, x)
+
+	for name, approx := range map[string]Index{"same index": exact, "copy": copied} {
+		recall, err := RecallAtK(approx, exact, queries, k)
+		if err != nil {
+			t.Fatalf("%s: RecallAtK: %v", name, err)
+		}
+		if recall != 1 {
+			t.Errorf("%s: recall = %v, want 1", name, recall)
+		}
+	}
+
+	// One probe out of 32 lists misses some neighbors
+	ivf := newIVFFlatL2(t, d, 32, x)
+	recall, err := RecallAtK(ivf, exact, queries, k)
+	if err != nil {
+		t.Fatalf("IVF RecallAtK: %v", err)
+	}
+	if recall <= 0 || recall > 1 {
+		t.Errorf("IVF recall = %v, want in (0, 1]", recall)
+	}
+
+	// With fewer than k vectors, recall is over the labels exact returns
+	small := newFlatL2(t, d, x[:5*d])
+	smallCopy := newFlatL2(t, d, x[:5*d])
+	if recall, err := RecallAtK(smallCopy, small, queries, k); err != nil || recall != 1 {
+		t.Errorf("RecallAtK with 5 vectors and k=%d = %v, %v, want 1", k, recall, err)
+	}
+
+	other := newFlatL2(t, 8, randomVectors(10, 8, 3))
+	if _, err := RecallAtK(other, exact, queries, k); err == nil {
+		t.Error("RecallAtK accepted indexes of different dimensions")
+	}
+}
@@ -0,0 +1,370 @@
+// Package bench compares index configurations on a dataset: it builds an
+// index from a factory description, then measures throughput, latency and
+// recall against an exact flat index, optionally sweeping nprobe or
+// efSearch.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"text/tabwriter"
+	"time"
+
+	faiss "github.com/BuiDanhTung28/goss"
+)
+
+// Defaults applied by RunBenchmark to zero fields of BenchConfig
+const (
+	DefaultNTrain   = 10000
+	DefaultNAdd     = 100000
+	DefaultNQuery   = 1000
+	DefaultK        = 10
+	DefaultClusters = 16
+)
+
+// BenchConfig describes a benchmark.
+type BenchConfig struct {
+	// Description is the IndexFactory description of the benchmarked index,
+	// e.g. "IVF1024,Flat" or "HNSW32".
+	Description string
+	// D is the vector dimension. It is required for generated data and
+	// checked against the file otherwise.
+	D      int
+	Metric int
+
+	// FvecsPath is the fvecs file the vectors are read from: the first
+	// NTrain vectors train the index, the next NAdd are added and the next
+	// NQuery are the queries. If empty, vectors are drawn from Clusters
+	// Gaussian clusters generated with Seed.
+	FvecsPath string
+	Clusters  int
+	Seed      int64
+
+	NTrain int // Training vectors, unused by indexes that don't need training
+	NAdd   int // Indexed vectors
+	NQuery int // Queries
+
+	K int64 // Neighbors per query
+
+	// NProbe and EfSearch are the nprobe values of IVF indexes and the
+	// efSearch values of HNSW indexes to measure, each in turn. If both are
+	// empty, the index is measured once with its default parameters.
+	NProbe   []int
+	EfSearch []int
+
+	// BatchSize is the number of queries per search call when measuring
+	// throughput. Zero means the default search batch size.
+	BatchSize int
+}
+
+// SweepResult holds the measurements for one parameter value.
+type SweepResult struct {
+	Param   string             `json:"param,omitempty"` // faiss.ParamNProbe, faiss.ParamEfSearch or empty
+	Value   int                `json:"value,omitempty"` // Parameter value
+	QPS     float64            `json:"qps"`             // Queries per second of batched searches
+	Latency faiss.LatencyStats `json:"latency"`         // Latencies of queries searched one at a time
+	Recall  float64            `json:"recall"`          // Recall@k against the flat baseline
+}
+
+// BenchReport holds the results of RunBenchmark.
+type BenchReport struct {
+	Description string        `json:"description"`
+	D           int           `json:"d"`
+	Metric      int           `json:"metric"`
+	NTrain      int           `json:"ntrain"`
+	NAdd        int           `json:"nadd"`
+	NQuery      int           `json:"nquery"`
+	K           int64         `json:"k"`
+	TrainTime   time.Duration `json:"train_time"`
+	AddTime     time.Duration `json:"add_time"`
+	BuildTime   time.Duration `json:"build_time"`   // TrainTime + AddTime
+	MemoryBytes int64         `json:"memory_bytes"` // Index.MemoryUsage after adding
+	Results     []SweepResult `json:"results"`
+}
+
+// RunBenchmark runs the benchmark described by cfg.
+func RunBenchmark(cfg BenchConfig) (BenchReport, error) {
+	return RunBenchmarkContext(context.Background(), cfg)
+}
+
+// RunBenchmarkContext is like RunBenchmark, stopping with ctx.Err() when ctx
+// is done. Cancellation is checked between the phases of the benchmark, the
+// add chunks and the swept values.
+func RunBenchmarkContext(ctx context.Context, cfg BenchConfig) (BenchReport, error) {
+	cfg = withDefaults(cfg)
+	if cfg.Description == "" {
+		return BenchReport{}, errors.New("index description is empty")
+	}
+	if err := faiss.ValidateMetric(cfg.Metric); err != nil {
+		return BenchReport{}, err
+	}
+	if err := faiss.ValidateK(cfg.K); err != nil {
+		return BenchReport{}, err
+	}
+
+	train, add, queries, d, err := loadDataset(cfg)
+	if err != nil {
+		return BenchReport{}, err
+	}
+	cfg.D = d
+
+	report := BenchReport{
+		Description: cfg.Description,
+		D:           cfg.D,
+		Metric:      cfg.Metric,
+		NTrain:      cfg.NTrain,
+		NAdd:        cfg.NAdd,
+		NQuery:      cfg.NQuery,
+		K:           cfg.K,
+	}
+
+	idx, err := faiss.IndexFactory(cfg.D, cfg.Description, cfg.Metric)
+	if err != nil {
+		return report, err
+	}
+	defer idx.Delete()
+
+	if idx.RequiresTraining() {
+		start := time.Now()
+		if err := idx.Train(train); err != nil {
+			return report, fmt.Errorf("train: %w", err)
+		}
+		report.TrainTime = time.Since(start)
+	}
+
+	start := time.Now()
+	if err := addChunks(ctx, idx, add, cfg.D); err != nil {
+		return report, err
+	}
+	report.AddTime = time.Since(start)
+	report.BuildTime = report.TrainTime + report.AddTime
+
+	if report.MemoryBytes, err = idx.MemoryUsage(); err != nil {
+		return report, fmt.Errorf("memory usage: %w", err)
+	}
+
+	groundTruth, err := baseline(ctx, cfg, add, queries)
+	if err != nil {
+		return report, err
+	}
+
+	sweeps := make([]SweepResult, 0, len(cfg.NProbe)+len(cfg.EfSearch))
+	for _, v := range cfg.NProbe {
+		sweeps = append(sweeps, SweepResult{Param: faiss.ParamNProbe, Value: v})
+	}
+	for _, v := range cfg.EfSearch {
+		sweeps = append(sweeps, SweepResult{Param: faiss.ParamEfSearch, Value: v})
+	}
+	if len(sweeps) == 0 {
+		sweeps = append(sweeps, SweepResult{})
+	}
+
+	for _, sweep := range sweeps {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := measure(idx, cfg, queries, groundTruth, &sweep); err != nil {
+			return report, err
+		}
+		report.Results = append(report.Results, sweep)
+	}
+	return report, nil
+}
+
+// withDefaults fills the zero fields of cfg.
+func withDefaults(cfg BenchConfig) BenchConfig {
+	if cfg.NTrain <= 0 {
+		cfg.NTrain = DefaultNTrain
+	}
+	if cfg.NAdd <= 0 {
+		cfg.NAdd = DefaultNAdd
+	}
+	if cfg.NQuery <= 0 {
+		cfg.NQuery = DefaultNQuery
+	}
+	if cfg.K <= 0 {
+		cfg.K = DefaultK
+	}
+	if cfg.Clusters <= 0 {
+		cfg.Clusters = DefaultClusters
+	}
+	return cfg
+}
+
+// loadDataset returns the training, indexed and query vectors of cfg, and
+// their dimension.
+func loadDataset(cfg BenchConfig) (train, add, queries []float32, d int, err error) {
+	n := cfg.NTrain + cfg.NAdd + cfg.NQuery
+
+	var vectors []float32
+	if cfg.FvecsPath != "" {
+		vectors, d, err = faiss.ReadFvecs(cfg.FvecsPath)
+		if err != nil {
+			return nil, nil, nil, 0, err
+		}
+		if d <= 0 {
+			return nil, nil, nil, 0, fmt.Errorf("%s holds no vectors", cfg.FvecsPath)
+		}
+		if cfg.D != 0 && d != cfg.D {
+			return nil, nil, nil, 0, &faiss.DimensionMismatchError{Got: d, Want: cfg.D}
+		}
+		if have := len(vectors) / d; have < n {
+			return nil, nil, nil, 0, fmt.Errorf("%s holds %d vectors, the split needs %d", cfg.FvecsPath, have, n)
+		}
+	} else {
+		if cfg.D <= 0 {
+			return nil, nil, nil, 0, faiss.ErrInvalidDimension
+		}
+		d = cfg.D
+		vectors = gaussianClusters(n, d, cfg.Clusters, cfg.Seed)
+	}
+
+	train = vectors[:cfg.NTrain*d]
+	add = vectors[cfg.NTrain*d : (cfg.NTrain+cfg.NAdd)*d]
+	queries = vectors[(cfg.NTrain+cfg.NAdd)*d : n*d]
+	return train, add, queries, d, nil
+}
+
+// gaussianClusters draws n d-dimensional vectors around clusters random
+// centers, with a standard deviation a tenth of the spread of the centers.
+func gaussianClusters(n, d, clusters int, seed int64) []float32 {
+	rng := rand.New(rand.NewSource(seed))
+
+	centers := make([]float32, clusters*d)
+	for i := range centers {
+		centers[i] = rng.Float32()*2 - 1
+	}
+
+	vectors := make([]float32, n*d)
+	for i := 0; i < n; i++ {
+		c := centers[rng.Intn(clusters)*d:]
+		for j := 0; j < d; j++ {
+			vectors[i*d+j] = c[j] + float32(rng.NormFloat64()*0.1)
+		}
+	}
+	return vectors
+}
+
+// addChunks adds x to idx in chunks of the default add batch size, checking
+// ctx in between.
+func addChunks(ctx context.Context, idx faiss.Index, x []float32, d int) error {
+	chunk, _ := faiss.DefaultBatchSizes()
+	n := len(x) / d
+	for i := 0; i < n; i += chunk {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := idx.Add(faiss.GetVectorBatch(x, d, i, chunk)); err != nil {
+			return fmt.Errorf("add: %w", err)
+		}
+	}
+	return nil
+}
+
+// baseline returns the exact top-k labels of queries, from a flat index
+// over add.
+func baseline(ctx context.Context, cfg BenchConfig, add, queries []float32) ([]int64, error) {
+	flat, err := faiss.IndexFactory(cfg.D, "Flat", cfg.Metric)
+	if err != nil {
+		return nil, err
+	}
+	defer flat.Delete()
+
+	if err := addChunks(ctx, flat, add, cfg.D); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, labels, err := flat.SearchBatch(queries, cfg.K, cfg.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("baseline search: %w", err)
+	}
+	return flatten(labels), nil
+}
+
+// measure sets the parameter of sweep on idx and fills in its measurements.
+func measure(idx faiss.Index, cfg BenchConfig, queries []float32, groundTruth []int64, sweep *SweepResult) error {
+	if err := setParam(idx, sweep.Param, sweep.Value); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	_, labels, err := idx.SearchBatch(queries, cfg.K, cfg.BatchSize)
+	elapsed := time.Since(start)
+	if err != nil {
+		return fmt.Errorf("search %s=%d: %w", sweep.Param, sweep.Value, err)
+	}
+	if elapsed > 0 {
+		sweep.QPS = float64(cfg.NQuery) / elapsed.Seconds()
+	}
+	sweep.Recall = faiss.Recall(groundTruth, flatten(labels), cfg.NQuery)
+
+	if sweep.Latency, err = faiss.BenchmarkSearch(idx, queries, cfg.K); err != nil {
+		return fmt.Errorf("latency %s=%d: %w", sweep.Param, sweep.Value, err)
+	}
+	return nil
+}
+
+// setParam sets the search parameter param of idx to v. An empty param
+// leaves idx unchanged.
+func setParam(idx faiss.Index, param string, v int) error {
+	switch param {
+	case "":
+		return nil
+	case faiss.ParamNProbe:
+		if ivf, err := faiss.AsIVFFlat(idx); err == nil {
+			return ivf.SetNProbe(v)
+		}
+		if ivf, err := faiss.AsIVFPQ(idx); err == nil {
+			return ivf.SetNProbe(v)
+		}
+		return errors.New("nprobe sweep requires an IVF Flat or IVF PQ index")
+	case faiss.ParamEfSearch:
+		hnsw, err := faiss.AsHNSW(idx)
+		if err != nil {
+			return fmt.Errorf("efSearch sweep: %w", err)
+		}
+		return hnsw.SetEfSearch(v)
+	}
+	return fmt.Errorf("unknown parameter %q", param)
+}
+
+// flatten concatenates the per-query labels returned by SearchBatch.
+func flatten(rows [][]int64) []int64 {
+	var n int
+	for _, row := range rows {
+		n += len(row)
+	}
+	out := make([]int64, 0, n)
+	for _, row := range rows {
+		out = append(out, row...)
+	}
+	return out
+}
+
+// WriteText writes r as an aligned table, for command-line tools.
+func (r BenchReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "index\t%s (d=%d, metric=%d)\n", r.Description, r.D, r.Metric)
+	fmt.Fprintf(tw, "data\ttrain=%d add=%d queries=%d k=%d\n", r.NTrain, r.NAdd, r.NQuery, r.K)
+	fmt.Fprintf(tw, "build\t%v (train %v, add %v)\n", r.BuildTime, r.TrainTime, r.AddTime)
+	fmt.Fprintf(tw, "memory\t%.1f MiB\n", float64(r.MemoryBytes)/(1<<20))
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "param\tvalue\trecall\tqps\tmean\tp50\tp95\tp99")
+	for _, s := range r.Results {
+		param, value := s.Param, fmt.Sprint(s.Value)
+		if param == "" {
+			param, value = "default", "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.4f\t%.0f\t%v\t%v\t%v\t%v\n",
+			param, value, s.Recall, s.QPS,
+			s.Latency.Mean, s.Latency.P50, s.Latency.P95, s.Latency.P99)
+	}
+	return tw.Flush()
+}
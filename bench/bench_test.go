@@ -0,0 +1,191 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	faiss "github.com/BuiDanhTung28/goss"
+)
+
+// smallConfig returns a configuration quick enough for tests.
+func smallConfig(description string) BenchConfig {
+	return BenchConfig{
+		Description: description,
+		D:           16,
+		Metric:      faiss.MetricL2,
+		Seed:        1,
+		NTrain:      2000,
+		NAdd:        3000,
+		NQuery:      50,
+		K:           5,
+	}
+}
+
+func TestRunBenchmarkFlatIsExact(t *testing.T) {
+	report, err := RunBenchmark(smallConfig("Flat"))
+	if err != nil {
+		t.Fatalf("RunBenchmark: %v", err)
+	}
+	if len(report.Results) != 1 || report.Results[0].Param != "" {
+		t.Fatalf("Results = %+v, want one default measurement", report.Results)
+	}
+	r := report.Results[0]
+	if r.Recall != 1 {
+		t.Errorf("flat recall = %v, want 1", r.Recall)
+	}
+	if r.QPS <= 0 || r.Latency.P50 <= 0 {
+		t.Errorf("QPS = %v, p50 = %v, want positive", r.QPS, r.Latency.P50)
+	}
+	if report.MemoryBytes < int64(3000*16*4) {
+		t.Errorf("MemoryBytes = %d, want at least the vectors' size", report.MemoryBytes)
+	}
+	if report.TrainTime != 0 || report.BuildTime != report.AddTime {
+		t.Errorf("train %v, build %v, add %v: a flat index needs no training", report.TrainTime, report.BuildTime, report.AddTime)
+	}
+}
+
+func TestRunBenchmarkNProbeSweep(t *testing.T) {
+	cfg := smallConfig("IVF16,Flat")
+	cfg.NProbe = []int{1, 4, 16}
+	report, err := RunBenchmark(cfg)
+	if err != nil {
+		t.Fatalf("RunBenchmark: %v", err)
+	}
+	if len(report.Results) != len(cfg.NProbe) {
+		t.Fatalf("got %d results, want %d", len(report.Results), len(cfg.NProbe))
+	}
+	for i, r := range report.Results {
+		if r.Param != faiss.ParamNProbe || r.Value != cfg.NProbe[i] {
+			t.Errorf("result %d measures %s=%d, want %s=%d", i, r.Param, r.Value, faiss.ParamNProbe, cfg.NProbe[i])
+		}
+		if i > 0 && r.Recall < report.Results[i-1].Recall {
+			t.Errorf("recall fell from %v to %v as nprobe grew", report.Results[i-1].Recall, r.Recall)
+		}
+	}
+	if last := report.Results[len(report.Results)-1].Recall; last != 1 {
+		t.Errorf("recall visiting every list = %v, want 1", last)
+	}
+	if report.TrainTime <= 0 {
+		t.Error("TrainTime is zero for an IVF index")
+	}
+
+	// The report survives a JSON round trip
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var decoded BenchReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, report) {
+		t.Errorf("decoded report = %+v, want %+v", decoded, report)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	text := buf.String()
+	if !strings.Contains(text, "IVF16,Flat") || strings.Count(text, faiss.ParamNProbe) != len(cfg.NProbe) {
+		t.Errorf("WriteText output lacks the index or the sweep:\n%s", text)
+	}
+}
+
+func TestRunBenchmarkEfSearchSweep(t *testing.T) {
+	cfg := smallConfig("HNSW16")
+	cfg.EfSearch = []int{8, 64}
+	report, err := RunBenchmark(cfg)
+	if err != nil {
+		t.Fatalf("RunBenchmark: %v", err)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(report.Results))
+	}
+	for i, r := range report.Results {
+		if r.Param != faiss.ParamEfSearch || r.Value != cfg.EfSearch[i] {
+			t.Errorf("result %d measures %s=%d, want %s=%d", i, r.Param, r.Value, faiss.ParamEfSearch, cfg.EfSearch[i])
+		}
+	}
+	if lo, hi := report.Results[0].Recall, report.Results[1].Recall; hi < lo {
+		t.Errorf("recall fell from %v to %v as efSearch grew", lo, hi)
+	}
+
+	// Sweeping a parameter the index doesn't have is an error
+	cfg.EfSearch, cfg.NProbe = nil, []int{4}
+	if _, err := RunBenchmark(cfg); err == nil {
+		t.Error("RunBenchmark swept nprobe on an HNSW index")
+	}
+}
+
+// writeFvecs writes vectors of dimension d in the fvecs format.
+func writeFvecs(t *testing.T, path string, vectors []float32, d int) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for i := 0; i < len(vectors)/d; i++ {
+		binary.Write(&buf, binary.LittleEndian, int32(d))
+		for _, v := range vectors[i*d : (i+1)*d] {
+			binary.Write(&buf, binary.LittleEndian, math.Float32bits(v))
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestRunBenchmarkFvecs(t *testing.T) {
+	const d = 8
+	path := filepath.Join(t.TempDir(), "data.fvecs")
+	writeFvecs(t, path, gaussianClusters(300, d, 4, 1), d)
+
+	cfg := BenchConfig{Description: "Flat", Metric: faiss.MetricL2, FvecsPath: path, NTrain: 100, NAdd: 150, NQuery: 50, K: 3}
+	report, err := RunBenchmark(cfg)
+	if err != nil {
+		t.Fatalf("RunBenchmark: %v", err)
+	}
+	if report.D != d || report.Results[0].Recall != 1 {
+		t.Errorf("D = %d, recall = %v, want %d and 1", report.D, report.Results[0].Recall, d)
+	}
+
+	cfg.NAdd = 200
+	if _, err := RunBenchmark(cfg); err == nil {
+		t.Error("RunBenchmark accepted a split larger than the file")
+	}
+	cfg.NAdd, cfg.D = 150, 16
+	var mismatch *faiss.DimensionMismatchError
+	if _, err := RunBenchmark(cfg); !errors.As(err, &mismatch) {
+		t.Errorf("RunBenchmark with the wrong D = %v, want a DimensionMismatchError", err)
+	}
+}
+
+func TestRunBenchmarkRejectsBadConfig(t *testing.T) {
+	bad := map[string]BenchConfig{
+		"no description": {D: 8},
+		"no dimension":   {Description: "Flat"},
+		"bad metric":     {Description: "Flat", D: 8, Metric: 42},
+		"bad factory":    {Description: "NoSuchIndex", D: 8, NTrain: 10, NAdd: 10, NQuery: 1},
+	}
+	for name, cfg := range bad {
+		if _, err := RunBenchmark(cfg); err == nil {
+			t.Errorf("%s: RunBenchmark succeeded", name)
+		}
+	}
+}
+
+func TestRunBenchmarkCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := RunBenchmarkContext(ctx, smallConfig("Flat")); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunBenchmarkContext with a cancelled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,71 @@
+package faiss
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// LatencyStats summarizes per-query search latencies measured by
+// BenchmarkSearch.
+type LatencyStats struct {
+	Queries int           // Number of queries timed
+	Mean    time.Duration // Mean latency
+	P50     time.Duration // Median latency
+	P95     time.Duration // 95th percentile latency
+	P99     time.Duration // 99th percentile latency
+	QPS     float64       // Queries per second, sequentially on one goroutine
+}
+
+// BenchmarkSearch searches each query of queries on its own and reports the
+// distribution of latencies. Queries run one after the other, so QPS doesn't
+// account for the parallelism FAISS gets from batched searches.
+func BenchmarkSearch(idx Index, queries []float32, k int64) (LatencyStats, error) {
+	if idx == nil {
+		return LatencyStats{}, errors.New("index is nil")
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(queries, d); err != nil {
+		return LatencyStats{}, wrapError(err, "benchmark queries validation")
+	}
+	if err := ValidateK(k, idx.Ntotal()); err != nil {
+		return LatencyStats{}, wrapError(err, "benchmark k validation")
+	}
+
+	nq := len(queries) / d
+	latencies := make([]time.Duration, nq)
+	var total time.Duration
+	for i := range latencies {
+		start := time.Now()
+		if _, _, err := idx.Search(queries[i*d:(i+1)*d], k); err != nil {
+			return LatencyStats{}, wrapError(err, "benchmark search")
+		}
+		latencies[i] = time.Since(start)
+		total += latencies[i]
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	stats := LatencyStats{
+		Queries: nq,
+		Mean:    total / time.Duration(nq),
+		P50:     percentile(latencies, 50),
+		P95:     percentile(latencies, 95),
+		P99:     percentile(latencies, 99),
+	}
+	if total > 0 {
+		stats.QPS = float64(nq) / total.Seconds()
+	}
+	return stats, nil
+}
+
+// percentile returns the p-th percentile of sorted, using the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
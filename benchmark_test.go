@@ -0,0 +1,58 @@
+package faiss
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBenchmarkSearchPercentiles(t *testing.T) {
+	const d, n, nq = 32, 20000, 200
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+
+	stats, err := BenchmarkSearch(idx, randomVectors(nq, d, 2), 10)
+	if err != nil {
+		t.Fatalf("BenchmarkSearch: %v", err)
+	}
+	if stats.Queries != nq {
+		t.Errorf("Queries = %d, want %d", stats.Queries, nq)
+	}
+	if stats.P50 <= 0 || stats.P50 > stats.P95 || stats.P95 > stats.P99 {
+		t.Errorf("percentiles not positive and ordered: p50 %v, p95 %v, p99 %v", stats.P50, stats.P95, stats.P99)
+	}
+	if stats.Mean <= 0 || stats.QPS <= 0 {
+		t.Errorf("Mean = %v, QPS = %v, want positive", stats.Mean, stats.QPS)
+	}
+
+	if _, err := BenchmarkSearch(idx, randomVectors(1, d+1, 3), 10); err == nil {
+		t.Error("BenchmarkSearch accepted queries of the wrong dimension")
+	}
+}
+
+func TestPercentileNearestRank(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i + 1)
+	}
+	for p, want := range map[int]time.Duration{50: 50, 95: 95, 99: 99, 100: 100, 0: 1} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile(1..100, %d) = %d, want %d", p, got, want)
+		}
+	}
+	if got := percentile([]time.Duration{7}, 99); got != 7 {
+		t.Errorf("percentile of one value = %d, want 7", got)
+	}
+}
+
+func BenchmarkFlatSearchOneQuery(b *testing.B) {
+	const d, n = 128, 100000
+	idx := newFlatL2(b, d, randomVectors(n, d, 1))
+	queries := randomVectors(100, d, 2)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := queries[(i%100)*d : (i%100+1)*d]
+		if _, _, err := idx.Search(q, 10); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package faiss
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrBlobNotFound is returned by BlobStore.Get for a missing object.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore is a flat namespace of objects, such as a directory or an object
+// storage bucket. Put must replace an existing object atomically, as object
+// stores such as S3 do. Get returns an error matching ErrBlobNotFound for a
+// missing object.
+type BlobStore interface {
+	Put(name string, r io.Reader) error
+	Get(name string) (io.ReadCloser, error)
+	Exists(name string) (bool, error)
+}
+
+// BlobDeleter is implemented by stores that can delete objects. Stores
+// without it accumulate stale objects, which must be cleaned up externally.
+type BlobDeleter interface {
+	Delete(name string) error
+}
+
+// FileBlobStore is a BlobStore keeping objects as files in a directory.
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore creates a store in dir, creating the directory if needed.
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, wrapError(err, "create blob store directory")
+	}
+	return &FileBlobStore{dir: dir}, nil
+}
+
+// path returns the file of object name, rejecting names that would escape
+// the store directory.
+func (s *FileBlobStore) path(name string) (string, error) {
+	if name == "" || filepath.Base(name) != name {
+		return "", fmt.Errorf("invalid blob name %q", name)
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// Put writes the object atomically: readers see the old content or the new
+// one, never a partial write.
+func (s *FileBlobStore) Put(name string, r io.Reader) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FileBlobStore) Get(name string) (io.ReadCloser, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, name)
+	}
+	return f, err
+}
+
+func (s *FileBlobStore) Exists(name string) (bool, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *FileBlobStore) Delete(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// MemoryBlobStore is a BlobStore keeping objects in memory, for tests.
+type MemoryBlobStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewMemoryBlobStore creates an empty in-memory store.
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{objects: make(map[string][]byte)}
+}
+
+func (s *MemoryBlobStore) Put(name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[name] = data
+	return nil
+}
+
+func (s *MemoryBlobStore) Get(name string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, name)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryBlobStore) Exists(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.objects[name]
+	return ok, nil
+}
+
+func (s *MemoryBlobStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, name)
+	return nil
+}
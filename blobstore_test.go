@@ -0,0 +1,106 @@
+package faiss
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// blobStores returns one store of each implementation, empty.
+func blobStores(t *testing.T) map[string]BlobStore {
+	t.Helper()
+
+	fileStore, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBlobStore: %v", err)
+	}
+	return map[string]BlobStore{
+		"file":   fileStore,
+		"memory": NewMemoryBlobStore(),
+	}
+}
+
+func readBlob(t *testing.T, store BlobStore, name string) string {
+	t.Helper()
+
+	r, err := store.Get(name)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", name, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %q: %v", name, err)
+	}
+	return string(data)
+}
+
+// failingReader returns some data and then an error, like an upload
+// interrupted midway.
+type failingReader struct{ sent bool }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("connection reset")
+	}
+	r.sent = true
+	return copy(p, "partial"), nil
+}
+
+func TestBlobStores(t *testing.T) {
+	for name, store := range blobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Get("missing"); !errors.Is(err, ErrBlobNotFound) {
+				t.Errorf("Get of a missing object = %v, want ErrBlobNotFound", err)
+			}
+			if ok, err := store.Exists("missing"); ok || err != nil {
+				t.Errorf("Exists of a missing object = %v, %v", ok, err)
+			}
+
+			if err := store.Put("obj", strings.NewReader("first")); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if err := store.Put("obj", strings.NewReader("second")); err != nil {
+				t.Fatalf("Put replacing: %v", err)
+			}
+			if got := readBlob(t, store, "obj"); got != "second" {
+				t.Errorf("Get = %q, want %q", got, "second")
+			}
+
+			// A failed upload leaves the previous content in place
+			if err := store.Put("obj", &failingReader{}); err == nil {
+				t.Error("Put from a failing reader succeeded")
+			}
+			if got := readBlob(t, store, "obj"); got != "second" {
+				t.Errorf("Get after a failed Put = %q, want %q", got, "second")
+			}
+
+			deleter, ok := store.(BlobDeleter)
+			if !ok {
+				t.Fatal("store does not implement BlobDeleter")
+			}
+			if err := deleter.Delete("obj"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if ok, err := store.Exists("obj"); ok || err != nil {
+				t.Errorf("Exists after Delete = %v, %v", ok, err)
+			}
+			if err := deleter.Delete("obj"); err != nil {
+				t.Errorf("Delete of a missing object: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileBlobStoreRejectsPaths(t *testing.T) {
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBlobStore: %v", err)
+	}
+	for _, name := range []string{"", "../escape", "dir/obj"} {
+		if err := store.Put(name, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", name)
+		}
+	}
+}
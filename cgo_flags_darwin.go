@@ -4,10 +4,14 @@
 package faiss
 
 /*
-#cgo CXXFLAGS: -std=c++17 -O3
+#cgo CXXFLAGS: -std=c++17 -O3 -I${SRCDIR}/faiss_source
 #cgo CFLAGS: -I${SRCDIR}/faiss_source
 #cgo darwin LDFLAGS: -L${SRCDIR}/internal/lib/darwin_arm64 -lfaiss_c -lfaiss -lstdc++ -lomp -framework Accelerate
 // Link with libomp installed via homebrew
 #cgo LDFLAGS: -L/opt/homebrew/opt/libomp/lib -lomp
 */
 import "C"
+
+// libDir is the directory, relative to the module root, that the LDFLAGS
+// above link the FAISS static libraries from.
+const libDir = "internal/lib/darwin_arm64"
@@ -4,10 +4,14 @@
 package faiss
 
 /*
-#cgo CXXFLAGS: -std=c++17 -O3
+#cgo CXXFLAGS: -std=c++17 -O3 -I${SRCDIR}/faiss_source
 #cgo CFLAGS: -I${SRCDIR}/faiss_source
 #cgo LDFLAGS: -L${SRCDIR}/internal/lib -lfaiss -lstdc++ -lm -lrt
 // On Linux, OpenMP is usually found with -fopenmp
 #cgo LDFLAGS: -fopenmp
 */
 import "C"
+
+// libDir is the directory, relative to the module root, that the LDFLAGS
+// above link the FAISS static libraries from.
+const libDir = "internal/lib"
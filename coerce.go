@@ -0,0 +1,186 @@
+package faiss
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// ErrCoercionMismatch is returned when vectors are coerced with a policy other
+// than the one recorded for an index.
+var ErrCoercionMismatch = errors.New("dimension coercion doesn't match the index")
+
+// CoercePolicy selects how CoerceDimension changes the dimension of vectors.
+type CoercePolicy int
+
+const (
+	// CoerceZeroPad appends zeros; it only grows the dimension. Distances
+	// between padded vectors equal those of the originals.
+	CoerceZeroPad CoercePolicy = iota
+	// CoerceTruncate drops the trailing components; it only shrinks the
+	// dimension.
+	CoerceTruncate
+	// CoerceRandomProjection multiplies by a random Gaussian matrix, which
+	// approximately preserves distances (Johnson-Lindenstrauss). The matrix
+	// is derived from DefaultProjectionSeed unless a seed is given.
+	CoerceRandomProjection
+)
+
+// DefaultProjectionSeed is the seed of the projection used by
+// CoerceDimension with CoerceRandomProjection.
+const DefaultProjectionSeed = 42
+
+func (p CoercePolicy) String() string {
+	switch p {
+	case CoerceZeroPad:
+		return "zero-pad"
+	case CoerceTruncate:
+		return "truncate"
+	case CoerceRandomProjection:
+		return "random-projection"
+	default:
+		return fmt.Sprintf("CoercePolicy(%d)", int(p))
+	}
+}
+
+// parseCoercePolicy is the inverse of CoercePolicy.String.
+func parseCoercePolicy(s string) (CoercePolicy, error) {
+	for _, p := range []CoercePolicy{CoerceZeroPad, CoerceTruncate, CoerceRandomProjection} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown coerce policy %q", s)
+}
+
+// Projection is a random linear map from FromD to ToD dimensions.
+type Projection struct {
+	FromD  int
+	ToD    int
+	Matrix []float32 // ToD rows of FromD values
+}
+
+// NewProjection creates a random Gaussian projection, scaled by 1/sqrt(toD)
+// so that squared distances are preserved in expectation. The same seed
+// always gives the same matrix.
+func NewProjection(fromD, toD int, seed int64) (*Projection, error) {
+	if fromD <= 0 || toD <= 0 {
+		return nil, ErrInvalidDimension
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	scale := 1 / math.Sqrt(float64(toD))
+	matrix := make([]float32, toD*fromD)
+	for i := range matrix {
+		matrix[i] = float32(rng.NormFloat64() * scale)
+	}
+	return &Projection{FromD: fromD, ToD: toD, Matrix: matrix}, nil
+}
+
+// Apply projects vectors of dimension FromD.
+func (p *Projection) Apply(vectors []float32) ([]float32, error) {
+	out, _, err := PCATransform{Matrix: p.Matrix, DIn: p.FromD, DOut: p.ToD}.Apply(vectors, p.FromD)
+	if err != nil {
+		return nil, wrapError(err, "projection")
+	}
+	return out, nil
+}
+
+// CoerceDimension converts vectors of dimension fromD to dimension toD with
+// policy, so that vectors from models of different dimensions can go to the
+// same index. The input is not modified.
+func CoerceDimension(vectors []float32, fromD, toD int, policy CoercePolicy) ([]float32, error) {
+	return coerceDimension(vectors, fromD, toD, policy, DefaultProjectionSeed, nil)
+}
+
+// coerceDimension implements CoerceDimension. CoerceRandomProjection uses
+// projection if not nil, and otherwise generates one from seed.
+func coerceDimension(vectors []float32, fromD, toD int, policy CoercePolicy, seed int64, projection *Projection) ([]float32, error) {
+	if toD <= 0 {
+		return nil, ErrInvalidDimension
+	}
+	if err := ValidateVectors(vectors, fromD); err != nil {
+		return nil, wrapError(err, "coerce vectors validation")
+	}
+	n := len(vectors) / fromD
+
+	switch policy {
+	case CoerceZeroPad, CoerceTruncate:
+		if policy == CoerceZeroPad && toD < fromD {
+			return nil, fmt.Errorf("%s can't reduce dimension %d to %d", policy, fromD, toD)
+		}
+		if policy == CoerceTruncate && toD > fromD {
+			return nil, fmt.Errorf("%s can't increase dimension %d to %d", policy, fromD, toD)
+		}
+		keep := fromD
+		if toD < keep {
+			keep = toD
+		}
+		out := make([]float32, n*toD)
+		for i := 0; i < n; i++ {
+			copy(out[i*toD:i*toD+keep], vectors[i*fromD:i*fromD+keep])
+		}
+		return out, nil
+	case CoerceRandomProjection:
+		if projection == nil {
+			var err error
+			if projection, err = NewProjection(fromD, toD, seed); err != nil {
+				return nil, err
+			}
+		}
+		return projection.Apply(vectors)
+	default:
+		return nil, fmt.Errorf("unknown coerce policy %d", int(policy))
+	}
+}
+
+// CoerceTransform is a Transform coercing vectors from FromD to ToD
+// dimensions with Policy, for use in a TransformingIndex. Seed is the seed
+// of CoerceRandomProjection. The transform is saved with the index by
+// TransformingIndex.Write, recording the policy the index uses.
+//
+// Create it with NewCoerceTransform, which generates the projection matrix
+// once; a CoerceTransform literal regenerates it on every Apply.
+type CoerceTransform struct {
+	FromD  int
+	ToD    int
+	Policy CoercePolicy
+	Seed   int64
+
+	projection *Projection // CoerceRandomProjection matrix, if generated
+}
+
+// NewCoerceTransform creates a CoerceTransform, generating the matrix of
+// CoerceRandomProjection from seed.
+func NewCoerceTransform(fromD, toD int, policy CoercePolicy, seed int64) (CoerceTransform, error) {
+	t := CoerceTransform{FromD: fromD, ToD: toD, Policy: policy, Seed: seed}
+	switch policy {
+	case CoerceZeroPad, CoerceTruncate:
+		if fromD <= 0 || toD <= 0 {
+			return CoerceTransform{}, ErrInvalidDimension
+		}
+	case CoerceRandomProjection:
+		p, err := NewProjection(fromD, toD, seed)
+		if err != nil {
+			return CoerceTransform{}, err
+		}
+		t.projection = p
+	default:
+		return CoerceTransform{}, fmt.Errorf("unknown coerce policy %d", int(policy))
+	}
+	return t, nil
+}
+
+func (t CoerceTransform) InputDim() int { return t.FromD }
+
+func (t CoerceTransform) Apply(x []float32, d int) ([]float32, int, error) {
+	if d != t.FromD {
+		return nil, 0, fmt.Errorf("coerce: %w", &DimensionMismatchError{Got: d, Want: t.FromD})
+	}
+	out, err := coerceDimension(x, t.FromD, t.ToD, t.Policy, t.Seed, t.projection)
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, t.ToD, nil
+}
@@ -0,0 +1,182 @@
+package faiss
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func squaredDistance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		diff := float64(a[i] - b[i])
+		sum += diff * diff
+	}
+	return sum
+}
+
+func TestCoerceDimensionPadAndTruncate(t *testing.T) {
+	x := []float32{1, 2, 3, 4, 5, 6}
+
+	padded, err := CoerceDimension(x, 3, 5, CoerceZeroPad)
+	if err != nil {
+		t.Fatalf("CoerceDimension ZeroPad: %v", err)
+	}
+	want := []float32{1, 2, 3, 0, 0, 4, 5, 6, 0, 0}
+	for i := range want {
+		if padded[i] != want[i] {
+			t.Fatalf("ZeroPad = %v, want %v", padded, want)
+		}
+	}
+
+	truncated, err := CoerceDimension(x, 3, 2, CoerceTruncate)
+	if err != nil {
+		t.Fatalf("CoerceDimension Truncate: %v", err)
+	}
+	want = []float32{1, 2, 4, 5}
+	for i := range want {
+		if truncated[i] != want[i] {
+			t.Fatalf("Truncate = %v, want %v", truncated, want)
+		}
+	}
+	if x[3] != 4 {
+		t.Error("CoerceDimension modified its input")
+	}
+
+	if _, err := CoerceDimension(x, 3, 2, CoerceZeroPad); err == nil {
+		t.Error("ZeroPad accepted reducing the dimension")
+	}
+	if _, err := CoerceDimension(x, 3, 5, CoerceTruncate); err == nil {
+		t.Error("Truncate accepted increasing the dimension")
+	}
+	if _, err := CoerceDimension(x, 4, 2, CoerceTruncate); err == nil {
+		t.Error("CoerceDimension accepted vectors that aren't a multiple of fromD")
+	}
+}
+
+func TestNewProjectionIsDeterministic(t *testing.T) {
+	a, err := NewProjection(16, 8, 3)
+	if err != nil {
+		t.Fatalf("NewProjection: %v", err)
+	}
+	b, _ := NewProjection(16, 8, 3)
+	c, _ := NewProjection(16, 8, 4)
+	same, other := true, true
+	for i := range a.Matrix {
+		same = same && a.Matrix[i] == b.Matrix[i]
+		other = other && a.Matrix[i] == c.Matrix[i]
+	}
+	if !same {
+		t.Error("the same seed gave different matrices")
+	}
+	if other {
+		t.Error("different seeds gave the same matrix")
+	}
+
+	if _, err := NewProjection(0, 8, 3); err == nil {
+		t.Error("NewProjection accepted a zero dimension")
+	}
+}
+
+// TestProjectionPreservesDistances is a Johnson-Lindenstrauss sanity check:
+// a random projection from 256 to 128 dimensions keeps pairwise squared
+// distances of random vectors within a loose factor of the originals.
+func TestProjectionPreservesDistances(t *testing.T) {
+	const fromD, toD, n = 256, 128, 50
+	x := randomVectors(n, fromD, 1)
+
+	y, err := CoerceDimension(x, fromD, toD, CoerceRandomProjection)
+	if err != nil {
+		t.Fatalf("CoerceDimension: %v", err)
+	}
+	if len(y) != n*toD {
+		t.Fatalf("len = %d, want %d", len(y), n*toD)
+	}
+
+	var sumRatio float64
+	pairs := 0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			before := squaredDistance(x[i*fromD:(i+1)*fromD], x[j*fromD:(j+1)*fromD])
+			after := squaredDistance(y[i*toD:(i+1)*toD], y[j*toD:(j+1)*toD])
+			ratio := after / before
+			if ratio < 0.5 || ratio > 1.5 {
+				t.Errorf("pair %d, %d: squared distance ratio %.3f, want within [0.5, 1.5]", i, j, ratio)
+			}
+			sumRatio += ratio
+			pairs++
+		}
+	}
+	if mean := sumRatio / float64(pairs); math.Abs(mean-1) > 0.1 {
+		t.Errorf("mean squared distance ratio = %.3f, want about 1", mean)
+	}
+}
+
+func TestNewCoerceTransform(t *testing.T) {
+	const fromD, toD = 16, 8
+	x := randomVectors(20, fromD, 1)
+
+	coerce, err := NewCoerceTransform(fromD, toD, CoerceRandomProjection, DefaultProjectionSeed)
+	if err != nil {
+		t.Fatalf("NewCoerceTransform: %v", err)
+	}
+	want, err := CoerceDimension(x, fromD, toD, CoerceRandomProjection)
+	if err != nil {
+		t.Fatalf("CoerceDimension: %v", err)
+	}
+	if coerce.projection == nil {
+		t.Fatal("NewCoerceTransform didn't build the projection")
+	}
+	got, d, err := coerce.Apply(x, fromD)
+	if err != nil || d != toD || !approxEqual(got, want, 0) {
+		t.Fatalf("Apply = %d dimensions, %v, want the CoerceDimension result", d, err)
+	}
+
+	if _, err := NewCoerceTransform(fromD, 0, CoerceZeroPad, 0); !errors.Is(err, ErrInvalidDimension) {
+		t.Errorf("NewCoerceTransform to dimension 0 = %v, want ErrInvalidDimension", err)
+	}
+	if _, err := NewCoerceTransform(fromD, toD, CoercePolicy(42), 0); err == nil {
+		t.Error("NewCoerceTransform accepted an unknown policy")
+	}
+}
+
+func TestTransformingIndexRejectsOtherCoercion(t *testing.T) {
+	const fromD, toD = 4, 8
+	coerce := CoerceTransform{FromD: fromD, ToD: toD, Policy: CoerceZeroPad}
+	idx, err := NewTransformingIndex(newFlatL2(t, toD, nil), coerce)
+	if err != nil {
+		t.Fatalf("NewTransformingIndex: %v", err)
+	}
+
+	x := randomVectors(10, fromD, 1)
+	if err := idx.AddCoerced(x, fromD, CoerceZeroPad); err != nil {
+		t.Fatalf("AddCoerced: %v", err)
+	}
+	if err := idx.AddCoerced(x, fromD, CoerceRandomProjection); !errors.Is(err, ErrCoercionMismatch) {
+		t.Errorf("AddCoerced with another policy: got %v, want ErrCoercionMismatch", err)
+	}
+	if err := idx.AddCoerced(randomVectors(10, 6, 1), 6, CoerceZeroPad); !errors.Is(err, ErrCoercionMismatch) {
+		t.Errorf("AddCoerced from another dimension: got %v, want ErrCoercionMismatch", err)
+	}
+	if idx.Ntotal() != 10 {
+		t.Errorf("Ntotal = %d, want 10", idx.Ntotal())
+	}
+
+	// The policy is recorded with the saved index
+	fname := filepath.Join(t.TempDir(), "coerced.index")
+	if err := idx.Write(fname); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	loaded, err := ReadTransformingIndex(fname, 0)
+	if err != nil {
+		t.Fatalf("ReadTransformingIndex: %v", err)
+	}
+	defer loaded.Delete()
+	if c, ok := loaded.Coercion(); !ok || c != coerce {
+		t.Errorf("loaded Coercion = %+v, %v, want %+v", c, ok, coerce)
+	}
+	if err := loaded.AddCoerced(x, fromD, CoerceTruncate); !errors.Is(err, ErrCoercionMismatch) {
+		t.Errorf("loaded AddCoerced with another policy: got %v, want ErrCoercionMismatch", err)
+	}
+}
@@ -0,0 +1,228 @@
+package faiss
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CSVOptions configures LoadCSV and WriteCSV.
+type CSVOptions struct {
+	// Header indicates that the first row holds column names.
+	Header bool
+	// IDColumnName selects the ID column by header name. Requires Header.
+	IDColumnName string
+	// IDColumn selects the ID column by 1-based position; 0 means the rows
+	// carry no IDs unless IDColumnName is set. Rows with IDs are added with
+	// AddWithIDs.
+	IDColumn int
+	// Delimiter is the field delimiter, ',' if zero.
+	Delimiter rune
+	// BatchSize is the number of rows added at once, the default add batch
+	// size (see SetDefaultBatchSizes) if zero.
+	BatchSize int
+	// SkipInvalid skips rows with unparsable values or a wrong number of
+	// columns instead of failing.
+	SkipInvalid bool
+}
+
+// LoadCSV adds the vectors of a CSV stream to idx, one vector per row.
+// The dimension is inferred from the first data row and must match idx.D().
+// It returns the number of vectors added and, with SkipInvalid, the number of
+// rows skipped. Errors on invalid rows include the 1-based row number.
+func LoadCSV(idx Index, r io.Reader, opts CSVOptions) (added int, skipped int, err error) {
+	if idx == nil {
+		return 0, 0, errors.New("index is nil")
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	if opts.Delimiter != 0 {
+		reader.Comma = opts.Delimiter
+	}
+
+	batchSize, err := addBatchSize(opts.BatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	idCol := opts.IDColumn - 1
+	row := 0
+
+	if opts.Header {
+		header, err := reader.Read()
+		row++
+		if err != nil {
+			return 0, 0, wrapError(err, "read CSV header")
+		}
+		if opts.IDColumnName != "" {
+			idCol = -1
+			for i, name := range header {
+				if name == opts.IDColumnName {
+					idCol = i
+					break
+				}
+			}
+			if idCol < 0 {
+				return 0, 0, fmt.Errorf("ID column %q not found in CSV header", opts.IDColumnName)
+			}
+		}
+	} else if opts.IDColumnName != "" {
+		return 0, 0, errors.New("IDColumnName requires a CSV header")
+	}
+
+	d := idx.D()
+	vectors := make([]float32, 0, batchSize*d)
+	ids := make([]int64, 0, batchSize)
+
+	flush := func() error {
+		if len(vectors) == 0 {
+			return nil
+		}
+		var err error
+		if idCol >= 0 {
+			err = idx.AddWithIDs(vectors, ids)
+		} else {
+			err = idx.AddBatch(vectors, batchSize)
+		}
+		if err != nil {
+			return wrapError(err, fmt.Sprintf("add CSV rows ending at row %d", row))
+		}
+		added += len(vectors) / d
+		vectors = vectors[:0]
+		ids = ids[:0]
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			return added, skipped, wrapError(err, fmt.Sprintf("read CSV row %d", row))
+		}
+
+		nvals := len(record)
+		if idCol >= 0 {
+			nvals--
+		}
+		if nvals != d {
+			if opts.SkipInvalid {
+				skipped++
+				continue
+			}
+			return added, skipped, fmt.Errorf("CSV row %d has %d values, index dimension is %d", row, nvals, d)
+		}
+
+		vecStart, idStart := len(vectors), len(ids)
+		rowErr := error(nil)
+		for i, field := range record {
+			if i == idCol {
+				id, err := strconv.ParseInt(field, 10, 64)
+				if err != nil {
+					rowErr = fmt.Errorf("CSV row %d: invalid ID %q", row, field)
+					break
+				}
+				ids = append(ids, id)
+				continue
+			}
+			v, err := strconv.ParseFloat(field, 32)
+			if err != nil {
+				rowErr = fmt.Errorf("CSV row %d, column %d: invalid value %q", row, i+1, field)
+				break
+			}
+			vectors = append(vectors, float32(v))
+		}
+
+		if rowErr != nil {
+			if !opts.SkipInvalid {
+				return added, skipped, rowErr
+			}
+			// Drop the partially parsed row
+			vectors = vectors[:vecStart]
+			ids = ids[:idStart]
+			skipped++
+			continue
+		}
+
+		if len(vectors) >= batchSize*d {
+			if err := flush(); err != nil {
+				return added, skipped, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return added, skipped, err
+	}
+	return added, skipped, nil
+}
+
+// WriteCSV writes the vectors of a flat index as CSV, one vector per row.
+// With Header, a row of column names is written first. With IDColumn or
+// IDColumnName set, each row starts with the vector's ID.
+func WriteCSV(idx *IndexFlat, w io.Writer, opts CSVOptions) error {
+	if idx == nil || idx.Index == nil {
+		return errors.New("index is nil")
+	}
+
+	writer := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		writer.Comma = opts.Delimiter
+	}
+
+	batchSize, err := addBatchSize(opts.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	d := idx.D()
+	withIDs := opts.IDColumn > 0 || opts.IDColumnName != ""
+
+	fields := make([]string, 0, d+1)
+	if opts.Header {
+		if withIDs {
+			name := opts.IDColumnName
+			if name == "" {
+				name = "id"
+			}
+			fields = append(fields, name)
+		}
+		for j := 0; j < d; j++ {
+			fields = append(fields, fmt.Sprintf("v%d", j))
+		}
+		if err := writer.Write(fields); err != nil {
+			return wrapError(err, "write CSV header")
+		}
+	}
+
+	ntotal := idx.Ntotal()
+	for start := int64(0); start < ntotal; start += int64(batchSize) {
+		end := start + int64(batchSize)
+		vectors, err := idx.GetVectorRange(start, end)
+		if err != nil {
+			return wrapError(err, "read vectors for CSV")
+		}
+
+		for i := 0; i < len(vectors)/d; i++ {
+			fields = fields[:0]
+			if withIDs {
+				fields = append(fields, strconv.FormatInt(start+int64(i), 10))
+			}
+			for _, v := range vectors[i*d : (i+1)*d] {
+				fields = append(fields, strconv.FormatFloat(float64(v), 'g', -1, 32))
+			}
+			if err := writer.Write(fields); err != nil {
+				return wrapError(err, "write CSV row")
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
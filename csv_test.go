@@ -0,0 +1,86 @@
+package faiss
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	const d, n = 4, 300
+	x := randomVectors(n, d, 1)
+	src := newFlatL2(t, d, x)
+
+	var buf bytes.Buffer
+	if err := WriteCSV(src, &buf, CSVOptions{Header: true, Delimiter: ';', BatchSize: 64}); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	dst := newFlatL2(t, d, nil)
+	added, skipped, err := LoadCSV(dst, &buf, CSVOptions{Header: true, Delimiter: ';', BatchSize: 64})
+	if err != nil {
+		t.Fatalf("LoadCSV: %v", err)
+	}
+	if added != n || skipped != 0 {
+		t.Fatalf("LoadCSV added %d, skipped %d, want %d and 0", added, skipped, n)
+	}
+	got, err := dst.AllVectors()
+	if err != nil {
+		t.Fatalf("AllVectors: %v", err)
+	}
+	if !approxEqual(got, x, 0) {
+		t.Error("vectors loaded from CSV differ from the written ones")
+	}
+}
+
+func TestCSVRoundTripWithIDs(t *testing.T) {
+	const d = 2
+	src := newFlatL2(t, d, []float32{1, 0, 0, 1, 5, 5})
+
+	var buf bytes.Buffer
+	if err := WriteCSV(src, &buf, CSVOptions{Header: true, IDColumnName: "id"}); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	if header, _, _ := strings.Cut(buf.String(), "\n"); header != "id,v0,v1" {
+		t.Errorf("header = %q, want %q", header, "id,v0,v1")
+	}
+
+	dst, err := IndexFactory(d, "IDMap,Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory: %v", err)
+	}
+	defer dst.Delete()
+	if added, _, err := LoadCSV(dst, &buf, CSVOptions{Header: true, IDColumnName: "id"}); err != nil || added != 3 {
+		t.Fatalf("LoadCSV = %d, %v, want 3 rows", added, err)
+	}
+	_, labels, err := dst.Search([]float32{4, 4}, 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if labels[0] != 2 {
+		t.Errorf("nearest label = %d, want ID 2", labels[0])
+	}
+}
+
+func TestLoadCSVInvalidRows(t *testing.T) {
+	const input = "1,2,3\n4,x,6\n7,8\n9,10,11\n"
+
+	idx := newFlatL2(t, 3, nil)
+	_, _, err := LoadCSV(idx, strings.NewReader(input), CSVOptions{})
+	if err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Errorf("LoadCSV with an invalid value = %v, want an error naming row 2", err)
+	}
+
+	idx = newFlatL2(t, 3, nil)
+	added, skipped, err := LoadCSV(idx, strings.NewReader(input), CSVOptions{SkipInvalid: true})
+	if err != nil {
+		t.Fatalf("LoadCSV with SkipInvalid: %v", err)
+	}
+	if added != 2 || skipped != 2 || idx.Ntotal() != 2 {
+		t.Errorf("added %d, skipped %d, Ntotal %d, want 2, 2 and 2", added, skipped, idx.Ntotal())
+	}
+
+	if _, _, err := LoadCSV(newFlatL2(t, 4, nil), strings.NewReader(input), CSVOptions{}); err == nil {
+		t.Error("LoadCSV accepted rows of the wrong dimension")
+	}
+}
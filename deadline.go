@@ -0,0 +1,102 @@
+package faiss
+
+import (
+	"fmt"
+	"time"
+)
+
+// deadlineFirstBatch is the number of queries of the first sub-batch of
+// SearchWithDeadline, small enough to measure the speed of the index
+// before committing to larger sub-batches.
+const deadlineFirstBatch = 4
+
+// DeadlineError is returned by SearchWithDeadline when the deadline passed
+// before every query was searched.
+type DeadlineError struct {
+	Completed int // Leading queries searched, whose results are valid
+	Total     int // Queries passed
+}
+
+func (e *DeadlineError) Error() string {
+	return fmt.Sprintf("%v: %d of %d queries searched", ErrDeadlineExceeded, e.Completed, e.Total)
+}
+
+func (e *DeadlineError) Unwrap() error { return ErrDeadlineExceeded }
+
+func (idx *faissIndex) SearchWithDeadline(x []float32, k int64, deadline time.Time) (
+	distances []float32, labels []int64, completed int, err error,
+) {
+	if idx.idx == nil {
+		return nil, nil, 0, ErrIndexClosed
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return nil, nil, 0, wrapError(err, "search vectors validation")
+	}
+	if err := ValidateK(k, idx.Ntotal()); err != nil {
+		return nil, nil, 0, wrapError(err, "search k validation")
+	}
+	if !idx.IsTrained() {
+		return nil, nil, 0, wrapError(ErrIndexNotTrained, "search operation")
+	}
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return nil, nil, 0, wrapError(ErrEmptyIndex, "search operation")
+	}
+	// Clamp k once: every sub-batch writes rows of the same width.
+	k = clampK(k, ntotal)
+
+	nq := len(x) / d
+	distances = make([]float32, int64(nq)*k)
+	labels = make([]int64, int64(nq)*k)
+	for i := range labels {
+		labels[i] = -1
+	}
+
+	maxBatch, _ := searchBatchSize(0)
+	size := deadlineFirstBatch
+	for completed < nq {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return distances, labels, completed, &DeadlineError{Completed: completed, Total: nq}
+		}
+
+		end := completed + size
+		if end > nq {
+			end = nq
+		}
+
+		start := time.Now()
+		if err := idx.searchInto(
+			x[completed*d:end*d],
+			k,
+			distances[int64(completed)*k:int64(end)*k],
+			labels[int64(completed)*k:int64(end)*k],
+		); err != nil {
+			return distances, labels, completed, wrapError(err, fmt.Sprintf("search queries %d-%d", completed, end-1))
+		}
+		elapsed := time.Since(start)
+
+		n := end - completed
+		completed = end
+
+		// Size the next sub-batch to take at most half the time left: double
+		// it while ahead of schedule, shrink it otherwise.
+		perQuery := elapsed / time.Duration(n)
+		budget := time.Until(deadline) / 2
+		switch {
+		case perQuery <= 0 || time.Duration(2*size)*perQuery <= budget:
+			size *= 2
+		default:
+			size = int(budget / perQuery)
+		}
+		if size > maxBatch {
+			size = maxBatch
+		}
+		if size < 1 {
+			size = 1
+		}
+	}
+	return distances, labels, completed, nil
+}
@@ -0,0 +1,71 @@
+package faiss
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchWithDeadline(t *testing.T) {
+	const d, n, nq = 8, 20, 30
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	queries := randomVectors(nq, d, 2)
+
+	// k above Ntotal is clamped once, so every row has Ntotal results
+	distances, labels, completed, err := idx.SearchWithDeadline(queries, 50, time.Now().Add(time.Minute))
+	if err != nil || completed != nq {
+		t.Fatalf("SearchWithDeadline = %d completed, %v, want %d", completed, err, nq)
+	}
+	wantD, wantL, err := idx.Search(queries, n)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if !reflect.DeepEqual(labels, wantL) || !approxEqual(distances, wantD, 1e-5) {
+		t.Error("SearchWithDeadline results differ from Search")
+	}
+
+	// A passed deadline searches nothing
+	_, labels, completed, err = idx.SearchWithDeadline(queries, 5, time.Now().Add(-time.Second))
+	var deadlineErr *DeadlineError
+	if !errors.As(err, &deadlineErr) || !errors.Is(err, ErrDeadlineExceeded) || completed != 0 {
+		t.Fatalf("SearchWithDeadline after the deadline = %d completed, %v, want a DeadlineError", completed, err)
+	}
+	if deadlineErr.Completed != 0 || deadlineErr.Total != nq {
+		t.Errorf("DeadlineError = %+v, want 0 of %d", deadlineErr, nq)
+	}
+	for _, label := range labels {
+		if label != -1 {
+			t.Fatal("unsearched rows hold labels other than -1")
+		}
+	}
+}
+
+func TestSearchWithDeadlinePartialResults(t *testing.T) {
+	// Far more work than fits before the deadline
+	const d, n, nq, k = 128, 50000, 5000, 3
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	queries := randomVectors(nq, d, 2)
+
+	distances, labels, completed, err := idx.SearchWithDeadline(queries, k, time.Now().Add(20*time.Millisecond))
+	if !errors.Is(err, ErrDeadlineExceeded) {
+		t.Fatalf("SearchWithDeadline = %d completed, %v, want ErrDeadlineExceeded", completed, err)
+	}
+	if completed < deadlineFirstBatch || completed >= nq {
+		t.Fatalf("completed = %d, want a partial search of at least %d queries", completed, deadlineFirstBatch)
+	}
+
+	// Completed rows are valid, the others are left empty
+	wantD, wantL, err := idx.Search(queries[:completed*d], k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if !reflect.DeepEqual(labels[:completed*k], wantL) || !approxEqual(distances[:completed*k], wantD, 1e-3) {
+		t.Error("completed rows differ from Search")
+	}
+	for _, label := range labels[completed*k:] {
+		if label != -1 {
+			t.Fatal("rows after completed hold labels other than -1")
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package faiss
+
+import (
+	"fmt"
+	"math"
+)
+
+// isSimilarity reports whether larger values mean closer under metric.
+func isSimilarity(metric int) bool {
+	return metric == MetricInnerProduct
+}
+
+// IsCloser reports whether distance a is better than distance b, as returned
+// by a search under metric: larger for MetricInnerProduct, which is a
+// similarity, and smaller for the other metrics.
+func IsCloser(metric int, a, b float32) bool {
+	if isSimilarity(metric) {
+		return a > b
+	}
+	return a < b
+}
+
+// computeDistance computes the distance between x and y under metric, using
+// the same conventions as FAISS: MetricL2 is the squared Euclidean distance
+// and MetricInnerProduct is a similarity (larger is closer).
+func computeDistance(metric int, x, y []float32) (float32, error) {
+	if len(x) != len(y) {
+		return 0, fmt.Errorf("vector dimensions differ: %d != %d", len(x), len(y))
+	}
+
+	var dist float64
+	switch metric {
+	case MetricL2:
+		for i := range x {
+			diff := float64(x[i]) - float64(y[i])
+			dist += diff * diff
+		}
+	case MetricInnerProduct:
+		for i := range x {
+			dist += float64(x[i]) * float64(y[i])
+		}
+	case MetricL1:
+		for i := range x {
+			dist += math.Abs(float64(x[i]) - float64(y[i]))
+		}
+	case MetricLinf:
+		for i := range x {
+			dist = math.Max(dist, math.Abs(float64(x[i])-float64(y[i])))
+		}
+	case MetricCanberra:
+		for i := range x {
+			num := math.Abs(float64(x[i]) - float64(y[i]))
+			den := math.Abs(float64(x[i])) + math.Abs(float64(y[i]))
+			if den != 0 {
+				dist += num / den
+			}
+		}
+	case MetricBrayCurtis:
+		var num, den float64
+		for i := range x {
+			num += math.Abs(float64(x[i]) - float64(y[i]))
+			den += math.Abs(float64(x[i]) + float64(y[i]))
+		}
+		if den != 0 {
+			dist = num / den
+		}
+	case MetricJensenShannon:
+		for i := range x {
+			xi, yi := float64(x[i]), float64(y[i])
+			mi := (xi + yi) / 2
+			if xi > 0 {
+				dist += xi * math.Log(xi/mi)
+			}
+			if yi > 0 {
+				dist += yi * math.Log(yi/mi)
+			}
+		}
+		dist /= 2
+	default:
+		return 0, fmt.Errorf("unsupported metric type for distance computation: %d", metric)
+	}
+
+	return float32(dist), nil
+}
@@ -0,0 +1,49 @@
+package faiss
+
+import "testing"
+
+func TestIsCloser(t *testing.T) {
+	tests := []struct {
+		metric int
+		a, b   float32
+		want   bool
+	}{
+		{MetricL2, 1, 2, true},
+		{MetricL2, 2, 1, false},
+		{MetricL2, 1, 1, false},
+		{MetricL1, 0.5, 3, true},
+		{MetricInnerProduct, 2, 1, true},
+		{MetricInnerProduct, 1, 2, false},
+		{MetricInnerProduct, -1, -2, true},
+		{MetricInnerProduct, 1, 1, false},
+	}
+	for _, tt := range tests {
+		if got := IsCloser(tt.metric, tt.a, tt.b); got != tt.want {
+			t.Errorf("IsCloser(%d, %v, %v) = %v, want %v", tt.metric, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestIsCloserAgreesWithSearch(t *testing.T) {
+	const d = 8
+	for _, metric := range []int{MetricL2, MetricInnerProduct} {
+		idx, err := NewIndexFlat(d, metric)
+		if err != nil {
+			t.Fatalf("NewIndexFlat: %v", err)
+		}
+		defer idx.Delete()
+		if err := idx.Add(randomVectors(200, d, 1)); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+
+		distances, _, err := idx.Search(randomVectors(1, d, 2), 20)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		for i := 1; i < len(distances); i++ {
+			if IsCloser(metric, distances[i], distances[i-1]) {
+				t.Errorf("metric %d: rank %d (%v) is closer than rank %d (%v)", metric, i, distances[i], i-1, distances[i-1])
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package faiss
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Defaults of DriftOptions
+const (
+	DefaultDriftSampleRate = 0.01
+	DefaultDriftWindowSize = 10000
+)
+
+// DriftOptions configures a DriftMonitor.
+type DriftOptions struct {
+	// SampleRate is the fraction of observed vectors whose distance to the
+	// nearest centroid is measured. Zero means DefaultDriftSampleRate.
+	SampleRate float64
+	// WindowSize is the number of most recent samples DriftScore is computed
+	// on. Zero means DefaultDriftWindowSize.
+	WindowSize int
+	// Threshold is the DriftScore at which OnDrift is called. Zero disables
+	// the callback.
+	Threshold float64
+	// OnDrift is called once when DriftScore reaches Threshold. It is
+	// re-armed by SetBaseline, typically after a Retrain.
+	OnDrift func(score float64)
+}
+
+// DriftMonitor detects when vectors added to an IVF index no longer fit its
+// clustering, which degrades recall. It measures how far sampled vectors are
+// from their nearest centroid, compared with a baseline measured on data
+// representative of the training set.
+//
+// The distances are squared L2 distances. For MetricInnerProduct they are
+// derived from the similarities with CosineToL2, which assumes normalized
+// vectors. A DriftMonitor is safe for concurrent use.
+type DriftMonitor struct {
+	idx  *faissIndex
+	opts DriftOptions
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	baseline float64   // Mean distance of the baseline vectors
+	window   []float32 // Ring buffer of the most recent sampled distances
+	next     int       // Position of the next sample in window
+	sum      float64   // Sum of the distances in window
+	fired    bool      // Whether OnDrift was called since the baseline was set
+}
+
+// NewDriftMonitor creates a monitor for the trained IVF index idx. baseline
+// holds vectors representative of the data the index was trained on, such as
+// the training set or a sample of it.
+func NewDriftMonitor(idx Index, baseline []float32, opts DriftOptions) (*DriftMonitor, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return nil, ErrNullPointer
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate must be in [0, 1], got %v", opts.SampleRate)
+	}
+	if opts.SampleRate == 0 {
+		opts.SampleRate = DefaultDriftSampleRate
+	}
+	if opts.WindowSize < 0 {
+		return nil, fmt.Errorf("window size must be positive, got %d", opts.WindowSize)
+	}
+	if opts.WindowSize == 0 {
+		opts.WindowSize = DefaultDriftWindowSize
+	}
+
+	m := &DriftMonitor{
+		idx:    idx.native(),
+		opts:   opts,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		window: make([]float32, 0, opts.WindowSize),
+	}
+	if err := m.SetBaseline(baseline); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// distances returns the squared L2 distances from the vectors of x to their
+// nearest centroid.
+func (m *DriftMonitor) distances(x []float32) ([]float32, error) {
+	distances, err := m.idx.coarseDistances(x)
+	if err != nil {
+		return nil, err
+	}
+	if m.idx.MetricType() == MetricInnerProduct {
+		for i, sim := range distances {
+			distances[i] = CosineToL2(sim)
+		}
+	}
+	return distances, nil
+}
+
+// SetBaseline measures a new baseline on vectors representative of the
+// training data and clears the samples, for example after the index was
+// retrained on them.
+func (m *DriftMonitor) SetBaseline(baseline []float32) error {
+	if len(baseline) == 0 {
+		return wrapError(ErrEmptyVectors, "drift baseline")
+	}
+
+	distances, err := m.distances(baseline)
+	if err != nil {
+		return wrapError(err, "drift baseline")
+	}
+
+	var sum float64
+	for _, dist := range distances {
+		sum += float64(dist)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.baseline = sum / float64(len(distances))
+	m.window = m.window[:0]
+	m.next = 0
+	m.sum = 0
+	m.fired = false
+	return nil
+}
+
+// Observe samples vectors added to the index by other means than Add.
+func (m *DriftMonitor) Observe(x []float32) error {
+	d := m.idx.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return wrapError(err, "drift observe vectors validation")
+	}
+
+	m.mu.Lock()
+	sample := make([]float32, 0, len(x))
+	for i := 0; i < len(x)/d; i++ {
+		if m.rng.Float64() < m.opts.SampleRate {
+			sample = append(sample, x[i*d:(i+1)*d]...)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(sample) == 0 {
+		return nil
+	}
+
+	distances, err := m.distances(sample)
+	if err != nil {
+		return wrapError(err, "drift observe")
+	}
+
+	m.mu.Lock()
+	for _, dist := range distances {
+		if len(m.window) < m.opts.WindowSize {
+			m.window = append(m.window, dist)
+		} else {
+			m.sum -= float64(m.window[m.next])
+			m.window[m.next] = dist
+		}
+		m.next = (m.next + 1) % m.opts.WindowSize
+		m.sum += float64(dist)
+	}
+	score := m.score()
+	fire := m.opts.OnDrift != nil && m.opts.Threshold > 0 && score >= m.opts.Threshold && !m.fired
+	if fire {
+		m.fired = true
+	}
+	m.mu.Unlock()
+
+	// Called without the lock, so the callback can use the monitor.
+	if fire {
+		m.opts.OnDrift(score)
+	}
+	return nil
+}
+
+// Add adds x to the index and observes it.
+func (m *DriftMonitor) Add(x []float32) error {
+	if err := m.idx.Add(x); err != nil {
+		return err
+	}
+	return m.Observe(x)
+}
+
+// DriftScore returns the mean distance of the recent samples to their
+// nearest centroid, divided by that of the baseline: about 1 while the data
+// matches the training distribution, growing as it drifts away. It is 0
+// before any vector was sampled.
+func (m *DriftMonitor) DriftScore() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.score()
+}
+
+// score computes DriftScore. m.mu must be held.
+func (m *DriftMonitor) score() float64 {
+	if len(m.window) == 0 {
+		return 0
+	}
+	mean := m.sum / float64(len(m.window))
+	if m.baseline == 0 {
+		// Baseline vectors sit on the centroids: any distance is drift.
+		if mean == 0 {
+			return 1
+		}
+		return math.Inf(1)
+	}
+	return mean / m.baseline
+}
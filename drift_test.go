@@ -0,0 +1,68 @@
+package faiss
+
+import "testing"
+
+func TestDriftMonitorAndRetrain(t *testing.T) {
+	const d, nlist, n, k = 16, 16, 4000, 10
+	// Day-one data and shifted data around different cluster centers
+	before := clusteredVectors(n, d, nlist, 1)
+	after := clusteredVectors(n, d, nlist, 2)
+
+	idx := newIVFFlatL2(t, d, nlist, before)
+	fired := 0
+	monitor, err := NewDriftMonitor(idx, before, DriftOptions{
+		SampleRate: 1,
+		WindowSize: 1000,
+		Threshold:  3,
+		OnDrift:    func(float64) { fired++ },
+	})
+	if err != nil {
+		t.Fatalf("NewDriftMonitor: %v", err)
+	}
+
+	if err := monitor.Observe(before[:1000*d]); err != nil {
+		t.Fatalf("Observe: %v", err)
+	}
+	if score := monitor.DriftScore(); score < 0.5 || score > 2 {
+		t.Errorf("DriftScore on training-like data = %v, want about 1", score)
+	}
+
+	if err := monitor.Add(after); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if score := monitor.DriftScore(); score < 3 {
+		t.Errorf("DriftScore after the shift = %v, want at least 3", score)
+	}
+	if fired != 1 {
+		t.Errorf("OnDrift called %d times, want once", fired)
+	}
+
+	all := append(append([]float32(nil), before...), after...)
+	if err := idx.Retrain(all); err != nil {
+		t.Fatalf("Retrain: %v", err)
+	}
+	if got := idx.Ntotal(); got != 2*n {
+		t.Fatalf("Ntotal after Retrain = %d, want %d", got, 2*n)
+	}
+
+	// The shifted data fits the new clustering
+	if err := monitor.SetBaseline(all); err != nil {
+		t.Fatalf("SetBaseline: %v", err)
+	}
+	if err := monitor.Observe(after[:1000*d]); err != nil {
+		t.Fatalf("Observe: %v", err)
+	}
+	if score := monitor.DriftScore(); score < 0.5 || score > 2 {
+		t.Errorf("DriftScore after Retrain = %v, want about 1", score)
+	}
+
+	// With one probe, queries from the shifted data find their neighbors
+	exact := newFlatL2(t, d, all)
+	recall, err := RecallAtK(idx, exact, after[:100*d], k)
+	if err != nil {
+		t.Fatalf("RecallAtK: %v", err)
+	}
+	if recall < 0.9 {
+		t.Errorf("recall@%d after Retrain = %v, want at least 0.9", k, recall)
+	}
+}
@@ -6,29 +6,182 @@ package faiss
 #include <faiss/c_api/Index_c.h>
 #include <faiss/c_api/index_io_c.h>
 #include <faiss/c_api/error_c.h>
+#include "faiss_ext.h"
 */
 import "C"
 import (
 	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"sync"
 )
 
 // Error handling
 var (
-	ErrInvalidDimension = errors.New("invalid dimension")
-	ErrInvalidK         = errors.New("invalid k value")
-	ErrInvalidRadius    = errors.New("invalid radius")
-	ErrEmptyVectors     = errors.New("empty vectors")
-	ErrIndexNotTrained  = errors.New("index not trained")
-	ErrNullPointer      = errors.New("null pointer")
+	ErrInvalidDimension   = errors.New("invalid dimension")
+	ErrInvalidK           = errors.New("invalid k value")
+	ErrInvalidRadius      = errors.New("invalid radius")
+	ErrEmptyVectors       = errors.New("empty vectors")
+	ErrIndexNotTrained    = errors.New("index not trained")
+	ErrEmptyIndex         = errors.New("index is empty")
+	ErrNullPointer        = errors.New("null pointer")
+	ErrKeyNotFound        = errors.New("key not found")
+	ErrIndexClosed        = error(closedError{})
+	ErrInvalidMetric      = errors.New("invalid metric")
+	ErrIndexFrozen        = errors.New("index is frozen")
+	ErrReadOnly           = errors.New("index is read-only")
+	ErrInvalidBatchSize   = errors.New("invalid batch size")
+	ErrCorruptIndexHeader = errors.New("corrupt index header")
+	ErrDeadlineExceeded   = errors.New("search deadline exceeded")
+	ErrSelfTestFailed     = errors.New("self test failed")
 )
 
+// closedError is the type of ErrIndexClosed. Methods of a deleted index
+// used to fail with ErrNullPointer, so it also matches ErrNullPointer with
+// errors.Is.
+type closedError struct{}
+
+func (closedError) Error() string {
+	return "index is closed"
+}
+
+func (closedError) Is(target error) bool {
+	return target == ErrNullPointer
+}
+
+// DimensionMismatchError reports vectors whose size doesn't fit the index
+// dimension. For a single vector Got is its length; for a batch Got is the
+// total slice length, which is not a multiple of Want.
+// It matches ErrInvalidDimension with errors.Is.
+type DimensionMismatchError struct {
+	Got  int
+	Want int
+}
+
+func (e *DimensionMismatchError) Error() string {
+	return fmt.Sprintf("dimension mismatch: got %d values, want %d per vector", e.Got, e.Want)
+}
+
+func (e *DimensionMismatchError) Unwrap() error {
+	return ErrInvalidDimension
+}
+
+// ErrorCategory classifies errors raised by the FAISS library.
+type ErrorCategory int
+
+const (
+	CategoryUnknown         ErrorCategory = iota
+	CategoryNotTrained                    // Operation requires a trained index
+	CategoryOutOfMemory                   // Allocation failed
+	CategoryInvalidArgument               // A FAISS precondition check failed
+	CategoryIO                            // Reading or writing an index failed
+	CategoryNotSupported                  // Operation not implemented for this index type
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryNotTrained:
+		return "not trained"
+	case CategoryOutOfMemory:
+		return "out of memory"
+	case CategoryInvalidArgument:
+		return "invalid argument"
+	case CategoryIO:
+		return "I/O"
+	case CategoryNotSupported:
+		return "not supported"
+	default:
+		return "unknown"
+	}
+}
+
+// FaissError is an error raised by the FAISS library. Msg is the original
+// FAISS message and Category is derived from it.
+//
+// Use errors.Is with the ErrFaiss* values to test the category:
+//
+//	if errors.Is(err, faiss.ErrFaissOutOfMemory) { ... }
+//
+// Errors in CategoryNotTrained also match ErrIndexNotTrained.
+type FaissError struct {
+	Category ErrorCategory
+	Msg      string
+}
+
+// Category sentinels for errors.Is
+var (
+	ErrFaissNotTrained      = &FaissError{Category: CategoryNotTrained}
+	ErrFaissOutOfMemory     = &FaissError{Category: CategoryOutOfMemory}
+	ErrFaissInvalidArgument = &FaissError{Category: CategoryInvalidArgument}
+	ErrFaissIO              = &FaissError{Category: CategoryIO}
+	ErrFaissNotSupported    = &FaissError{Category: CategoryNotSupported}
+)
+
+func (e *FaissError) Error() string {
+	if e.Msg == "" {
+		return "FAISS error: " + e.Category.String()
+	}
+	return e.Msg
+}
+
+// Is reports whether target is a category sentinel matching e.
+func (e *FaissError) Is(target error) bool {
+	if target == ErrIndexNotTrained {
+		return e.Category == CategoryNotTrained
+	}
+	t, ok := target.(*FaissError)
+	return ok && t.Msg == "" && t.Category == e.Category
+}
+
+// errorPatterns maps substrings of FAISS messages to categories. They are
+// checked in order, so more specific patterns come first.
+var errorPatterns = []struct {
+	substr   string
+	category ErrorCategory
+}{
+	{"bad_alloc", CategoryOutOfMemory},
+	{"out of memory", CategoryOutOfMemory},
+	{"Cannot allocate", CategoryOutOfMemory},
+	{"is_trained", CategoryNotTrained},
+	{"not trained", CategoryNotTrained},
+	{"not implemented", CategoryNotSupported},
+	{"not supported", CategoryNotSupported},
+	{"could not open", CategoryIO},
+	{"read error", CategoryIO},
+	{"write error", CategoryIO},
+	{"fopen", CategoryIO},
+	{"fread", CategoryIO},
+	{"fwrite", CategoryIO},
+	{"Error: '", CategoryInvalidArgument}, // FAISS_THROW_IF_NOT assertion
+	{"invalid", CategoryInvalidArgument},
+}
+
+// newFaissError categorizes a FAISS error message.
+func newFaissError(msg string) *FaissError {
+	for _, p := range errorPatterns {
+		if strings.Contains(msg, p.substr) {
+			return &FaissError{Category: p.category, Msg: msg}
+		}
+	}
+	return &FaissError{Category: CategoryUnknown, Msg: msg}
+}
+
 func getLastError() error {
 	errMsg := C.faiss_get_last_error()
 	if errMsg == nil {
-		return errors.New("unknown FAISS error")
+		return newFaissError("unknown FAISS error")
+	}
+	return newFaissError(C.GoString(errMsg))
+}
+
+// getLastExtError returns the last error raised by the faiss_ext bindings
+func getLastExtError() error {
+	errMsg := C.goss_get_last_error()
+	if errMsg == nil {
+		return newFaissError("unknown FAISS error")
 	}
-	return errors.New(C.GoString(errMsg))
+	return newFaissError(C.GoString(errMsg))
 }
 
 func wrapError(err error, context string) error {
@@ -38,16 +191,20 @@ func wrapError(err error, context string) error {
 	return fmt.Errorf("%s: %w", context, err)
 }
 
+// Metric is a distance metric type. It is an alias of int so that existing
+// code passing plain ints keeps compiling.
+type Metric = int
+
 // Metric types for similarity computation
 const (
-	MetricInnerProduct  = C.METRIC_INNER_PRODUCT // Inner product (cosine for normalized vectors)
-	MetricL2            = C.METRIC_L2            // L2 (Euclidean) distance
-	MetricL1            = C.METRIC_L1            // L1 (Manhattan) distance
-	MetricLinf          = C.METRIC_Linf          // L-infinity distance
-	MetricLp            = C.METRIC_Lp            // Lp distance
-	MetricCanberra      = C.METRIC_Canberra      // Canberra distance
-	MetricBrayCurtis    = C.METRIC_BrayCurtis    // Bray-Curtis distance
-	MetricJensenShannon = C.METRIC_JensenShannon // Jensen-Shannon divergence
+	MetricInnerProduct  Metric = C.METRIC_INNER_PRODUCT // Inner product (cosine for normalized vectors)
+	MetricL2            Metric = C.METRIC_L2            // L2 (Euclidean) distance
+	MetricL1            Metric = C.METRIC_L1            // L1 (Manhattan) distance
+	MetricLinf          Metric = C.METRIC_Linf          // L-infinity distance
+	MetricLp            Metric = C.METRIC_Lp            // Lp distance, p is set with SetMetricArg
+	MetricCanberra      Metric = C.METRIC_Canberra      // Canberra distance
+	MetricBrayCurtis    Metric = C.METRIC_BrayCurtis    // Bray-Curtis distance
+	MetricJensenShannon Metric = C.METRIC_JensenShannon // Jensen-Shannon divergence
 )
 
 // Index types for factory creation
@@ -71,7 +228,12 @@ const (
 	DefaultHNSWEfSearch = 16  // Default search parameter for HNSW
 )
 
-// Batch operation configurations
+// Batch operation configurations. Add operations (AddBatch, AddWithIDsBatch,
+// LoadCSV, WriteCSV, MigrateIndex, ...) accept batch sizes up to
+// MaxAddBatchSize, and search operations (SearchBatch, SearchBatchFunc,
+// RangeSearchBatch, ComputeDistancesBatch) up to MaxSearchBatchSize; larger
+// values fail with a *LimitError. SetDefaultBatchSizes enforces the same
+// ranges for the defaults used when a batch size of 0 is passed.
 const (
 	DefaultAddBatchSize    = 1000  // Default batch size for adding vectors
 	DefaultSearchBatchSize = 100   // Default batch size for search queries
@@ -79,8 +241,125 @@ const (
 	MaxSearchBatchSize     = 1000  // Maximum allowed batch size for search
 	MinAddBatchSize        = 1     // Minimum allowed batch size for add
 	MinSearchBatchSize     = 1     // Minimum allowed batch size for search
+	DefaultRemoveBatchSize = 10000 // Default number of IDs removed per selector
 )
 
+// MaxK is the maximum k of a search, rejecting absurd values before FAISS
+// attempts multi-gigabyte allocations for them.
+const MaxK = 1 << 24
+
+// LimitError reports a value above MaxK, MaxAddBatchSize or
+// MaxSearchBatchSize. It matches ErrInvalidK or ErrInvalidBatchSize
+// respectively.
+type LimitError struct {
+	Limit string // "MaxK", "MaxAddBatchSize" or "MaxSearchBatchSize"
+	Got   int64
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%d exceeds %s (%d)", e.Got, e.Limit, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	if e.Limit == "MaxK" {
+		return ErrInvalidK
+	}
+	return ErrInvalidBatchSize
+}
+
+// batchSizes holds the defaults set by SetDefaultBatchSizes.
+var batchSizes = struct {
+	sync.Mutex
+	add    int
+	search int
+}{add: DefaultAddBatchSize, search: DefaultSearchBatchSize}
+
+// SetDefaultBatchSizes sets the batch sizes used when a batch operation,
+// such as AddBatch or SearchBatch, is passed a batch size of 0. add must be
+// in [MinAddBatchSize, MaxAddBatchSize] and search in [MinSearchBatchSize,
+// MaxSearchBatchSize]; 0 restores DefaultAddBatchSize or
+// DefaultSearchBatchSize.
+func SetDefaultBatchSizes(add, search int) error {
+	if add == 0 {
+		add = DefaultAddBatchSize
+	}
+	if search == 0 {
+		search = DefaultSearchBatchSize
+	}
+	if add < MinAddBatchSize || add > MaxAddBatchSize {
+		return fmt.Errorf("%w: add batch size %d is outside [%d, %d]", ErrInvalidBatchSize, add, MinAddBatchSize, MaxAddBatchSize)
+	}
+	if search < MinSearchBatchSize || search > MaxSearchBatchSize {
+		return fmt.Errorf("%w: search batch size %d is outside [%d, %d]", ErrInvalidBatchSize, search, MinSearchBatchSize, MaxSearchBatchSize)
+	}
+
+	batchSizes.Lock()
+	defer batchSizes.Unlock()
+
+	batchSizes.add = add
+	batchSizes.search = search
+	return nil
+}
+
+// DefaultBatchSizes returns the batch sizes set by SetDefaultBatchSizes.
+func DefaultBatchSizes() (add, search int) {
+	batchSizes.Lock()
+	defer batchSizes.Unlock()
+
+	return batchSizes.add, batchSizes.search
+}
+
+// addBatchSize resolves the batch size of an add operation: the configured
+// default if batchSize is not positive, and an error above MaxAddBatchSize.
+func addBatchSize(batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize, _ = DefaultBatchSizes()
+	}
+	if batchSize > MaxAddBatchSize {
+		return 0, &LimitError{Limit: "MaxAddBatchSize", Got: int64(batchSize), Max: MaxAddBatchSize}
+	}
+	return batchSize, nil
+}
+
+// searchBatchSize is addBatchSize for search operations, limited by
+// MaxSearchBatchSize.
+func searchBatchSize(batchSize int) (int, error) {
+	if batchSize <= 0 {
+		_, batchSize = DefaultBatchSizes()
+	}
+	if batchSize > MaxSearchBatchSize {
+		return 0, &LimitError{Limit: "MaxSearchBatchSize", Got: int64(batchSize), Max: MaxSearchBatchSize}
+	}
+	return batchSize, nil
+}
+
+// BatchOption configures optional behavior of AddBatch and SearchBatch.
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	onProgress func(done, total int)
+}
+
+// OnProgress registers a callback invoked after each batch is processed.
+// done is the cumulative number of vectors processed so far and total is the
+// number of vectors in the whole call.
+func OnProgress(fn func(done, total int)) BatchOption {
+	return func(o *batchOptions) {
+		o.onProgress = fn
+	}
+}
+
+func applyBatchOptions(opts []BatchOption) batchOptions {
+	var o batchOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
 // Utility functions
 
 // ValidateVectors validates that vectors have the correct dimensions
@@ -92,16 +371,49 @@ func ValidateVectors(vectors []float32, d int) error {
 		return ErrInvalidDimension
 	}
 	if len(vectors)%d != 0 {
-		return fmt.Errorf("vectors length %d is not divisible by dimension %d", len(vectors), d)
+		return &DimensionMismatchError{Got: len(vectors), Want: d}
 	}
 	return nil
 }
 
-// ValidateK validates the k parameter for search
-func ValidateK(k int64) error {
+// ValidateFloat16Vectors is ValidateVectors for half-precision vectors, with
+// sizes counted in float16 elements.
+func ValidateFloat16Vectors(vectors []uint16, d int) error {
+	if len(vectors) == 0 {
+		return ErrEmptyVectors
+	}
+	if d <= 0 {
+		return ErrInvalidDimension
+	}
+	if len(vectors)%d != 0 {
+		return &DimensionMismatchError{Got: len(vectors), Want: d}
+	}
+	return nil
+}
+
+// ValidateMetric validates that metric is one of the Metric constants
+func ValidateMetric(metric int) error {
+	switch metric {
+	case MetricInnerProduct, MetricL2, MetricL1, MetricLinf, MetricLp,
+		MetricCanberra, MetricBrayCurtis, MetricJensenShannon:
+		return nil
+	}
+	return fmt.Errorf("%w: %d", ErrInvalidMetric, metric)
+}
+
+// ValidateK validates the k parameter for search: it must be positive and at
+// most MaxK. The index's Ntotal can be passed to give more helpful messages.
+func ValidateK(k int64, ntotal ...int64) error {
 	if k <= 0 {
 		return ErrInvalidK
 	}
+	if k > MaxK {
+		err := &LimitError{Limit: "MaxK", Got: k, Max: MaxK}
+		if len(ntotal) > 0 {
+			return fmt.Errorf("%w; the index holds %d vectors", err, ntotal[0])
+		}
+		return err
+	}
 	return nil
 }
 
@@ -124,42 +436,31 @@ func NormalizeVectors(vectors []float32, d int) error {
 		start := i * d
 		end := start + d
 
-		// Calculate norm
-		norm := float32(0)
+		// Calculate norm, in float64 so that squares of large or tiny
+		// components neither overflow nor underflow
+		norm := float64(0)
 		for j := start; j < end; j++ {
-			norm += vectors[j] * vectors[j]
+			norm += float64(vectors[j]) * float64(vectors[j])
 		}
 
 		if norm == 0 {
 			continue // Skip zero vectors
 		}
 
-		norm = float32(1.0) / float32(sqrt(float64(norm)))
+		norm = math.Sqrt(norm)
 
 		// Normalize
 		for j := start; j < end; j++ {
-			vectors[j] *= norm
+			vectors[j] = float32(float64(vectors[j]) / norm)
 		}
 	}
 
 	return nil
 }
 
-// sqrt computes square root
-func sqrt(x float64) float64 {
-	if x == 0 {
-		return 0
-	}
-	z := x
-	for i := 0; i < 10; i++ {
-		z = (z + x/z) / 2
-	}
-	return z
-}
-
 // GetVectorBatch extracts a batch of vectors from a larger slice
 func GetVectorBatch(vectors []float32, d int, start, count int) []float32 {
-	if start < 0 || count <= 0 {
+	if d <= 0 || start < 0 || count <= 0 {
 		return nil
 	}
 
@@ -168,7 +469,7 @@ func GetVectorBatch(vectors []float32, d int, start, count int) []float32 {
 		return nil
 	}
 
-	if start+count > n {
+	if count > n-start {
 		count = n - start
 	}
 
@@ -0,0 +1,798 @@
+// faiss_ext.cpp - implementation of faiss_ext.h on top of the FAISS C++ API.
+
+#include "faiss_ext.h"
+
+#include <faiss/IndexFlatCodes.h>
+#include <faiss/IndexHNSW.h>
+#include <faiss/IndexIDMap.h>
+#include <faiss/IndexIVF.h>
+#include <faiss/IndexIVFPQ.h>
+#include <faiss/IndexPreTransform.h>
+#include <faiss/VectorTransform.h>
+#include <faiss/clone_index.h>
+#include <faiss/impl/IDSelector.h>
+#include <faiss/impl/io.h>
+#include <faiss/index_io.h>
+#include <faiss/invlists/InvertedLists.h>
+#include <faiss/utils/utils.h>
+
+#include <atomic>
+#include <cstdlib>
+#include <algorithm>
+#include <cstring>
+#include <exception>
+#include <memory>
+#include <string>
+#include <unordered_map>
+#include <vector>
+
+// Declared here rather than through <omp.h>, whose location depends on the
+// toolchain; the symbol comes from the OpenMP runtime FAISS is linked with.
+extern "C" int omp_get_max_threads();
+extern "C" void omp_set_num_threads(int n);
+
+#define GOSS_STR_(x) #x
+#define GOSS_STR(x) GOSS_STR_(x)
+
+namespace {
+
+thread_local std::string last_error;
+
+// Thread count set by goss_omp_set_num_threads, 0 for the OpenMP default.
+std::atomic<int> omp_threads{0};
+// Count last applied on this thread, and the thread's default before that.
+thread_local int omp_threads_applied = 0;
+thread_local int omp_threads_default = 0;
+
+// Applies omp_threads to the calling thread, whose OpenMP setting is
+// independent of the threads goss_omp_set_num_threads ran on.
+void sync_omp_threads() {
+    int n = omp_threads.load(std::memory_order_relaxed);
+    if (n == omp_threads_applied) {
+        return;
+    }
+    if (omp_threads_default == 0) {
+        omp_threads_default = omp_get_max_threads();
+    }
+    omp_set_num_threads(n > 0 ? n : omp_threads_default);
+    omp_threads_applied = n;
+}
+
+const faiss::IndexHNSW* as_hnsw(const FaissIndex* index) {
+    return dynamic_cast<const faiss::IndexHNSW*>(
+            reinterpret_cast<const faiss::Index*>(index));
+}
+
+faiss::IndexHNSW* as_hnsw(FaissIndex* index) {
+    return dynamic_cast<faiss::IndexHNSW*>(
+            reinterpret_cast<faiss::Index*>(index));
+}
+
+const faiss::IndexIVFPQ* as_ivfpq(const FaissIndex* index) {
+    return dynamic_cast<const faiss::IndexIVFPQ*>(
+            reinterpret_cast<const faiss::Index*>(index));
+}
+
+} // namespace
+
+const char* goss_get_last_error() {
+    return last_error.empty() ? nullptr : last_error.c_str();
+}
+
+const char* goss_version() {
+    return GOSS_STR(FAISS_VERSION_MAJOR) "." GOSS_STR(
+            FAISS_VERSION_MINOR) "." GOSS_STR(FAISS_VERSION_PATCH);
+}
+
+const char* goss_compile_options() {
+    static const std::string options = faiss::get_compile_options();
+    return options.c_str();
+}
+
+int goss_omp_max_threads() {
+    sync_omp_threads();
+    return omp_get_max_threads();
+}
+
+void goss_omp_set_num_threads(int n) {
+    omp_threads.store(n > 0 ? n : 0, std::memory_order_relaxed);
+    sync_omp_threads();
+}
+
+int goss_Index_train(FaissIndex* index, idx_t n, const float* x) {
+    sync_omp_threads();
+    return faiss_Index_train(index, n, x);
+}
+
+int goss_Index_add(FaissIndex* index, idx_t n, const float* x) {
+    sync_omp_threads();
+    return faiss_Index_add(index, n, x);
+}
+
+int goss_Index_add_with_ids(
+        FaissIndex* index,
+        idx_t n,
+        const float* x,
+        const idx_t* xids) {
+    sync_omp_threads();
+    return faiss_Index_add_with_ids(index, n, x, xids);
+}
+
+int goss_Index_add_strided(
+        FaissIndex* index,
+        idx_t n,
+        const float* x,
+        size_t stride) {
+    sync_omp_threads();
+    try {
+        auto idx = reinterpret_cast<faiss::Index*>(index);
+        size_t d = idx->d;
+        if (stride == d) {
+            idx->add(n, x);
+            return 0;
+        }
+        std::vector<float> packed(n * d);
+        for (idx_t i = 0; i < n; i++) {
+            memcpy(packed.data() + i * d, x + i * stride, d * sizeof(float));
+        }
+        idx->add(n, packed.data());
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_Index_search(
+        const FaissIndex* index,
+        idx_t n,
+        const float* x,
+        idx_t k,
+        float* distances,
+        idx_t* labels) {
+    sync_omp_threads();
+    return faiss_Index_search(index, n, x, k, distances, labels);
+}
+
+int goss_Index_search_with_params(
+        const FaissIndex* index,
+        idx_t n,
+        const float* x,
+        idx_t k,
+        const FaissSearchParameters* params,
+        float* distances,
+        idx_t* labels) {
+    sync_omp_threads();
+    return faiss_Index_search_with_params(
+            index, n, x, k, params, distances, labels);
+}
+
+int goss_Index_range_search(
+        const FaissIndex* index,
+        idx_t n,
+        const float* x,
+        float radius,
+        FaissRangeSearchResult* result) {
+    sync_omp_threads();
+    return faiss_Index_range_search(index, n, x, radius, result);
+}
+
+int goss_Index_assign(
+        FaissIndex* index,
+        idx_t n,
+        const float* x,
+        idx_t* labels,
+        idx_t k) {
+    sync_omp_threads();
+    return faiss_Index_assign(index, n, x, labels, k);
+}
+
+float goss_Index_metric_arg(const FaissIndex* index) {
+    return reinterpret_cast<const faiss::Index*>(index)->metric_arg;
+}
+
+void goss_Index_set_metric_arg(FaissIndex* index, float metric_arg) {
+    auto idx = reinterpret_cast<faiss::Index*>(index);
+    idx->metric_arg = metric_arg;
+    if (auto ivf = dynamic_cast<faiss::IndexIVF*>(idx)) {
+        ivf->quantizer->metric_arg = metric_arg;
+    }
+}
+
+int64_t goss_Index_storage_capacity(const FaissIndex* index) {
+    auto idx = reinterpret_cast<const faiss::Index*>(index);
+    if (auto flat = dynamic_cast<const faiss::IndexFlatCodes*>(idx)) {
+        return flat->code_size == 0 ? -1 : flat->codes.capacity() / flat->code_size;
+    }
+    if (auto ivf = dynamic_cast<const faiss::IndexIVF*>(idx)) {
+        auto lists = dynamic_cast<const faiss::ArrayInvertedLists*>(ivf->invlists);
+        if (!lists) {
+            return -1;
+        }
+        int64_t capacity = 0;
+        for (const auto& ids : lists->ids) {
+            capacity += ids.capacity();
+        }
+        return capacity;
+    }
+    return -1;
+}
+
+int goss_IndexFlatCodes_reserve(FaissIndex* index, idx_t n) {
+    auto flat = dynamic_cast<faiss::IndexFlatCodes*>(
+            reinterpret_cast<faiss::Index*>(index));
+    if (!flat) {
+        last_error = "index has no flat code storage";
+        return -1;
+    }
+    try {
+        flat->codes.reserve(n * flat->code_size);
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_Index_stable_ids(const FaissIndex* index) {
+    auto idx = reinterpret_cast<const faiss::Index*>(index);
+    while (auto pt = dynamic_cast<const faiss::IndexPreTransform*>(idx)) {
+        idx = pt->index;
+    }
+    return dynamic_cast<const faiss::IndexIVF*>(idx) ||
+                    dynamic_cast<const faiss::IndexIDMap*>(idx)
+            ? 1
+            : 0;
+}
+
+int goss_Index_is_idmap(const FaissIndex* index) {
+    auto idx = reinterpret_cast<const faiss::Index*>(index);
+    while (auto pt = dynamic_cast<const faiss::IndexPreTransform*>(idx)) {
+        idx = pt->index;
+    }
+    return dynamic_cast<const faiss::IndexIDMap*>(idx) ? 1 : 0;
+}
+
+int goss_Index_contains(
+        const FaissIndex* index,
+        idx_t n,
+        const idx_t* ids,
+        uint8_t* found) {
+    try {
+        auto idx = reinterpret_cast<const faiss::Index*>(index);
+        while (auto pt = dynamic_cast<const faiss::IndexPreTransform*>(idx)) {
+            idx = pt->index;
+        }
+        memset(found, 0, n);
+
+        if (dynamic_cast<const faiss::IndexFlatCodes*>(idx)) {
+            for (idx_t i = 0; i < n; i++) {
+                found[i] = ids[i] >= 0 && ids[i] < idx->ntotal;
+            }
+            return 0;
+        }
+
+        // Scan the stored IDs once against the requested ones.
+        std::unordered_map<idx_t, idx_t> positions;
+        for (idx_t i = 0; i < n; i++) {
+            positions[ids[i]] = i;
+        }
+        auto mark = [&](const faiss::idx_t* stored, size_t size) {
+            for (size_t j = 0; j < size; j++) {
+                auto it = positions.find(stored[j]);
+                if (it != positions.end()) {
+                    found[it->second] = 1;
+                }
+            }
+        };
+
+        if (auto idmap = dynamic_cast<const faiss::IndexIDMap*>(idx)) {
+            mark(idmap->id_map.data(), idmap->id_map.size());
+            return 0;
+        }
+        if (auto ivf = dynamic_cast<const faiss::IndexIVF*>(idx)) {
+            for (size_t list_no = 0; list_no < ivf->nlist; list_no++) {
+                size_t size = ivf->invlists->list_size(list_no);
+                if (size == 0) {
+                    continue;
+                }
+                const faiss::idx_t* stored = ivf->invlists->get_ids(list_no);
+                mark(stored, size);
+                ivf->invlists->release_ids(list_no, stored);
+            }
+            return 0;
+        }
+        last_error = "index type doesn't support ID membership tests";
+    } catch (const std::exception& e) {
+        last_error = e.what();
+    }
+    return -1;
+}
+
+int goss_Index_reconstruct_batch(
+        const FaissIndex* index,
+        idx_t n,
+        const idx_t* keys,
+        float* recons) {
+    try {
+        reinterpret_cast<const faiss::Index*>(index)->reconstruct_batch(
+                n, keys, recons);
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int64_t goss_Index_memory_usage(const FaissIndex* index) {
+    auto idx = reinterpret_cast<const faiss::Index*>(index);
+    if (auto flat = dynamic_cast<const faiss::IndexFlatCodes*>(idx)) {
+        return flat->codes.size();
+    }
+    if (auto ivf = dynamic_cast<const faiss::IndexIVF*>(idx)) {
+        auto lists = dynamic_cast<const faiss::ArrayInvertedLists*>(ivf->invlists);
+        int64_t quantizer = goss_Index_memory_usage(
+                reinterpret_cast<const FaissIndex*>(ivf->quantizer));
+        if (!lists || quantizer < 0) {
+            return -1;
+        }
+        int64_t bytes = quantizer;
+        for (size_t i = 0; i < lists->codes.size(); i++) {
+            bytes += lists->codes[i].size() +
+                    lists->ids[i].size() * sizeof(faiss::idx_t);
+        }
+        // Per-list vector headers
+        bytes += lists->codes.size() * 2 * sizeof(std::vector<uint8_t>);
+        if (auto ivfpq = dynamic_cast<const faiss::IndexIVFPQ*>(idx)) {
+            bytes += ivfpq->pq.centroids.size() * sizeof(float);
+        }
+        return bytes;
+    }
+    if (auto hnsw = dynamic_cast<const faiss::IndexHNSW*>(idx)) {
+        int64_t storage = hnsw->storage
+                ? goss_Index_memory_usage(
+                          reinterpret_cast<const FaissIndex*>(hnsw->storage))
+                : 0;
+        if (storage < 0) {
+            return -1;
+        }
+        const auto& graph = hnsw->hnsw;
+        return storage + graph.neighbors.size() * sizeof(graph.neighbors[0]) +
+                graph.levels.size() * sizeof(graph.levels[0]) +
+                graph.offsets.size() * sizeof(graph.offsets[0]);
+    }
+    if (auto idmap = dynamic_cast<const faiss::IndexIDMap*>(idx)) {
+        int64_t inner = goss_Index_memory_usage(
+                reinterpret_cast<const FaissIndex*>(idmap->index));
+        if (inner < 0) {
+            return -1;
+        }
+        return inner + idmap->id_map.size() * sizeof(faiss::idx_t);
+    }
+    return -1;
+}
+
+namespace {
+
+// Discards the data written to it, keeping only its size
+struct CountingIOWriter : faiss::IOWriter {
+    size_t size = 0;
+
+    size_t operator()(const void*, size_t size, size_t nitems) override {
+        this->size += size * nitems;
+        return nitems;
+    }
+};
+
+} // namespace
+
+int64_t goss_Index_serialized_size(const FaissIndex* index) {
+    try {
+        CountingIOWriter writer;
+        faiss::write_index(reinterpret_cast<const faiss::Index*>(index), &writer);
+        return writer.size;
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+}
+
+int goss_write_index_buf(const FaissIndex* index, uint8_t** buf, size_t* size) {
+    try {
+        faiss::VectorIOWriter writer;
+        faiss::write_index(reinterpret_cast<const faiss::Index*>(index), &writer);
+        *buf = static_cast<uint8_t*>(malloc(writer.data.size()));
+        if (!*buf) {
+            last_error = "std::bad_alloc";
+            return -1;
+        }
+        memcpy(*buf, writer.data.data(), writer.data.size());
+        *size = writer.data.size();
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_read_index_buf(
+        const uint8_t* buf,
+        size_t size,
+        int io_flags,
+        FaissIndex** p_out) {
+    try {
+        faiss::VectorIOReader reader;
+        reader.data.assign(buf, buf + size);
+        *p_out = reinterpret_cast<FaissIndex*>(
+                faiss::read_index(&reader, io_flags));
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_IndexIVF_add_core(
+        FaissIndex* index,
+        idx_t n,
+        const float* x,
+        const idx_t* xids,
+        const idx_t* list_nos) {
+    auto ivf = dynamic_cast<faiss::IndexIVF*>(
+            reinterpret_cast<faiss::Index*>(index));
+    if (!ivf) {
+        last_error = "index is not an IndexIVF";
+        return -1;
+    }
+    sync_omp_threads();
+    try {
+        ivf->add_core(n, x, xids, list_nos);
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+namespace {
+
+// Clones index with its storage swapped out by detach, which is called
+// again to put it back even if the clone fails.
+template <typename Detach>
+faiss::Index* clone_detached(faiss::Index* index, Detach detach) {
+    detach();
+    faiss::Index* out;
+    try {
+        out = faiss::clone_index(index);
+    } catch (...) {
+        detach();
+        throw;
+    }
+    detach();
+    out->ntotal = 0;
+    return out;
+}
+
+// Clones index without its stored vectors, so that nothing proportional to
+// ntotal is copied; other index types are cloned whole and reset.
+faiss::Index* clone_empty(faiss::Index* index) {
+    if (auto pt = dynamic_cast<faiss::IndexPreTransform*>(index)) {
+        std::unique_ptr<faiss::Index> inner(clone_empty(pt->index));
+        faiss::Index* swapped = inner.get();
+        return clone_detached(pt, [&]() { std::swap(pt->index, swapped); });
+    }
+    if (auto idmap = dynamic_cast<faiss::IndexIDMap*>(index)) {
+        std::unique_ptr<faiss::Index> inner(clone_empty(idmap->index));
+        faiss::Index* swapped = inner.get();
+        std::vector<faiss::idx_t> id_map;
+        std::unordered_map<faiss::idx_t, faiss::idx_t> rev_map;
+        auto idmap2 = dynamic_cast<faiss::IndexIDMap2*>(index);
+        return clone_detached(idmap, [&]() {
+            std::swap(idmap->index, swapped);
+            std::swap(idmap->id_map, id_map);
+            if (idmap2) {
+                std::swap(idmap2->rev_map, rev_map);
+            }
+        });
+    }
+    if (auto ivf = dynamic_cast<faiss::IndexIVF*>(index)) {
+        std::unique_ptr<faiss::InvertedLists> empty(
+                new faiss::ArrayInvertedLists(ivf->nlist, ivf->code_size));
+        faiss::InvertedLists* swapped = empty.get();
+        faiss::DirectMap direct_map;
+        direct_map.type = ivf->direct_map.type;
+        return clone_detached(ivf, [&]() {
+            std::swap(ivf->invlists, swapped);
+            std::swap(ivf->direct_map, direct_map);
+        });
+    }
+    if (auto flat = dynamic_cast<faiss::IndexFlatCodes*>(index)) {
+        std::vector<uint8_t> codes;
+        return clone_detached(
+                flat, [&]() { std::swap(flat->codes, codes); });
+    }
+    std::unique_ptr<faiss::Index> out(faiss::clone_index(index));
+    out->reset();
+    return out.release();
+}
+
+// Re-adds the vectors of src to dst, an empty clone of it, batch_size at a
+// time. Wrappers are copied through to their inner index.
+void copy_vectors(
+        const faiss::Index* src,
+        faiss::Index* dst,
+        faiss::idx_t batch_size) {
+    std::vector<float> x;
+    if (auto pt = dynamic_cast<const faiss::IndexPreTransform*>(src)) {
+        auto out = dynamic_cast<faiss::IndexPreTransform*>(dst);
+        copy_vectors(pt->index, out->index, batch_size);
+        out->ntotal = out->index->ntotal;
+        return;
+    }
+    if (auto idmap = dynamic_cast<const faiss::IndexIDMap*>(src)) {
+        auto out = dynamic_cast<faiss::IndexIDMap*>(dst);
+        copy_vectors(idmap->index, out->index, batch_size);
+        out->id_map = idmap->id_map;
+        if (auto out2 = dynamic_cast<faiss::IndexIDMap2*>(out)) {
+            out2->construct_rev_map();
+        }
+        out->ntotal = out->index->ntotal;
+        return;
+    }
+    if (auto ivf = dynamic_cast<const faiss::IndexIVF*>(src)) {
+        auto out = dynamic_cast<faiss::IndexIVF*>(dst);
+        std::vector<faiss::idx_t> ids, list_nos;
+        for (size_t list_no = 0; list_no < ivf->nlist; list_no++) {
+            size_t size = ivf->invlists->list_size(list_no);
+            faiss::InvertedLists::ScopedIds list_ids(ivf->invlists, list_no);
+            for (size_t i0 = 0; i0 < size; i0 += batch_size) {
+                size_t n = std::min(size - i0, size_t(batch_size));
+                x.resize(n * ivf->d);
+                ids.assign(list_ids.get() + i0, list_ids.get() + i0 + n);
+                list_nos.assign(n, list_no);
+                for (size_t i = 0; i < n; i++) {
+                    ivf->reconstruct_from_offset(
+                            list_no, i0 + i, x.data() + i * ivf->d);
+                }
+                out->add_core(n, x.data(), ids.data(), list_nos.data());
+            }
+        }
+        return;
+    }
+    for (faiss::idx_t i0 = 0; i0 < src->ntotal; i0 += batch_size) {
+        faiss::idx_t n = std::min(src->ntotal - i0, batch_size);
+        x.resize(n * src->d);
+        src->reconstruct_n(i0, n, x.data());
+        dst->add(n, x.data());
+    }
+}
+
+} // namespace
+
+int goss_Index_compact(
+        FaissIndex* index,
+        idx_t batch_size,
+        FaissIndex** p_out) {
+    if (batch_size <= 0) {
+        last_error = "compact batch size must be positive";
+        return -1;
+    }
+    sync_omp_threads();
+    try {
+        auto src = reinterpret_cast<faiss::Index*>(index);
+        std::unique_ptr<faiss::Index> out(clone_empty(src));
+        copy_vectors(src, out.get(), batch_size);
+        if (out->ntotal != src->ntotal) {
+            last_error = "compact re-added " + std::to_string(out->ntotal) +
+                    " of " + std::to_string(src->ntotal) + " vectors";
+            return -1;
+        }
+        *p_out = reinterpret_cast<FaissIndex*>(out.release());
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_IndexIVF_clustering_params(
+        const FaissIndex* index,
+        FaissClusteringParameters* cp) {
+    auto ivf = dynamic_cast<const faiss::IndexIVF*>(
+            reinterpret_cast<const faiss::Index*>(index));
+    if (!ivf) {
+        last_error = "index is not an IVF index";
+        return -1;
+    }
+    const faiss::ClusteringParameters& src = ivf->cp;
+    cp->niter = src.niter;
+    cp->nredo = src.nredo;
+    cp->verbose = src.verbose;
+    cp->spherical = src.spherical;
+    cp->int_centroids = src.int_centroids;
+    cp->update_index = src.update_index;
+    cp->frozen_centroids = src.frozen_centroids;
+    cp->min_points_per_centroid = src.min_points_per_centroid;
+    cp->max_points_per_centroid = src.max_points_per_centroid;
+    cp->seed = src.seed;
+    cp->decode_block_size = src.decode_block_size;
+    return 0;
+}
+
+int goss_IndexIVF_reconstruct_list(
+        const FaissIndex* index,
+        size_t list_no,
+        float* x) {
+    auto ivf = dynamic_cast<const faiss::IndexIVF*>(
+            reinterpret_cast<const faiss::Index*>(index));
+    if (!ivf) {
+        last_error = "index is not an IVF index";
+        return -1;
+    }
+    try {
+        size_t size = ivf->invlists->list_size(list_no);
+        for (size_t i = 0; i < size; i++) {
+            ivf->reconstruct_from_offset(list_no, i, x + i * ivf->d);
+        }
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_IndexIVF_enable_direct_map(FaissIndex* index) {
+    auto ivf = dynamic_cast<faiss::IndexIVF*>(
+            reinterpret_cast<faiss::Index*>(index));
+    if (!ivf) {
+        last_error = "index is not an IVF index";
+        return -1;
+    }
+    try {
+        if (ivf->direct_map.type == faiss::DirectMap::NoMap) {
+            ivf->set_direct_map_type(faiss::DirectMap::Hashtable);
+        }
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_Index_remove_ids(
+        FaissIndex* index,
+        const FaissIDSelector* sel,
+        size_t* n_removed) {
+    auto idx = reinterpret_cast<faiss::Index*>(index);
+    auto selector = reinterpret_cast<const faiss::IDSelector*>(sel);
+    try {
+        auto ivf = dynamic_cast<faiss::IndexIVF*>(idx);
+        if (!ivf || ivf->direct_map.type != faiss::DirectMap::Hashtable) {
+            *n_removed = idx->remove_ids(*selector);
+            return 0;
+        }
+        // Without a map, the removal scans the inverted lists.
+        ivf->set_direct_map_type(faiss::DirectMap::NoMap);
+        size_t removed;
+        try {
+            removed = ivf->remove_ids(*selector);
+        } catch (...) {
+            ivf->set_direct_map_type(faiss::DirectMap::Hashtable);
+            throw;
+        }
+        ivf->set_direct_map_type(faiss::DirectMap::Hashtable);
+        *n_removed = removed;
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+void goss_Index_set_verbose_all(FaissIndex* index, int verbose) {
+    auto idx = reinterpret_cast<faiss::Index*>(index);
+    idx->verbose = verbose != 0;
+    if (auto ivf = dynamic_cast<faiss::IndexIVF*>(idx)) {
+        ivf->quantizer->verbose = verbose != 0;
+        ivf->cp.verbose = verbose != 0;
+    }
+}
+
+int goss_IndexHNSW_check(const FaissIndex* index) {
+    return as_hnsw(index) ? 0 : -1;
+}
+
+int goss_IndexHNSW_M(const FaissIndex* index) {
+    auto hnsw = as_hnsw(index);
+    // Level 0 has 2*M neighbors, upper levels have M.
+    return hnsw ? hnsw->hnsw.nb_neighbors(1) : -1;
+}
+
+int goss_IndexHNSW_efSearch(const FaissIndex* index) {
+    auto hnsw = as_hnsw(index);
+    return hnsw ? hnsw->hnsw.efSearch : -1;
+}
+
+int goss_IndexHNSW_set_efSearch(FaissIndex* index, int efSearch) {
+    auto hnsw = as_hnsw(index);
+    if (!hnsw) {
+        return -1;
+    }
+    hnsw->hnsw.efSearch = efSearch;
+    return 0;
+}
+
+int goss_IndexHNSW_efConstruction(const FaissIndex* index) {
+    auto hnsw = as_hnsw(index);
+    return hnsw ? hnsw->hnsw.efConstruction : -1;
+}
+
+int goss_IndexHNSW_set_efConstruction(FaissIndex* index, int efConstruction) {
+    auto hnsw = as_hnsw(index);
+    if (!hnsw) {
+        return -1;
+    }
+    hnsw->hnsw.efConstruction = efConstruction;
+    return 0;
+}
+
+int goss_SearchParametersHNSW_new(
+        FaissSearchParameters** p_sp,
+        FaissIDSelector* sel,
+        int efSearch) {
+    try {
+        auto params = new faiss::SearchParametersHNSW();
+        params->sel = reinterpret_cast<faiss::IDSelector*>(sel);
+        params->efSearch = efSearch;
+        *p_sp = reinterpret_cast<FaissSearchParameters*>(params);
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_IndexIVFPQ_check(const FaissIndex* index) {
+    return as_ivfpq(index) ? 0 : -1;
+}
+
+int goss_IndexIVFPQ_M(const FaissIndex* index) {
+    auto ivfpq = as_ivfpq(index);
+    return ivfpq ? static_cast<int>(ivfpq->pq.M) : -1;
+}
+
+int goss_IndexIVFPQ_nbits(const FaissIndex* index) {
+    auto ivfpq = as_ivfpq(index);
+    return ivfpq ? static_cast<int>(ivfpq->pq.nbits) : -1;
+}
+
+int goss_VectorTransform_apply_noalloc(
+        const FaissVectorTransform* vt,
+        idx_t n,
+        const float* x,
+        float* xt) {
+    sync_omp_threads();
+    try {
+        reinterpret_cast<const faiss::VectorTransform*>(vt)->apply_noalloc(
+                n, x, xt);
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
+
+int goss_VectorTransform_reverse_transform(
+        const FaissVectorTransform* vt,
+        idx_t n,
+        const float* xt,
+        float* x) {
+    try {
+        reinterpret_cast<const faiss::VectorTransform*>(vt)->reverse_transform(
+                n, xt, x);
+    } catch (const std::exception& e) {
+        last_error = e.what();
+        return -1;
+    }
+    return 0;
+}
@@ -0,0 +1,226 @@
+/*
+ * faiss_ext.h - C bindings for FAISS features missing from the official C API.
+ * Functions follow the C API conventions: indexes are passed as FaissIndex*,
+ * and a query on an index of the wrong type returns -1.
+ */
+#ifndef GOSS_FAISS_EXT_H
+#define GOSS_FAISS_EXT_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#include <faiss/c_api/Clustering_c.h>
+#include <faiss/c_api/Index_c.h>
+#include <faiss/c_api/VectorTransform_c.h>
+#include <faiss/c_api/impl/AuxIndexStructures_c.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* Message of the last exception caught by a goss_ function on this thread */
+const char* goss_get_last_error();
+
+/* Build information of the linked library */
+const char* goss_version();
+const char* goss_compile_options();
+int goss_omp_max_threads();
+
+/* Process-wide OpenMP thread count, 0 for the OpenMP default. OpenMP keeps
+ * the count per OS thread, so it is applied by the goss_Index_ wrappers
+ * below on whichever thread they run. */
+void goss_omp_set_num_threads(int n);
+
+/* Index operations of the C API, run with the goss_omp_set_num_threads
+ * thread count */
+int goss_Index_train(FaissIndex* index, idx_t n, const float* x);
+int goss_Index_add(FaissIndex* index, idx_t n, const float* x);
+int goss_Index_add_with_ids(
+        FaissIndex* index,
+        idx_t n,
+        const float* x,
+        const idx_t* xids);
+
+/* Adds n vectors of dimension d placed stride floats apart in x, as in the
+ * records of an .fvecs file (stride d + 1). Vectors that are not contiguous
+ * are packed batch by batch into a buffer of the extension. Returns non-zero
+ * on error. */
+int goss_Index_add_strided(
+        FaissIndex* index,
+        idx_t n,
+        const float* x,
+        size_t stride);
+
+int goss_Index_search(
+        const FaissIndex* index,
+        idx_t n,
+        const float* x,
+        idx_t k,
+        float* distances,
+        idx_t* labels);
+int goss_Index_search_with_params(
+        const FaissIndex* index,
+        idx_t n,
+        const float* x,
+        idx_t k,
+        const FaissSearchParameters* params,
+        float* distances,
+        idx_t* labels);
+int goss_Index_range_search(
+        const FaissIndex* index,
+        idx_t n,
+        const float* x,
+        float radius,
+        FaissRangeSearchResult* result);
+int goss_Index_assign(
+        FaissIndex* index,
+        idx_t n,
+        const float* x,
+        idx_t* labels,
+        idx_t k);
+
+/* Index metric_arg; for IVF indexes the quantizer is updated too */
+float goss_Index_metric_arg(const FaissIndex* index);
+void goss_Index_set_metric_arg(FaissIndex* index, float metric_arg);
+
+/* Number of vectors the index storage can hold without reallocating, or -1
+ * if the index type doesn't expose its storage */
+int64_t goss_Index_storage_capacity(const FaissIndex* index);
+
+/* Reserves flat code storage for n vectors in total; returns non-zero on
+ * error, including for indexes without flat code storage */
+int goss_IndexFlatCodes_reserve(FaissIndex* index, idx_t n);
+
+/* 1 if the IDs of the vectors survive removals, as in IVF and IDMap indexes
+ * (possibly behind an IndexPreTransform), 0 if remove_ids renumbers the
+ * vectors stored after a removed one */
+int goss_Index_stable_ids(const FaissIndex* index);
+
+/* 1 if the index is an IndexIDMap or IndexIDMap2, possibly behind an
+ * IndexPreTransform, 0 otherwise */
+int goss_Index_is_idmap(const FaissIndex* index);
+
+/* Sets found[i] to 1 if a vector with ID ids[i] is stored in the index, 0
+ * otherwise. Supported for flat, IVF and IDMap indexes, possibly behind an
+ * IndexPreTransform; returns non-zero for other index types. */
+int goss_Index_contains(
+        const FaissIndex* index,
+        idx_t n,
+        const idx_t* ids,
+        uint8_t* found);
+
+/* Reconstructs the n vectors with IDs keys into recons, n * d floats, in a
+ * single call. Returns non-zero on error, such as an ID not stored. */
+int goss_Index_reconstruct_batch(
+        const FaissIndex* index,
+        idx_t n,
+        const idx_t* keys,
+        float* recons);
+
+/* Estimated memory used by the index data structures in bytes, or -1 if
+ * the index type is not known */
+int64_t goss_Index_memory_usage(const FaissIndex* index);
+
+/* Size of the serialized index in bytes, computed without buffering it, or
+ * -1 on error */
+int64_t goss_Index_serialized_size(const FaissIndex* index);
+
+/* In-memory serialization; returns non-zero on error. The buffer written by
+ * goss_write_index_buf is allocated with malloc and must be released with
+ * free. */
+int goss_write_index_buf(const FaissIndex* index, uint8_t** buf, size_t* size);
+int goss_read_index_buf(
+        const uint8_t* buf,
+        size_t size,
+        int io_flags,
+        FaissIndex** p_out);
+
+/* IndexIVF::add_core with precomputed list assignments; xids may be NULL
+ * for sequential IDs. Returns non-zero on error. */
+int goss_IndexIVF_add_core(
+        FaissIndex* index,
+        idx_t n,
+        const float* x,
+        const idx_t* xids,
+        const idx_t* list_nos);
+
+/* Gives an IVF index a Hashtable direct map, so that its vectors can be
+ * reconstructed by ID, unless it has a direct map already. Unlike the Array
+ * map of faiss_IndexIVF_make_direct_map, it allows adding with IDs, and
+ * goss_Index_remove_ids keeps it up to date. Returns non-zero on error,
+ * including for indexes that are not IVF. */
+int goss_IndexIVF_enable_direct_map(FaissIndex* index);
+
+/* faiss_Index_remove_ids, also for IVF indexes with a Hashtable direct map,
+ * which FAISS only removes from with an IDSelectorArray: the map is dropped
+ * for the removal and rebuilt afterwards. Returns non-zero on error. */
+int goss_Index_remove_ids(
+        FaissIndex* index,
+        const FaissIDSelector* sel,
+        size_t* n_removed);
+
+/* Decodes the vectors of inverted list list_no into x, in list order, which
+ * is the order of faiss_IndexIVF_invlists_get_ids. Returns non-zero on
+ * error. */
+int goss_IndexIVF_reconstruct_list(
+        const FaissIndex* index,
+        size_t list_no,
+        float* x);
+
+/* Rebuilds index into a new index of the same type with exactly sized
+ * storage, decoding and re-adding the stored vectors batch_size at a time.
+ * IDs and IVF list assignments are kept. The source storage is detached
+ * while its empty copy is made, so the index must not be used concurrently.
+ * Returns non-zero on error. */
+int goss_Index_compact(
+        FaissIndex* index,
+        idx_t batch_size,
+        FaissIndex** p_out);
+
+/* Copies the clustering parameters IndexIVF::train uses for the coarse
+ * quantizer into cp. Returns non-zero on error. */
+int goss_IndexIVF_clustering_params(
+        const FaissIndex* index,
+        FaissClusteringParameters* cp);
+
+/* Sets verbose on the index and, for IVF indexes, on the quantizer and the
+ * clustering run by train */
+void goss_Index_set_verbose_all(FaissIndex* index, int verbose);
+
+/* IndexHNSW */
+int goss_IndexHNSW_check(const FaissIndex* index);
+int goss_IndexHNSW_M(const FaissIndex* index);
+int goss_IndexHNSW_efSearch(const FaissIndex* index);
+int goss_IndexHNSW_set_efSearch(FaissIndex* index, int efSearch);
+int goss_IndexHNSW_efConstruction(const FaissIndex* index);
+int goss_IndexHNSW_set_efConstruction(FaissIndex* index, int efConstruction);
+
+/* SearchParametersHNSW, freed with faiss_SearchParameters_free; sel may
+ * be NULL. Returns non-zero on error. */
+int goss_SearchParametersHNSW_new(
+        FaissSearchParameters** p_sp,
+        FaissIDSelector* sel,
+        int efSearch);
+
+/* IndexIVFPQ */
+int goss_IndexIVFPQ_check(const FaissIndex* index);
+int goss_IndexIVFPQ_M(const FaissIndex* index);
+int goss_IndexIVFPQ_nbits(const FaissIndex* index);
+
+/* VectorTransform; returns non-zero on error */
+int goss_VectorTransform_apply_noalloc(
+        const FaissVectorTransform* vt,
+        idx_t n,
+        const float* x,
+        float* xt);
+int goss_VectorTransform_reverse_transform(
+        const FaissVectorTransform* vt,
+        idx_t n,
+        const float* xt,
+        float* x);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,240 @@
+package faiss
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// randomVectors returns n reproducible random vectors of dimension d, with
+// components uniform in [0, 1).
+func randomVectors(n, d int, seed int64) []float32 {
+	rng := rand.New(rand.NewSource(seed))
+	x := make([]float32, n*d)
+	for i := range x {
+		x[i] = rng.Float32()
+	}
+	return x
+}
+
+// clusteredVectors returns n reproducible vectors of dimension d spread
+// tightly around nclusters random centers; vector i belongs to cluster
+// i % nclusters.
+func clusteredVectors(n, d, nclusters int, seed int64) []float32 {
+	rng := rand.New(rand.NewSource(seed))
+	centers := make([]float32, nclusters*d)
+	for i := range centers {
+		centers[i] = rng.Float32() * 10
+	}
+	x := make([]float32, n*d)
+	for i := 0; i < n; i++ {
+		c := i % nclusters
+		for j := 0; j < d; j++ {
+			x[i*d+j] = centers[c*d+j] + float32(rng.NormFloat64()*0.05)
+		}
+	}
+	return x
+}
+
+// newFlatL2 returns a flat L2 index holding x, deleted when the test ends.
+func newFlatL2(t testing.TB, d int, x []float32) *IndexFlat {
+	t.Helper()
+
+	idx, err := NewIndexFlatL2(d)
+	if err != nil {
+		t.Fatalf("NewIndexFlatL2(%d): %v", d, err)
+	}
+	t.Cleanup(idx.Delete)
+	if len(x) > 0 {
+		if err := idx.Add(x); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	return idx
+}
+
+// checkProgress verifies that a progress callback was called once per
+// batch, with counts increasing up to total.
+func checkProgress(t *testing.T, calls []int, batches, total int) {
+	t.Helper()
+
+	if len(calls) != batches {
+		t.Fatalf("progress called %d times, want %d", len(calls), batches)
+	}
+	for i := 1; i < len(calls); i++ {
+		if calls[i] <= calls[i-1] {
+			t.Fatalf("progress counts not increasing: %v", calls)
+		}
+	}
+	if last := calls[len(calls)-1]; last != total {
+		t.Fatalf("last progress count = %d, want %d", last, total)
+	}
+}
+
+// newIVFFlatL2 returns an IVF flat L2 index trained on x and holding it,
+// deleted when the test ends.
+func newIVFFlatL2(t testing.TB, d, nlist int, x []float32) *IndexIVFFlat {
+	t.Helper()
+
+	idx, err := NewIndexIVFFlatL2(d, nlist)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2(%d, %d): %v", d, nlist, err)
+	}
+	t.Cleanup(idx.Delete)
+	if err := idx.Train(x); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	if err := idx.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	return idx
+}
+
+// approxEqual reports whether a and b have the same length and differ by at
+// most tol element-wise.
+func approxEqual(a, b []float32, tol float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(float64(a[i])-float64(b[i])) > tol {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDimensionMismatchError(t *testing.T) {
+	idx := newFlatL2(t, 4, randomVectors(10, 4, 1))
+
+	_, _, err := idx.Search(make([]float32, 6), 1)
+	var mismatch *DimensionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Search with 6 floats = %v, want a DimensionMismatchError", err)
+	}
+	if mismatch.Got != 6 || mismatch.Want != 4 {
+		t.Errorf("got Got=%d Want=%d, want Got=6 Want=4", mismatch.Got, mismatch.Want)
+	}
+	if !errors.Is(err, ErrInvalidDimension) {
+		t.Errorf("%v doesn't match ErrInvalidDimension", err)
+	}
+
+	if err := idx.Add(make([]float32, 5)); !errors.As(err, &mismatch) || mismatch.Got != 5 || mismatch.Want != 4 {
+		t.Errorf("Add with 5 floats = %v, want Got=5 Want=4", err)
+	}
+}
+
+func TestErrIndexClosedMatchesErrNullPointer(t *testing.T) {
+	idx, err := IndexFactory(4, "Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory: %v", err)
+	}
+	idx.Delete()
+
+	_, _, err = idx.Search(make([]float32, 4), 1)
+	if !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Search after Delete = %v, want ErrIndexClosed", err)
+	}
+	if !errors.Is(err, ErrNullPointer) {
+		t.Errorf("Search after Delete = %v doesn't match ErrNullPointer", err)
+	}
+	if errors.Is(ErrNullPointer, ErrIndexClosed) {
+		t.Error("ErrNullPointer matches ErrIndexClosed")
+	}
+}
+
+// TestCloseConcurrently is meant to run with -race: concurrent Close and
+// Delete calls on typed wrappers must free the index once, without racing.
+func TestCloseConcurrently(t *testing.T) {
+	const d = 8
+	type closer interface {
+		Close() error
+		Delete()
+		Search(x []float32, k int64) ([]float32, []int64, error)
+	}
+
+	constructors := map[string]func() (closer, error){
+		"Flat":    func() (closer, error) { return NewIndexFlatL2(d) },
+		"IVFFlat": func() (closer, error) { return NewIndexIVFFlatL2(d, 4) },
+		"IVFPQ":   func() (closer, error) { return NewIndexIVFPQ(d, 4, 2, 8, MetricL2) },
+		"HNSW":    func() (closer, error) { return NewIndexHNSWL2(d, 16) },
+	}
+	for name, newIndex := range constructors {
+		idx, err := newIndex()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				if g%2 == 0 {
+					idx.Delete()
+				} else if err := idx.Close(); err != nil {
+					t.Errorf("%s: Close: %v", name, err)
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if _, _, err := idx.Search(make([]float32, d), 1); !errors.Is(err, ErrIndexClosed) {
+			t.Errorf("%s: Search after Close = %v, want ErrIndexClosed", name, err)
+		}
+	}
+}
+
+func TestFaissErrorCategories(t *testing.T) {
+	// A missing file makes FAISS throw "could not open ... for reading"
+	_, err := ReadIndex(t.TempDir()+"/missing.faiss", 0)
+	if !errors.Is(err, ErrFaissIO) {
+		t.Errorf("ReadIndex of a missing file = %v, want ErrFaissIO", err)
+	}
+	var faissErr *FaissError
+	if !errors.As(err, &faissErr) || faissErr.Msg == "" {
+		t.Errorf("ReadIndex error %v doesn't carry the FAISS message", err)
+	}
+
+	tests := []struct {
+		msg  string
+		want error
+	}{
+		{"Error in virtual void faiss::IndexIVF::add_core(...): Error: 'is_trained' failed", ErrFaissNotTrained},
+		{"std::bad_alloc", ErrFaissOutOfMemory},
+		{"Error in faiss::Index::remove_ids: remove_ids not implemented for this type of index", ErrFaissNotSupported},
+		{"Error in faiss::IndexFlat::search: Error: 'k > 0' failed", ErrFaissInvalidArgument},
+	}
+	for _, tt := range tests {
+		err := wrapError(newFaissError(tt.msg), "operation")
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%q: category %v, want %v", tt.msg, newFaissError(tt.msg).Category, tt.want)
+		}
+	}
+
+	if err := newFaissError("Error: 'is_trained' failed"); !errors.Is(err, ErrIndexNotTrained) {
+		t.Error("not trained FAISS error doesn't match ErrIndexNotTrained")
+	}
+	if err := newFaissError("something else"); errors.Is(err, ErrFaissIO) || err.Category != CategoryUnknown {
+		t.Errorf("unrecognized message got category %v", err.Category)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+
+	// Probes may run concurrently with each other
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- SelfTest() }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent SelfTest: %v", err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package faissarrow converts between FAISS indexes and Apache Arrow record
+// batches with the schema (id int64, vector fixed_size_list<float32>[d]).
+//
+// It lives in its own module so that users of the core package don't pull
+// in the Arrow dependency.
+package faissarrow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	faiss "github.com/BuiDanhTung28/goss"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// Column names of the interchange schema
+const (
+	IDColumn     = "id"
+	VectorColumn = "vector"
+)
+
+// Schema returns the interchange schema for d-dimensional vectors.
+func Schema(d int) *arrow.Schema {
+	return arrow.NewSchema([]arrow.Field{
+		{Name: IDColumn, Type: arrow.PrimitiveTypes.Int64},
+		{Name: VectorColumn, Type: arrow.FixedSizeListOfNonNullable(int32(d), arrow.PrimitiveTypes.Float32)},
+	}, nil)
+}
+
+// FromArrowRecord adds the vectors of rec to idx with AddWithIDs, in batches
+// of faiss.DefaultAddBatchSize rows. Vector data is passed to FAISS straight
+// from the Arrow buffers, without an intermediate copy.
+func FromArrowRecord(idx faiss.Index, rec arrow.Record) error {
+	if idx == nil {
+		return errors.New("index is nil")
+	}
+	if rec == nil {
+		return errors.New("record is nil")
+	}
+
+	ids, vectors, err := columns(rec, idx.D())
+	if err != nil {
+		return err
+	}
+
+	if ids.NullN() > 0 {
+		return fmt.Errorf("column %q contains %d null values", IDColumn, ids.NullN())
+	}
+	if vectors.NullN() > 0 {
+		return fmt.Errorf("column %q contains %d null vectors", VectorColumn, vectors.NullN())
+	}
+
+	n := int(rec.NumRows())
+	if n == 0 {
+		return nil
+	}
+
+	d := idx.D()
+	values, ok := vectors.ListValues().(*array.Float32)
+	if !ok {
+		return fmt.Errorf("column %q values are %s, expected float32", VectorColumn, vectors.ListValues().DataType())
+	}
+	if values.NullN() > 0 {
+		return fmt.Errorf("column %q contains %d null elements", VectorColumn, values.NullN())
+	}
+
+	start, _ := vectors.ValueOffsets(0)
+	flat := values.Float32Values()[start : start+int64(n*d)]
+	idValues := ids.Int64Values()
+
+	for i := 0; i < n; i += faiss.DefaultAddBatchSize {
+		end := i + faiss.DefaultAddBatchSize
+		if end > n {
+			end = n
+		}
+
+		if err := idx.AddWithIDs(flat[i*d:end*d], idValues[i:end]); err != nil {
+			return fmt.Errorf("add rows %d-%d: %w", i, end-1, err)
+		}
+	}
+
+	return nil
+}
+
+// columns validates the schema of rec against dimension d and returns its
+// id and vector columns.
+func columns(rec arrow.Record, d int) (*array.Int64, *array.FixedSizeList, error) {
+	schema := rec.Schema()
+
+	idIdx := schema.FieldIndices(IDColumn)
+	if len(idIdx) != 1 {
+		return nil, nil, fmt.Errorf("schema must have exactly one %q column, found %d", IDColumn, len(idIdx))
+	}
+	vecIdx := schema.FieldIndices(VectorColumn)
+	if len(vecIdx) != 1 {
+		return nil, nil, fmt.Errorf("schema must have exactly one %q column, found %d", VectorColumn, len(vecIdx))
+	}
+
+	ids, ok := rec.Column(idIdx[0]).(*array.Int64)
+	if !ok {
+		return nil, nil, fmt.Errorf("column %q is %s, expected int64", IDColumn, rec.Column(idIdx[0]).DataType())
+	}
+
+	vecField := schema.Field(vecIdx[0])
+	listType, ok := vecField.Type.(*arrow.FixedSizeListType)
+	if !ok {
+		return nil, nil, fmt.Errorf("column %q is %s, expected fixed_size_list<float32>[%d]", VectorColumn, vecField.Type, d)
+	}
+	if int(listType.Len()) != d {
+		return nil, nil, fmt.Errorf("column %q has list size %d, index dimension is %d", VectorColumn, listType.Len(), d)
+	}
+	if listType.Elem().ID() != arrow.FLOAT32 {
+		return nil, nil, fmt.Errorf("column %q has %s elements, expected float32", VectorColumn, listType.Elem())
+	}
+
+	vectors, ok := rec.Column(vecIdx[0]).(*array.FixedSizeList)
+	if !ok {
+		return nil, nil, fmt.Errorf("column %q is not a fixed size list array", VectorColumn)
+	}
+
+	return ids, vectors, nil
+}
+
+// RecordIterator yields the vectors of an index as Arrow records.
+type RecordIterator struct {
+	idx       faiss.Index
+	chunkSize int64
+	next      int64
+	ntotal    int64
+	schema    *arrow.Schema
+	mem       memory.Allocator
+}
+
+// ToArrowRecords returns an iterator over the vectors of idx in records of at
+// most chunkSize rows. Vectors are fetched with Reconstruct, so idx must
+// support reconstruction and use sequential IDs 0..Ntotal-1, as flat indexes do.
+func ToArrowRecords(idx faiss.Index, chunkSize int) (*RecordIterator, error) {
+	if idx == nil {
+		return nil, errors.New("index is nil")
+	}
+	if chunkSize <= 0 {
+		chunkSize = faiss.DefaultAddBatchSize
+	}
+
+	return &RecordIterator{
+		idx:       idx,
+		chunkSize: int64(chunkSize),
+		ntotal:    idx.Ntotal(),
+		schema:    Schema(idx.D()),
+		mem:       memory.DefaultAllocator,
+	}, nil
+}
+
+// Schema returns the schema of the produced records.
+func (it *RecordIterator) Schema() *arrow.Schema {
+	return it.schema
+}
+
+// Next returns the next record, or io.EOF when all vectors have been
+// returned. The caller must Release each record.
+func (it *RecordIterator) Next() (arrow.Record, error) {
+	if it.next >= it.ntotal {
+		return nil, io.EOF
+	}
+
+	end := it.next + it.chunkSize
+	if end > it.ntotal {
+		end = it.ntotal
+	}
+
+	b := array.NewRecordBuilder(it.mem, it.schema)
+	defer b.Release()
+
+	idBuilder := b.Field(0).(*array.Int64Builder)
+	listBuilder := b.Field(1).(*array.FixedSizeListBuilder)
+	valueBuilder := listBuilder.ValueBuilder().(*array.Float32Builder)
+
+	for id := it.next; id < end; id++ {
+		vec, err := it.idx.Reconstruct(id)
+		if err != nil {
+			return nil, fmt.Errorf("reconstruct vector %d: %w", id, err)
+		}
+		idBuilder.Append(id)
+		listBuilder.Append(true)
+		valueBuilder.AppendValues(vec, nil)
+	}
+
+	it.next = end
+	return b.NewRecord(), nil
+}
@@ -0,0 +1,176 @@
+package faiss
+
+import (
+	"fmt"
+	"math"
+)
+
+// float16ChunkSize is the number of float32 elements converted at a time by
+// the float16 methods, bounding their scratch buffer to 256 KiB whatever the
+// size of the input.
+const float16ChunkSize = 1 << 16
+
+// Float16ToFloat32 converts an IEEE 754 half-precision value, given by its
+// bits, to float32. The conversion is exact: subnormals become normal
+// float32 values, and infinities and NaNs are kept, NaN payload included.
+func Float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// Subnormal: shift the mantissa up to its implicit bit.
+		exp = 127 - 15 + 1
+		for mant&0x400 == 0 {
+			mant <<= 1
+			exp--
+		}
+		mant &= 0x3ff
+	case 0x1f:
+		exp = 0xff
+	default:
+		exp += 127 - 15
+	}
+	return math.Float32frombits(sign | exp<<23 | mant<<13)
+}
+
+// Float32ToFloat16 converts f to the bits of the nearest IEEE 754
+// half-precision value, rounding ties to even. Values beyond the half
+// range become infinities, values too small for its subnormals become
+// zeros of the same sign, and NaNs stay NaNs.
+func Float32ToFloat16(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23) & 0xff
+	mant := b & 0x7fffff
+
+	if exp == 0xff {
+		if mant != 0 {
+			// Keep the top of the payload, and the quiet bit so that the
+			// result can't turn into an infinity.
+			return sign | 0x7e00 | uint16(mant>>13)
+		}
+		return sign | 0x7c00
+	}
+
+	e := exp - 127 + 15
+	switch {
+	case e >= 0x1f:
+		return sign | 0x7c00
+	case e <= 0:
+		// Subnormal result: below half the smallest subnormal rounds to zero.
+		if e < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - e)
+		half := mant >> shift
+		rem := mant & (1<<shift - 1)
+		if halfway := uint32(1) << (shift - 1); rem > halfway || rem == halfway && half&1 == 1 {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	// A carry out of the mantissa correctly bumps the exponent, up to
+	// infinity.
+	half := uint32(e)<<10 | mant>>13
+	if rem := mant & 0x1fff; rem > 0x1000 || rem == 0x1000 && half&1 == 1 {
+		half++
+	}
+	return sign | uint16(half)
+}
+
+// float16sToFloat32 converts src into dst, which must be at least as long.
+func float16sToFloat32(dst []float32, src []uint16) {
+	dst = dst[:len(src)]
+	for i, h := range src {
+		dst[i] = Float16ToFloat32(h)
+	}
+}
+
+// float16Chunks calls fn with the vectors of x converted to float32, a chunk
+// of whole vectors at a time in a pooled buffer that is reused across calls.
+// first is the index of the first vector of the chunk.
+func float16Chunks(x []uint16, d int, fn func(chunk []float32, first int) error) error {
+	rows := float16ChunkSize / d
+	if rows == 0 {
+		rows = 1
+	}
+	step := rows * d
+
+	buf := float32Buffers.Get().(*[]float32)
+	defer float32Buffers.Put(buf)
+	if cap(*buf) < step {
+		*buf = make([]float32, step)
+	}
+
+	for start := 0; start < len(x); start += step {
+		end := start + step
+		if end > len(x) {
+			end = len(x)
+		}
+		chunk := (*buf)[:end-start]
+		float16sToFloat32(chunk, x[start:end])
+		if err := fn(chunk, start/d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFloat16 adds the float16 vectors of x with add, chunk by chunk.
+func addFloat16(x []uint16, d int, add func([]float32) error) error {
+	if err := ValidateFloat16Vectors(x, d); err != nil {
+		return wrapError(err, "add float16 vectors validation")
+	}
+
+	return float16Chunks(x, d, func(chunk []float32, first int) error {
+		if err := add(chunk); err != nil {
+			return wrapError(err, fmt.Sprintf("add float16 vectors from %d", first))
+		}
+		return nil
+	})
+}
+
+// searchFloat16 searches the float16 queries of x with search, chunk by
+// chunk, and concatenates the results.
+func searchFloat16(x []uint16, d int, k int64, search func([]float32, int64) ([]float32, []int64, error)) (distances []float32, labels []int64, err error) {
+	if err := ValidateFloat16Vectors(x, d); err != nil {
+		return nil, nil, wrapError(err, "search float16 vectors validation")
+	}
+	nq := len(x) / d
+
+	err = float16Chunks(x, d, func(chunk []float32, first int) error {
+		chunkDistances, chunkLabels, err := search(chunk, k)
+		if err != nil {
+			return wrapError(err, fmt.Sprintf("search float16 queries from %d", first))
+		}
+		if distances == nil {
+			// k may have been clamped to the index size: size the results
+			// after the first chunk.
+			perQuery := len(chunkLabels) / (len(chunk) / d)
+			distances = make([]float32, 0, nq*perQuery)
+			labels = make([]int64, 0, nq*perQuery)
+		}
+		distances = append(distances, chunkDistances...)
+		labels = append(labels, chunkLabels...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return distances, labels, nil
+}
+
+func (idx *faissIndex) AddFloat16(x []uint16) error {
+	return addFloat16(x, idx.D(), idx.Add)
+}
+
+func (idx *faissIndex) SearchFloat16(x []uint16, k int64) (distances []float32, labels []int64, err error) {
+	return searchFloat16(x, idx.D(), k, idx.Search)
+}
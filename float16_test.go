@@ -0,0 +1,165 @@
+package faiss
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFloat16Conversions(t *testing.T) {
+	cases := []struct {
+		h uint16
+		f float32
+	}{
+		{0x0000, 0},
+		{0x3c00, 1},
+		{0xc000, -2},
+		{0x3555, 0.333251953125},
+		{0x7bff, 65504},                          // Largest normal
+		{0x0400, float32(math.Ldexp(1, -14))},    // Smallest normal
+		{0x0001, float32(math.Ldexp(1, -24))},    // Smallest subnormal
+		{0x03ff, float32(math.Ldexp(1023, -24))}, // Largest subnormal
+		{0x8001, -float32(math.Ldexp(1, -24))},   // Negative subnormal
+		{0x7c00, float32(math.Inf(1))},           // +Inf
+		{0xfc00, float32(math.Inf(-1))},          // -Inf
+	}
+	for _, c := range cases {
+		if got := Float16ToFloat32(c.h); got != c.f {
+			t.Errorf("Float16ToFloat32(%#04x) = %v, want %v", c.h, got, c.f)
+		}
+		if got := Float32ToFloat16(c.f); got != c.h {
+			t.Errorf("Float32ToFloat16(%v) = %#04x, want %#04x", c.f, got, c.h)
+		}
+	}
+	if got := Float32ToFloat16(float32(math.Copysign(0, -1))); got != 0x8000 {
+		t.Errorf("Float32ToFloat16(-0) = %#04x, want 0x8000", got)
+	}
+
+	// Every half value converts back to itself, NaNs to NaNs
+	for h := 0; h <= 0xffff; h++ {
+		f := Float16ToFloat32(uint16(h))
+		back := Float32ToFloat16(f)
+		if h&0x7c00 == 0x7c00 && h&0x3ff != 0 {
+			if !math.IsNaN(float64(f)) || back&0x7c00 != 0x7c00 || back&0x3ff == 0 {
+				t.Errorf("NaN %#04x converted to %v and back to %#04x", h, f, back)
+			}
+			continue
+		}
+		if back != uint16(h) {
+			t.Errorf("%#04x converted to %v and back to %#04x", h, f, back)
+		}
+	}
+}
+
+func TestFloat32ToFloat16Rounding(t *testing.T) {
+	cases := []struct {
+		f float32
+		h uint16
+	}{
+		{1 + float32(math.Ldexp(1, -11)), 0x3c00}, // Tie rounds to the even 1
+		{1 + float32(math.Ldexp(3, -11)), 0x3c02}, // Tie rounds to the even 0x3c02
+		{1 + float32(math.Ldexp(1, -11)) + float32(math.Ldexp(1, -20)), 0x3c01},
+		{65519, 0x7bff},                          // Below the midpoint to 65536
+		{65520, 0x7c00},                          // Tie rounds up to infinity
+		{1e10, 0x7c00},                           // Overflow
+		{float32(math.Ldexp(1, -25)), 0x0000},    // Tie rounds to the even 0
+		{float32(math.Ldexp(1.5, -25)), 0x0001},  // Above half the smallest subnormal
+		{float32(math.Ldexp(3, -25)), 0x0002},    // Subnormal tie rounds to even
+		{float32(math.Ldexp(1, -30)), 0x0000},    // Underflow
+		{-float32(math.Ldexp(1, -30)), 0x8000},   // Underflow keeps the sign
+		{float32(math.Ldexp(2047, -25)), 0x0400}, // Subnormal rounding up to the smallest normal
+	}
+	for _, c := range cases {
+		if got := Float32ToFloat16(c.f); got != c.h {
+			t.Errorf("Float32ToFloat16(%v) = %#04x, want %#04x", c.f, got, c.h)
+		}
+	}
+}
+
+func toFloat16(x []float32) []uint16 {
+	h := make([]uint16, len(x))
+	for i, v := range x {
+		h[i] = Float32ToFloat16(v)
+	}
+	return h
+}
+
+func fromFloat16(h []uint16) []float32 {
+	x := make([]float32, len(h))
+	for i, v := range h {
+		x[i] = Float16ToFloat32(v)
+	}
+	return x
+}
+
+func TestFloat16AddAndSearch(t *testing.T) {
+	// Enough vectors and queries to span several conversion chunks
+	const d, n, nq, k = 64, 3000, 2500, 3
+	x := toFloat16(randomVectors(n, d, 1))
+	queries := toFloat16(randomVectors(nq, d, 2))
+
+	got := newFlatL2(t, d, nil)
+	if err := got.AddFloat16(x); err != nil {
+		t.Fatalf("AddFloat16: %v", err)
+	}
+	want := newFlatL2(t, d, fromFloat16(x))
+	if got.Ntotal() != n {
+		t.Fatalf("Ntotal = %d, want %d", got.Ntotal(), n)
+	}
+	stored, err := got.Reconstruct(n - 1)
+	if err != nil {
+		t.Fatalf("Reconstruct: %v", err)
+	}
+	if !reflect.DeepEqual(stored, fromFloat16(x[(n-1)*d:])) {
+		t.Error("the last vector added as float16 isn't stored exactly")
+	}
+
+	gotD, gotL, err := got.SearchFloat16(queries, k)
+	if err != nil {
+		t.Fatalf("SearchFloat16: %v", err)
+	}
+	wantD, wantL, err := want.Search(fromFloat16(queries), k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if !reflect.DeepEqual(gotL, wantL) || !approxEqual(gotD, wantD, 1e-5) {
+		t.Error("SearchFloat16 differs from a search of the converted queries")
+	}
+
+	var mismatch *DimensionMismatchError
+	if err := got.AddFloat16(x[:d+1]); !errors.As(err, &mismatch) {
+		t.Errorf("AddFloat16 of a partial vector = %v, want a DimensionMismatchError", err)
+	}
+	if _, _, err := got.SearchFloat16(nil, k); !errors.Is(err, ErrEmptyVectors) {
+		t.Errorf("SearchFloat16 of no queries = %v, want ErrEmptyVectors", err)
+	}
+}
+
+// BenchmarkFloat16Conversion compares converting float16 vectors chunk by
+// chunk, as AddFloat16 does, with converting them all up front: B/op shows
+// the full float32 copy the chunks avoid.
+func BenchmarkFloat16Conversion(b *testing.B) {
+	const d, n = 128, 50000
+	x := toFloat16(randomVectors(n, d, 1))
+	discard := func([]float32) error { return nil }
+
+	b.Run("Chunked", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(x) * 2))
+		for i := 0; i < b.N; i++ {
+			if err := addFloat16(x, d, discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Naive", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(x) * 2))
+		for i := 0; i < b.N; i++ {
+			if err := discard(fromFloat16(x)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
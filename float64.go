@@ -0,0 +1,40 @@
+package faiss
+
+import (
+	"sync"
+)
+
+// float32Buffers recycles the conversion buffers of the float64 methods:
+// FAISS copies the vectors it is given, so a buffer can be reused as soon as
+// the call returns.
+var float32Buffers = sync.Pool{
+	New: func() any { return new([]float32) },
+}
+
+// toFloat32 converts x into a pooled buffer, which must be released with
+// float32Buffers.Put.
+func toFloat32(x []float64) *[]float32 {
+	buf := float32Buffers.Get().(*[]float32)
+	if cap(*buf) < len(x) {
+		*buf = make([]float32, len(x))
+	}
+	*buf = (*buf)[:len(x)]
+	for i, v := range x {
+		(*buf)[i] = float32(v)
+	}
+	return buf
+}
+
+func (idx *faissIndex) AddFloat64(x []float64) error {
+	buf := toFloat32(x)
+	defer float32Buffers.Put(buf)
+
+	return idx.Add(*buf)
+}
+
+func (idx *faissIndex) SearchFloat64(x []float64, k int64) (distances []float32, labels []int64, err error) {
+	buf := toFloat32(x)
+	defer float32Buffers.Put(buf)
+
+	return idx.Search(*buf, k)
+}
@@ -0,0 +1,53 @@
+package faiss
+
+// ReadOnlyIndex is a search-only view of an index, returned by Frozen. It
+// exposes no mutating method, so it can be shared by any number of
+// goroutines without locking.
+type ReadOnlyIndex interface {
+	D() int
+	Ntotal() int64
+	MetricType() int
+	Search(x []float32, k int64) (distances []float32, labels []int64, err error)
+	SearchBatch(queries []float32, k int64, batchSize int, opts ...BatchOption) (distances [][]float32, labels [][]int64, err error)
+	Reconstruct(key int64) ([]float32, error)
+}
+
+// frozenIndex hides the Index behind ReadOnlyIndex: a type assertion on the
+// handle can't reach the mutating methods.
+type frozenIndex struct {
+	idx *faissIndex
+}
+
+func (idx *faissIndex) Frozen() (ReadOnlyIndex, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+	if !idx.IsTrained() {
+		return nil, wrapError(ErrIndexNotTrained, "freeze")
+	}
+
+	// Wait for in-flight adds, so that readers never see a partial one.
+	idx.mu.Lock()
+	idx.frozen.Store(true)
+	idx.mu.Unlock()
+
+	return &frozenIndex{idx: idx}, nil
+}
+
+func (f *frozenIndex) D() int { return f.idx.D() }
+
+func (f *frozenIndex) Ntotal() int64 { return f.idx.Ntotal() }
+
+func (f *frozenIndex) MetricType() int { return f.idx.MetricType() }
+
+func (f *frozenIndex) Search(x []float32, k int64) ([]float32, []int64, error) {
+	return f.idx.Search(x, k)
+}
+
+func (f *frozenIndex) SearchBatch(queries []float32, k int64, batchSize int, opts ...BatchOption) ([][]float32, [][]int64, error) {
+	return f.idx.SearchBatch(queries, k, batchSize, opts...)
+}
+
+func (f *frozenIndex) Reconstruct(key int64) ([]float32, error) {
+	return f.idx.Reconstruct(key)
+}
@@ -0,0 +1,70 @@
+package faiss
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestFrozenConcurrentSearches is meant for go test -race: dozens of
+// goroutines search through one frozen handle while others try to mutate
+// the original index.
+func TestFrozenConcurrentSearches(t *testing.T) {
+	const d, n, k, searchers, mutators, rounds = 16, 5000, 10, 48, 4, 50
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	queries := randomVectors(20, d, 2)
+	wantD, wantL, err := idx.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	frozen, err := idx.Frozen()
+	if err != nil {
+		t.Fatalf("Frozen: %v", err)
+	}
+	if _, ok := frozen.(Index); ok {
+		t.Fatal("the frozen handle can be asserted back to a mutable Index")
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < searchers; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				gotD, gotL, err := frozen.Search(queries, k)
+				if err != nil {
+					t.Errorf("Search: %v", err)
+					return
+				}
+				if !reflect.DeepEqual(gotL, wantL) || !reflect.DeepEqual(gotD, wantD) {
+					t.Error("concurrent Search returned different results")
+					return
+				}
+			}
+		}()
+	}
+	extra := randomVectors(1, d, 3)
+	for g := 0; g < mutators; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				if err := idx.Add(extra); !errors.Is(err, ErrIndexFrozen) {
+					t.Errorf("Add on a frozen index = %v, want ErrIndexFrozen", err)
+					return
+				}
+				if _, err := idx.RemoveIDsSlice([]int64{0}); !errors.Is(err, ErrIndexFrozen) {
+					t.Errorf("RemoveIDsSlice on a frozen index = %v, want ErrIndexFrozen", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := frozen.Ntotal(); got != n {
+		t.Errorf("Ntotal = %d, want %d", got, n)
+	}
+}
@@ -0,0 +1,147 @@
+package faiss
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// floatsFromBytes decodes data as little-endian float32 values, ignoring
+// trailing bytes.
+func floatsFromBytes(data []byte) []float32 {
+	x := make([]float32, len(data)/4)
+	for i := range x {
+		x[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return x
+}
+
+func finite(x []float32) bool {
+	for _, v := range x {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzValidateVectors(f *testing.F) {
+	f.Add(0, 4)
+	f.Add(8, 4)
+	f.Add(7, 4)
+	f.Add(4, 0)
+	f.Add(4, -1)
+
+	f.Fuzz(func(t *testing.T, n, d int) {
+		if n < 0 || n > 1<<16 {
+			t.Skip()
+		}
+		err := ValidateVectors(make([]float32, n), d)
+		valid := n > 0 && d > 0 && n%d == 0
+		if valid != (err == nil) {
+			t.Errorf("ValidateVectors(len %d, d %d) = %v", n, d, err)
+		}
+	})
+}
+
+func FuzzNormalizeVectors(f *testing.F) {
+	f.Add([]byte{0, 0, 128, 63, 0, 0, 0, 64}, 2)
+	f.Add([]byte{255, 255, 127, 127, 255, 255, 127, 127}, 1) // MaxFloat32
+	f.Add([]byte{1, 0, 0, 0, 1, 0, 0, 0}, 2)                 // Denormals
+	f.Add([]byte{}, 3)
+
+	f.Fuzz(func(t *testing.T, data []byte, d int) {
+		x := floatsFromBytes(data)
+		if err := NormalizeVectors(x, d); err != nil {
+			if ValidateVectors(x, d) == nil {
+				t.Fatalf("NormalizeVectors rejected valid input: %v", err)
+			}
+			return
+		}
+
+		for i := 0; i < len(x)/d; i++ {
+			vec := x[i*d : (i+1)*d]
+			if !finite(vec) {
+				continue
+			}
+			var norm float64
+			for _, v := range vec {
+				norm += float64(v) * float64(v)
+			}
+			if norm != 0 && math.Abs(math.Sqrt(norm)-1) > 1e-5 {
+				t.Errorf("vector %d has norm %v after normalization", i, math.Sqrt(norm))
+			}
+		}
+	})
+}
+
+func FuzzGetVectorBatch(f *testing.F) {
+	f.Add(10, 4, 0, 3)
+	f.Add(10, 4, 2, 100)
+	f.Add(10, 0, 0, 1)
+	f.Add(10, 4, -1, 1)
+	f.Add(3, 4, 0, 1)
+
+	f.Fuzz(func(t *testing.T, n, d, start, count int) {
+		if n < 0 || n > 1<<16 {
+			t.Skip()
+		}
+		x := make([]float32, n)
+		for i := range x {
+			x[i] = float32(i)
+		}
+
+		batch := GetVectorBatch(x, d, start, count)
+		if batch == nil {
+			return
+		}
+		if d <= 0 || start < 0 || count <= 0 {
+			t.Fatalf("GetVectorBatch(d %d, start %d, count %d) returned %d values", d, start, count, len(batch))
+		}
+		if len(batch)%d != 0 || len(batch) > count*d {
+			t.Fatalf("batch holds %d values for d %d and count %d", len(batch), d, count)
+		}
+		if batch[0] != float32(start*d) {
+			t.Fatalf("batch starts at value %v, want %v", batch[0], start*d)
+		}
+	})
+}
+
+func FuzzSearch(f *testing.F) {
+	const d, n = 4, 50
+	idx, err := NewIndexFlatL2(d)
+	if err != nil {
+		f.Fatalf("NewIndexFlatL2: %v", err)
+	}
+	defer idx.Delete()
+	if err := idx.Add(randomVectors(n, d, 1)); err != nil {
+		f.Fatalf("Add: %v", err)
+	}
+
+	f.Add([]byte{0, 0, 128, 63, 0, 0, 128, 63, 0, 0, 128, 63, 0, 0, 128, 63}, int64(5))
+	f.Add([]byte{0, 0, 192, 127, 0, 0, 128, 127, 0, 0, 128, 255, 0, 0, 0, 0}, int64(n+10)) // NaN, +Inf, -Inf
+	f.Add([]byte{1, 2, 3}, int64(1))
+	f.Add([]byte{}, int64(0))
+
+	f.Fuzz(func(t *testing.T, data []byte, k int64) {
+		queries := floatsFromBytes(data)
+		distances, labels, err := idx.Search(queries, k)
+		if err != nil {
+			return
+		}
+
+		nq := int64(len(queries) / d)
+		want := k
+		if want > n {
+			want = n
+		}
+		if int64(len(labels)) != nq*want || len(distances) != len(labels) {
+			t.Fatalf("got %d labels and %d distances for %d queries and k %d", len(labels), len(distances), nq, k)
+		}
+		for _, label := range labels {
+			if label < -1 || label >= n {
+				t.Fatalf("label %d out of range [-1, %d)", label, n)
+			}
+		}
+	})
+}
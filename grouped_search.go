@@ -0,0 +1,92 @@
+package faiss
+
+import (
+	"errors"
+)
+
+// GroupResult is one group returned by GroupedSearch.
+type GroupResult struct {
+	Group    int64   // Group (e.g. document) ID
+	Label    int64   // Label of the best hit within the group
+	Distance float32 // Distance of the best hit within the group
+}
+
+// GroupByHighBits returns a grouping function for the ID encoding convention
+// where the group ID is stored in the bits above shift, for example
+// document = label >> 20.
+func GroupByHighBits(shift uint) func(label int64) int64 {
+	return func(label int64) int64 {
+		return label >> shift
+	}
+}
+
+// GroupedSearch returns the k best distinct groups for the single query x,
+// each represented by its best hit. groupOf maps a label to its group.
+// The index is over-fetched adaptively, doubling the number of candidates
+// until k distinct groups are found or min(MaxK, Ntotal) candidates have
+// been searched; fewer than k groups are returned in that case.
+// Results are ordered from closest to farthest under the index's metric.
+func GroupedSearch(idx Index, x []float32, k int64, groupOf func(label int64) int64) ([]GroupResult, error) {
+	if idx == nil {
+		return nil, errors.New("index is nil")
+	}
+
+	if groupOf == nil {
+		return nil, errors.New("groupOf is nil")
+	}
+
+	if err := ValidateK(k); err != nil {
+		return nil, wrapError(err, "grouped search k validation")
+	}
+
+	if len(x) != idx.D() {
+		return nil, &DimensionMismatchError{Got: len(x), Want: idx.D()}
+	}
+
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return nil, wrapError(ErrEmptyIndex, "grouped search")
+	}
+
+	// A search returns at most MaxK candidates
+	limit := ntotal
+	if limit > MaxK {
+		limit = MaxK
+	}
+
+	fetch := k * 4
+	for {
+		if fetch > limit {
+			fetch = limit
+		}
+
+		distances, labels, err := idx.Search(x, fetch)
+		if err != nil {
+			return nil, wrapError(err, "grouped search")
+		}
+
+		// Search results are already sorted by the index metric, so the
+		// first hit seen for a group is its best one.
+		results := make([]GroupResult, 0, k)
+		seen := make(map[int64]struct{}, k)
+		for i, label := range labels {
+			if label < 0 {
+				continue
+			}
+			group := groupOf(label)
+			if _, ok := seen[group]; ok {
+				continue
+			}
+			seen[group] = struct{}{}
+			results = append(results, GroupResult{Group: group, Label: label, Distance: distances[i]})
+			if int64(len(results)) == k {
+				break
+			}
+		}
+
+		if int64(len(results)) == k || fetch >= limit {
+			return results, nil
+		}
+		fetch *= 2
+	}
+}
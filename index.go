@@ -10,11 +10,20 @@ package faiss
 #include <faiss/c_api/index_io_c.h>
 #include <faiss/c_api/impl/AuxIndexStructures_c.h>
 #include <faiss/c_api/index_factory_c.h>
+#include <faiss/c_api/IndexFlat_c.h>
+#include <faiss/c_api/IndexIVF_c.h>
+#include "faiss_ext.h"
 */
 import "C"
 import (
+	"context"
+	"errors"
 	"fmt"
 	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -29,6 +38,18 @@ type Index interface {
 	// training.
 	IsTrained() bool
 
+	// RequiresTraining reports whether the index type must be trained before
+	// vectors can be added. Unlike IsTrained it stays true after training.
+	// IVF indexes require training; for index types whose requirement isn't
+	// known it reports !IsTrained().
+	RequiresTraining() bool
+
+	// MinTrainingPoints returns the minimum number of training vectors:
+	// nlist for IVF indexes, also at least 2^nbits for IVFPQ, 0 for indexes
+	// that don't require training and 1 when the minimum is not known.
+	// k-means gives better centroids with 39 or more points per centroid.
+	MinTrainingPoints() int
+
 	// Ntotal returns the number of indexed vectors.
 	Ntotal() int64
 
@@ -41,23 +62,166 @@ type Index interface {
 
 	// Add adds vectors to the index.
 	// The vectors are stored with sequential IDs starting from the current Ntotal.
+	//
+	// FAISS always copies added vectors: flat indexes append them to their
+	// own code storage, and other indexes encode them. The cgo rules also
+	// forbid C code from keeping Go memory after a call returns, so x can be
+	// reused or released as soon as Add returns, and there is no zero-copy
+	// variant.
 	Add(x []float32) error
 
+	// AddReturningIDs is like Add, but returns the sequential IDs assigned to
+	// the vectors. Concurrent adds through this index are serialized, so the
+	// returned IDs are exactly those of x.
+	AddReturningIDs(x []float32) ([]int64, error)
+
+	// AddVectors2D adds vectors given as rows. Every row must have length D;
+	// otherwise nothing is added and the error names the first bad row.
+	AddVectors2D(vectors [][]float32) error
+
 	// AddWithIDs is like Add, but stores xids instead of sequential IDs.
 	// This allows custom ID assignment for vectors.
 	AddWithIDs(x []float32, xids []int64) error
 
 	// Search queries the index with the vectors in x.
 	// Returns the IDs of the k nearest neighbors for each query vector and the
-	// corresponding distances.
+	// corresponding distances. Searching an index holding no vectors returns
+	// ErrEmptyIndex.
+	//
+	// k is clamped to Ntotal, so the results hold min(k, Ntotal) entries per
+	// query rather than being padded; use len(labels)/nq as the stride.
+	// Approximate indexes may still return fewer neighbors than that, with
+	// label -1 for the missing ones.
 	Search(x []float32, k int64) (distances []float32, labels []int64, err error)
 
+	// KthNeighborDistance returns the distance from each query to its k-th
+	// nearest neighbor, the last column of the Search distances, as used by
+	// kNN outlier scores. k must not exceed Ntotal. If an approximate index
+	// finds fewer than k neighbors, the distance is the placeholder FAISS
+	// reports for missing results.
+	KthNeighborDistance(x []float32, k int64) ([]float32, error)
+
+	// SearchWithOptions is Search with parameters applied to this call only,
+	// such as nprobe or efSearch, so that concurrent searches can use
+	// different settings without changing the index. Unset options keep the
+	// index settings.
+	SearchWithOptions(x []float32, k int64, opts SearchOptions) (distances []float32, labels []int64, err error)
+
+	// SearchThreshold searches for the k nearest neighbors of the single
+	// query x and keeps only those within threshold. The direction follows
+	// the metric: for MetricInnerProduct results with a similarity >=
+	// threshold are kept, for all other metrics results with a distance <=
+	// threshold. At most k results are returned, best first.
+	SearchThreshold(x []float32, k int64, threshold float32) (distances []float32, labels []int64, err error)
+
+	// Search2D is like Search for queries given as rows. It returns the
+	// neighbors of each query, best first; when fewer than k vectors are
+	// found the list is shorter than k.
+	Search2D(queries [][]float32, k int64) ([][]Neighbor, error)
+
+	// SearchOne searches for the k nearest neighbors of the single query x,
+	// which must have length D. Like Search2D it returns fewer than k
+	// neighbors when fewer are found.
+	SearchOne(query []float32, k int64) ([]Neighbor, error)
+
+	// SearchComposite searches with the query built by BuildQuery from
+	// positives and negatives, using the index metric. All vectors must have
+	// length D.
+	SearchComposite(positives, negatives [][]float32, negWeight float32, k int64) ([]Neighbor, error)
+
+	// SearchDiverse returns up to k neighbors of the single query x, best
+	// first, skipping any neighbor whose vector is within Euclidean distance
+	// minDist of an already selected one; minDist = 0 collapses exact
+	// duplicates. At most min(MaxK, Ntotal) candidates are considered.
+	// Candidates are reconstructed, giving IVF indexes a direct map the
+	// first time, as RerankIDs does.
+	SearchDiverse(x []float32, k int64, minDist float32) ([]Neighbor, error)
+
+	// SearchDistinct returns up to k neighbors of the single query x with
+	// distinct labels, best first. When the same ID was added several times
+	// only its best entry is kept, and the search is repeated with a larger
+	// k until k distinct labels are found or min(MaxK, Ntotal) candidates
+	// were searched.
+	SearchDistinct(x []float32, k int64) ([]Neighbor, error)
+
+	// SearchWithPayloads searches like SearchOne and joins each hit with its
+	// payload, resolved by a single call to resolver. Hits without a payload
+	// are kept with a nil Payload, unless DropMissingPayloads is given.
+	SearchWithPayloads(x []float32, k int64, resolver PayloadResolver, opts ...PayloadOption) ([]PayloadHit, error)
+
+	// RerankIDs ranks the externally provided candidateIDs, for example from
+	// a keyword search, by their distance to query under the index metric and
+	// returns the best k, without scanning the index. Candidates that are
+	// not in the index are returned in missing; duplicates are ranked once.
+	// If k exceeds the number of candidates found, all are returned ranked.
+	// The candidates are reconstructed, giving IVF indexes a direct map
+	// the first time, which then costs about 16 bytes per vector. Failing
+	// to reconstruct a stored candidate, e.g. in an "IDMap" index, which
+	// can't reconstruct by ID unlike "IDMap2", is an error.
+	RerankIDs(query []float32, candidateIDs []int64, k int64) (labels []int64, distances []float32, missing []int64, err error)
+
 	// SearchBatch queries the index with multiple vectors in batches
 	// Returns distances and labels for each query vector
-	SearchBatch(queries []float32, k int64, batchSize int) (distances [][]float32, labels [][]int64, err error)
-
-	// AddBatch adds vectors in batches for better memory management and performance
-	AddBatch(vectors []float32, batchSize int) error
+	SearchBatch(queries []float32, k int64, batchSize int, opts ...BatchOption) (distances [][]float32, labels [][]int64, err error)
+
+	// SearchBatchFunc is a streaming variant of SearchBatch: instead of
+	// collecting all results, it calls fn for each query as soon as its batch
+	// completes. The slices passed to fn are reused between batches and are
+	// only valid during the call. An error returned by fn aborts the search.
+	SearchBatchFunc(queries []float32, k int64, batchSize int, fn func(queryIdx int, distances []float32, labels []int64) error) error
+
+	// SearchWithDeadline is like Search, but stops when deadline passes.
+	// Queries are searched in order, in sub-batches that start small and
+	// grow while ahead of schedule, and the clock is checked between them.
+	// completed is the number of leading queries searched: result rows
+	// [0, completed) are valid, later rows hold -1 labels. When not all
+	// queries completed, err is a *DeadlineError matching
+	// ErrDeadlineExceeded. A single C call can't be interrupted, so a
+	// sub-batch started before the deadline may end after it.
+	SearchWithDeadline(x []float32, k int64, deadline time.Time) (distances []float32, labels []int64, completed int, err error)
+
+	// RangeSearchBatch returns, for each query, every stored vector within
+	// radius, closest first: for MetricInnerProduct those with a similarity
+	// > radius, for L2 those with a squared distance < radius. Queries are
+	// searched batchSize at a time, freeing each batch's C results before
+	// the next, so memory is bounded by the results themselves.
+	RangeSearchBatch(queries []float32, radius float32, batchSize int) ([]RangeResult, error)
+
+	// AddBatch adds vectors in batches for better memory management and performance.
+	// The vectors are validated once, then each batch costs a single cgo call.
+	AddBatch(vectors []float32, batchSize int, opts ...BatchOption) error
+
+	// AddFloat64 is Add for float64 vectors, which are converted to float32:
+	// FAISS stores float32, so precision beyond about 7 significant digits is
+	// lost, and values outside the float32 range become infinite.
+	AddFloat64(x []float64) error
+
+	// SearchFloat64 is Search for float64 queries, converted to float32 with
+	// the same precision loss as AddFloat64.
+	SearchFloat64(x []float64, k int64) (distances []float32, labels []int64, err error)
+
+	// AddFloat16 is Add for IEEE 754 half-precision vectors, given by their
+	// bits. They are converted to float32 a bounded chunk at a time instead
+	// of all at once; if adding a chunk fails, the chunks before it stay
+	// added.
+	AddFloat16(x []uint16) error
+
+	// SearchFloat16 is Search for half-precision queries, converted to
+	// float32 a bounded chunk at a time like AddFloat16.
+	SearchFloat16(x []uint16, k int64) (distances []float32, labels []int64, err error)
+
+	// AddFromMmap adds countVectors vectors of the .fvecs file at path,
+	// starting at vector offsetVectors, or all the vectors after it if
+	// countVectors is negative. The file is memory-mapped and read by FAISS
+	// batch by batch, without copying it into Go memory, and unmapped before
+	// returning. Every vector must have the dimension of the index. The
+	// batches before a failing one stay added. Memory mapping is only
+	// supported on Unix systems.
+	AddFromMmap(path string, offsetVectors, countVectors int64) error
+
+	// AddWithIDsBatch is AddWithIDs in batches, like AddBatch. The vectors
+	// and IDs are chunked together, so each batch keeps its own IDs.
+	AddWithIDsBatch(x []float32, xids []int64, batchSize int, opts ...BatchOption) error
 
 	// Reset removes all vectors from the index.
 	Reset() error
@@ -66,29 +230,195 @@ type Index interface {
 	// Returns the number of elements removed and error.
 	RemoveIDs(sel *IDSelector) (int, error)
 
-	// Delete frees the memory used by the index.
+	// RemoveIDsSlice removes the vectors with the given IDs, without having
+	// to build and free an IDSelector. Duplicate IDs are ignored and negative
+	// IDs are rejected. Returns the number of elements removed.
+	RemoveIDsSlice(ids []int64) (int, error)
+
+	// RemoveIDRange removes the vectors with IDs in [start, end), such as a
+	// time window of timestamp IDs. Returns the number of elements removed.
+	RemoveIDRange(start, end int64) (int, error)
+
+	// RemoveIDsBatch removes the given IDs from the index and reports which of
+	// them were present (removed) and which were not (missing).
+	// Presence is checked against the IDs stored by flat, IVF and IDMap
+	// indexes; other index types return an error and remove nothing.
+	RemoveIDsBatch(ids []int64) (removed []int64, missing []int64, err error)
+
+	// Compact rebuilds the index storage densely, releasing memory left over
+	// by removals. The stored vectors are decoded and re-added to a fresh
+	// index in batches of DefaultAddBatchSize, keeping their IDs and IVF
+	// lists, so it takes O(n) time and holds both copies of the stored
+	// vectors until the old index is freed. Adds through this index wait
+	// for it to finish; like Delete, it must not run concurrently with
+	// searches, which would use the replaced index.
+	Compact() error
+
+	// FragmentationInfo reports how much storage is held beyond the stored
+	// vectors and, for IVF indexes, how unbalanced the inverted lists are,
+	// to help decide when Compact is worthwhile.
+	FragmentationInfo() (FragmentationReport, error)
+
+	// MemoryUsage estimates the memory held by the index data structures in
+	// bytes: stored codes, IVF lists and centroids, PQ codebooks, HNSW links
+	// and IDMap IDs. For other index types it falls back to
+	// ExactSerializedSize.
+	MemoryUsage() (int64, error)
+
+	// ExactSerializedSize returns the size of the index as written by
+	// WriteIndex, without buffering it. It is the most accurate measure of
+	// the index size, but costs a full serialization pass.
+	ExactSerializedSize() (int64, error)
+
+	// Frozen makes the index immutable and returns a search-only handle that
+	// can be shared by goroutines without locking. Afterwards every mutating
+	// method of the index, such as Add, Train, Reset or the search parameter
+	// setters, fails with ErrIndexFrozen; freezing can't be undone. The
+	// direct map of IVF indexes is not enabled once frozen, so Reconstruct
+	// on them only works if it was enabled before, e.g. by RerankIDs.
+	// The index must not be deleted while the handle is in use.
+	Frozen() (ReadOnlyIndex, error)
+
+	// Reconstruct returns a copy of the stored vector with the given ID.
+	// Not all index types support reconstruction.
+	Reconstruct(key int64) ([]float32, error)
+
+	// AllVectors returns a copy of every stored vector in ID order, for
+	// indexes using sequential IDs that support reconstruction. It is the
+	// safe counterpart of IndexFlat.Xb. IVF indexes are read list by list,
+	// without a direct map.
+	AllVectors() ([]float32, error)
+
+	// ComputeDistance returns the distance between query and the stored vector
+	// with the given ID under the index's metric, as Search would report it.
+	// For MetricInnerProduct the value is a similarity: larger means closer.
+	// The index must support reconstruction.
+	ComputeDistance(query []float32, id int64) (float32, error)
+
+	// ComputeDistanceToIDs is like ComputeDistance for several IDs at once.
+	ComputeDistanceToIDs(query []float32, ids []int64) ([]float32, error)
+
+	// MetricArg returns the metric argument, the p of MetricLp.
+	MetricArg() float32
+
+	// SetMetricArg sets p for an index created with MetricLp. p must be
+	// positive; it should be set before adding vectors to an IVF index, whose
+	// assignment to clusters depends on it.
+	SetMetricArg(p float32) error
+
+	// Warmup prepares an index for serving so the first queries after
+	// loading are not slowed down. TouchAll pre-faults the pages of an index
+	// loaded with IOFlagMmap and is a no-op on indexes fully held in memory;
+	// SampleQueries runs on any index, also priming the caches and lazily
+	// built structures of HNSW and IVF indexes.
+	Warmup(strategy WarmupStrategy) (WarmupStats, error)
+
+	// WarmupContext is like Warmup but can be cancelled through ctx.
+	WarmupContext(ctx context.Context, strategy WarmupStrategy) (WarmupStats, error)
+
+	// Delete frees the memory used by the index. Afterwards the methods
+	// returning an error fail with ErrIndexClosed. It is safe to call more
+	// than once.
 	Delete()
 
 	// Internal method to get C pointer
 	cPtr() *C.FaissIndex
+
+	// Internal method to get the wrapper owning the C pointer
+	native() *faissIndex
+}
+
+// clampK limits k to the number of vectors in the index: FAISS pads results
+// beyond ntotal with label -1, which only wastes memory.
+func clampK(k, ntotal int64) int64 {
+	if k > ntotal {
+		return ntotal
+	}
+	return k
+}
+
+// Neighbor is a search result: the label of a stored vector and its distance
+// to the query under the index metric.
+type Neighbor struct {
+	Label    int64
+	Distance float32
+}
+
+// FragmentationReport is returned by FragmentationInfo.
+type FragmentationReport struct {
+	Ntotal int64 // Number of stored vectors
+	// Capacity is the number of vectors the storage can hold without
+	// reallocating, or -1 if the index type doesn't expose its storage.
+	Capacity int64
+	// FreeSlots is Capacity - Ntotal: space left by removals or by growth
+	// ahead of future adds. It is 0 when Capacity is unknown.
+	FreeSlots int64
+
+	// Inverted list statistics, only set for IVF indexes
+	NList            int     // Number of inverted lists
+	EmptyLists       int     // Lists holding no vectors
+	ListSizeMean     float64 // Mean number of vectors per list
+	ListSizeVariance float64 // Variance of the number of vectors per list
+	// ImbalanceFactor is the FAISS imbalance factor, nlist * sum(size^2) /
+	// ntotal^2: 1 when all lists have the same size, growing as vectors
+	// concentrate in fewer lists. It is 0 for empty indexes.
+	ImbalanceFactor float64
+}
+
+// RangeResult holds the results of RangeSearchBatch for one query.
+type RangeResult struct {
+	Labels    []int64
+	Distances []float32
 }
 
 // faissIndex is the main implementation of the Index interface
 type faissIndex struct {
-	idx *C.FaissIndex
+	idx      *C.FaissIndex
+	mu       sync.Mutex  // Serializes Delete and adds
+	mmapPath string      // File backing the index when loaded with IOFlagMmap
+	frozen   atomic.Bool // Set by Frozen; mutations then fail with ErrIndexFrozen
 }
 
 // NewFaissIndex creates a new index wrapper around a C FaissIndex
 func NewFaissIndex(cIdx *C.FaissIndex) Index {
+	return newFaissIndex(cIdx)
+}
+
+// newFaissIndex wraps cIdx, registering the finalizer and leak tracking.
+func newFaissIndex(cIdx *C.FaissIndex) *faissIndex {
 	idx := &faissIndex{idx: cIdx}
-	runtime.SetFinalizer(idx, (*faissIndex).Delete)
+	runtime.SetFinalizer(idx, (*faissIndex).finalize)
+	trackObject(unsafe.Pointer(idx), "Index")
 	return idx
 }
 
+// closedIndex replaces the embedded index of a typed wrapper once it is
+// closed, so that every method of the wrapper returns ErrIndexClosed instead
+// of reaching the freed index.
+var closedIndex = &faissIndex{}
+
+// closed reports whether the index was freed, through this or any other
+// reference to it. It is safe to call on a nil receiver.
+func (idx *faissIndex) closed() bool {
+	return idx == nil || idx.idx == nil
+}
+
+// checkMutable returns ErrIndexFrozen if the index was frozen by Frozen.
+func (idx *faissIndex) checkMutable() error {
+	if idx.frozen.Load() {
+		return ErrIndexFrozen
+	}
+	return nil
+}
+
 func (idx *faissIndex) cPtr() *C.FaissIndex {
 	return idx.idx
 }
 
+func (idx *faissIndex) native() *faissIndex {
+	return idx
+}
+
 func (idx *faissIndex) D() int {
 	if idx.idx == nil {
 		return 0
@@ -103,6 +433,35 @@ func (idx *faissIndex) IsTrained() bool {
 	return C.faiss_Index_is_trained(idx.idx) != 0
 }
 
+func (idx *faissIndex) RequiresTraining() bool {
+	if idx.idx == nil {
+		return false
+	}
+	if C.faiss_IndexIVF_cast(idx.idx) != nil {
+		return true
+	}
+	return !idx.IsTrained()
+}
+
+func (idx *faissIndex) MinTrainingPoints() int {
+	if !idx.RequiresTraining() {
+		return 0
+	}
+
+	ivf := C.faiss_IndexIVF_cast(idx.idx)
+	if ivf == nil {
+		return 1
+	}
+
+	points := int(C.faiss_IndexIVF_nlist(ivf))
+	if C.goss_IndexIVFPQ_check(idx.idx) == 0 {
+		if ksub := 1 << int(C.goss_IndexIVFPQ_nbits(idx.idx)); ksub > points {
+			points = ksub
+		}
+	}
+	return points
+}
+
 func (idx *faissIndex) Ntotal() int64 {
 	if idx.idx == nil {
 		return 0
@@ -117,9 +476,39 @@ func (idx *faissIndex) MetricType() int {
 	return int(C.faiss_Index_metric_type(idx.idx))
 }
 
+func (idx *faissIndex) MetricArg() float32 {
+	if idx.idx == nil {
+		return 0
+	}
+	return float32(C.goss_Index_metric_arg(idx.idx))
+}
+
+func (idx *faissIndex) SetMetricArg(p float32) error {
+	if idx.idx == nil {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	if metric := idx.MetricType(); metric != MetricLp {
+		return fmt.Errorf("metric argument only applies to MetricLp, index metric is %d", metric)
+	}
+
+	if !(p > 0) {
+		return fmt.Errorf("p must be positive, got %v", p)
+	}
+
+	C.goss_Index_set_metric_arg(idx.idx, C.float(p))
+	return nil
+}
+
 func (idx *faissIndex) Train(x []float32) error {
 	if idx.idx == nil {
-		return ErrNullPointer
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
 	}
 
 	d := idx.D()
@@ -127,37 +516,97 @@ func (idx *faissIndex) Train(x []float32) error {
 		return wrapError(err, "train vectors validation")
 	}
 
+	if seed, ok := currentRandomSeed(); ok && C.faiss_IndexIVF_cast(idx.idx) != nil {
+		verbose := C.faiss_Index_verbose(idx.idx) != 0
+		return trainIVF(idx.idx, x, TrainOptions{Seed: seed, Verbose: verbose})
+	}
+
 	n := len(x) / d
-	if c := C.faiss_Index_train(idx.idx, C.idx_t(n), (*C.float)(&x[0])); c != 0 {
+	if c := C.goss_Index_train(idx.idx, C.idx_t(n), (*C.float)(&x[0])); c != 0 {
 		return wrapError(getLastError(), "train operation")
 	}
 	return nil
 }
 
 func (idx *faissIndex) Add(x []float32) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	_, err := idx.add(x)
+	return err
+}
+
+func (idx *faissIndex) AddVectors2D(vectors [][]float32) error {
 	if idx.idx == nil {
-		return ErrNullPointer
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	if len(vectors) == 0 {
+		return wrapError(ErrEmptyVectors, "add 2D vectors validation")
+	}
+
+	d := idx.D()
+	flat := make([]float32, 0, len(vectors)*d)
+	for i, row := range vectors {
+		if len(row) != d {
+			return fmt.Errorf("row %d: %w", i, &DimensionMismatchError{Got: len(row), Want: d})
+		}
+		flat = append(flat, row...)
+	}
+
+	return idx.Add(flat)
+}
+
+func (idx *faissIndex) AddReturningIDs(x []float32) ([]int64, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.add(x)
+}
+
+// add adds x and returns the sequential IDs assigned. idx.mu must be held.
+func (idx *faissIndex) add(x []float32) ([]int64, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return nil, err
 	}
 
 	d := idx.D()
 	if err := ValidateVectors(x, d); err != nil {
-		return wrapError(err, "add vectors validation")
+		return nil, wrapError(err, "add vectors validation")
 	}
 
 	if !idx.IsTrained() {
-		return wrapError(ErrIndexNotTrained, "add operation")
+		return nil, wrapError(ErrIndexNotTrained, "add operation")
 	}
 
 	n := len(x) / d
-	if c := C.faiss_Index_add(idx.idx, C.idx_t(n), (*C.float)(&x[0])); c != 0 {
-		return wrapError(getLastError(), "add operation")
+	start := idx.Ntotal()
+	if c := C.goss_Index_add(idx.idx, C.idx_t(n), (*C.float)(&x[0])); c != 0 {
+		return nil, wrapError(getLastError(), "add operation")
 	}
-	return nil
+
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = start + int64(i)
+	}
+	return ids, nil
 }
 
 func (idx *faissIndex) AddWithIDs(x []float32, xids []int64) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
 	if idx.idx == nil {
-		return ErrNullPointer
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
 	}
 
 	d := idx.D()
@@ -174,7 +623,7 @@ func (idx *faissIndex) AddWithIDs(x []float32, xids []int64) error {
 		return wrapError(fmt.Errorf("number of IDs (%d) doesn't match number of vectors (%d)", len(xids), n), "add_with_ids")
 	}
 
-	if c := C.faiss_Index_add_with_ids(
+	if c := C.goss_Index_add_with_ids(
 		idx.idx,
 		C.idx_t(n),
 		(*C.float)(&x[0]),
@@ -189,7 +638,23 @@ func (idx *faissIndex) Search(x []float32, k int64) (
 	distances []float32, labels []int64, err error,
 ) {
 	if idx.idx == nil {
-		return nil, nil, ErrNullPointer
+		return nil, nil, ErrIndexClosed
+	}
+
+	if err := ValidateK(k, idx.Ntotal()); err != nil {
+		return nil, nil, wrapError(err, "search k validation")
+	}
+
+	return idx.search(x, k)
+}
+
+// search is Search without the MaxK limit, for internal searches of every
+// stored vector whose k is bounded by Ntotal instead.
+func (idx *faissIndex) search(x []float32, k int64) (
+	distances []float32, labels []int64, err error,
+) {
+	if idx.idx == nil {
+		return nil, nil, ErrIndexClosed
 	}
 
 	d := idx.D()
@@ -197,50 +662,329 @@ func (idx *faissIndex) Search(x []float32, k int64) (
 		return nil, nil, wrapError(err, "search vectors validation")
 	}
 
-	if err := ValidateK(k); err != nil {
-		return nil, nil, wrapError(err, "search k validation")
-	}
-
 	if !idx.IsTrained() {
 		return nil, nil, wrapError(ErrIndexNotTrained, "search operation")
 	}
 
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return nil, nil, wrapError(ErrEmptyIndex, "search operation")
+	}
+	k = clampK(k, ntotal)
+
 	n := len(x) / d
 	distances = make([]float32, int64(n)*k)
 	labels = make([]int64, int64(n)*k)
+	if err := idx.searchInto(x, k, distances, labels); err != nil {
+		return nil, nil, err
+	}
+	return
+}
 
-	if c := C.faiss_Index_search(
+// searchInto searches the validated queries x with k as given, which must
+// not exceed Ntotal, writing the results to distances and labels.
+func (idx *faissIndex) searchInto(x []float32, k int64, distances []float32, labels []int64) error {
+	if c := C.goss_Index_search(
 		idx.idx,
-		C.idx_t(n),
+		C.idx_t(len(x)/idx.D()),
 		(*C.float)(&x[0]),
 		C.idx_t(k),
 		(*C.float)(&distances[0]),
 		(*C.idx_t)(&labels[0]),
 	); c != 0 {
-		err = wrapError(getLastError(), "search operation")
-		return nil, nil, err
+		return wrapError(getLastError(), "search operation")
 	}
-	return
+	return nil
+}
+
+func (idx *faissIndex) KthNeighborDistance(x []float32, k int64) ([]float32, error) {
+	if ntotal := idx.Ntotal(); ntotal > 0 && k > ntotal {
+		return nil, fmt.Errorf("%w: index holds %d vectors, fewer than k=%d", ErrInvalidK, ntotal, k)
+	}
+
+	distances, _, err := idx.Search(x, k)
+	if err != nil {
+		return nil, err
+	}
+
+	nq := len(x) / idx.D()
+	stride := len(distances) / nq
+	kth := make([]float32, nq)
+	for i := range kth {
+		kth[i] = distances[(i+1)*stride-1]
+	}
+	return kth, nil
+}
+
+func (idx *faissIndex) SearchThreshold(x []float32, k int64, threshold float32) (
+	distances []float32, labels []int64, err error,
+) {
+	if idx.idx == nil {
+		return nil, nil, ErrIndexClosed
+	}
+
+	if d := idx.D(); len(x) != d {
+		return nil, nil, &DimensionMismatchError{Got: len(x), Want: d}
+	}
+
+	allDistances, allLabels, err := idx.Search(x, k)
+	if err != nil {
+		return nil, nil, wrapError(err, "threshold search")
+	}
+
+	metric := idx.MetricType()
+	for i, label := range allLabels {
+		if label < 0 {
+			break // Fewer than k results
+		}
+		dist := allDistances[i]
+		if IsCloser(metric, threshold, dist) {
+			break // Results are sorted, so the rest are beyond the threshold
+		}
+		distances = append(distances, dist)
+		labels = append(labels, label)
+	}
+
+	return distances, labels, nil
+}
+
+func (idx *faissIndex) SearchOne(query []float32, k int64) ([]Neighbor, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+
+	if d := idx.D(); len(query) != d {
+		return nil, &DimensionMismatchError{Got: len(query), Want: d}
+	}
+
+	results, err := idx.Search2D([][]float32{query}, k)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+func (idx *faissIndex) SearchComposite(positives, negatives [][]float32, negWeight float32, k int64) ([]Neighbor, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+
+	query, err := BuildQuery(positives, negatives, negWeight, idx.MetricType())
+	if err != nil {
+		return nil, wrapError(err, "composite search query")
+	}
+
+	return idx.SearchOne(query, k)
+}
+
+func (idx *faissIndex) SearchDiverse(x []float32, k int64, minDist float32) ([]Neighbor, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+
+	if err := ValidateK(k, idx.Ntotal()); err != nil {
+		return nil, wrapError(err, "diverse search k validation")
+	}
+
+	if minDist < 0 {
+		return nil, fmt.Errorf("minDist must be non-negative, got %v", minDist)
+	}
+
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return nil, wrapError(ErrEmptyIndex, "diverse search")
+	}
+
+	// Compare squared distances, as MetricL2 does
+	minDist2 := minDist * minDist
+
+	// Over-fetch, doubling until k diverse results are found or as many
+	// candidates as a search returns, min(MaxK, Ntotal), have been searched.
+	limit := ntotal
+	if limit > MaxK {
+		limit = MaxK
+	}
+
+	if err := enableDirectMap(idx); err != nil {
+		return nil, wrapError(err, "diverse search")
+	}
+
+	d := idx.D()
+	fetch := k * 4
+	for {
+		if fetch > limit {
+			fetch = limit
+		}
+
+		candidates, err := idx.SearchOne(x, fetch)
+		if err != nil {
+			return nil, wrapError(err, "diverse search")
+		}
+
+		ids := make([]int64, len(candidates))
+		for i, n := range candidates {
+			ids[i] = n.Label
+		}
+		vectors := make([]float32, len(ids)*d)
+		if err := reconstructBatch(idx, ids, vectors); err != nil {
+			return nil, wrapError(err, "diverse search reconstruction")
+		}
+
+		results := make([]Neighbor, 0, k)
+		selected := make([][]float32, 0, k)
+		for i, n := range candidates {
+			vec := vectors[i*d : (i+1)*d]
+
+			diverse := true
+			for _, s := range selected {
+				if dist, _ := computeDistance(MetricL2, vec, s); dist <= minDist2 {
+					diverse = false
+					break
+				}
+			}
+			if !diverse {
+				continue
+			}
+
+			results = append(results, n)
+			selected = append(selected, vec)
+			if int64(len(results)) == k {
+				break
+			}
+		}
+
+		if int64(len(results)) == k || fetch >= limit {
+			return results, nil
+		}
+		fetch *= 2
+	}
+}
+
+func (idx *faissIndex) SearchDistinct(x []float32, k int64) ([]Neighbor, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+
+	if err := ValidateK(k, idx.Ntotal()); err != nil {
+		return nil, wrapError(err, "distinct search k validation")
+	}
+
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return nil, wrapError(ErrEmptyIndex, "distinct search")
+	}
+
+	// Over-fetch, doubling until k distinct labels are found or as many
+	// candidates as a search returns, min(MaxK, Ntotal), have been searched.
+	limit := ntotal
+	if limit > MaxK {
+		limit = MaxK
+	}
+
+	fetch := k
+	for {
+		if fetch > limit {
+			fetch = limit
+		}
+
+		candidates, err := idx.SearchOne(x, fetch)
+		if err != nil {
+			return nil, wrapError(err, "distinct search")
+		}
+
+		// Results are sorted by the index metric, so the first entry seen
+		// for a label is its best one.
+		results := make([]Neighbor, 0, k)
+		seen := make(map[int64]struct{}, k)
+		for _, n := range candidates {
+			if _, ok := seen[n.Label]; ok {
+				continue
+			}
+			seen[n.Label] = struct{}{}
+			results = append(results, n)
+			if int64(len(results)) == k {
+				break
+			}
+		}
+
+		if int64(len(results)) == k || fetch >= limit {
+			return results, nil
+		}
+		fetch *= 2
+	}
+}
+
+func (idx *faissIndex) Search2D(queries [][]float32, k int64) ([][]Neighbor, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+
+	if len(queries) == 0 {
+		return nil, wrapError(ErrEmptyVectors, "search 2D queries validation")
+	}
+
+	d := idx.D()
+	flat := make([]float32, 0, len(queries)*d)
+	for i, row := range queries {
+		if len(row) != d {
+			return nil, fmt.Errorf("query %d: %w", i, &DimensionMismatchError{Got: len(row), Want: d})
+		}
+		flat = append(flat, row...)
+	}
+
+	distances, labels, err := idx.Search(flat, k)
+	if err != nil {
+		return nil, err
+	}
+
+	// Search clamps k to Ntotal
+	k = int64(len(labels) / len(queries))
+
+	results := make([][]Neighbor, len(queries))
+	for i := range queries {
+		neighbors := make([]Neighbor, 0, k)
+		for j := int64(i) * k; j < int64(i+1)*k; j++ {
+			if labels[j] < 0 {
+				break
+			}
+			neighbors = append(neighbors, Neighbor{Label: labels[j], Distance: distances[j]})
+		}
+		results[i] = neighbors
+	}
+
+	return results, nil
 }
 
-func (idx *faissIndex) SearchBatch(queries []float32, k int64, batchSize int) (distances [][]float32, labels [][]int64, err error) {
+func (idx *faissIndex) SearchBatch(queries []float32, k int64, batchSize int, opts ...BatchOption) (distances [][]float32, labels [][]int64, err error) {
 	if idx.idx == nil {
-		return nil, nil, ErrNullPointer
+		return nil, nil, ErrIndexClosed
 	}
 
-	if batchSize <= 0 {
-		batchSize = DefaultSearchBatchSize
+	batchSize, err = searchBatchSize(batchSize)
+	if err != nil {
+		return nil, nil, err
 	}
+	o := applyBatchOptions(opts)
 
 	d := idx.D()
 	if err := ValidateVectors(queries, d); err != nil {
 		return nil, nil, wrapError(err, "search batch queries validation")
 	}
 
+	if err := ValidateK(k, idx.Ntotal()); err != nil {
+		return nil, nil, wrapError(err, "search batch k validation")
+	}
+
 	if !idx.IsTrained() {
 		return nil, nil, wrapError(ErrIndexNotTrained, "search batch operation")
 	}
 
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return nil, nil, wrapError(ErrEmptyIndex, "search batch operation")
+	}
+	k = clampK(k, ntotal)
+
 	totalQueries := len(queries) / d
 	if totalQueries == 0 {
 		return make([][]float32, 0), make([][]int64, 0), nil
@@ -281,63 +1025,331 @@ func (idx *faissIndex) SearchBatch(queries []float32, k int64, batchSize int) (d
 			distances[queryIdx] = batchDistances[start:end]
 			labels[queryIdx] = batchLabels[start:end]
 		}
+
+		if o.onProgress != nil {
+			o.onProgress(end, totalQueries)
+		}
 	}
 
 	return distances, labels, nil
 }
 
-func (idx *faissIndex) AddBatch(vectors []float32, batchSize int) error {
+func (idx *faissIndex) SearchBatchFunc(queries []float32, k int64, batchSize int, fn func(queryIdx int, distances []float32, labels []int64) error) error {
 	if idx.idx == nil {
-		return ErrNullPointer
+		return ErrIndexClosed
+	}
+
+	if fn == nil {
+		return errors.New("search batch callback is nil")
 	}
 
-	if batchSize <= 0 {
-		batchSize = DefaultAddBatchSize
+	batchSize, err := searchBatchSize(batchSize)
+	if err != nil {
+		return err
 	}
 
 	d := idx.D()
-	if err := ValidateVectors(vectors, d); err != nil {
-		return wrapError(err, "add batch vectors validation")
+	if err := ValidateVectors(queries, d); err != nil {
+		return wrapError(err, "search batch queries validation")
+	}
+
+	if err := ValidateK(k, idx.Ntotal()); err != nil {
+		return wrapError(err, "search batch k validation")
 	}
 
 	if !idx.IsTrained() {
-		return wrapError(ErrIndexNotTrained, "add batch operation")
+		return wrapError(ErrIndexNotTrained, "search batch operation")
 	}
 
-	totalVectors := len(vectors) / d
-	if totalVectors == 0 {
-		return nil // Nothing to add
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return wrapError(ErrEmptyIndex, "search batch operation")
 	}
+	k = clampK(k, ntotal)
 
-	// Use optimal batch size if the provided one is too large
-	if batchSize > totalVectors {
-		batchSize = totalVectors
+	totalQueries := len(queries) / d
+	if batchSize > totalQueries {
+		batchSize = totalQueries
 	}
 
-	for i := 0; i < totalVectors; i += batchSize {
+	// Buffers reused by every batch
+	distances := make([]float32, int64(batchSize)*k)
+	labels := make([]int64, int64(batchSize)*k)
+
+	for i := 0; i < totalQueries; i += batchSize {
 		end := i + batchSize
-		if end > totalVectors {
-			end = totalVectors
+		if end > totalQueries {
+			end = totalQueries
 		}
 
-		batchStart := i * d
-		batchEnd := end * d
-		batch := vectors[batchStart:batchEnd]
+		if c := C.goss_Index_search(
+			idx.idx,
+			C.idx_t(end-i),
+			(*C.float)(&queries[i*d]),
+			C.idx_t(k),
+			(*C.float)(&distances[0]),
+			(*C.idx_t)(&labels[0]),
+		); c != 0 {
+			return wrapError(getLastError(), fmt.Sprintf("search batch %d-%d", i, end-1))
+		}
 
-		if err := idx.Add(batch); err != nil {
-			return wrapError(err, fmt.Sprintf("add batch %d-%d", i, end-1))
+		for j := 0; j < end-i; j++ {
+			start := int64(j) * k
+			if err := fn(i+j, distances[start:start+k], labels[start:start+k]); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func (idx *faissIndex) Reset() error {
+func (idx *faissIndex) RangeSearchBatch(queries []float32, radius float32, batchSize int) ([]RangeResult, error) {
 	if idx.idx == nil {
-		return ErrNullPointer
+		return nil, ErrIndexClosed
 	}
 
-	if c := C.faiss_Index_reset(idx.idx); c != 0 {
+	batchSize, err := searchBatchSize(batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(queries, d); err != nil {
+		return nil, wrapError(err, "range search queries validation")
+	}
+
+	if radius != radius { // NaN
+		return nil, ErrInvalidRadius
+	}
+	// Similarities can be negative, distances can't.
+	if !isSimilarity(idx.MetricType()) {
+		if err := ValidateRadius(radius); err != nil {
+			return nil, err
+		}
+	}
+
+	if !idx.IsTrained() {
+		return nil, wrapError(ErrIndexNotTrained, "range search operation")
+	}
+
+	nq := len(queries) / d
+	results := make([]RangeResult, nq)
+	for i := 0; i < nq; i += batchSize {
+		end := i + batchSize
+		if end > nq {
+			end = nq
+		}
+
+		if err := idx.rangeSearch(queries[i*d:end*d], radius, results[i:end]); err != nil {
+			return nil, wrapError(err, fmt.Sprintf("range search batch %d-%d", i, end-1))
+		}
+	}
+	return results, nil
+}
+
+// rangeSearch range searches the len(out) queries of x into out, sorting
+// each result closest first. The C result is freed before returning.
+func (idx *faissIndex) rangeSearch(x []float32, radius float32, out []RangeResult) error {
+	n := len(out)
+
+	var rsr *C.FaissRangeSearchResult
+	if c := C.faiss_RangeSearchResult_new(&rsr, C.idx_t(n)); c != 0 {
+		return getLastError()
+	}
+	defer C.faiss_RangeSearchResult_free(rsr)
+
+	if c := C.goss_Index_range_search(idx.idx, C.idx_t(n), (*C.float)(&x[0]), C.float(radius), rsr); c != 0 {
+		return getLastError()
+	}
+
+	var cLims *C.size_t
+	C.faiss_RangeSearchResult_lims(rsr, &cLims)
+	var cLabels *C.idx_t
+	var cDistances *C.float
+	C.faiss_RangeSearchResult_labels(rsr, &cLabels, &cDistances)
+
+	lims := unsafe.Slice(cLims, n+1)
+	total := int(lims[n])
+	var labels []int64
+	var distances []float32
+	if total > 0 {
+		labels = unsafe.Slice((*int64)(unsafe.Pointer(cLabels)), total)
+		distances = unsafe.Slice((*float32)(unsafe.Pointer(cDistances)), total)
+	}
+
+	metric := idx.MetricType()
+	for q := range out {
+		lo, hi := int(lims[q]), int(lims[q+1])
+		r := RangeResult{
+			Labels:    append([]int64(nil), labels[lo:hi]...),
+			Distances: append([]float32(nil), distances[lo:hi]...),
+		}
+		sort.Sort(rangeResultOrder{r: r, metric: metric})
+		out[q] = r
+	}
+	return nil
+}
+
+// rangeResultOrder sorts a RangeResult closest first.
+type rangeResultOrder struct {
+	r      RangeResult
+	metric int
+}
+
+func (o rangeResultOrder) Len() int { return len(o.r.Labels) }
+
+func (o rangeResultOrder) Less(i, j int) bool {
+	return IsCloser(o.metric, o.r.Distances[i], o.r.Distances[j])
+}
+
+func (o rangeResultOrder) Swap(i, j int) {
+	o.r.Labels[i], o.r.Labels[j] = o.r.Labels[j], o.r.Labels[i]
+	o.r.Distances[i], o.r.Distances[j] = o.r.Distances[j], o.r.Distances[i]
+}
+
+func (idx *faissIndex) AddBatch(vectors []float32, batchSize int, opts ...BatchOption) error {
+	if idx.idx == nil {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	batchSize, err := addBatchSize(batchSize)
+	if err != nil {
+		return err
+	}
+	o := applyBatchOptions(opts)
+
+	d := idx.D()
+	if err := ValidateVectors(vectors, d); err != nil {
+		return wrapError(err, "add batch vectors validation")
+	}
+
+	if !idx.IsTrained() {
+		return wrapError(ErrIndexNotTrained, "add batch operation")
+	}
+
+	totalVectors := len(vectors) / d
+	if totalVectors == 0 {
+		return nil // Nothing to add
+	}
+
+	// Use optimal batch size if the provided one is too large
+	if batchSize > totalVectors {
+		batchSize = totalVectors
+	}
+
+	for i := 0; i < totalVectors; i += batchSize {
+		end := i + batchSize
+		if end > totalVectors {
+			end = totalVectors
+		}
+
+		batchStart := i * d
+		batchEnd := end * d
+		batch := vectors[batchStart:batchEnd]
+
+		if err := idx.addBatch(batch, nil, end-i); err != nil {
+			return wrapError(err, fmt.Sprintf("add batch %d-%d", i, end-1))
+		}
+
+		if o.onProgress != nil {
+			o.onProgress(end, totalVectors)
+		}
+	}
+
+	return nil
+}
+
+func (idx *faissIndex) AddWithIDsBatch(x []float32, xids []int64, batchSize int, opts ...BatchOption) error {
+	if idx.idx == nil {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	batchSize, err := addBatchSize(batchSize)
+	if err != nil {
+		return err
+	}
+	o := applyBatchOptions(opts)
+
+	d := idx.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return wrapError(err, "add_with_ids batch vectors validation")
+	}
+
+	totalVectors := len(x) / d
+	if len(xids) != totalVectors {
+		return wrapError(fmt.Errorf("number of IDs (%d) doesn't match number of vectors (%d)", len(xids), totalVectors), "add_with_ids batch")
+	}
+
+	if !idx.IsTrained() {
+		return wrapError(ErrIndexNotTrained, "add_with_ids batch operation")
+	}
+
+	for i := 0; i < totalVectors; i += batchSize {
+		end := i + batchSize
+		if end > totalVectors {
+			end = totalVectors
+		}
+
+		if err := idx.addBatch(x[i*d:end*d], xids[i:end], end-i); err != nil {
+			return wrapError(err, fmt.Sprintf("add_with_ids batch %d-%d", i, end-1))
+		}
+
+		if o.onProgress != nil {
+			o.onProgress(end, totalVectors)
+		}
+	}
+
+	return nil
+}
+
+// addBatch adds the n vectors of x, with ids if not nil, in a single cgo
+// call. It skips the validation of Add and AddWithIDs, which AddBatch and
+// AddWithIDsBatch do once for all batches, and only checks what may change
+// between batches.
+func (idx *faissIndex) addBatch(x []float32, ids []int64, n int) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.idx == nil {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	if ids == nil {
+		if c := C.goss_Index_add(idx.idx, C.idx_t(n), (*C.float)(&x[0])); c != 0 {
+			return wrapError(getLastError(), "add operation")
+		}
+		return nil
+	}
+	if c := C.goss_Index_add_with_ids(
+		idx.idx,
+		C.idx_t(n),
+		(*C.float)(&x[0]),
+		(*C.idx_t)(&ids[0]),
+	); c != 0 {
+		return wrapError(getLastError(), "add_with_ids operation")
+	}
+	return nil
+}
+
+func (idx *faissIndex) Reset() error {
+	if idx.idx == nil {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	if c := C.faiss_Index_reset(idx.idx); c != 0 {
 		return wrapError(getLastError(), "reset operation")
 	}
 	return nil
@@ -345,7 +1357,10 @@ func (idx *faissIndex) Reset() error {
 
 func (idx *faissIndex) RemoveIDs(sel *IDSelector) (int, error) {
 	if idx.idx == nil {
-		return 0, ErrNullPointer
+		return 0, ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return 0, err
 	}
 
 	if sel == nil || sel.sel == nil {
@@ -353,20 +1368,398 @@ func (idx *faissIndex) RemoveIDs(sel *IDSelector) (int, error) {
 	}
 
 	var nRemoved C.size_t
-	if c := C.faiss_Index_remove_ids(idx.idx, sel.sel, &nRemoved); c != 0 {
-		return 0, wrapError(getLastError(), "remove_ids operation")
+	if c := C.goss_Index_remove_ids(idx.idx, sel.sel, &nRemoved); c != 0 {
+		return 0, wrapError(getLastExtError(), "remove_ids operation")
 	}
 	return int(nRemoved), nil
 }
 
+func (idx *faissIndex) RemoveIDsSlice(ids []int64) (int, error) {
+	if idx.idx == nil {
+		return 0, ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return 0, err
+	}
+
+	// Work on a copy: RemoveDuplicateIDs sorts in place.
+	cleanIDs := make([]int64, len(ids))
+	copy(cleanIDs, ids)
+	sel, err := CreateBatchSelector(cleanIDs, -1)
+	if err != nil {
+		return 0, wrapError(err, "remove_ids_slice selector")
+	}
+	defer sel.Delete()
+
+	return idx.RemoveIDs(sel)
+}
+
+func (idx *faissIndex) RemoveIDRange(start, end int64) (int, error) {
+	if idx.idx == nil {
+		return 0, ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return 0, err
+	}
+
+	sel, err := CreateRangeSelector(start, end, -1)
+	if err != nil {
+		return 0, wrapError(err, "remove_id_range selector")
+	}
+	defer sel.Delete()
+
+	return idx.RemoveIDs(sel)
+}
+
+func (idx *faissIndex) RemoveIDsBatch(ids []int64) (removed []int64, missing []int64, err error) {
+	if idx.idx == nil {
+		return nil, nil, ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	// Work on a sorted, deduplicated copy so the caller's slice is untouched.
+	cleanIDs := make([]int64, len(ids))
+	copy(cleanIDs, ids)
+	cleanIDs = RemoveDuplicateIDs(cleanIDs)
+
+	removed = make([]int64, 0, len(cleanIDs))
+	missing = make([]int64, 0)
+	found := make([]uint8, DefaultRemoveBatchSize)
+
+	// Process chunks from the highest IDs down: indexes with sequential IDs
+	// renumber the vectors after a removed one, but never those before it.
+	for end := len(cleanIDs); end > 0; end -= DefaultRemoveBatchSize {
+		start := end - DefaultRemoveBatchSize
+		if start < 0 {
+			start = 0
+		}
+
+		chunk := cleanIDs[start:end]
+		if c := C.goss_Index_contains(
+			idx.idx,
+			C.idx_t(len(chunk)),
+			(*C.idx_t)(&chunk[0]),
+			(*C.uint8_t)(&found[0]),
+		); c != 0 {
+			return nil, nil, wrapError(getLastExtError(), "remove_ids_batch membership")
+		}
+
+		present := make([]int64, 0, len(chunk))
+		for i, id := range chunk {
+			if found[i] != 0 {
+				present = append(present, id)
+			} else {
+				missing = append(missing, id)
+			}
+		}
+
+		if len(present) == 0 {
+			continue
+		}
+
+		sel, err := NewIDSelectorBatch(present)
+		if err != nil {
+			return nil, nil, wrapError(err, "remove_ids_batch selector")
+		}
+		n, err := idx.RemoveIDs(sel)
+		sel.Delete()
+		if err != nil {
+			return nil, nil, wrapError(err, fmt.Sprintf("remove_ids_batch %d-%d", cleanIDs[start], cleanIDs[end-1]))
+		}
+		if n < len(present) {
+			return nil, nil, fmt.Errorf("remove_ids_batch %d-%d: removed %d of %d present IDs", cleanIDs[start], cleanIDs[end-1], n, len(present))
+		}
+
+		removed = append(removed, present...)
+	}
+
+	sortIDs(removed)
+	sortIDs(missing)
+	return removed, missing, nil
+}
+
+func (idx *faissIndex) Compact() error {
+	// Held for the whole rebuild: an add between the copy and the swap
+	// would be lost with the old index.
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.idx == nil {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	// A refine index only references its base, which a clone would duplicate.
+	if C.faiss_IndexRefineFlat_cast(idx.idx) != nil {
+		return errors.New("compact is not supported for IndexRefineFlat")
+	}
+
+	batchSize, err := addBatchSize(0)
+	if err != nil {
+		return wrapError(err, "compact")
+	}
+
+	var cIdx *C.FaissIndex
+	if c := C.goss_Index_compact(idx.idx, C.idx_t(batchSize), &cIdx); c != 0 {
+		return wrapError(getLastExtError(), "compact")
+	}
+
+	C.faiss_Index_free(idx.idx)
+	idx.idx = cIdx
+	idx.mmapPath = ""
+	return nil
+}
+
+func (idx *faissIndex) FragmentationInfo() (FragmentationReport, error) {
+	if idx.idx == nil {
+		return FragmentationReport{}, ErrIndexClosed
+	}
+
+	report := FragmentationReport{
+		Ntotal:   idx.Ntotal(),
+		Capacity: int64(C.goss_Index_storage_capacity(idx.idx)),
+	}
+	if report.Capacity > report.Ntotal {
+		report.FreeSlots = report.Capacity - report.Ntotal
+	}
+
+	ivf := C.faiss_IndexIVF_cast(idx.idx)
+	if ivf == nil {
+		return report, nil
+	}
+
+	report.NList = int(C.faiss_IndexIVF_nlist(ivf))
+	if report.NList == 0 {
+		return report, nil
+	}
+
+	sizes := make([]float64, report.NList)
+	var sum float64
+	for i := range sizes {
+		sizes[i] = float64(C.faiss_IndexIVF_get_list_size(ivf, C.size_t(i)))
+		if sizes[i] == 0 {
+			report.EmptyLists++
+		}
+		sum += sizes[i]
+	}
+
+	report.ListSizeMean = sum / float64(report.NList)
+	for _, size := range sizes {
+		diff := size - report.ListSizeMean
+		report.ListSizeVariance += diff * diff
+	}
+	report.ListSizeVariance /= float64(report.NList)
+	if report.ListSizeMean > 0 {
+		report.ImbalanceFactor = 1 + report.ListSizeVariance/(report.ListSizeMean*report.ListSizeMean)
+	}
+
+	return report, nil
+}
+
+func (idx *faissIndex) MemoryUsage() (int64, error) {
+	if idx.idx == nil {
+		return 0, ErrIndexClosed
+	}
+
+	if bytes := int64(C.goss_Index_memory_usage(idx.idx)); bytes >= 0 {
+		return bytes, nil
+	}
+	return idx.ExactSerializedSize()
+}
+
+func (idx *faissIndex) ExactSerializedSize() (int64, error) {
+	if idx.idx == nil {
+		return 0, ErrIndexClosed
+	}
+
+	size := int64(C.goss_Index_serialized_size(idx.idx))
+	if size < 0 {
+		return 0, wrapError(getLastExtError(), "serialized size")
+	}
+	return size, nil
+}
+
+func (idx *faissIndex) AllVectors() ([]float32, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return []float32{}, nil
+	}
+
+	vectors := make([]float32, ntotal*int64(idx.D()))
+	if err := reconstructN(idx, 0, ntotal, vectors); err != nil {
+		return nil, wrapError(err, "all vectors")
+	}
+	return vectors, nil
+}
+
+func (idx *faissIndex) Reconstruct(key int64) ([]float32, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+
+	recons := make([]float32, idx.D())
+	if c := C.faiss_Index_reconstruct(idx.idx, C.idx_t(key), (*C.float)(&recons[0])); c != 0 {
+		return nil, wrapError(getLastError(), "reconstruct operation")
+	}
+	return recons, nil
+}
+
+// enableDirectMap gives an IVF index a Hashtable direct map, so that its
+// vectors can be reconstructed by ID. The map is built once, holding idx.mu
+// so that no add races with it, and then kept up to date by adds, removes
+// and Compact. It does nothing for other indexes.
+func enableDirectMap(idx Index) error {
+	native := idx.native()
+	// A frozen index is shared with lock-free readers and must not change;
+	// reconstruction then works only if the direct map was enabled before.
+	if native.frozen.Load() {
+		return nil
+	}
+
+	native.mu.Lock()
+	defer native.mu.Unlock()
+
+	if native.idx == nil {
+		return ErrIndexClosed
+	}
+	if C.faiss_IndexIVF_cast(native.idx) == nil {
+		return nil
+	}
+	if c := C.goss_IndexIVF_enable_direct_map(native.idx); c != 0 {
+		return wrapError(getLastExtError(), "enable direct map")
+	}
+	return nil
+}
+
+// reconstructBatch reconstructs the vectors with the given IDs into out with
+// a single cgo call.
+func reconstructBatch(idx Index, ids []int64, out []float32) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if c := C.goss_Index_reconstruct_batch(
+		idx.cPtr(),
+		C.idx_t(len(ids)),
+		(*C.idx_t)(&ids[0]),
+		(*C.float)(&out[0]),
+	); c != 0 {
+		return wrapError(getLastExtError(), fmt.Sprintf("reconstruct %d vectors", len(ids)))
+	}
+	return nil
+}
+
+// reconstructN reconstructs the n vectors with IDs start..start+n-1 into out.
+func reconstructN(idx Index, start, n int64, out []float32) error {
+	if c := C.faiss_Index_reconstruct_n(
+		idx.cPtr(),
+		C.idx_t(start),
+		C.idx_t(n),
+		(*C.float)(&out[0]),
+	); c != 0 {
+		return wrapError(getLastError(), fmt.Sprintf("reconstruct %d-%d", start, start+n-1))
+	}
+	return nil
+}
+
+func (idx *faissIndex) ComputeDistance(query []float32, id int64) (float32, error) {
+	distances, err := idx.ComputeDistanceToIDs(query, []int64{id})
+	if err != nil {
+		return 0, err
+	}
+	return distances[0], nil
+}
+
+func (idx *faissIndex) ComputeDistanceToIDs(query []float32, ids []int64) ([]float32, error) {
+	if idx.idx == nil {
+		return nil, ErrIndexClosed
+	}
+
+	d := idx.D()
+	if len(query) != d {
+		return nil, &DimensionMismatchError{Got: len(query), Want: d}
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("empty IDs slice")
+	}
+
+	metric := idx.MetricType()
+	recons := make([]float32, d)
+	distances := make([]float32, len(ids))
+	for i, id := range ids {
+		if c := C.faiss_Index_reconstruct(idx.idx, C.idx_t(id), (*C.float)(&recons[0])); c != 0 {
+			return nil, wrapError(getLastError(), fmt.Sprintf("reconstruct vector %d", id))
+		}
+
+		dist, err := computeDistance(metric, query, recons)
+		if err != nil {
+			return nil, wrapError(err, "compute distance")
+		}
+		distances[i] = dist
+	}
+	return distances, nil
+}
+
+// Delete frees the C index. It is idempotent and safe for concurrent use.
 func (idx *faissIndex) Delete() {
+	idx.free(false)
+}
+
+func (idx *faissIndex) finalize() {
+	idx.free(true)
+}
+
+func (idx *faissIndex) free(finalized bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
 	if idx.idx != nil {
 		C.faiss_Index_free(idx.idx)
 		idx.idx = nil
+		untrackObject(unsafe.Pointer(idx), finalized)
 	}
 	runtime.SetFinalizer(idx, nil)
 }
 
+// SetVerbose enables or disables FAISS progress logging to stderr for idx,
+// such as k-means iterations during training. For IVF indexes it also
+// applies to the coarse quantizer and its clustering.
+func SetVerbose(idx Index, v bool) error {
+	if idx == nil || idx.cPtr() == nil {
+		return ErrNullPointer
+	}
+	if err := idx.native().checkMutable(); err != nil {
+		return err
+	}
+
+	verbose := C.int(0)
+	if v {
+		verbose = 1
+	}
+	C.goss_Index_set_verbose_all(idx.cPtr(), verbose)
+	return nil
+}
+
+// IsVerbose reports whether FAISS progress logging is enabled for idx.
+func IsVerbose(idx Index) bool {
+	if idx == nil || idx.cPtr() == nil {
+		return false
+	}
+	return C.faiss_Index_verbose(idx.cPtr()) != 0
+}
+
 // IndexFactory builds a composite index using the factory pattern.
 // description is a comma-separated list of components.
 // Common descriptions:
@@ -379,6 +1772,10 @@ func IndexFactory(d int, description string, metric int) (Index, error) {
 		return nil, ErrInvalidDimension
 	}
 
+	if err := ValidateMetric(metric); err != nil {
+		return nil, err
+	}
+
 	if description == "" {
 		description = "Flat"
 	}
@@ -392,8 +1789,5 @@ func IndexFactory(d int, description string, metric int) (Index, error) {
 		return nil, wrapError(getLastError(), "index factory")
 	}
 
-	idx := &faissIndex{idx: cIdx}
-	runtime.SetFinalizer(idx, (*faissIndex).Delete)
-
-	return idx, nil
+	return newFaissIndex(cIdx), nil
 }
@@ -3,14 +3,17 @@ package faiss
 
 /*
 #include <faiss/c_api/IndexFlat_c.h>
+#include <faiss/c_api/IndexIVF_c.h>
 #include <faiss/c_api/Index_c.h>
+#include "faiss_ext.h"
 */
 import "C"
 import (
 	"errors"
 	"fmt"
 	"math"
-	"runtime"
+	"sort"
+	"sync"
 	"unsafe"
 )
 
@@ -19,6 +22,8 @@ import (
 // It's useful as a baseline for comparison and for small datasets.
 type IndexFlat struct {
 	Index
+
+	closeMu sync.Mutex // Serializes Close
 }
 
 // NewIndexFlat creates a new flat index with the specified dimension and metric.
@@ -27,6 +32,9 @@ func NewIndexFlat(d int, metric int) (*IndexFlat, error) {
 	if d <= 0 {
 		return nil, fmt.Errorf("dimension must be positive, got %d", d)
 	}
+	if err := ValidateMetric(metric); err != nil {
+		return nil, err
+	}
 
 	var cIdx *C.FaissIndex
 	if c := C.faiss_IndexFlat_new_with(
@@ -37,10 +45,32 @@ func NewIndexFlat(d int, metric int) (*IndexFlat, error) {
 		return nil, wrapError(getLastError(), "IndexFlat creation")
 	}
 
-	idx := &faissIndex{idx: cIdx}
-	runtime.SetFinalizer(idx, (*faissIndex).Delete)
+	return &IndexFlat{Index: newFaissIndex(cIdx)}, nil
+}
+
+// Close frees the index and detaches it from idx. Afterwards the IndexFlat
+// methods return ErrIndexClosed, and so do they if the index was deleted
+// through another reference. It is idempotent and safe to call from several
+// goroutines at once; other methods must not run concurrently with it.
+func (idx *IndexFlat) Close() error {
+	idx.closeMu.Lock()
+	defer idx.closeMu.Unlock()
 
-	return &IndexFlat{idx}, nil
+	if idx.Index != nil {
+		idx.Index.Delete()
+	}
+	idx.Index = closedIndex
+	return nil
+}
+
+// Delete frees the index. It is equivalent to Close.
+func (idx *IndexFlat) Delete() {
+	idx.Close()
+}
+
+// closed reports whether the index was freed.
+func (idx *IndexFlat) closed() bool {
+	return idx.Index == nil || idx.cPtr() == nil
 }
 
 // NewIndexFlatIP creates a new flat index with the inner product metric type.
@@ -65,11 +95,134 @@ func NewIndexFlatLinf(d int) (*IndexFlat, error) {
 	return NewIndexFlat(d, MetricLinf)
 }
 
+// ToFlat converts idx into an exact IndexFlat with the same dimension and
+// metric, by reconstructing all its vectors. Lossy encodings such as PQ are
+// decoded, so the flat index holds their approximations.
+//
+// The flat index labels vectors 0..Ntotal-1, so idx must use sequential IDs,
+// as assigned by Add. IVF indexes are decoded list by list, scanning each
+// list once, into a buffer of Ntotal*D*4 bytes; other indexes are copied in
+// chunks. idx is not modified.
+func ToFlat(idx Index) (*IndexFlat, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return nil, ErrNullPointer
+	}
+
+	flat, err := NewIndexFlat(idx.D(), idx.MetricType())
+	if err != nil {
+		return nil, err
+	}
+
+	d := idx.D()
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return flat, nil
+	}
+
+	if C.faiss_IndexIVF_cast(idx.cPtr()) != nil {
+		vectors, err := ivfVectorsByID(idx.cPtr(), d, ntotal)
+		if err == nil {
+			err = flat.Add(vectors)
+		}
+		if err != nil {
+			flat.Close()
+			return nil, wrapError(err, "to flat")
+		}
+		return flat, nil
+	}
+
+	chunkSize := ntotal
+	if chunkSize > MaxAddBatchSize {
+		chunkSize = MaxAddBatchSize
+	}
+	chunk := make([]float32, chunkSize*int64(d))
+	for start := int64(0); start < ntotal; start += chunkSize {
+		n := ntotal - start
+		if n > chunkSize {
+			n = chunkSize
+		}
+
+		vectors := chunk[:n*int64(d)]
+		if err := reconstructN(idx, start, n, vectors); err != nil {
+			flat.Close()
+			return nil, wrapError(err, "to flat")
+		}
+
+		if err := flat.Add(vectors); err != nil {
+			flat.Close()
+			return nil, wrapError(err, "to flat add")
+		}
+	}
+
+	return flat, nil
+}
+
+// ivfVectorsByID decodes the vectors of an IVF index list by list and
+// returns them ordered by ID, which must range over 0..ntotal-1.
+func ivfVectorsByID(cIdx *C.FaissIndex, d int, ntotal int64) ([]float32, error) {
+	nlist := int(C.faiss_IndexIVF_nlist(C.faiss_IndexIVF_cast(cIdx)))
+	vectors := make([]float32, ntotal*int64(d))
+	var list []float32
+	for listNo := 0; listNo < nlist; listNo++ {
+		ids, err := ivfListIDs(cIdx, listNo)
+		if err != nil {
+			return nil, wrapError(err, "read list")
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		if cap(list) < len(ids)*d {
+			list = make([]float32, len(ids)*d)
+		}
+		list = list[:len(ids)*d]
+		if c := C.goss_IndexIVF_reconstruct_list(cIdx, C.size_t(listNo), (*C.float)(&list[0])); c != 0 {
+			return nil, wrapError(getLastExtError(), "read list")
+		}
+
+		for i, id := range ids {
+			if id < 0 || id >= ntotal {
+				return nil, fmt.Errorf("ID %d is outside the sequential range [0, %d)", id, ntotal)
+			}
+			copy(vectors[id*int64(d):(id+1)*int64(d)], list[i*d:(i+1)*d])
+		}
+	}
+	return vectors, nil
+}
+
+// Reserve preallocates storage for n vectors in total, so that a bulk load
+// of up to n vectors through repeated Add calls doesn't reallocate and copy
+// the stored vectors as it grows. It does nothing if the storage already
+// has room for n vectors.
+func (idx *IndexFlat) Reserve(n int64) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.native().checkMutable(); err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("invalid capacity: %d", n)
+	}
+
+	native := idx.native()
+	native.mu.Lock()
+	defer native.mu.Unlock()
+
+	if c := C.goss_IndexFlatCodes_reserve(idx.cPtr(), C.idx_t(n)); c != 0 {
+		return wrapError(getLastExtError(), "reserve")
+	}
+	return nil
+}
+
 // Xb returns the index's vectors.
 // The returned slice becomes invalid after any add or remove operation.
 // Use with caution as it provides direct access to internal memory.
+//
+// Deprecated: Xb exposes FAISS-owned memory. Use AllVectors, GetVector,
+// GetVectors or GetVectorRange, which return copies.
 func (idx *IndexFlat) Xb() []float32 {
-	if idx.Index == nil {
+	if idx.closed() {
 		return nil
 	}
 
@@ -81,43 +234,33 @@ func (idx *IndexFlat) Xb() []float32 {
 		return nil
 	}
 
-	return (*[1 << 30]float32)(unsafe.Pointer(ptr))[:size:size]
+	// size is the number of floats (ntotal * d), which may exceed what a
+	// fixed-size array type can describe, especially on 32-bit platforms.
+	if uint64(size) > uint64(math.MaxInt) {
+		return nil
+	}
+	return unsafe.Slice((*float32)(unsafe.Pointer(ptr)), int(size))
 }
 
 // GetVector returns a copy of the vector at the specified index.
-// This is safer than using Xb() as it creates a copy.
+// The vector is reconstructed by FAISS, so the result stays valid after
+// later mutations of the index.
 func (idx *IndexFlat) GetVector(id int64) ([]float32, error) {
-	if idx.Index == nil {
-		return nil, errors.New("index is nil")
+	if idx.closed() {
+		return nil, ErrIndexClosed
 	}
 
 	if id < 0 || id >= idx.Ntotal() {
 		return nil, fmt.Errorf("invalid vector ID: %d (valid range: 0-%d)", id, idx.Ntotal()-1)
 	}
 
-	d := idx.D()
-	vectors := idx.Xb()
-	if vectors == nil {
-		return nil, errors.New("no vectors in index")
-	}
-
-	start := int(id) * d
-	end := start + d
-
-	if end > len(vectors) {
-		return nil, errors.New("vector access out of bounds")
-	}
-
-	// Create a copy
-	result := make([]float32, d)
-	copy(result, vectors[start:end])
-	return result, nil
+	return idx.Reconstruct(id)
 }
 
 // GetVectors returns copies of multiple vectors by their IDs.
 func (idx *IndexFlat) GetVectors(ids []int64) ([]float32, error) {
-	if idx.Index == nil {
-		return nil, errors.New("index is nil")
+	if idx.closed() {
+		return nil, ErrIndexClosed
 	}
 
 	if len(ids) == 0 {
@@ -134,21 +277,41 @@ func (idx *IndexFlat) GetVectors(ids []int64) ([]float32, error) {
 		}
 	}
 
-	vectors := idx.Xb()
-	if vectors == nil {
-		return nil, errors.New("no vectors in index")
+	// Visit the IDs in sorted order so that contiguous runs can be
+	// reconstructed with a single reconstruct_n call.
+	order := make([]int, len(ids))
+	for i := range order {
+		order[i] = i
 	}
+	sort.Slice(order, func(a, b int) bool {
+		return ids[order[a]] < ids[order[b]]
+	})
 
 	result := make([]float32, len(ids)*d)
-	for i, id := range ids {
-		start := int(id) * d
-		end := start + d
+	for runStart := 0; runStart < len(order); {
+		// Extend the run while IDs are consecutive (or repeated)
+		runEnd := runStart + 1
+		for runEnd < len(order) && ids[order[runEnd]]-ids[order[runEnd-1]] <= 1 {
+			runEnd++
+		}
 
-		if end > len(vectors) {
-			return nil, fmt.Errorf("vector access out of bounds for ID %d", id)
+		first := ids[order[runStart]]
+		count := ids[order[runEnd-1]] - first + 1
+		buf := make([]float32, count*int64(d))
+		if c := C.faiss_Index_reconstruct_n(
+			idx.cPtr(),
+			C.idx_t(first),
+			C.idx_t(count),
+			(*C.float)(&buf[0]),
+		); c != 0 {
+			return nil, wrapError(getLastError(), fmt.Sprintf("reconstruct vectors %d-%d", first, first+count-1))
 		}
 
-		copy(result[i*d:(i+1)*d], vectors[start:end])
+		for _, pos := range order[runStart:runEnd] {
+			offset := int(ids[pos]-first) * d
+			copy(result[pos*d:(pos+1)*d], buf[offset:offset+d])
+		}
+		runStart = runEnd
 	}
 
 	return result, nil
@@ -156,8 +319,8 @@ func (idx *IndexFlat) GetVectors(ids []int64) ([]float32, error) {
 
 // GetVectorRange returns a copy of vectors in the specified range [start, end).
 func (idx *IndexFlat) GetVectorRange(start, end int64) ([]float32, error) {
-	if idx.Index == nil {
-		return nil, errors.New("index is nil")
+	if idx.closed() {
+		return nil, ErrIndexClosed
 	}
 
 	if start < 0 || end < 0 {
@@ -202,25 +365,27 @@ func (idx *IndexFlat) GetVectorRange(start, end int64) ([]float32, error) {
 	return result, nil
 }
 
-// ComputeDistances computes distances between a query vector and all vectors in the index.
-// Returns distances in the same order as the vectors were added.
+// ComputeDistances computes distances between a query vector and all vectors
+// in the index, sorted best first as returned by Search. Unlike Search it is
+// not limited to MaxK vectors. See ComputeDistancesUnsorted for the distances
+// in ID order.
 func (idx *IndexFlat) ComputeDistances(query []float32) ([]float32, error) {
-	if idx.Index == nil {
-		return nil, errors.New("index is nil")
+	if idx.closed() {
+		return nil, ErrIndexClosed
 	}
 
 	d := idx.D()
 	if len(query) != d {
-		return nil, fmt.Errorf("query dimension %d doesn't match index dimension %d", len(query), d)
+		return nil, &DimensionMismatchError{Got: len(query), Want: d}
 	}
 
 	ntotal := idx.Ntotal()
 	if ntotal == 0 {
-		return nil, errors.New("index is empty")
+		return nil, wrapError(ErrEmptyIndex, "compute distances")
 	}
 
 	// Use search with k = ntotal to get all distances
-	distances, _, err := idx.Search(query, ntotal)
+	distances, _, err := idx.native().search(query, ntotal)
 	if err != nil {
 		return nil, wrapError(err, "compute distances")
 	}
@@ -228,12 +393,108 @@ func (idx *IndexFlat) ComputeDistances(query []float32) ([]float32, error) {
 	return distances, nil
 }
 
-// ComputeDistancesBatch computes distances between multiple query vectors and all vectors in the index
-// using SearchBatch for better memory management and performance.
-// Returns a matrix where result[i*ntotal+j] is the distance between query i and index vector j.
+// ComputeDistancesUnsorted computes distances between a query vector and all
+// vectors in the index without sorting them: result[i] is the distance to
+// vector i, under the index's metric.
+func (idx *IndexFlat) ComputeDistancesUnsorted(query []float32) ([]float32, error) {
+	if idx.closed() {
+		return nil, ErrIndexClosed
+	}
+
+	d := idx.D()
+	if len(query) != d {
+		return nil, &DimensionMismatchError{Got: len(query), Want: d}
+	}
+
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return nil, wrapError(ErrEmptyIndex, "compute distances unsorted")
+	}
+
+	// Reconstruct a chunk at a time, so that only the distances are held
+	// for the whole index
+	chunk := int64(DefaultAddBatchSize)
+	if chunk > ntotal {
+		chunk = ntotal
+	}
+	vectors := make([]float32, chunk*int64(d))
+
+	metric := idx.MetricType()
+	distances := make([]float32, ntotal)
+	for start := int64(0); start < ntotal; start += chunk {
+		n := chunk
+		if start+n > ntotal {
+			n = ntotal - start
+		}
+		if err := reconstructN(idx, start, n, vectors); err != nil {
+			return nil, err
+		}
+
+		for i := int64(0); i < n; i++ {
+			dist, err := computeDistance(metric, query, vectors[i*int64(d):(i+1)*int64(d)])
+			if err != nil {
+				return nil, wrapError(err, "compute distances unsorted")
+			}
+			distances[start+i] = dist
+		}
+	}
+
+	return distances, nil
+}
+
+// DistanceHistogram returns a histogram of the distances between query and
+// all vectors in the index, which helps choosing a range search radius.
+// edges has buckets+1 increasing values; counts[i] is the number of
+// distances in [edges[i], edges[i+1]), the last bucket including its upper edge.
+func (idx *IndexFlat) DistanceHistogram(query []float32, buckets int) (edges []float32, counts []int64, err error) {
+	if buckets <= 0 {
+		return nil, nil, fmt.Errorf("buckets must be positive, got %d", buckets)
+	}
+
+	distances, err := idx.ComputeDistances(query)
+	if err != nil {
+		return nil, nil, wrapError(err, "distance histogram")
+	}
+
+	min, max := distances[0], distances[0]
+	for _, dist := range distances {
+		if dist < min {
+			min = dist
+		}
+		if dist > max {
+			max = dist
+		}
+	}
+
+	width := (max - min) / float32(buckets)
+	edges = make([]float32, buckets+1)
+	for i := range edges {
+		edges[i] = min + float32(i)*width
+	}
+	edges[buckets] = max
+
+	counts = make([]int64, buckets)
+	for _, dist := range distances {
+		b := buckets - 1
+		if width > 0 {
+			b = int((dist - min) / width)
+		}
+		if b >= buckets {
+			b = buckets - 1
+		}
+		counts[b]++
+	}
+
+	return edges, counts, nil
+}
+
+// ComputeDistancesBatch computes distances between multiple query vectors
+// and all vectors in the index, searching batchSize queries at a time.
+// result[i*ntotal:(i+1)*ntotal] holds the distances of query i, sorted as by
+// ComputeDistances. Like ComputeDistances it is not limited to MaxK vectors.
 func (idx *IndexFlat) ComputeDistancesBatch(queries []float32, batchSize int) ([]float32, error) {
-	if idx.Index == nil {
-		return nil, fmt.Errorf("index is nil")
+	if idx.closed() {
+		return nil, ErrIndexClosed
 	}
 
 	d := idx.D()
@@ -243,43 +504,83 @@ func (idx *IndexFlat) ComputeDistancesBatch(queries []float32, batchSize int) ([
 
 	ntotal := idx.Ntotal()
 	if ntotal == 0 {
-		return nil, fmt.Errorf("index is empty")
+		return nil, wrapError(ErrEmptyIndex, "compute distances batch")
 	}
 
-	if batchSize <= 0 {
-		batchSize = DefaultSearchBatchSize
-	}
-
-	distances, _, err := idx.SearchBatch(queries, ntotal, batchSize)
+	batchSize, err := searchBatchSize(batchSize)
 	if err != nil {
-		return nil, wrapError(err, "compute distances batch")
+		return nil, err
 	}
 
 	numQueries := len(queries) / d
-	result := make([]float32, numQueries*int(ntotal))
+	result := make([]float32, 0, numQueries*int(ntotal))
+	for start := 0; start < numQueries; start += batchSize {
+		end := start + batchSize
+		if end > numQueries {
+			end = numQueries
+		}
 
-	for i := 0; i < numQueries; i++ {
-		if i < len(distances) && i < len(distances[i]) {
-			start := i * int(ntotal)
-			end := start + int(ntotal)
-			copy(result[start:end], distances[i])
+		distances, _, err := idx.native().search(queries[start*d:end*d], ntotal)
+		if err != nil {
+			return nil, wrapError(err, fmt.Sprintf("compute distances batch %d-%d", start, end-1))
 		}
+		result = append(result, distances...)
 	}
 
 	return result, nil
 }
 
+// SearchWithSecondaryMetric searches the index under its own metric, then
+// recomputes the distances of the returned neighbors under the secondary
+// metric from their reconstructed vectors.
+// Entries for missing neighbors (label -1) get a NaN secondary distance.
+func (idx *IndexFlat) SearchWithSecondaryMetric(x []float32, k int64, secondary int) (
+	distances []float32, labels []int64, secondaryDistances []float32, err error,
+) {
+	if idx.closed() {
+		return nil, nil, nil, ErrIndexClosed
+	}
+
+	distances, labels, err = idx.Search(x, k)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	d := idx.D()
+	stride := int64(len(labels) / (len(x) / d)) // Search clamps k to Ntotal
+	secondaryDistances = make([]float32, len(labels))
+	for i, label := range labels {
+		if label < 0 {
+			secondaryDistances[i] = float32(math.NaN())
+			continue
+		}
+
+		vec, err := idx.Reconstruct(label)
+		if err != nil {
+			return nil, nil, nil, wrapError(err, "secondary metric reconstruction")
+		}
+
+		q := int64(i) / stride
+		query := x[q*int64(d) : (q+1)*int64(d)]
+		if secondaryDistances[i], err = computeDistance(secondary, query, vec); err != nil {
+			return nil, nil, nil, wrapError(err, "secondary metric")
+		}
+	}
+
+	return distances, labels, secondaryDistances, nil
+}
+
 // ComputeL2Norms computes the L2 norms of all vectors in the index.
 func (idx *IndexFlat) ComputeL2Norms() ([]float32, error) {
-	if idx.Index == nil {
-		return nil, fmt.Errorf("index is nil")
+	if idx.closed() {
+		return nil, ErrIndexClosed
 	}
 
 	d := idx.D()
 	ntotal := idx.Ntotal()
 
 	if ntotal == 0 {
-		return nil, fmt.Errorf("index is empty")
+		return nil, wrapError(ErrEmptyIndex, "compute L2 norms")
 	}
 
 	vectors := idx.Xb()
@@ -307,8 +608,11 @@ func (idx *IndexFlat) ComputeL2Norms() ([]float32, error) {
 // NormalizeVectors normalizes all vectors in the index to unit length.
 // This is useful for converting an L2 index to cosine similarity.
 func (idx *IndexFlat) NormalizeVectors() error {
-	if idx.Index == nil {
-		return errors.New("index is nil")
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.native().checkMutable(); err != nil {
+		return err
 	}
 
 	norms, err := idx.ComputeL2Norms()
@@ -342,9 +646,27 @@ func (idx *IndexFlat) NormalizeVectors() error {
 	return nil
 }
 
+// AddNormalized adds a copy of x normalized to unit length.
+// The caller's slice is left untouched. Combined with NewIndexFlatIP this
+// gives cosine similarity search.
+func (idx *IndexFlat) AddNormalized(x []float32) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+
+	vectors := make([]float32, len(x))
+	copy(vectors, x)
+
+	if err := NormalizeVectors(vectors, idx.D()); err != nil {
+		return wrapError(err, "normalize vectors")
+	}
+
+	return idx.Add(vectors)
+}
+
 // GetMemoryUsage returns the estimated memory usage of the index in bytes.
 func (idx *IndexFlat) GetMemoryUsage() int64 {
-	if idx.Index == nil {
+	if idx.closed() {
 		return 0
 	}
 
@@ -360,11 +682,21 @@ func (idx *IndexFlat) GetMemoryUsage() int64 {
 }
 
 // FlatIndexBuilder helps build flat indices with validation.
+//
+// Vectors of the wrong length are rejected rather than added: Err and
+// RejectedCount report the rejections, and Build refuses to build when any
+// occurred unless AllowPartial(true) was set.
 type FlatIndexBuilder struct {
-	dimension int
-	metric    int
-	vectors   []float32
-	normalize bool
+	dimension    int
+	metric       int
+	vectors      []float32
+	ids          []int64 // IDs of the vectors, if added with IDs
+	withoutIDs   bool    // Vectors were added without IDs
+	normalize    bool
+	auto         bool  // Infer dimension from the first vector
+	allowPartial bool  // Build despite rejections
+	rejected     int   // Number of rejected adds
+	err          error // First rejection
 }
 
 // NewFlatIndexBuilder creates a new flat index builder.
@@ -377,6 +709,17 @@ func NewFlatIndexBuilder(dimension int) *FlatIndexBuilder {
 	}
 }
 
+// NewFlatIndexBuilderAuto creates a flat index builder that infers the
+// dimension from the first vector added. Subsequent vectors must have the
+// same length, otherwise they are rejected.
+func NewFlatIndexBuilderAuto() *FlatIndexBuilder {
+	return &FlatIndexBuilder{
+		metric:  MetricL2,
+		vectors: make([]float32, 0),
+		auto:    true,
+	}
+}
+
 // SetMetric sets the metric type for the index.
 func (b *FlatIndexBuilder) SetMetric(metric int) *FlatIndexBuilder {
 	b.metric = metric
@@ -389,31 +732,135 @@ func (b *FlatIndexBuilder) SetNormalize(normalize bool) *FlatIndexBuilder {
 	return b
 }
 
+// AllowPartial makes Build succeed with the accepted vectors even if some
+// adds were rejected.
+func (b *FlatIndexBuilder) AllowPartial(allow bool) *FlatIndexBuilder {
+	b.allowPartial = allow
+	return b
+}
+
+// reject records a rejected add.
+func (b *FlatIndexBuilder) reject(err error) *FlatIndexBuilder {
+	b.rejected++
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// checkVector infers the dimension in auto mode and reports whether vector
+// has the builder dimension, rejecting it otherwise.
+func (b *FlatIndexBuilder) checkVector(vector []float32) bool {
+	if b.auto && b.dimension == 0 && len(vector) > 0 {
+		b.dimension = len(vector)
+	}
+	if len(vector) != b.dimension || b.dimension <= 0 {
+		b.reject(fmt.Errorf("vector %d has dimension %d, expected %d", b.GetVectorCount(), len(vector), b.dimension))
+		return false
+	}
+	return true
+}
+
 // AddVector adds a single vector to the builder.
 func (b *FlatIndexBuilder) AddVector(vector []float32) *FlatIndexBuilder {
-	if len(vector) == b.dimension {
+	if b.ids != nil {
+		return b.reject(errors.New("vector added without an ID after vectors with IDs"))
+	}
+	if b.checkVector(vector) {
 		b.vectors = append(b.vectors, vector...)
+		b.withoutIDs = true
 	}
 	return b
 }
 
 // AddVectors adds multiple vectors to the builder.
 func (b *FlatIndexBuilder) AddVectors(vectors []float32) *FlatIndexBuilder {
-	if len(vectors)%b.dimension == 0 {
-		b.vectors = append(b.vectors, vectors...)
+	if b.ids != nil {
+		return b.reject(errors.New("vectors added without IDs after vectors with IDs"))
+	}
+	if b.dimension <= 0 {
+		if b.auto {
+			return b.reject(errors.New("dimension not yet inferred: add a single vector with AddVector first"))
+		}
+		return b.reject(fmt.Errorf("invalid dimension: %d", b.dimension))
 	}
+	if len(vectors)%b.dimension != 0 {
+		return b.reject(fmt.Errorf("vectors length %d is not a multiple of dimension %d", len(vectors), b.dimension))
+	}
+	b.vectors = append(b.vectors, vectors...)
+	b.withoutIDs = true
 	return b
 }
 
+// AddVectorWithID adds a single vector with a custom ID. Builders given IDs
+// produce an IDMap index, built with BuildIndex; vectors with and without
+// IDs can't be mixed.
+func (b *FlatIndexBuilder) AddVectorWithID(vector []float32, id int64) *FlatIndexBuilder {
+	if b.withoutIDs {
+		return b.reject(errors.New("vector added with an ID after vectors without IDs"))
+	}
+	if id < 0 {
+		return b.reject(fmt.Errorf("negative ID %d", id))
+	}
+	if b.checkVector(vector) {
+		b.vectors = append(b.vectors, vector...)
+		b.ids = append(b.ids, id)
+	}
+	return b
+}
+
+// Err returns the reason of the first rejected add, or nil.
+func (b *FlatIndexBuilder) Err() error {
+	return b.err
+}
+
+// RejectedCount returns the number of rejected adds.
+func (b *FlatIndexBuilder) RejectedCount() int {
+	return b.rejected
+}
+
 // GetVectorCount returns the number of vectors currently in the builder.
 func (b *FlatIndexBuilder) GetVectorCount() int {
+	if b.dimension <= 0 {
+		return 0
+	}
 	return len(b.vectors) / b.dimension
 }
 
-// Build creates the flat index with the accumulated vectors.
-func (b *FlatIndexBuilder) Build() (*IndexFlat, error) {
+// check verifies that the builder can build an index.
+func (b *FlatIndexBuilder) check() error {
+	if b.err != nil && !b.allowPartial {
+		return fmt.Errorf("%d adds rejected, first: %w", b.rejected, b.err)
+	}
 	if b.dimension <= 0 {
-		return nil, fmt.Errorf("invalid dimension: %d", b.dimension)
+		return fmt.Errorf("invalid dimension: %d", b.dimension)
+	}
+	return nil
+}
+
+// prepared returns a copy of the accumulated vectors, normalized if
+// requested.
+func (b *FlatIndexBuilder) prepared() ([]float32, error) {
+	vectors := make([]float32, len(b.vectors))
+	copy(vectors, b.vectors)
+
+	if b.normalize {
+		if err := NormalizeVectors(vectors, b.dimension); err != nil {
+			return nil, wrapError(err, "normalize vectors")
+		}
+	}
+	return vectors, nil
+}
+
+// Build creates the flat index with the accumulated vectors. It fails if
+// adds were rejected, unless AllowPartial(true) was set, and if vectors were
+// added with IDs, which require BuildIndex.
+func (b *FlatIndexBuilder) Build() (*IndexFlat, error) {
+	if b.ids != nil {
+		return nil, errors.New("vectors were added with IDs: use BuildIndex")
+	}
+	if err := b.check(); err != nil {
+		return nil, err
 	}
 
 	// Create the index
@@ -424,15 +871,10 @@ func (b *FlatIndexBuilder) Build() (*IndexFlat, error) {
 
 	// Add vectors if any
 	if len(b.vectors) > 0 {
-		vectors := make([]float32, len(b.vectors))
-		copy(vectors, b.vectors)
-
-		// Normalize if requested
-		if b.normalize {
-			if err := NormalizeVectors(vectors, b.dimension); err != nil {
-				idx.Delete()
-				return nil, wrapError(err, "normalize vectors")
-			}
+		vectors, err := b.prepared()
+		if err != nil {
+			idx.Delete()
+			return nil, err
 		}
 
 		// Add vectors to index
@@ -445,8 +887,54 @@ func (b *FlatIndexBuilder) Build() (*IndexFlat, error) {
 	return idx, nil
 }
 
-// Clear removes all vectors from the builder.
+// BuildIndex is like Build, but also handles vectors added with IDs, for
+// which it creates an "IDMap,Flat" index.
+func (b *FlatIndexBuilder) BuildIndex() (Index, error) {
+	if b.ids == nil {
+		idx, err := b.Build()
+		if err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+
+	idx, err := IndexFactory(b.dimension, "IDMap,Flat", b.metric)
+	if err != nil {
+		return nil, wrapError(err, "create IDMap flat index")
+	}
+
+	vectors, err := b.prepared()
+	if err != nil {
+		idx.Delete()
+		return nil, err
+	}
+	if err := idx.AddWithIDs(vectors, b.ids); err != nil {
+		idx.Delete()
+		return nil, wrapError(err, "add vectors with IDs to index")
+	}
+	return idx, nil
+}
+
+// MustBuild is like Build but panics on error, for indexes built from
+// static data.
+func (b *FlatIndexBuilder) MustBuild() *IndexFlat {
+	idx, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return idx
+}
+
+// Clear removes all vectors from the builder, along with the recorded
+// rejections.
 func (b *FlatIndexBuilder) Clear() *FlatIndexBuilder {
 	b.vectors = b.vectors[:0]
+	b.ids = nil
+	b.withoutIDs = false
+	b.rejected = 0
+	b.err = nil
 	return b
 }
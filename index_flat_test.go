@@ -0,0 +1,580 @@
+package faiss
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetVectorAfterAdd(t *testing.T) {
+	const d = 4
+	first := randomVectors(3, d, 1)
+	idx := newFlatL2(t, d, first)
+
+	// Grow the storage well past its capacity, which reallocates the memory
+	// an Xb slice taken before would point to.
+	if err := idx.Add(randomVectors(10000, d, 2)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	for id := int64(0); id < 3; id++ {
+		got, err := idx.GetVector(id)
+		if err != nil {
+			t.Fatalf("GetVector(%d): %v", id, err)
+		}
+		if want := first[id*d : (id+1)*d]; !reflect.DeepEqual(got, want) {
+			t.Fatalf("GetVector(%d) = %v, want %v", id, got, want)
+		}
+	}
+
+	got, err := idx.GetVectors([]int64{2, 0})
+	if err != nil {
+		t.Fatalf("GetVectors: %v", err)
+	}
+	want := append(append([]float32(nil), first[2*d:3*d]...), first[:d]...)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetVectors = %v, want %v", got, want)
+	}
+}
+
+func TestXbLength(t *testing.T) {
+	const d, n = 64, 300000
+	idx := newFlatL2(t, d, nil)
+	if err := idx.AddBatch(randomVectors(n, d, 1), 0); err != nil {
+		t.Fatalf("AddBatch: %v", err)
+	}
+
+	xb := idx.Xb()
+	if want := idx.Ntotal() * int64(idx.D()); int64(len(xb)) != want {
+		t.Fatalf("len(Xb()) = %d, want Ntotal*D = %d", len(xb), want)
+	}
+}
+
+func TestAddNormalized(t *testing.T) {
+	idx, err := NewIndexFlatIP(3)
+	if err != nil {
+		t.Fatalf("NewIndexFlatIP: %v", err)
+	}
+	defer idx.Delete()
+
+	x := []float32{3, 0, 4}
+	if err := idx.AddNormalized(x); err != nil {
+		t.Fatalf("AddNormalized: %v", err)
+	}
+	if want := []float32{3, 0, 4}; !reflect.DeepEqual(x, want) {
+		t.Fatalf("caller's slice changed to %v", x)
+	}
+
+	stored, err := idx.GetVector(0)
+	if err != nil {
+		t.Fatalf("GetVector: %v", err)
+	}
+	var norm float64
+	for _, v := range stored {
+		norm += float64(v) * float64(v)
+	}
+	if math.Abs(math.Sqrt(norm)-1) > 1e-6 {
+		t.Fatalf("stored vector %v has norm %v, want 1", stored, math.Sqrt(norm))
+	}
+	if want := []float32{0.6, 0, 0.8}; !approxEqual(stored, want, 1e-6) {
+		t.Fatalf("stored vector = %v, want %v", stored, want)
+	}
+}
+
+func TestFlatIndexBuilderAutoInfersDimension(t *testing.T) {
+	b := NewFlatIndexBuilderAuto().
+		AddVector([]float32{1, 2, 3, 4}).
+		AddVector([]float32{5, 6, 7, 8}).
+		AddVector([]float32{9, 10, 11, 12})
+
+	idx, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer idx.Delete()
+
+	if got := idx.D(); got != 4 {
+		t.Fatalf("D = %d, want 4", got)
+	}
+	if got := idx.Ntotal(); got != 3 {
+		t.Fatalf("Ntotal = %d, want 3", got)
+	}
+}
+
+func TestSearchWithSecondaryMetric(t *testing.T) {
+	const d, n, nq, k = 8, 200, 5, 10
+	x := randomVectors(n, d, 1)
+	queries := randomVectors(nq, d, 2)
+	idx := newFlatL2(t, d, x)
+
+	distances, labels, ip, err := idx.SearchWithSecondaryMetric(queries, k, MetricInnerProduct)
+	if err != nil {
+		t.Fatalf("SearchWithSecondaryMetric: %v", err)
+	}
+	if len(distances) != nq*k || len(labels) != nq*k || len(ip) != nq*k {
+		t.Fatalf("got %d distances, %d labels, %d secondary distances, want %d each",
+			len(distances), len(labels), len(ip), nq*k)
+	}
+
+	for i, label := range labels {
+		q := queries[(i/k)*d : (i/k+1)*d]
+		v := x[label*d : (label+1)*d]
+
+		var dot, l2 float64
+		for j := range q {
+			dot += float64(q[j]) * float64(v[j])
+			diff := float64(q[j]) - float64(v[j])
+			l2 += diff * diff
+		}
+		if math.Abs(float64(ip[i])-dot) > 1e-4 {
+			t.Errorf("result %d: inner product %v, want %v", i, ip[i], dot)
+		}
+		if math.Abs(float64(distances[i])-l2) > 1e-4 {
+			t.Errorf("result %d: L2 distance %v, want %v", i, distances[i], l2)
+		}
+	}
+}
+
+func TestDistanceHistogramBimodal(t *testing.T) {
+	const d, n, buckets = 16, 1000, 10
+	x := clusteredVectors(n, d, 2, 1)
+	idx := newFlatL2(t, d, x)
+
+	// Query from the first cluster: half the distances are near 0, the
+	// other half near the squared distance between the cluster centers
+	edges, counts, err := idx.DistanceHistogram(x[:d], buckets)
+	if err != nil {
+		t.Fatalf("DistanceHistogram: %v", err)
+	}
+	if len(edges) != buckets+1 || len(counts) != buckets {
+		t.Fatalf("got %d edges and %d counts, want %d and %d", len(edges), len(counts), buckets+1, buckets)
+	}
+	for i := 1; i < len(edges); i++ {
+		if edges[i] < edges[i-1] {
+			t.Fatalf("edges are not increasing: %v", edges)
+		}
+	}
+
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	if total != n {
+		t.Errorf("histogram holds %d distances, want %d", total, n)
+	}
+
+	near := counts[0] + counts[1]
+	far := counts[buckets-2] + counts[buckets-1]
+	if near != n/2 || far != n/2 {
+		t.Errorf("histogram %v is not bimodal: %d near, %d far", counts, near, far)
+	}
+}
+
+func TestComputeDistancesUnsorted(t *testing.T) {
+	// Spans several reconstruction chunks, the last one partial
+	const d, n = 8, 2*DefaultAddBatchSize + 123
+	x := randomVectors(n, d, 1)
+	query := randomVectors(1, d, 2)
+
+	for _, metric := range []int{MetricL2, MetricInnerProduct} {
+		idx, err := NewIndexFlat(d, metric)
+		if err != nil {
+			t.Fatalf("NewIndexFlat: %v", err)
+		}
+		defer idx.Delete()
+
+		if _, err := idx.ComputeDistancesUnsorted(query); !errors.Is(err, ErrEmptyIndex) {
+			t.Errorf("metric %d: empty index returned %v, want ErrEmptyIndex", metric, err)
+		}
+
+		if err := idx.Add(x); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		distances, err := idx.ComputeDistancesUnsorted(query)
+		if err != nil {
+			t.Fatalf("ComputeDistancesUnsorted: %v", err)
+		}
+		if len(distances) != n {
+			t.Fatalf("metric %d: got %d distances, want %d", metric, len(distances), n)
+		}
+
+		for i := 0; i < n; i++ {
+			var want float64
+			for j := 0; j < d; j++ {
+				q, v := float64(query[j]), float64(x[i*d+j])
+				if metric == MetricL2 {
+					want += (q - v) * (q - v)
+				} else {
+					want += q * v
+				}
+			}
+			if math.Abs(float64(distances[i])-want) > 1e-4 {
+				t.Errorf("metric %d: distance to vector %d = %v, want %v", metric, i, distances[i], want)
+			}
+		}
+	}
+}
+
+// getVectorsNaive reconstructs ids one at a time.
+func getVectorsNaive(idx *IndexFlat, ids []int64) ([]float32, error) {
+	result := make([]float32, 0, len(ids)*idx.D())
+	for _, id := range ids {
+		vec, err := idx.GetVector(id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, vec...)
+	}
+	return result, nil
+}
+
+func TestGetVectorsMatchesNaive(t *testing.T) {
+	const d, n = 8, 1000
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+
+	// Shuffled, with contiguous runs, gaps and repeats
+	rng := rand.New(rand.NewSource(2))
+	ids := make([]int64, 0, 600)
+	for _, id := range rng.Perm(n)[:500] {
+		ids = append(ids, int64(id))
+	}
+	ids = append(ids, 3, 3, 0, n-1, 4, 5, 6)
+	rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	got, err := idx.GetVectors(ids)
+	if err != nil {
+		t.Fatalf("GetVectors: %v", err)
+	}
+	want, err := getVectorsNaive(idx, ids)
+	if err != nil {
+		t.Fatalf("GetVector: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("GetVectors differs from reconstructing each ID")
+	}
+}
+
+func BenchmarkGetVectors(b *testing.B) {
+	const d, n, count = 128, 100000, 10000
+	idx := newFlatL2(b, d, randomVectors(n, d, 1))
+
+	ids := make([]int64, count)
+	for i := range ids {
+		ids[i] = int64(n/2 + i)
+	}
+
+	b.Run("Contiguous", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := idx.GetVectors(ids); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := getVectorsNaive(idx, ids); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestLpRanksDifferentlyFromL2(t *testing.T) {
+	// From the origin, a is closer under L2 (2 < 2.25), but b is closer
+	// under Lp with p=0.5 (sqrt(1.5) < 1+1)
+	x := []float32{
+		1, 1, // a
+		1.5, 0, // b
+	}
+	query := []float32{0, 0}
+
+	l2 := newFlatL2(t, 2, x)
+	_, labels, err := l2.Search(query, 2)
+	if err != nil {
+		t.Fatalf("L2 Search: %v", err)
+	}
+	if !reflect.DeepEqual(labels, []int64{0, 1}) {
+		t.Errorf("L2 ranking = %v, want [0 1]", labels)
+	}
+
+	lp, err := NewIndexFlat(2, MetricLp)
+	if err != nil {
+		t.Fatalf("NewIndexFlat(MetricLp): %v", err)
+	}
+	defer lp.Delete()
+	if err := lp.SetMetricArg(0.5); err != nil {
+		t.Fatalf("SetMetricArg: %v", err)
+	}
+	if err := lp.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	distances, labels, err := lp.Search(query, 2)
+	if err != nil {
+		t.Fatalf("Lp Search: %v", err)
+	}
+	if !reflect.DeepEqual(labels, []int64{1, 0}) {
+		t.Errorf("Lp(0.5) ranking = %v, want [1 0]", labels)
+	}
+	// FAISS reports sum(|x_i - y_i|^p) without the final root
+	if want := []float32{float32(math.Sqrt(1.5)), 2}; !approxEqual(distances, want, 1e-5) {
+		t.Errorf("Lp(0.5) distances = %v, want %v", distances, want)
+	}
+
+	if err := l2.SetMetricArg(0.5); err == nil {
+		t.Error("SetMetricArg accepted an L2 index")
+	}
+	if err := lp.SetMetricArg(0); err == nil {
+		t.Error("SetMetricArg accepted p=0")
+	}
+}
+
+func TestInvalidMetric(t *testing.T) {
+	check := func(name string, err error) {
+		t.Helper()
+		if !errors.Is(err, ErrInvalidMetric) || !strings.Contains(err.Error(), "42") {
+			t.Errorf("%s with metric 42 = %v, want ErrInvalidMetric naming 42", name, err)
+		}
+	}
+
+	_, err := NewIndexFlat(4, 42)
+	check("NewIndexFlat", err)
+	_, err = NewIndexIVFFlat(4, 2, 42)
+	check("NewIndexIVFFlat", err)
+	_, err = IndexFactory(4, "Flat", 42)
+	check("IndexFactory", err)
+}
+
+func TestToFlatFromIVFFlat(t *testing.T) {
+	const d, n, nlist, k = 8, 2000, 16, 10
+	x := clusteredVectors(n, d, nlist, 1)
+	ivf := newIVFFlatL2(t, d, nlist, x)
+
+	flat, err := ToFlat(ivf)
+	if err != nil {
+		t.Fatalf("ToFlat: %v", err)
+	}
+	defer flat.Close()
+
+	if flat.D() != d || flat.MetricType() != ivf.MetricType() || flat.Ntotal() != n {
+		t.Fatalf("ToFlat gave d=%d metric=%d ntotal=%d, want %d %d %d", flat.D(), flat.MetricType(), flat.Ntotal(), d, ivf.MetricType(), n)
+	}
+	vectors, err := flat.AllVectors()
+	if err != nil {
+		t.Fatalf("AllVectors: %v", err)
+	}
+	if !reflect.DeepEqual(vectors, x) {
+		t.Error("flat vectors differ from the vectors added to the IVF index")
+	}
+
+	// Visiting every list makes the IVF search exact, like the flat one
+	if err := ivf.SetNProbe(nlist); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+	queries := randomVectors(20, d, 2)
+	wantD, wantL, err := ivf.Search(queries, k)
+	if err != nil {
+		t.Fatalf("IVF Search: %v", err)
+	}
+	gotD, gotL, err := flat.Search(queries, k)
+	if err != nil {
+		t.Fatalf("flat Search: %v", err)
+	}
+	if !reflect.DeepEqual(gotL, wantL) || !approxEqual(gotD, wantD, 1e-4) {
+		t.Errorf("flat Search = %v, want %v", gotL, wantL)
+	}
+}
+
+func TestReserveKeepsCapacity(t *testing.T) {
+	const d, n = 8, 1000
+	idx := newFlatL2(t, d, nil)
+	if err := idx.Reserve(n); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	before, err := idx.FragmentationInfo()
+	if err != nil {
+		t.Fatalf("FragmentationInfo: %v", err)
+	}
+	if before.Capacity < n {
+		t.Fatalf("Capacity after Reserve(%d) = %d", n, before.Capacity)
+	}
+
+	x := randomVectors(n, d, 1)
+	for i := 0; i < n; i += 10 {
+		if err := idx.Add(x[i*d : (i+10)*d]); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	after, err := idx.FragmentationInfo()
+	if err != nil {
+		t.Fatalf("FragmentationInfo: %v", err)
+	}
+	if after.Capacity != before.Capacity {
+		t.Errorf("Capacity changed from %d to %d while filling the reservation", before.Capacity, after.Capacity)
+	}
+	if got, err := idx.AllVectors(); err != nil || !reflect.DeepEqual(got, x) {
+		t.Errorf("AllVectors after reserved adds = %v, want the added vectors", err)
+	}
+}
+
+// BenchmarkBulkAdd loads vectors through many small Add calls, with and
+// without reserving the storage first.
+func BenchmarkBulkAdd(b *testing.B) {
+	const d, n, batch = 128, 200000, 100
+	x := randomVectors(n, d, 1)
+
+	for _, reserve := range []bool{false, true} {
+		name := "NoReserve"
+		if reserve {
+			name = "Reserve"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				idx, err := NewIndexFlatL2(d)
+				if err != nil {
+					b.Fatalf("NewIndexFlatL2: %v", err)
+				}
+				b.StartTimer()
+
+				if reserve {
+					if err := idx.Reserve(n); err != nil {
+						b.Fatalf("Reserve: %v", err)
+					}
+				}
+				for j := 0; j < n; j += batch {
+					if err := idx.Add(x[j*d : (j+batch)*d]); err != nil {
+						b.Fatalf("Add: %v", err)
+					}
+				}
+
+				b.StopTimer()
+				idx.Close()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func TestToFlatSmallAndCustomIDs(t *testing.T) {
+	const d, n = 8, 10
+	x := randomVectors(n, d, 1)
+
+	hnsw, err := NewIndexHNSWL2(d, 16)
+	if err != nil {
+		t.Fatalf("NewIndexHNSWL2: %v", err)
+	}
+	defer hnsw.Delete()
+	if err := hnsw.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	flat, err := ToFlat(hnsw)
+	if err != nil {
+		t.Fatalf("ToFlat: %v", err)
+	}
+	defer flat.Close()
+	if vectors, err := flat.AllVectors(); err != nil || !reflect.DeepEqual(vectors, x) {
+		t.Errorf("ToFlat from HNSW = %v, want the added vectors", err)
+	}
+
+	// IVF IDs outside 0..Ntotal-1 can't become flat positions
+	ivf, err := NewIndexIVFFlatL2(d, 2)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer ivf.Delete()
+	if err := ivf.Train(x); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = int64(100 + i)
+	}
+	if err := ivf.AddWithIDs(x, ids); err != nil {
+		t.Fatalf("AddWithIDs: %v", err)
+	}
+	if _, err := ToFlat(ivf); err == nil {
+		t.Error("ToFlat accepted an IVF index with custom IDs")
+	}
+}
+
+func TestFlatIndexBuilderRejectsMismatchedVectors(t *testing.T) {
+	b := NewFlatIndexBuilder(3).
+		AddVector([]float32{1, 2, 3}).
+		AddVector([]float32{1, 2}).
+		AddVectors([]float32{4, 5, 6, 7, 8, 9}).
+		AddVectors([]float32{1, 2, 3, 4}).
+		AddVector([]float32{7, 8, 9})
+
+	if b.RejectedCount() != 2 || b.Err() == nil {
+		t.Fatalf("RejectedCount = %d, Err = %v, want 2 rejections", b.RejectedCount(), b.Err())
+	}
+	if b.GetVectorCount() != 4 {
+		t.Errorf("GetVectorCount = %d, want 4", b.GetVectorCount())
+	}
+	if _, err := b.Build(); err == nil {
+		t.Fatal("Build succeeded despite rejected adds")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("MustBuild didn't panic despite rejected adds")
+			}
+		}()
+		b.MustBuild()
+	}()
+
+	// AllowPartial builds with the accepted vectors only
+	idx, err := b.AllowPartial(true).Build()
+	if err != nil {
+		t.Fatalf("Build with AllowPartial: %v", err)
+	}
+	defer idx.Delete()
+	if idx.Ntotal() != 4 {
+		t.Errorf("Ntotal = %d, want 4", idx.Ntotal())
+	}
+	stored, err := idx.Reconstruct(3)
+	if err != nil {
+		t.Fatalf("Reconstruct: %v", err)
+	}
+	if want := []float32{7, 8, 9}; !slices.Equal(stored, want) {
+		t.Errorf("last vector = %v, want %v", stored, want)
+	}
+}
+
+func TestFlatIndexBuilderWithIDs(t *testing.T) {
+	b := NewFlatIndexBuilder(2).
+		AddVectorWithID([]float32{1, 0}, 100).
+		AddVectorWithID([]float32{0, 1}, 200)
+	if _, err := b.Build(); err == nil {
+		t.Error("Build accepted vectors with IDs")
+	}
+
+	idx, err := b.BuildIndex()
+	if err != nil {
+		t.Fatalf("BuildIndex: %v", err)
+	}
+	defer idx.Delete()
+	_, labels, err := idx.Search([]float32{0, 0.9}, 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if labels[0] != 200 {
+		t.Errorf("nearest label = %d, want 200", labels[0])
+	}
+
+	// IDs and positional vectors don't mix, nor do negative IDs
+	mixed := NewFlatIndexBuilder(2).
+		AddVectorWithID([]float32{1, 0}, 1).
+		AddVector([]float32{0, 1}).
+		AddVectorWithID([]float32{1, 1}, -1)
+	if mixed.RejectedCount() != 2 {
+		t.Errorf("RejectedCount = %d, want 2", mixed.RejectedCount())
+	}
+	if _, err := mixed.BuildIndex(); err == nil {
+		t.Error("BuildIndex succeeded despite rejected adds")
+	}
+}
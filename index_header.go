@@ -0,0 +1,252 @@
+package faiss
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// IndexHeader describes an index file, as read by ReadIndexHeader.
+type IndexHeader struct {
+	FourCC     string  // FAISS type tag of the top-level index, e.g. "IwFl"
+	Type       string  // Best-effort type, e.g. "IVFFlat" or "IDMap,Flat"
+	D          int     // Vector dimension
+	Ntotal     int64   // Number of indexed vectors
+	MetricType int     // Distance metric type
+	MetricArg  float32 // p of MetricLp, 0 for other metrics
+	IsTrained  bool    // Whether the index was trained when written
+	FileSize   int64   // Size of the file in bytes
+}
+
+// IndexHeaderError reports a corrupt or truncated index file, with the byte
+// offset of the field that could not be read.
+type IndexHeaderError struct {
+	Path   string
+	Offset int64
+	Field  string
+	Err    error
+}
+
+func (e *IndexHeaderError) Error() string {
+	return fmt.Sprintf("index header %s: %s at offset %d: %v", e.Path, e.Field, e.Offset, e.Err)
+}
+
+func (e *IndexHeaderError) Unwrap() error { return e.Err }
+
+// indexHeaderDummy is written twice by FAISS after ntotal.
+const indexHeaderDummy = 1 << 20
+
+// fourCCTypes maps FAISS type tags to index types. Tags not listed are
+// reported as-is.
+var fourCCTypes = map[string]string{
+	"IxF2": IndexTypeFlat,
+	"IxFI": IndexTypeFlat,
+	"IxFl": IndexTypeFlat,
+	"IwFl": IndexTypeIVFFlat,
+	"IwFL": IndexTypeIVFFlat,
+	"IwPQ": IndexTypeIVFPQ,
+	"IvPQ": IndexTypeIVFPQ,
+	"IHNf": "HNSWFlat",
+	"IHNp": "HNSWPQ",
+	"IHNs": "HNSWSQ",
+	"IxPQ": IndexTypePQ,
+	"IxPq": IndexTypePQ,
+	"IxHE": IndexTypeLSH,
+	"IxHe": IndexTypeLSH,
+	"IxSQ": "SQ",
+	"IwSQ": "IVFSQ",
+	"IwSq": "IVFSQ",
+	"IxRF": "RefineFlat",
+	"IxPT": "PreTransform",
+	"IxMp": "IDMap",
+	"IxM2": "IDMap2",
+}
+
+// ReadIndexHeader reports the type, dimension, metric and size of the index
+// stored in fname by reading only the header at the start of the file, so it
+// is cheap even for multi-GB indexes. For ID-mapped indexes the header of the
+// wrapped index is read too, to report its type.
+//
+// Fields that hold impossible values, and files too short for the header or,
+// for flat indexes, for the vectors it announces, are reported as an
+// *IndexHeaderError with the offset of the faulty field.
+func ReadIndexHeader(fname string) (IndexHeader, error) {
+	var h IndexHeader
+	if fname == "" {
+		return h, errors.New("filename is empty")
+	}
+
+	f, err := os.Open(fname)
+	if err != nil {
+		return h, wrapError(err, "open index file")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return h, wrapError(err, "stat index file")
+	}
+
+	r := &headerReader{r: bufio.NewReader(f), path: fname}
+	if err := r.readHeader(&h); err != nil {
+		return h, err
+	}
+	h.FileSize = info.Size()
+
+	switch h.FourCC {
+	case "IxMp", "IxM2":
+		var inner IndexHeader
+		if err := r.readHeader(&inner); err != nil {
+			return h, err
+		}
+		h.Type += "," + inner.Type
+	case "IxF2", "IxFI", "IxFl":
+		start := r.off
+		n, err := r.uint64("vector count")
+		if err != nil {
+			return h, err
+		}
+		if want := uint64(h.Ntotal) * uint64(h.D); n != want {
+			return h, r.corrupt(start, "vector count", fmt.Sprintf("%d floats, want %d", n, want))
+		}
+		if end := r.off + int64(n)*4; end > h.FileSize {
+			return h, &IndexHeaderError{
+				Path:   fname,
+				Offset: h.FileSize,
+				Field:  "vectors",
+				Err:    fmt.Errorf("%w: file ends before byte %d", io.ErrUnexpectedEOF, end),
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// headerReader reads little-endian FAISS fields while tracking the offset.
+type headerReader struct {
+	r    io.Reader
+	path string
+	off  int64
+	buf  [8]byte
+}
+
+func (r *headerReader) read(n int, field string) ([]byte, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, &IndexHeaderError{Path: r.path, Offset: r.off, Field: field, Err: err}
+	}
+	r.off += int64(n)
+	return r.buf[:n], nil
+}
+
+func (r *headerReader) uint32(field string) (uint32, error) {
+	b, err := r.read(4, field)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *headerReader) uint64(field string) (uint64, error) {
+	b, err := r.read(8, field)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (r *headerReader) corrupt(off int64, field, msg string) error {
+	return &IndexHeaderError{
+		Path:   r.path,
+		Offset: off,
+		Field:  field,
+		Err:    fmt.Errorf("%w: %s", ErrCorruptIndexHeader, msg),
+	}
+}
+
+// readHeader reads a type tag followed by the fields FAISS writes for every
+// index: d, ntotal, two dummies, is_trained, metric_type and, for metrics
+// other than L2 and inner product, metric_arg.
+func (r *headerReader) readHeader(h *IndexHeader) error {
+	start := r.off
+	b, err := r.read(4, "type tag")
+	if err != nil {
+		return err
+	}
+	h.FourCC = string(b)
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return r.corrupt(start, "type tag", fmt.Sprintf("%q is not a FAISS index tag", h.FourCC))
+		}
+	}
+	h.Type = h.FourCC
+	if t, ok := fourCCTypes[h.FourCC]; ok {
+		h.Type = t
+	}
+
+	start = r.off
+	d, err := r.uint32("dimension")
+	if err != nil {
+		return err
+	}
+	if int32(d) <= 0 {
+		return r.corrupt(start, "dimension", fmt.Sprintf("%d", int32(d)))
+	}
+	h.D = int(d)
+
+	start = r.off
+	ntotal, err := r.uint64("ntotal")
+	if err != nil {
+		return err
+	}
+	if int64(ntotal) < 0 {
+		return r.corrupt(start, "ntotal", fmt.Sprintf("%d", int64(ntotal)))
+	}
+	h.Ntotal = int64(ntotal)
+
+	for i := 0; i < 2; i++ {
+		start = r.off
+		dummy, err := r.uint64("reserved field")
+		if err != nil {
+			return err
+		}
+		if dummy != indexHeaderDummy {
+			return r.corrupt(start, "reserved field", fmt.Sprintf("%#x, want %#x", dummy, indexHeaderDummy))
+		}
+	}
+
+	start = r.off
+	b, err = r.read(1, "is_trained")
+	if err != nil {
+		return err
+	}
+	if b[0] > 1 {
+		return r.corrupt(start, "is_trained", fmt.Sprintf("%d", b[0]))
+	}
+	h.IsTrained = b[0] == 1
+
+	start = r.off
+	metric, err := r.uint32("metric type")
+	if err != nil {
+		return err
+	}
+	h.MetricType = int(int32(metric))
+	if err := ValidateMetric(h.MetricType); err != nil {
+		return &IndexHeaderError{Path: r.path, Offset: start, Field: "metric type", Err: err}
+	}
+
+	if h.MetricType != MetricL2 && h.MetricType != MetricInnerProduct {
+		arg, err := r.uint32("metric arg")
+		if err != nil {
+			return err
+		}
+		h.MetricArg = math.Float32frombits(arg)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package faiss
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeIndexHeaderFile writes idx to a temporary file and returns its path.
+func writeIndexHeaderFile(t *testing.T, idx Index) string {
+	t.Helper()
+
+	fname := filepath.Join(t.TempDir(), "header.index")
+	if err := WriteIndex(idx, fname); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	return fname
+}
+
+func TestReadIndexHeader(t *testing.T) {
+	const d, n = 8, 50
+	fname := writeIndexHeaderFile(t, newFlatL2(t, d, randomVectors(n, d, 1)))
+
+	h, err := ReadIndexHeader(fname)
+	if err != nil {
+		t.Fatalf("ReadIndexHeader: %v", err)
+	}
+	info, err := os.Stat(fname)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	want := IndexHeader{
+		FourCC:     "IxF2",
+		Type:       IndexTypeFlat,
+		D:          d,
+		Ntotal:     n,
+		MetricType: MetricL2,
+		IsTrained:  true,
+		FileSize:   info.Size(),
+	}
+	if h != want {
+		t.Errorf("ReadIndexHeader = %+v, want %+v", h, want)
+	}
+}
+
+func TestReadIndexHeaderMetricArg(t *testing.T) {
+	const d = 4
+	idx, err := NewIndexFlat(d, MetricLp)
+	if err != nil {
+		t.Fatalf("NewIndexFlat: %v", err)
+	}
+	defer idx.Delete()
+	if err := idx.SetMetricArg(3); err != nil {
+		t.Fatalf("SetMetricArg: %v", err)
+	}
+	if err := idx.Add(randomVectors(10, d, 1)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	// The vector count after metric_arg is only checked if metric_arg was
+	// read, so a successful read covers both.
+	h, err := ReadIndexHeader(writeIndexHeaderFile(t, idx))
+	if err != nil {
+		t.Fatalf("ReadIndexHeader: %v", err)
+	}
+	if h.MetricType != MetricLp || h.MetricArg != 3 || h.Ntotal != 10 {
+		t.Errorf("ReadIndexHeader = metric %d, arg %v, Ntotal %d, want %d, 3 and 10", h.MetricType, h.MetricArg, h.Ntotal, MetricLp)
+	}
+}
+
+func TestReadIndexHeaderCorruptFiles(t *testing.T) {
+	const d, n = 8, 50
+	fname := writeIndexHeaderFile(t, newFlatL2(t, d, randomVectors(n, d, 1)))
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		field  string
+		offset int64
+		want   error
+	}{
+		{"truncated header", data[:10], "ntotal", 8, io.ErrUnexpectedEOF},
+		{"truncated vectors", data[:len(data)-4], "vectors", int64(len(data) - 4), io.ErrUnexpectedEOF},
+		{"wrong type tag", append([]byte{0, 1, 2, 3}, data[4:]...), "type tag", 0, ErrCorruptIndexHeader},
+		{"wrong reserved field", append(append([]byte{}, data[:16]...), make([]byte, len(data)-16)...), "reserved field", 16, ErrCorruptIndexHeader},
+	} {
+		path := filepath.Join(t.TempDir(), "corrupt.index")
+		if err := os.WriteFile(path, tc.data, 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+
+		_, err := ReadIndexHeader(path)
+		var headerErr *IndexHeaderError
+		if !errors.As(err, &headerErr) || !errors.Is(err, tc.want) {
+			t.Errorf("%s: ReadIndexHeader = %v, want an IndexHeaderError matching %v", tc.name, err, tc.want)
+			continue
+		}
+		if headerErr.Field != tc.field || headerErr.Offset != tc.offset {
+			t.Errorf("%s: error at %s, offset %d, want %s, offset %d", tc.name, headerErr.Field, headerErr.Offset, tc.field, tc.offset)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package faiss
+
+/*
+#include <stdlib.h>
+#include <faiss/c_api/Index_c.h>
+#include <faiss/c_api/index_factory_c.h>
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// IndexHNSW represents a Hierarchical Navigable Small World graph index.
+// It needs no training and trades memory for fast approximate search.
+type IndexHNSW struct {
+	*faissIndex
+
+	closeMu sync.Mutex // Serializes Close
+}
+
+// NewIndexHNSW creates a new HNSW index with M connections per node
+func NewIndexHNSW(d int, M int, metric int) (*IndexHNSW, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("dimension must be positive, got %d", d)
+	}
+	if M <= 0 {
+		return nil, fmt.Errorf("M must be positive, got %d", M)
+	}
+	if err := ValidateMetric(metric); err != nil {
+		return nil, err
+	}
+
+	cdesc := C.CString(fmt.Sprintf("HNSW%d", M))
+	defer C.free(unsafe.Pointer(cdesc))
+
+	var cIdx *C.FaissIndex
+	if c := C.faiss_index_factory(&cIdx, C.int(d), cdesc, C.FaissMetricType(metric)); c != 0 {
+		return nil, wrapError(getLastError(), "IndexHNSW creation")
+	}
+
+	return &IndexHNSW{faissIndex: newFaissIndex(cIdx)}, nil
+}
+
+// NewIndexHNSWL2 creates a new HNSW index with L2 metric
+func NewIndexHNSWL2(d int, M int) (*IndexHNSW, error) {
+	return NewIndexHNSW(d, M, MetricL2)
+}
+
+// NewIndexHNSWIP creates a new HNSW index with Inner Product metric
+func NewIndexHNSWIP(d int, M int) (*IndexHNSW, error) {
+	return NewIndexHNSW(d, M, MetricInnerProduct)
+}
+
+// AsHNSW returns a typed HNSW view of idx, typically an index loaded with
+// ReadIndex, so that its graph parameters can be inspected and tuned.
+// The view shares ownership with idx: deleting either frees both.
+func AsHNSW(idx Index) (*IndexHNSW, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return nil, errors.New("index is nil")
+	}
+
+	if C.goss_IndexHNSW_check(idx.cPtr()) != 0 {
+		return nil, errors.New("index is not an IndexHNSW")
+	}
+
+	return &IndexHNSW{faissIndex: idx.native()}, nil
+}
+
+// Close frees the index and detaches it from idx. Afterwards the IndexHNSW
+// methods return ErrIndexClosed, and so do they if the index was deleted
+// through another reference such as the Index it was obtained from. It is
+// idempotent and safe to call from several goroutines at once; other methods
+// must not run concurrently with it.
+func (idx *IndexHNSW) Close() error {
+	idx.closeMu.Lock()
+	defer idx.closeMu.Unlock()
+
+	if idx.faissIndex != nil {
+		idx.faissIndex.Delete()
+	}
+	idx.faissIndex = closedIndex
+	return nil
+}
+
+// Delete frees the index. It is equivalent to Close.
+func (idx *IndexHNSW) Delete() {
+	idx.Close()
+}
+
+// GetM returns the number of connections per node on the upper graph levels
+func (idx *IndexHNSW) GetM() (int, error) {
+	if idx.closed() {
+		return 0, ErrIndexClosed
+	}
+
+	return int(C.goss_IndexHNSW_M(idx.idx)), nil
+}
+
+// GetEfSearch returns the size of the candidate list used during search
+func (idx *IndexHNSW) GetEfSearch() (int, error) {
+	if idx.closed() {
+		return 0, ErrIndexClosed
+	}
+
+	return int(C.goss_IndexHNSW_efSearch(idx.idx)), nil
+}
+
+// SetEfSearch sets the size of the candidate list used during search.
+// Larger values improve recall at the cost of latency.
+func (idx *IndexHNSW) SetEfSearch(efSearch int) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+	if efSearch <= 0 {
+		return fmt.Errorf("efSearch must be positive, got %d", efSearch)
+	}
+
+	if C.goss_IndexHNSW_set_efSearch(idx.idx, C.int(efSearch)) != 0 {
+		return errors.New("index is not an IndexHNSW")
+	}
+	return nil
+}
+
+// GetEfConstruction returns the size of the candidate list used when adding
+func (idx *IndexHNSW) GetEfConstruction() (int, error) {
+	if idx.closed() {
+		return 0, ErrIndexClosed
+	}
+
+	return int(C.goss_IndexHNSW_efConstruction(idx.idx)), nil
+}
+
+// SetEfConstruction sets the size of the candidate list used when adding.
+// It only affects vectors added afterwards.
+func (idx *IndexHNSW) SetEfConstruction(efConstruction int) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+	if efConstruction <= 0 {
+		return fmt.Errorf("efConstruction must be positive, got %d", efConstruction)
+	}
+
+	if C.goss_IndexHNSW_set_efConstruction(idx.idx, C.int(efConstruction)) != 0 {
+		return errors.New("index is not an IndexHNSW")
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ package faiss
 /*
 #include <stdlib.h>
 #include <faiss/c_api/index_io_c.h>
+#include "faiss_ext.h"
 */
 import "C"
 import (
@@ -63,5 +64,48 @@ func ReadIndex(fname string, ioflags int) (Index, error) {
 	if c := C.faiss_read_index_fname(cfname, C.int(ioflags), &cIdx); c != 0 {
 		return nil, wrapError(getLastError(), "read index operation")
 	}
-	return NewFaissIndex(cIdx), nil
+	idx := newFaissIndex(cIdx)
+	if ioflags&IOFlagMmap != 0 {
+		idx.mmapPath = fname
+	}
+	return idx, nil
+}
+
+// SerializeIndex writes idx to a byte slice in the FAISS file format, so it
+// can be stored anywhere ReadIndex's files could be.
+func SerializeIndex(idx Index) ([]byte, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return nil, errors.New("index is nil")
+	}
+
+	var buf *C.uint8_t
+	var size C.size_t
+	if c := C.goss_write_index_buf(idx.cPtr(), &buf, &size); c != 0 {
+		return nil, wrapError(getLastExtError(), "serialize index")
+	}
+	defer C.free(unsafe.Pointer(buf))
+
+	// C.GoBytes takes an int32 length, too small for large indexes.
+	data := make([]byte, int(size))
+	copy(data, unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(size)))
+	return data, nil
+}
+
+// DeserializeIndex reads an index from data written by SerializeIndex.
+func DeserializeIndex(data []byte) (Index, error) {
+	if len(data) == 0 {
+		return nil, errors.New("index data is empty")
+	}
+
+	var cIdx *C.FaissIndex
+	if c := C.goss_read_index_buf(
+		(*C.uint8_t)(unsafe.Pointer(&data[0])),
+		C.size_t(len(data)),
+		0,
+		&cIdx,
+	); c != 0 {
+		return nil, wrapError(getLastExtError(), "deserialize index")
+	}
+
+	return newFaissIndex(cIdx), nil
 }
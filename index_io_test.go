@@ -0,0 +1,159 @@
+package faiss
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// roundTrip writes idx to a temporary file and reads it back.
+func roundTrip(t *testing.T, idx Index) Index {
+	t.Helper()
+
+	fname := filepath.Join(t.TempDir(), "index.faiss")
+	if err := WriteIndex(idx, fname); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	loaded, err := ReadIndex(fname, 0)
+	if err != nil {
+		t.Fatalf("ReadIndex: %v", err)
+	}
+	t.Cleanup(loaded.Delete)
+	return loaded
+}
+
+func TestHNSWRoundTripKeepsParameters(t *testing.T) {
+	const d = 16
+	x := randomVectors(2000, d, 1)
+
+	idx, err := NewIndexHNSW(d, 24, MetricL2)
+	if err != nil {
+		t.Fatalf("NewIndexHNSW: %v", err)
+	}
+	defer idx.Delete()
+	if err := idx.SetEfConstruction(80); err != nil {
+		t.Fatalf("SetEfConstruction: %v", err)
+	}
+	if err := idx.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := idx.SetEfSearch(48); err != nil {
+		t.Fatalf("SetEfSearch: %v", err)
+	}
+
+	hnsw, err := AsHNSW(roundTrip(t, idx))
+	if err != nil {
+		t.Fatalf("AsHNSW: %v", err)
+	}
+	if m, err := hnsw.GetM(); err != nil || m != 24 {
+		t.Errorf("GetM = %d, %v, want 24", m, err)
+	}
+	if ef, err := hnsw.GetEfConstruction(); err != nil || ef != 80 {
+		t.Errorf("GetEfConstruction = %d, %v, want 80", ef, err)
+	}
+	if ef, err := hnsw.GetEfSearch(); err != nil || ef != 48 {
+		t.Errorf("GetEfSearch = %d, %v, want 48", ef, err)
+	}
+
+	queries := randomVectors(10, d, 2)
+	_, want, err := idx.Search(queries, 5)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	_, got, err := hnsw.Search(queries, 5)
+	if err != nil {
+		t.Fatalf("Search after load: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search after load = %v, want %v", got, want)
+	}
+
+	// The loaded graph accepts new vectors, which are found by search
+	extra := randomVectors(100, d, 3)
+	if err := hnsw.Add(extra); err != nil {
+		t.Fatalf("Add after load: %v", err)
+	}
+	if got := hnsw.Ntotal(); got != 2100 {
+		t.Errorf("Ntotal after Add = %d, want 2100", got)
+	}
+	_, labels, err := hnsw.Search(extra[:d], 1)
+	if err != nil {
+		t.Fatalf("Search for added vector: %v", err)
+	}
+	if labels[0] != 2000 {
+		t.Errorf("nearest neighbor of added vector 2000 is %d", labels[0])
+	}
+}
+
+func TestIVFRoundTripKeepsParameters(t *testing.T) {
+	const d, nlist = 16, 16
+	x := clusteredVectors(2000, d, nlist, 1)
+
+	flat := newIVFFlatL2(t, d, nlist, x)
+	if err := flat.SetNProbe(5); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+	ivfFlat, err := AsIVFFlat(roundTrip(t, flat))
+	if err != nil {
+		t.Fatalf("AsIVFFlat: %v", err)
+	}
+	checkIVFParams(t, ivfFlat, nlist, 5)
+
+	pq, err := NewIndexIVFPQ(d, nlist, 4, 8, MetricL2)
+	if err != nil {
+		t.Fatalf("NewIndexIVFPQ: %v", err)
+	}
+	defer pq.Delete()
+	if err := pq.Train(x); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	if err := pq.SetNProbe(7); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+	ivfPQ, err := AsIVFPQ(roundTrip(t, pq))
+	if err != nil {
+		t.Fatalf("AsIVFPQ: %v", err)
+	}
+	checkIVFParams(t, ivfPQ, nlist, 7)
+	if m, err := ivfPQ.GetM(); err != nil || m != 4 {
+		t.Errorf("GetM = %d, %v, want 4", m, err)
+	}
+	if nbits, err := ivfPQ.GetNBits(); err != nil || nbits != 8 {
+		t.Errorf("GetNBits = %d, %v, want 8", nbits, err)
+	}
+}
+
+func checkIVFParams(t *testing.T, idx nprobeTuner, nlist, nprobe int) {
+	t.Helper()
+
+	if got, err := idx.GetNList(); err != nil || got != nlist {
+		t.Errorf("%T: GetNList = %d, %v, want %d", idx, got, err, nlist)
+	}
+	if got, err := idx.GetNProbe(); err != nil || got != nprobe {
+		t.Errorf("%T: GetNProbe = %d, %v, want %d", idx, got, err, nprobe)
+	}
+
+	// Changes through the view are visible through the C index
+	if err := idx.SetNProbe(2); err != nil {
+		t.Fatalf("%T: SetNProbe: %v", idx, err)
+	}
+	if got, err := idx.GetNProbe(); err != nil || got != 2 {
+		t.Errorf("%T: GetNProbe after SetNProbe = %d, %v, want 2", idx, got, err)
+	}
+}
+
+func TestGetNProbeSharedAcrossViews(t *testing.T) {
+	const d, nlist = 8, 8
+	idx := newIVFFlatL2(t, d, nlist, clusteredVectors(1000, d, nlist, 1))
+
+	view, err := AsIVFFlat(idx)
+	if err != nil {
+		t.Fatalf("AsIVFFlat: %v", err)
+	}
+	if err := view.SetNProbe(4); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+	if got, err := idx.GetNProbe(); err != nil || got != 4 {
+		t.Errorf("GetNProbe on the original = %d, %v, want 4", got, err)
+	}
+}
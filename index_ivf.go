@@ -0,0 +1,472 @@
+package faiss
+
+/*
+#include <faiss/c_api/Index_c.h>
+#include <faiss/c_api/IndexIVF_c.h>
+#include <faiss/c_api/IndexFlat_c.h>
+#include <faiss/c_api/Clustering_c.h>
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"unsafe"
+)
+
+// maxPointsPerCentroid matches the FAISS k-means default: training points
+// beyond this many per centroid are subsampled away by FAISS anyway.
+const maxPointsPerCentroid = 256
+
+// Bounds applied by SuggestIVFParams
+const (
+	// minPointsPerCentroid is the FAISS k-means minimum: with fewer training
+	// points per centroid, clustering warns and centroids are poor.
+	minPointsPerCentroid = 39
+	maxSuggestedNList    = 65536
+)
+
+// SuggestIVFParams suggests nlist and nprobe for an IVF index over n vectors,
+// following the usual heuristic: nlist around 4*sqrt(n), rounded down to a
+// power of two, and nprobe = nlist/16. nlist is clamped to [1, 65536] and to
+// at most n/39 so that training on all n vectors gives enough points per
+// centroid; nprobe is at least 1.
+//
+// For example n = 1000 gives (16, 1), n = 1e6 gives (2048, 128) and n = 1e9
+// or more gives (65536, 4096).
+func SuggestIVFParams(n int64) (nlist, nprobe int) {
+	if n <= 0 {
+		return 1, 1
+	}
+
+	target := 4 * math.Sqrt(float64(n))
+	if limit := float64(n / minPointsPerCentroid); target > limit {
+		target = limit
+	}
+	if target > maxSuggestedNList {
+		target = maxSuggestedNList
+	}
+
+	nlist = 1
+	for float64(nlist*2) <= target {
+		nlist *= 2
+	}
+
+	nprobe = nlist / 16
+	if nprobe < 1 {
+		nprobe = 1
+	}
+	return nlist, nprobe
+}
+
+// TrainOptions controls the k-means clustering used to train an IVF index.
+// Zero values keep the index's own clustering parameters, except Seed which
+// is always applied.
+type TrainOptions struct {
+	Seed    int64 // Random seed for k-means initialization, within the int32 range
+	NIter   int   // Number of k-means iterations
+	NRedo   int   // Number of k-means runs, the best one is kept
+	Verbose bool  // Print clustering progress
+}
+
+var randomSeed struct {
+	sync.Mutex
+	set  bool
+	seed int64
+}
+
+// SetRandomSeed sets the seed of the k-means clustering run by Train on IVF
+// indexes, making training reproducible: the same seed and data always yield
+// the same centroids. Use TrainWithOptions for a per-call seed. FAISS seeds
+// are 32-bit: training fails if seed is outside the int32 range.
+func SetRandomSeed(seed int64) {
+	randomSeed.Lock()
+	defer randomSeed.Unlock()
+
+	randomSeed.set = true
+	randomSeed.seed = seed
+}
+
+// currentRandomSeed returns the seed set by SetRandomSeed, if any.
+func currentRandomSeed() (int64, bool) {
+	randomSeed.Lock()
+	defer randomSeed.Unlock()
+
+	return randomSeed.seed, randomSeed.set
+}
+
+// shouldRetrain reports whether the imbalance factor of the inverted lists
+// of idx exceeds threshold.
+func shouldRetrain(idx *faissIndex, threshold float64) (bool, error) {
+	if threshold < 1 {
+		return false, fmt.Errorf("imbalance threshold must be at least 1, got %v", threshold)
+	}
+
+	report, err := idx.FragmentationInfo()
+	if err != nil {
+		return false, err
+	}
+	return report.ImbalanceFactor > threshold, nil
+}
+
+// trainIVF trains an IVF index, running the coarse k-means itself with opts.
+func trainIVF(cIdx *C.FaissIndex, x []float32, opts TrainOptions) error {
+	centroids, err := ivfCentroids(cIdx, x, opts)
+	if err != nil {
+		return err
+	}
+	return trainIVFWithCentroids(cIdx, x, centroids)
+}
+
+// ivfCentroids runs the coarse k-means of an IVF index on x with opts and
+// returns the nlist centroids, leaving the index untouched.
+func ivfCentroids(cIdx *C.FaissIndex, x []float32, opts TrainOptions) ([]float32, error) {
+	if opts.Seed < math.MinInt32 || opts.Seed > math.MaxInt32 {
+		return nil, fmt.Errorf("seed %d is outside the int32 range of FAISS seeds", opts.Seed)
+	}
+
+	d := int(C.faiss_Index_d(cIdx))
+	if err := ValidateVectors(x, d); err != nil {
+		return nil, wrapError(err, "train vectors validation")
+	}
+	n := len(x) / d
+
+	ivf := C.faiss_IndexIVF_cast(cIdx)
+	if ivf == nil {
+		return nil, errors.New("index is not an IVF index")
+	}
+	nlist := int(C.faiss_IndexIVF_nlist(ivf))
+
+	// Start from the parameters IndexIVF::train would use, e.g. fewer
+	// iterations than plain k-means and spherical centroids for inner product
+	var cp C.FaissClusteringParameters
+	if c := C.goss_IndexIVF_clustering_params(cIdx, &cp); c != 0 {
+		return nil, wrapError(getLastExtError(), "clustering parameters")
+	}
+	cp.seed = C.int(opts.Seed)
+	if opts.NIter > 0 {
+		cp.niter = C.int(opts.NIter)
+	}
+	if opts.NRedo > 0 {
+		cp.nredo = C.int(opts.NRedo)
+	}
+	if opts.Verbose {
+		cp.verbose = 1
+	}
+
+	var clus *C.FaissClustering
+	if c := C.faiss_Clustering_new_with_params(&clus, C.int(d), C.int(nlist), &cp); c != 0 {
+		return nil, wrapError(getLastError(), "clustering creation")
+	}
+	defer C.faiss_Clustering_free(clus)
+
+	var assign *C.FaissIndex
+	if c := C.faiss_IndexFlat_new_with(&assign, C.idx_t(d), C.faiss_Index_metric_type(cIdx)); c != 0 {
+		return nil, wrapError(getLastError(), "clustering assignment index creation")
+	}
+	defer C.faiss_Index_free(assign)
+
+	if c := C.faiss_Clustering_train(clus, C.idx_t(n), (*C.float)(&x[0]), assign); c != 0 {
+		return nil, wrapError(getLastError(), "clustering train operation")
+	}
+
+	var centroids *C.float
+	var size C.size_t
+	C.faiss_Clustering_centroids(clus, &centroids, &size)
+	if centroids == nil || int(size) != nlist*d {
+		return nil, fmt.Errorf("clustering produced %d values, expected %d", int(size), nlist*d)
+	}
+	return append([]float32(nil), unsafe.Slice((*float32)(unsafe.Pointer(centroids)), nlist*d)...), nil
+}
+
+// trainIVFWithCentroids trains an IVF index on x, using centroids from
+// ivfCentroids for its coarse quantizer.
+func trainIVFWithCentroids(cIdx *C.FaissIndex, x []float32, centroids []float32) error {
+	ivf := C.faiss_IndexIVF_cast(cIdx)
+	if ivf == nil {
+		return errors.New("index is not an IVF index")
+	}
+	nlist := int(C.faiss_IndexIVF_nlist(ivf))
+	n := len(x) / int(C.faiss_Index_d(cIdx))
+
+	// Seed the coarse quantizer with the centroids: IVF training skips its
+	// own k-means when the quantizer already holds nlist trained centroids.
+	quantizer := C.faiss_IndexIVF_quantizer(ivf)
+	if c := C.faiss_Index_reset(quantizer); c != 0 {
+		return wrapError(getLastError(), "quantizer reset")
+	}
+	if c := C.goss_Index_add(quantizer, C.idx_t(nlist), (*C.float)(&centroids[0])); c != 0 {
+		return wrapError(getLastError(), "quantizer add centroids")
+	}
+
+	if c := C.goss_Index_train(cIdx, C.idx_t(n), (*C.float)(&x[0])); c != 0 {
+		return wrapError(getLastError(), "train operation")
+	}
+	return nil
+}
+
+// ivfListIDs returns the IDs stored in inverted list listNo of an IVF index.
+func ivfListIDs(cIdx *C.FaissIndex, listNo int) ([]int64, error) {
+	if cIdx == nil {
+		return nil, errors.New("index is nil")
+	}
+
+	ivf := C.faiss_IndexIVF_cast(cIdx)
+	if ivf == nil {
+		return nil, errors.New("index is not an IVF index")
+	}
+
+	nlist := int(C.faiss_IndexIVF_nlist(ivf))
+	if listNo < 0 || listNo >= nlist {
+		return nil, fmt.Errorf("invalid list number: %d (valid range: 0-%d)", listNo, nlist-1)
+	}
+
+	size := int(C.faiss_IndexIVF_get_list_size(ivf, C.size_t(listNo)))
+	ids := make([]int64, size)
+	if size == 0 {
+		return ids, nil
+	}
+
+	C.faiss_IndexIVF_invlists_get_ids(ivf, C.size_t(listNo), (*C.idx_t)(&ids[0]))
+	return ids, nil
+}
+
+// GetInvertedListIDs returns the IDs of the vectors stored in inverted list listNo
+func (idx *IndexIVFFlat) GetInvertedListIDs(listNo int) ([]int64, error) {
+	if idx.closed() {
+		return nil, ErrIndexClosed
+	}
+
+	return ivfListIDs(idx.idx, listNo)
+}
+
+// TrainWithOptions trains the index like Train, but runs the coarse k-means
+// with the given options.
+func (idx *IndexIVFPQ) TrainWithOptions(x []float32, opts TrainOptions) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	return trainIVF(idx.idx, x, opts)
+}
+
+// GetInvertedListIDs returns the IDs of the vectors stored in inverted list listNo
+func (idx *IndexIVFPQ) GetInvertedListIDs(listNo int) ([]int64, error) {
+	if idx.closed() {
+		return nil, ErrIndexClosed
+	}
+
+	return ivfListIDs(idx.idx, listNo)
+}
+
+// trainChunked trains idx on a reservoir sample of sampleSize vectors drawn
+// from chunks, which returns false once the data is exhausted.
+func trainChunked(idx Index, sampleSize int, chunks func() ([]float32, bool)) error {
+	if chunks == nil {
+		return errors.New("chunk source is nil")
+	}
+
+	_, err := TrainFromStream(idx, func() ([]float32, error) {
+		chunk, ok := chunks()
+		if !ok {
+			return nil, io.EOF
+		}
+		return chunk, nil
+	}, sampleSize)
+	return err
+}
+
+// TrainChunked trains the index on data pulled lazily from chunks until it
+// returns false. FAISS k-means can't be trained incrementally, so a uniform
+// reservoir sample of nlist*256 vectors, the most k-means would use, is
+// kept in memory and trained on once the data is exhausted.
+func (idx *IndexIVFFlat) TrainChunked(chunks func() ([]float32, bool)) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+
+	return trainChunked(idx, idx.nlist*maxPointsPerCentroid, chunks)
+}
+
+// TrainChunked trains the index on data pulled lazily from chunks until it
+// returns false. As for IndexIVFFlat, training runs on a reservoir sample,
+// large enough for both the coarse quantizer and the PQ codebooks.
+func (idx *IndexIVFPQ) TrainChunked(chunks func() ([]float32, bool)) error {
+	nlist, err := idx.GetNList()
+	if err != nil {
+		return err
+	}
+	nbits, err := idx.GetNBits()
+	if err != nil {
+		return err
+	}
+
+	centroids := nlist
+	if ksub := 1 << nbits; ksub > centroids {
+		centroids = ksub
+	}
+	return trainChunked(idx, centroids*maxPointsPerCentroid, chunks)
+}
+
+// assignToLists returns the inverted list of each vector in x, as chosen by
+// the coarse quantizer of an IVF index.
+func (idx *faissIndex) assignToLists(x []float32) ([]int64, error) {
+	ivf := C.faiss_IndexIVF_cast(idx.idx)
+	if ivf == nil {
+		return nil, errors.New("index is not an IVF index")
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return nil, wrapError(err, "assign vectors validation")
+	}
+
+	if !idx.IsTrained() {
+		return nil, wrapError(ErrIndexNotTrained, "assign to lists")
+	}
+
+	n := len(x) / d
+	listNos := make([]int64, n)
+	quantizer := C.faiss_IndexIVF_quantizer(ivf)
+	if c := C.goss_Index_assign(quantizer, C.idx_t(n), (*C.float)(&x[0]), (*C.idx_t)(&listNos[0]), 1); c != 0 {
+		return nil, wrapError(getLastError(), "assign to lists")
+	}
+	return listNos, nil
+}
+
+// coarseDistances returns the distance from each vector of x to its nearest
+// centroid, as reported by the coarse quantizer of an IVF index.
+func (idx *faissIndex) coarseDistances(x []float32) ([]float32, error) {
+	ivf := C.faiss_IndexIVF_cast(idx.idx)
+	if ivf == nil {
+		return nil, errors.New("index is not an IVF index")
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return nil, wrapError(err, "coarse distances vectors validation")
+	}
+
+	if !idx.IsTrained() {
+		return nil, wrapError(ErrIndexNotTrained, "coarse distances")
+	}
+
+	n := len(x) / d
+	distances := make([]float32, n)
+	labels := make([]int64, n)
+	quantizer := C.faiss_IndexIVF_quantizer(ivf)
+	if c := C.goss_Index_search(
+		quantizer,
+		C.idx_t(n),
+		(*C.float)(&x[0]),
+		1,
+		(*C.float)(&distances[0]),
+		(*C.idx_t)(&labels[0]),
+	); c != 0 {
+		return nil, wrapError(getLastError(), "coarse distances")
+	}
+	return distances, nil
+}
+
+// addPreassigned adds x to the given inverted lists of an IVF index, skipping
+// coarse quantization. xids may be nil for sequential IDs.
+func (idx *faissIndex) addPreassigned(x []float32, xids []int64, listNos []int64) error {
+	ivf := C.faiss_IndexIVF_cast(idx.idx)
+	if ivf == nil {
+		return errors.New("index is not an IVF index")
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return wrapError(err, "add preassigned vectors validation")
+	}
+
+	if !idx.IsTrained() {
+		return wrapError(ErrIndexNotTrained, "add preassigned")
+	}
+
+	n := len(x) / d
+	if xids != nil && len(xids) != n {
+		return fmt.Errorf("number of IDs (%d) doesn't match number of vectors (%d)", len(xids), n)
+	}
+	if len(listNos) != n {
+		return fmt.Errorf("number of list numbers (%d) doesn't match number of vectors (%d)", len(listNos), n)
+	}
+
+	nlist := int64(C.faiss_IndexIVF_nlist(ivf))
+	for i, list := range listNos {
+		if list < 0 || list >= nlist {
+			return fmt.Errorf("list number %d of vector %d is out of range [0, %d)", list, i, nlist)
+		}
+	}
+
+	var cxids *C.idx_t
+	if xids != nil {
+		cxids = (*C.idx_t)(&xids[0])
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if c := C.goss_IndexIVF_add_core(
+		idx.idx,
+		C.idx_t(n),
+		(*C.float)(&x[0]),
+		cxids,
+		(*C.idx_t)(&listNos[0]),
+	); c != 0 {
+		return wrapError(getLastExtError(), "add preassigned")
+	}
+	return nil
+}
+
+// AssignToLists returns the inverted list each vector of x would be added
+// to. It only reads the coarse quantizer, so it can run concurrently from
+// several goroutines to parallelize ingestion before AddPreassigned.
+func (idx *IndexIVFFlat) AssignToLists(x []float32) ([]int64, error) {
+	if idx.closed() {
+		return nil, ErrIndexClosed
+	}
+
+	return idx.assignToLists(x)
+}
+
+// AddPreassigned adds x with IDs xids to the inverted lists listNos, as
+// computed by AssignToLists, skipping coarse quantization. xids may be nil
+// for sequential IDs. Every list number must be in [0, nlist).
+func (idx *IndexIVFFlat) AddPreassigned(x []float32, xids []int64, listNos []int64) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+
+	return idx.addPreassigned(x, xids, listNos)
+}
+
+// AssignToLists returns the inverted list each vector of x would be added
+// to. See IndexIVFFlat.AssignToLists.
+func (idx *IndexIVFPQ) AssignToLists(x []float32) ([]int64, error) {
+	if idx.closed() {
+		return nil, ErrIndexClosed
+	}
+
+	return idx.assignToLists(x)
+}
+
+// AddPreassigned adds x to the inverted lists listNos, skipping coarse
+// quantization. See IndexIVFFlat.AddPreassigned.
+func (idx *IndexIVFPQ) AddPreassigned(x []float32, xids []int64, listNos []int64) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+
+	return idx.addPreassigned(x, xids, listNos)
+}
@@ -6,21 +6,23 @@ package faiss
 #include <faiss/c_api/IndexIVF_c.h>
 #include <faiss/c_api/IndexIVFFlat_c.h>
 #include <faiss/c_api/index_factory_c.h>
+#include "faiss_ext.h"
 */
 import "C"
 import (
 	"errors"
 	"fmt"
-	"runtime"
+	"sort"
+	"sync"
 	"unsafe"
 )
 
 // IndexIVFFlat represents an IVF (Inverted File) index with flat storage
 // This index type clusters vectors into groups and stores them uncompressed
 type IndexIVFFlat struct {
-	*faissIndex     // Embedding the concrete faissIndex type instead of interface
-	nlist       int // Store nlist value for easy access
-	nprobe      int // Store nprobe value for easy access
+	*faissIndex            // Embedding the concrete faissIndex type instead of interface
+	nlist       int        // Store nlist value for easy access
+	closeMu     sync.Mutex // Serializes Close
 }
 
 // NewIndexIVFFlat creates a new IVF index with flat storage
@@ -31,6 +33,9 @@ func NewIndexIVFFlat(d int, nlist int, metric int) (*IndexIVFFlat, error) {
 	if nlist <= 0 {
 		return nil, fmt.Errorf("nlist must be positive, got %d", nlist)
 	}
+	if err := ValidateMetric(metric); err != nil {
+		return nil, err
+	}
 
 	var cIdx *C.FaissIndex
 	description := fmt.Sprintf("IVF%d,Flat", nlist)
@@ -42,9 +47,47 @@ func NewIndexIVFFlat(d int, nlist int, metric int) (*IndexIVFFlat, error) {
 		return nil, wrapError(getLastError(), "IndexIVFFlat creation")
 	}
 
-	idx := &faissIndex{idx: cIdx}
-	runtime.SetFinalizer(idx, (*faissIndex).Delete)
-	return &IndexIVFFlat{faissIndex: idx, nlist: nlist, nprobe: 1}, nil
+	return &IndexIVFFlat{faissIndex: newFaissIndex(cIdx), nlist: nlist}, nil
+}
+
+// Close frees the index and detaches it from idx. Afterwards the
+// IndexIVFFlat methods return ErrIndexClosed, and so do they if the index
+// was deleted through another reference such as the Index it was obtained
+// from. It is idempotent and safe to call from several goroutines at once;
+// other methods must not run concurrently with it.
+func (idx *IndexIVFFlat) Close() error {
+	idx.closeMu.Lock()
+	defer idx.closeMu.Unlock()
+
+	if idx.faissIndex != nil {
+		idx.faissIndex.Delete()
+	}
+	idx.faissIndex = closedIndex
+	return nil
+}
+
+// Delete frees the index. It is equivalent to Close.
+func (idx *IndexIVFFlat) Delete() {
+	idx.Close()
+}
+
+// AsIVFFlat returns a typed IVF flat view of idx, typically an index loaded
+// with ReadIndex, so that nprobe can be tuned. nlist and nprobe are read from
+// the C index. The view shares ownership with idx: deleting either frees both.
+func AsIVFFlat(idx Index) (*IndexIVFFlat, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return nil, errors.New("index is nil")
+	}
+
+	if C.faiss_IndexIVFFlat_cast(idx.cPtr()) == nil {
+		return nil, errors.New("index is not an IndexIVFFlat")
+	}
+
+	ivf := C.faiss_IndexIVF_cast(idx.cPtr())
+	return &IndexIVFFlat{
+		faissIndex: idx.native(),
+		nlist:      int(C.faiss_IndexIVF_nlist(ivf)),
+	}, nil
 }
 
 // NewIndexIVFFlatL2 creates a new IVF index with L2 metric
@@ -69,26 +112,30 @@ func NewIndexIVFFlatLinf(d int, nlist int) (*IndexIVFFlat, error) {
 
 // GetNList returns the number of clusters (inverted lists)
 func (idx *IndexIVFFlat) GetNList() (int, error) {
-	if idx.faissIndex == nil {
-		return 0, fmt.Errorf("index is nil")
+	if idx.closed() {
+		return 0, ErrIndexClosed
 	}
 
 	return idx.nlist, nil
 }
 
-// GetNProbe returns the number of clusters to visit during search
+// GetNProbe returns the number of clusters to visit during search. It is
+// read from the C index, so it reflects changes made through other views.
 func (idx *IndexIVFFlat) GetNProbe() (int, error) {
-	if idx.faissIndex == nil {
-		return 0, fmt.Errorf("index is nil")
+	if idx.closed() {
+		return 0, ErrIndexClosed
 	}
 
-	return idx.nprobe, nil
+	return int(C.faiss_IndexIVF_nprobe(C.faiss_IndexIVF_cast(idx.idx))), nil
 }
 
 // SetNProbe sets the number of clusters to visit during search
 func (idx *IndexIVFFlat) SetNProbe(nprobe int) error {
-	if idx.faissIndex == nil {
-		return errors.New("index is nil")
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
 	}
 	if nprobe <= 0 {
 		return fmt.Errorf("nprobe must be positive, got %d", nprobe)
@@ -97,14 +144,168 @@ func (idx *IndexIVFFlat) SetNProbe(nprobe int) error {
 		return fmt.Errorf("nprobe (%d) cannot be greater than nlist (%d)", nprobe, idx.nlist)
 	}
 
-	idx.nprobe = nprobe
+	ivf := C.faiss_IndexIVF_cast(idx.idx)
+	if ivf == nil {
+		return errors.New("index is not an IVF index")
+	}
+	C.faiss_IndexIVF_set_nprobe(ivf, C.size_t(nprobe))
 	return nil
 }
 
+// TrainWithOptions trains the index like Train, but runs the coarse k-means
+// with the given options. The same seed and data always produce the same
+// centroids, and therefore the same search results.
+func (idx *IndexIVFFlat) TrainWithOptions(x []float32, opts TrainOptions) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	return trainIVF(idx.idx, x, opts)
+}
+
+// TrainChecked runs AnalyzeTrainingData on x and trains the index only if
+// no problems are found, returning a *TrainingDataError holding the report
+// otherwise. AllowTrainingProblems trains regardless.
+func (idx *IndexIVFFlat) TrainChecked(x []float32, opts ...TrainCheckOption) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+
+	return trainChecked(idx.faissIndex, x, opts)
+}
+
+// Retrain re-clusters the coarse quantizer on newTrainingData and reassigns
+// every stored vector to the new lists, keeping its ID. Use it when the data
+// has drifted away from the distribution the index was trained on, as
+// reported by a DriftMonitor. K-means uses the seed set by SetRandomSeed, or
+// 0 if none was set.
+//
+// All stored vectors are decoded into memory first, which takes
+// Ntotal*D*4 bytes. Adds are blocked until Retrain returns, but searches
+// must not run meanwhile: they would see a partially rebuilt index. If
+// k-means fails, e.g. with fewer training vectors than lists, the index is
+// left unchanged; if re-adding fails, it is left with only part of the
+// vectors.
+func (idx *IndexIVFFlat) Retrain(newTrainingData []float32) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(newTrainingData, d); err != nil {
+		return wrapError(err, "retrain vectors validation")
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// Decode the vectors list by list, with their IDs.
+	ntotal := int(idx.Ntotal())
+	vectors := make([]float32, ntotal*d)
+	ids := make([]int64, 0, ntotal)
+	for list := 0; list < idx.nlist; list++ {
+		listIDs, err := ivfListIDs(idx.idx, list)
+		if err != nil {
+			return wrapError(err, "retrain read list")
+		}
+		if len(listIDs) == 0 {
+			continue
+		}
+		if c := C.goss_IndexIVF_reconstruct_list(
+			idx.idx,
+			C.size_t(list),
+			(*C.float)(&vectors[len(ids)*d]),
+		); c != 0 {
+			return wrapError(getLastExtError(), "retrain read list")
+		}
+		ids = append(ids, listIDs...)
+	}
+
+	// Re-add in ID order, so that indexes using sequential IDs, possibly
+	// with a direct map, can use plain adds.
+	order := make([]int, len(ids))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return ids[order[a]] < ids[order[b]] })
+	sequential := true
+	for i, j := range order {
+		if ids[j] != int64(i) {
+			sequential = false
+			break
+		}
+	}
+
+	opts := TrainOptions{Verbose: C.faiss_Index_verbose(idx.idx) != 0}
+	if seed, ok := currentRandomSeed(); ok {
+		opts.Seed = seed
+	}
+
+	// Run k-means before touching the index, so that a failed clustering
+	// leaves every vector in place.
+	centroids, err := ivfCentroids(idx.idx, newTrainingData, opts)
+	if err != nil {
+		return wrapError(err, "retrain")
+	}
+	if c := C.faiss_Index_reset(idx.idx); c != 0 {
+		return wrapError(getLastError(), "retrain reset")
+	}
+	if err := trainIVFWithCentroids(idx.idx, newTrainingData, centroids); err != nil {
+		return wrapError(err, "retrain")
+	}
+
+	chunk := make([]float32, 0, DefaultAddBatchSize*d)
+	chunkIDs := make([]int64, 0, DefaultAddBatchSize)
+	for start := 0; start < len(order); start += DefaultAddBatchSize {
+		end := start + DefaultAddBatchSize
+		if end > len(order) {
+			end = len(order)
+		}
+
+		chunk, chunkIDs = chunk[:0], chunkIDs[:0]
+		for _, j := range order[start:end] {
+			chunk = append(chunk, vectors[j*d:(j+1)*d]...)
+			chunkIDs = append(chunkIDs, ids[j])
+		}
+
+		n := C.idx_t(end - start)
+		var c C.int
+		if sequential {
+			c = C.goss_Index_add(idx.idx, n, (*C.float)(&chunk[0]))
+		} else {
+			c = C.goss_Index_add_with_ids(idx.idx, n, (*C.float)(&chunk[0]), (*C.idx_t)(&chunkIDs[0]))
+		}
+		if c != 0 {
+			return wrapError(getLastError(), fmt.Sprintf("retrain re-add %d-%d", start, end-1))
+		}
+	}
+
+	return nil
+}
+
+// ShouldRetrain reports whether the inverted lists have become imbalanced
+// enough to warrant Retrain: whether the ImbalanceFactor reported by
+// FragmentationInfo exceeds threshold. A balanced index has a factor of 1;
+// values around 2 or more usually come with slower searches and lower
+// recall for a given nprobe.
+func (idx *IndexIVFFlat) ShouldRetrain(threshold float64) (bool, error) {
+	if idx.closed() {
+		return false, ErrIndexClosed
+	}
+
+	return shouldRetrain(idx.faissIndex, threshold)
+}
+
 // GetClusterCentroids returns the centroids of all clusters
 func (idx *IndexIVFFlat) GetClusterCentroids() ([][]float32, error) {
-	if idx.faissIndex == nil {
-		return nil, errors.New("index is nil")
+	if idx.closed() {
+		return nil, ErrIndexClosed
 	}
 
 	dim := idx.faissIndex.D()
@@ -112,9 +313,24 @@ func (idx *IndexIVFFlat) GetClusterCentroids() ([][]float32, error) {
 		return nil, errors.New("failed to get dimension from index")
 	}
 
+	if !idx.IsTrained() {
+		return nil, wrapError(ErrIndexNotTrained, "get cluster centroids")
+	}
+
+	ivf := C.faiss_IndexIVF_cast(idx.idx)
+	if ivf == nil {
+		return nil, errors.New("index is not an IVF index")
+	}
+
+	flat := make([]float32, idx.nlist*dim)
+	quantizer := C.faiss_IndexIVF_quantizer(ivf)
+	if c := C.faiss_Index_reconstruct_n(quantizer, 0, C.idx_t(idx.nlist), (*C.float)(&flat[0])); c != 0 {
+		return nil, wrapError(getLastError(), "reconstruct centroids")
+	}
+
 	centroids := make([][]float32, idx.nlist)
 	for i := 0; i < idx.nlist; i++ {
-		centroids[i] = make([]float32, dim)
+		centroids[i] = flat[i*dim : (i+1)*dim]
 	}
 
 	return centroids, nil
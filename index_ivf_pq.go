@@ -0,0 +1,168 @@
+package faiss
+
+/*
+#include <stdlib.h>
+#include <faiss/c_api/Index_c.h>
+#include <faiss/c_api/IndexIVF_c.h>
+#include <faiss/c_api/index_factory_c.h>
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// IndexIVFPQ represents an IVF index storing product-quantized vectors.
+// It must be trained before vectors are added.
+type IndexIVFPQ struct {
+	*faissIndex
+
+	closeMu sync.Mutex // Serializes Close
+}
+
+// NewIndexIVFPQ creates a new IVF index with nlist clusters and PQ codes of
+// m sub-vectors of nbits bits each
+func NewIndexIVFPQ(d int, nlist int, m int, nbits int, metric int) (*IndexIVFPQ, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("dimension must be positive, got %d", d)
+	}
+	if nlist <= 0 {
+		return nil, fmt.Errorf("nlist must be positive, got %d", nlist)
+	}
+	if m <= 0 || d%m != 0 {
+		return nil, fmt.Errorf("m must be a positive divisor of dimension %d, got %d", d, m)
+	}
+	if nbits <= 0 {
+		return nil, fmt.Errorf("nbits must be positive, got %d", nbits)
+	}
+	if err := ValidateMetric(metric); err != nil {
+		return nil, err
+	}
+
+	cdesc := C.CString(fmt.Sprintf("IVF%d,PQ%dx%d", nlist, m, nbits))
+	defer C.free(unsafe.Pointer(cdesc))
+
+	var cIdx *C.FaissIndex
+	if c := C.faiss_index_factory(&cIdx, C.int(d), cdesc, C.FaissMetricType(metric)); c != 0 {
+		return nil, wrapError(getLastError(), "IndexIVFPQ creation")
+	}
+
+	return &IndexIVFPQ{faissIndex: newFaissIndex(cIdx)}, nil
+}
+
+// AsIVFPQ returns a typed IVFPQ view of idx, typically an index loaded with
+// ReadIndex, so that nprobe can be tuned.
+// The view shares ownership with idx: deleting either frees both.
+func AsIVFPQ(idx Index) (*IndexIVFPQ, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return nil, errors.New("index is nil")
+	}
+
+	if C.goss_IndexIVFPQ_check(idx.cPtr()) != 0 {
+		return nil, errors.New("index is not an IndexIVFPQ")
+	}
+
+	return &IndexIVFPQ{faissIndex: idx.native()}, nil
+}
+
+// Close frees the index and detaches it from idx. Afterwards the IndexIVFPQ
+// methods return ErrIndexClosed, and so do they if the index was deleted
+// through another reference such as the Index it was obtained from. It is
+// idempotent and safe to call from several goroutines at once; other methods
+// must not run concurrently with it.
+func (idx *IndexIVFPQ) Close() error {
+	idx.closeMu.Lock()
+	defer idx.closeMu.Unlock()
+
+	if idx.faissIndex != nil {
+		idx.faissIndex.Delete()
+	}
+	idx.faissIndex = closedIndex
+	return nil
+}
+
+// Delete frees the index. It is equivalent to Close.
+func (idx *IndexIVFPQ) Delete() {
+	idx.Close()
+}
+
+// GetNList returns the number of clusters (inverted lists)
+func (idx *IndexIVFPQ) GetNList() (int, error) {
+	if idx.closed() {
+		return 0, ErrIndexClosed
+	}
+
+	return int(C.faiss_IndexIVF_nlist(C.faiss_IndexIVF_cast(idx.idx))), nil
+}
+
+// GetNProbe returns the number of clusters to visit during search
+func (idx *IndexIVFPQ) GetNProbe() (int, error) {
+	if idx.closed() {
+		return 0, ErrIndexClosed
+	}
+
+	return int(C.faiss_IndexIVF_nprobe(C.faiss_IndexIVF_cast(idx.idx))), nil
+}
+
+// SetNProbe sets the number of clusters to visit during search
+func (idx *IndexIVFPQ) SetNProbe(nprobe int) error {
+	nlist, err := idx.GetNList()
+	if err != nil {
+		return err
+	}
+	if nprobe <= 0 {
+		return fmt.Errorf("nprobe must be positive, got %d", nprobe)
+	}
+	if nprobe > nlist {
+		return fmt.Errorf("nprobe (%d) cannot be greater than nlist (%d)", nprobe, nlist)
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	C.faiss_IndexIVF_set_nprobe(C.faiss_IndexIVF_cast(idx.idx), C.size_t(nprobe))
+	return nil
+}
+
+// TrainChecked runs AnalyzeTrainingData on x, for the nlist coarse clusters
+// and the PQ codebooks, and trains the index only if no problems are found,
+// returning a *TrainingDataError holding the report otherwise.
+// AllowTrainingProblems trains regardless.
+func (idx *IndexIVFPQ) TrainChecked(x []float32, opts ...TrainCheckOption) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+
+	return trainChecked(idx.faissIndex, x, opts)
+}
+
+// ShouldRetrain reports whether the ImbalanceFactor reported by
+// FragmentationInfo exceeds threshold, see IndexIVFFlat.ShouldRetrain.
+func (idx *IndexIVFPQ) ShouldRetrain(threshold float64) (bool, error) {
+	if idx.closed() {
+		return false, ErrIndexClosed
+	}
+
+	return shouldRetrain(idx.faissIndex, threshold)
+}
+
+// GetM returns the number of PQ sub-vectors
+func (idx *IndexIVFPQ) GetM() (int, error) {
+	if idx.closed() {
+		return 0, ErrIndexClosed
+	}
+
+	return int(C.goss_IndexIVFPQ_M(idx.idx)), nil
+}
+
+// GetNBits returns the number of bits per PQ sub-vector code
+func (idx *IndexIVFPQ) GetNBits() (int, error) {
+	if idx.closed() {
+		return 0, ErrIndexClosed
+	}
+
+	return int(C.goss_IndexIVFPQ_nbits(idx.idx)), nil
+}
@@ -0,0 +1,551 @@
+package faiss
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func trainedCentroids(t *testing.T, idx *IndexIVFFlat, x []float32, opts TrainOptions) [][]float32 {
+	t.Helper()
+
+	if err := idx.TrainWithOptions(x, opts); err != nil {
+		t.Fatalf("TrainWithOptions: %v", err)
+	}
+	centroids, err := idx.GetClusterCentroids()
+	if err != nil {
+		t.Fatalf("GetClusterCentroids: %v", err)
+	}
+	return centroids
+}
+
+func TestTrainWithOptionsSeedIsReproducible(t *testing.T) {
+	const d, nlist = 16, 8
+	x := clusteredVectors(2000, d, nlist, 1)
+
+	var runs [3][][]float32
+	for i, seed := range []int64{42, 42, 7} {
+		idx, err := NewIndexIVFFlatL2(d, nlist)
+		if err != nil {
+			t.Fatalf("NewIndexIVFFlatL2: %v", err)
+		}
+		defer idx.Delete()
+		runs[i] = trainedCentroids(t, idx, x, TrainOptions{Seed: seed})
+	}
+
+	if !reflect.DeepEqual(runs[0], runs[1]) {
+		t.Error("training twice with the same seed produced different centroids")
+	}
+	if reflect.DeepEqual(runs[0], runs[2]) {
+		t.Error("training with different seeds produced identical centroids")
+	}
+}
+
+func TestTrainWithOptionsInnerProductIsSpherical(t *testing.T) {
+	const d, nlist = 16, 8
+	x := clusteredVectors(2000, d, nlist, 2)
+
+	idx, err := NewIndexIVFFlatIP(d, nlist)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatIP: %v", err)
+	}
+	defer idx.Delete()
+
+	// IndexIVF trains inner product quantizers with spherical k-means
+	for i, c := range trainedCentroids(t, idx, x, TrainOptions{Seed: 1}) {
+		var norm float64
+		for _, v := range c {
+			norm += float64(v) * float64(v)
+		}
+		if math.Abs(math.Sqrt(norm)-1) > 1e-4 {
+			t.Errorf("centroid %d has norm %v, want 1", i, math.Sqrt(norm))
+		}
+	}
+}
+
+func TestGetInvertedListIDsCoversAllVectors(t *testing.T) {
+	const d, nlist, n = 8, 16, 3000
+	x := clusteredVectors(n, d, nlist, 1)
+	idx := newIVFFlatL2(t, d, nlist, x)
+
+	assigned, err := idx.AssignToLists(x)
+	if err != nil {
+		t.Fatalf("AssignToLists: %v", err)
+	}
+
+	seen := make([]bool, n)
+	for list := 0; list < nlist; list++ {
+		ids, err := idx.GetInvertedListIDs(list)
+		if err != nil {
+			t.Fatalf("GetInvertedListIDs(%d): %v", list, err)
+		}
+		for _, id := range ids {
+			if id < 0 || id >= n {
+				t.Fatalf("list %d holds ID %d outside [0, %d)", list, id, n)
+			}
+			if seen[id] {
+				t.Fatalf("ID %d stored in more than one list", id)
+			}
+			seen[id] = true
+			if assigned[id] != int64(list) {
+				t.Errorf("ID %d is stored in list %d but assigned to list %d", id, list, assigned[id])
+			}
+		}
+	}
+	for id, ok := range seen {
+		if !ok {
+			t.Errorf("ID %d is in no list", id)
+		}
+	}
+
+	if _, err := idx.GetInvertedListIDs(nlist); err == nil {
+		t.Error("GetInvertedListIDs accepted an out of range list")
+	}
+}
+
+func TestSetRandomSeedMakesTrainReproducible(t *testing.T) {
+	const d, nlist = 16, 8
+	x := clusteredVectors(2000, d, nlist, 3)
+
+	SetRandomSeed(1234)
+	var runs [2][][]float32
+	for i := range runs {
+		idx, err := NewIndexIVFFlatL2(d, nlist)
+		if err != nil {
+			t.Fatalf("NewIndexIVFFlatL2: %v", err)
+		}
+		defer idx.Delete()
+		if err := idx.Train(x); err != nil {
+			t.Fatalf("Train: %v", err)
+		}
+		if runs[i], err = idx.GetClusterCentroids(); err != nil {
+			t.Fatalf("GetClusterCentroids: %v", err)
+		}
+	}
+
+	if !reflect.DeepEqual(runs[0], runs[1]) {
+		t.Error("training twice with the same seed produced different centroids")
+	}
+}
+
+func TestTrainWithOptionsRejectsOutOfRangeSeed(t *testing.T) {
+	idx, err := NewIndexIVFFlatL2(4, 2)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer idx.Delete()
+
+	for _, seed := range []int64{math.MaxInt32 + 1, math.MinInt32 - 1} {
+		if err := idx.TrainWithOptions(randomVectors(100, 4, 1), TrainOptions{Seed: seed}); err == nil {
+			t.Errorf("seed %d was accepted", seed)
+		}
+	}
+	if idx.IsTrained() {
+		t.Error("index trained despite the invalid seed")
+	}
+}
+
+func TestIVFFlatDeleteUnderGC(t *testing.T) {
+	const d, nlist = 8, 4
+	x := clusteredVectors(500, d, nlist, 1)
+
+	for i := 0; i < 50; i++ {
+		idx, err := NewIndexIVFFlatL2(d, nlist)
+		if err != nil {
+			t.Fatalf("NewIndexIVFFlatL2: %v", err)
+		}
+		if err := idx.Train(x); err != nil {
+			t.Fatalf("Train: %v", err)
+		}
+		if err := idx.Add(x); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		view, err := AsIVFFlat(idx)
+		if err != nil {
+			t.Fatalf("AsIVFFlat: %v", err)
+		}
+		runtime.GC()
+
+		if _, _, err := view.Search(x[:d], 3); err != nil {
+			t.Fatalf("Search through view: %v", err)
+		}
+
+		// Free through a different reference each time, or leave it to
+		// the finalizer, and use every reference afterwards
+		switch i % 4 {
+		case 0:
+			idx.Delete()
+		case 1:
+			view.Delete()
+		case 2:
+			var generic Index = idx
+			generic.Delete()
+			idx.Close()
+		case 3:
+			continue
+		}
+		runtime.GC()
+
+		for _, ref := range []Index{idx, view} {
+			if _, _, err := ref.Search(x[:d], 3); err == nil {
+				t.Fatalf("%d: Search after Delete succeeded", i)
+			}
+			ref.Delete()
+		}
+		runtime.GC()
+	}
+
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+	}
+}
+
+// meanSquaredDistance returns the mean squared L2 distance from each vector
+// of x to its nearest vector of centers.
+func meanSquaredDistance(x []float32, centers [][]float32, d int) float64 {
+	var total float64
+	for i := 0; i < len(x)/d; i++ {
+		best := math.Inf(1)
+		for _, c := range centers {
+			var dist float64
+			for j, v := range c {
+				diff := float64(x[i*d+j] - v)
+				dist += diff * diff
+			}
+			best = math.Min(best, dist)
+		}
+		total += best
+	}
+	return total / float64(len(x)/d)
+}
+
+func TestTrainChunked(t *testing.T) {
+	const d, nlist, n, chunk = 16, 8, 20000, 1000
+	x := clusteredVectors(n, d, nlist, 1)
+
+	idx, err := NewIndexIVFFlatL2(d, nlist)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer idx.Delete()
+
+	// More chunks than the reservoir holds, so sampling is exercised
+	pulled := 0
+	err = idx.TrainChunked(func() ([]float32, bool) {
+		if pulled*chunk >= n {
+			return nil, false
+		}
+		pulled++
+		return x[(pulled-1)*chunk*d : pulled*chunk*d], true
+	})
+	if err != nil {
+		t.Fatalf("TrainChunked: %v", err)
+	}
+	if pulled != n/chunk {
+		t.Errorf("TrainChunked pulled %d chunks, want %d", pulled, n/chunk)
+	}
+	if !idx.IsTrained() {
+		t.Fatal("index is not trained after TrainChunked")
+	}
+
+	centroids, err := idx.GetClusterCentroids()
+	if err != nil {
+		t.Fatalf("GetClusterCentroids: %v", err)
+	}
+	if len(centroids) != nlist {
+		t.Fatalf("got %d centroids, want %d", len(centroids), nlist)
+	}
+
+	// The centroids must quantize the data far better than its mean does
+	mean := make([]float32, d)
+	for i, v := range x {
+		mean[i%d] += v / n
+	}
+	quantization := meanSquaredDistance(x, centroids, d)
+	spread := meanSquaredDistance(x, [][]float32{mean}, d)
+	if quantization > 0.2*spread {
+		t.Errorf("centroids quantize with mean squared error %g, data spread is %g", quantization, spread)
+	}
+}
+
+func TestSuggestIVFParams(t *testing.T) {
+	tests := []struct {
+		n                  int64
+		nlist, nprobe      int
+		minNList, maxNList int
+	}{
+		{0, 1, 1, 1, 1},
+		{1000, 16, 1, 1, 1000 / 39},
+		{1e6, 2048, 128, 1000, 16000},
+		{1e9, 65536, 4096, 65536, 65536},
+		{math.MaxInt64, 65536, 4096, 65536, 65536},
+	}
+	for _, tt := range tests {
+		nlist, nprobe := SuggestIVFParams(tt.n)
+		if nlist != tt.nlist || nprobe != tt.nprobe {
+			t.Errorf("SuggestIVFParams(%d) = (%d, %d), want (%d, %d)", tt.n, nlist, nprobe, tt.nlist, tt.nprobe)
+		}
+		if nlist < tt.minNList || nlist > tt.maxNList {
+			t.Errorf("SuggestIVFParams(%d): nlist %d outside [%d, %d]", tt.n, nlist, tt.minNList, tt.maxNList)
+		}
+		if nlist&(nlist-1) != 0 {
+			t.Errorf("SuggestIVFParams(%d): nlist %d is not a power of two", tt.n, nlist)
+		}
+		if nprobe < 1 || nprobe > nlist {
+			t.Errorf("SuggestIVFParams(%d): nprobe %d outside [1, %d]", tt.n, nprobe, nlist)
+		}
+	}
+}
+
+func TestAddPreassignedRejectsBadLists(t *testing.T) {
+	const d, nlist = 8, 4
+	x := randomVectors(500, d, 1)
+	idx, err := NewIndexIVFFlatL2(d, nlist)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer idx.Delete()
+	if err := idx.Train(x); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+
+	vectors := x[:2*d]
+	for _, listNos := range [][]int64{{0, nlist}, {-1, 0}, {0}} {
+		if err := idx.AddPreassigned(vectors, nil, listNos); err == nil {
+			t.Errorf("AddPreassigned with lists %v succeeded", listNos)
+		}
+	}
+	if got := idx.Ntotal(); got != 0 {
+		t.Errorf("Ntotal after rejected adds = %d, want 0", got)
+	}
+
+	listNos, err := idx.AssignToLists(vectors)
+	if err != nil {
+		t.Fatalf("AssignToLists: %v", err)
+	}
+	if err := idx.AddPreassigned(vectors, []int64{10, 20}, listNos); err != nil {
+		t.Fatalf("AddPreassigned: %v", err)
+	}
+	for i, id := range []int64{10, 20} {
+		ids, err := idx.GetInvertedListIDs(int(listNos[i]))
+		if err != nil {
+			t.Fatalf("GetInvertedListIDs: %v", err)
+		}
+		found := false
+		for _, got := range ids {
+			found = found || got == id
+		}
+		if !found {
+			t.Errorf("ID %d is not in its assigned list %d: %v", id, listNos[i], ids)
+		}
+	}
+}
+
+func benchmarkIVFIngest(b *testing.B, add func(idx *IndexIVFFlat, x []float32) error) {
+	const d, nlist, n = 64, 256, 100000
+	x := randomVectors(n, d, 1)
+	idx, err := NewIndexIVFFlatL2(d, nlist)
+	if err != nil {
+		b.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer idx.Delete()
+	if err := idx.Train(x[:nlist*64*d]); err != nil {
+		b.Fatalf("Train: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if err := idx.Reset(); err != nil {
+			b.Fatalf("Reset: %v", err)
+		}
+		b.StartTimer()
+		if err := add(idx, x); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIVFAddBatch(b *testing.B) {
+	benchmarkIVFIngest(b, func(idx *IndexIVFFlat, x []float32) error {
+		return idx.AddBatch(x, 0)
+	})
+}
+
+// BenchmarkIVFAddPreassigned assigns lists from one goroutine per CPU, then
+// adds the preassigned vectors, to compare with BenchmarkIVFAddBatch.
+func BenchmarkIVFAddPreassigned(b *testing.B) {
+	benchmarkIVFIngest(b, func(idx *IndexIVFFlat, x []float32) error {
+		d := idx.D()
+		n := len(x) / d
+		workers := runtime.GOMAXPROCS(0)
+		listNos := make([]int64, n)
+		errs := make(chan error, workers)
+		for w := 0; w < workers; w++ {
+			start, end := n*w/workers, n*(w+1)/workers
+			go func() {
+				lists, err := idx.AssignToLists(x[start*d : end*d])
+				copy(listNos[start:end], lists)
+				errs <- err
+			}()
+		}
+		for w := 0; w < workers; w++ {
+			if err := <-errs; err != nil {
+				return err
+			}
+		}
+		return idx.AddPreassigned(x, nil, listNos)
+	})
+}
+
+func TestSetVerboseDuringTraining(t *testing.T) {
+	const d, nlist = 8, 4
+	idx, err := NewIndexIVFFlatL2(d, nlist)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer idx.Delete()
+
+	if IsVerbose(idx) {
+		t.Error("a new index is verbose")
+	}
+	if err := SetVerbose(idx, true); err != nil {
+		t.Fatalf("SetVerbose(true): %v", err)
+	}
+	if !IsVerbose(idx) {
+		t.Error("IsVerbose = false after SetVerbose(true)")
+	}
+
+	// The k-means progress printed to stderr can be checked with go test -v
+	if err := idx.Train(randomVectors(nlist*39, d, 1)); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+
+	if err := SetVerbose(idx, false); err != nil {
+		t.Fatalf("SetVerbose(false): %v", err)
+	}
+	if IsVerbose(idx) {
+		t.Error("IsVerbose = true after SetVerbose(false)")
+	}
+	if err := SetVerbose(nil, true); !errors.Is(err, ErrNullPointer) {
+		t.Errorf("SetVerbose(nil) = %v, want ErrNullPointer", err)
+	}
+}
+
+func TestShouldRetrainAfterSkewedAdds(t *testing.T) {
+	const d, nlist, n = 8, 16, 4000
+	x := randomVectors(n, d, 1)
+	idx := newIVFFlatL2(t, d, nlist, x)
+
+	retrain, err := idx.ShouldRetrain(2)
+	if err != nil {
+		t.Fatalf("ShouldRetrain: %v", err)
+	}
+	if retrain {
+		t.Error("ShouldRetrain(2) = true for data drawn like the training set")
+	}
+
+	// Many vectors around a single point pile into one list
+	skewed := clusteredVectors(4*n, d, 1, 2)
+	if err := idx.Add(skewed); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	before, err := idx.FragmentationInfo()
+	if err != nil {
+		t.Fatalf("FragmentationInfo: %v", err)
+	}
+	if retrain, err := idx.ShouldRetrain(2); err != nil || !retrain {
+		t.Errorf("ShouldRetrain(2) = %v, %v with imbalance %v, want true", retrain, err, before.ImbalanceFactor)
+	}
+	if retrain, _ := idx.ShouldRetrain(before.ImbalanceFactor); retrain {
+		t.Error("ShouldRetrain is true at a threshold equal to the imbalance factor")
+	}
+
+	// Retraining on the current data spreads the lists again
+	if err := idx.Retrain(append(append([]float32{}, x...), skewed...)); err != nil {
+		t.Fatalf("Retrain: %v", err)
+	}
+	after, err := idx.FragmentationInfo()
+	if err != nil {
+		t.Fatalf("FragmentationInfo: %v", err)
+	}
+	if after.ImbalanceFactor >= before.ImbalanceFactor {
+		t.Errorf("imbalance %v after Retrain, want below %v", after.ImbalanceFactor, before.ImbalanceFactor)
+	}
+
+	if _, err := idx.ShouldRetrain(0.5); err == nil {
+		t.Error("ShouldRetrain accepted a threshold below 1")
+	}
+}
+
+func TestRetrainFailureKeepsVectors(t *testing.T) {
+	const d, nlist, n = 8, 16, 1000
+	x := clusteredVectors(n, d, nlist, 1)
+	idx := newIVFFlatL2(t, d, nlist, x)
+
+	// K-means can't find 16 centroids in 4 points
+	if err := idx.Retrain(randomVectors(4, d, 2)); err == nil {
+		t.Fatal("Retrain succeeded with fewer training vectors than lists")
+	}
+	if got := idx.Ntotal(); got != n {
+		t.Fatalf("Ntotal = %d after a failed Retrain, want %d", got, n)
+	}
+	all, err := idx.AllVectors()
+	if err != nil {
+		t.Fatalf("AllVectors: %v", err)
+	}
+	if !approxEqual(all, x, 0) {
+		t.Error("vectors changed after a failed Retrain")
+	}
+}
+
+func TestIVFStaysMutableAfterReconstruction(t *testing.T) {
+	const d, nlist, n = 8, 8, 1000
+	x := clusteredVectors(n, d, nlist, 1)
+	idx := newIVFFlatL2(t, d, nlist, x)
+
+	all, err := idx.AllVectors()
+	if err != nil {
+		t.Fatalf("AllVectors: %v", err)
+	}
+	if !approxEqual(all, x, 0) {
+		t.Error("AllVectors differs from the added vectors")
+	}
+
+	// RerankIDs reconstructs by ID, which gives the index a direct map
+	labels, _, missing, err := idx.RerankIDs(x[5*d:6*d], []int64{5, 6, 7}, 1)
+	if err != nil || len(missing) != 0 || labels[0] != 5 {
+		t.Fatalf("RerankIDs = %v, missing %v, %v, want label 5", labels, missing, err)
+	}
+
+	sel, err := NewIDSelectorBatch([]int64{5, 6})
+	if err != nil {
+		t.Fatalf("NewIDSelectorBatch: %v", err)
+	}
+	defer sel.Delete()
+	if removed, err := idx.RemoveIDs(sel); err != nil || removed != 2 {
+		t.Fatalf("RemoveIDs = %d, %v, want 2 removed", removed, err)
+	}
+	if err := idx.AddWithIDs(x[:d], []int64{5000}); err != nil {
+		t.Fatalf("AddWithIDs: %v", err)
+	}
+	if err := idx.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if idx.Ntotal() != n-1 {
+		t.Fatalf("Ntotal = %d, want %d", idx.Ntotal(), n-1)
+	}
+
+	// The direct map follows the removal, the add and the rebuild
+	if v, err := idx.Reconstruct(5000); err != nil || !approxEqual(v, x[:d], 0) {
+		t.Errorf("Reconstruct(5000) = %v, %v, want the vector added with ID 5000", v, err)
+	}
+	if _, err := idx.Reconstruct(5); err == nil {
+		t.Error("Reconstruct found the removed ID 5")
+	}
+	if v, err := idx.Reconstruct(7); err != nil || !approxEqual(v, x[7*d:8*d], 0) {
+		t.Errorf("Reconstruct(7) = %v, %v, want vector 7", v, err)
+	}
+}
@@ -0,0 +1,83 @@
+package faiss
+
+/*
+#include <faiss/c_api/IndexFlat_c.h>
+#include <faiss/c_api/Index_c.h>
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+)
+
+// IndexRefineFlat wraps a (usually compressed) base index and re-ranks its
+// candidates with exact distances computed on full vectors stored alongside.
+// Search retrieves k*KFactor candidates from the base index, then keeps the
+// k best after refinement.
+type IndexRefineFlat struct {
+	Index
+	base Index // Kept alive for as long as the refine index references it
+}
+
+// NewIndexRefineFlat creates a refine index on top of base.
+// The refine index does not take ownership of base: base must outlive it and
+// must be deleted separately, after the refine index.
+// Vectors should be added through the refine index so that both the base
+// index and the refinement storage receive them.
+func NewIndexRefineFlat(base Index) (*IndexRefineFlat, error) {
+	if base == nil || base.cPtr() == nil {
+		return nil, errors.New("base index is nil")
+	}
+
+	var cIdx *C.FaissIndex
+	if c := C.faiss_IndexRefineFlat_new(&cIdx, base.cPtr()); c != 0 {
+		return nil, wrapError(getLastError(), "IndexRefineFlat creation")
+	}
+	C.faiss_IndexRefineFlat_set_own_fields(cIdx, 0)
+
+	return &IndexRefineFlat{Index: newFaissIndex(cIdx), base: base}, nil
+}
+
+// Close frees the refine index. Afterwards its methods return
+// ErrIndexClosed. The base index is not freed. It is safe to call more than
+// once.
+func (idx *IndexRefineFlat) Close() error {
+	idx.Index.Delete()
+	return nil
+}
+
+// closed reports whether the refine index was freed.
+func (idx *IndexRefineFlat) closed() bool {
+	return idx.cPtr() == nil
+}
+
+// Base returns the underlying base index.
+func (idx *IndexRefineFlat) Base() Index {
+	return idx.base
+}
+
+// GetKFactor returns the candidate over-fetch factor used during search.
+func (idx *IndexRefineFlat) GetKFactor() (float32, error) {
+	if idx.closed() {
+		return 0, ErrIndexClosed
+	}
+
+	return float32(C.faiss_IndexRefineFlat_k_factor(idx.cPtr())), nil
+}
+
+// SetKFactor sets the candidate over-fetch factor used during search.
+// The base index is queried for k*kFactor candidates.
+func (idx *IndexRefineFlat) SetKFactor(kFactor float32) error {
+	if idx.closed() {
+		return ErrIndexClosed
+	}
+	if err := idx.native().checkMutable(); err != nil {
+		return err
+	}
+	if kFactor < 1 {
+		return fmt.Errorf("k factor must be at least 1, got %v", kFactor)
+	}
+
+	C.faiss_IndexRefineFlat_set_k_factor(idx.cPtr(), C.float(kFactor))
+	return nil
+}
@@ -0,0 +1,80 @@
+package faiss
+
+import (
+	"errors"
+	"testing"
+)
+
+// newRefinedIVFPQ returns a strongly compressed IVFPQ index searching all
+// its lists, and a refine index over it holding x.
+func newRefinedIVFPQ(t *testing.T, d int, x []float32) (*IndexIVFPQ, *IndexRefineFlat) {
+	t.Helper()
+
+	base, err := NewIndexIVFPQ(d, 16, 4, 8, MetricL2)
+	if err != nil {
+		t.Fatalf("NewIndexIVFPQ: %v", err)
+	}
+	t.Cleanup(base.Delete)
+	refine, err := NewIndexRefineFlat(base)
+	if err != nil {
+		t.Fatalf("NewIndexRefineFlat: %v", err)
+	}
+	t.Cleanup(func() { refine.Close() })
+
+	if err := refine.Train(x); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	if err := refine.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := base.SetNProbe(16); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+	return base, refine
+}
+
+func TestIndexRefineFlatImprovesRecall(t *testing.T) {
+	const d, n, nq, k = 32, 5000, 100, 10
+	x := randomVectors(n, d, 1)
+	queries := randomVectors(nq, d, 2)
+	flat := newFlatL2(t, d, x)
+	base, refine := newRefinedIVFPQ(t, d, x)
+
+	raw, err := RecallAtK(base, flat, queries, k)
+	if err != nil {
+		t.Fatalf("RecallAtK(base): %v", err)
+	}
+	if err := refine.SetKFactor(8); err != nil {
+		t.Fatalf("SetKFactor: %v", err)
+	}
+	refined, err := RecallAtK(refine, flat, queries, k)
+	if err != nil {
+		t.Fatalf("RecallAtK(refine): %v", err)
+	}
+	if refined <= raw {
+		t.Fatalf("refined recall %v is not above the raw IVFPQ recall %v", refined, raw)
+	}
+}
+
+func TestIndexRefineFlatClose(t *testing.T) {
+	const d = 32
+	x := randomVectors(1000, d, 1)
+	_, refine := newRefinedIVFPQ(t, d, x)
+
+	if err := refine.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := refine.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	if n := refine.Ntotal(); n != 0 {
+		t.Fatalf("Ntotal after Close = %d, want 0", n)
+	}
+	if _, _, err := refine.Search(x[:d], 1); !errors.Is(err, ErrIndexClosed) {
+		t.Fatalf("Search after Close error = %v, want ErrIndexClosed", err)
+	}
+	if _, err := refine.GetKFactor(); !errors.Is(err, ErrIndexClosed) {
+		t.Fatalf("GetKFactor after Close error = %v, want ErrIndexClosed", err)
+	}
+}
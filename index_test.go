@@ -0,0 +1,1332 @@
+package faiss
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAddBatchProgress(t *testing.T) {
+	const d, n = 8, 1000
+	idx := newFlatL2(t, d, nil)
+
+	var calls []int
+	err := idx.AddBatch(randomVectors(n, d, 1), n/10, OnProgress(func(done, total int) {
+		if total != n {
+			t.Errorf("progress total = %d, want %d", total, n)
+		}
+		calls = append(calls, done)
+	}))
+	if err != nil {
+		t.Fatalf("AddBatch: %v", err)
+	}
+	checkProgress(t, calls, 10, n)
+	if got := idx.Ntotal(); got != n {
+		t.Fatalf("Ntotal = %d, want %d", got, n)
+	}
+}
+
+func TestSearchBatchProgress(t *testing.T) {
+	const d, n, nq = 8, 200, 100
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+
+	var calls []int
+	_, labels, err := idx.SearchBatch(randomVectors(nq, d, 2), 5, nq/10, OnProgress(func(done, total int) {
+		if total != nq {
+			t.Errorf("progress total = %d, want %d", total, nq)
+		}
+		calls = append(calls, done)
+	}))
+	if err != nil {
+		t.Fatalf("SearchBatch: %v", err)
+	}
+	checkProgress(t, calls, 10, nq)
+	if len(labels) != nq {
+		t.Fatalf("got results for %d queries, want %d", len(labels), nq)
+	}
+}
+
+func TestRemoveIDsBatch(t *testing.T) {
+	const d, n = 8, 500
+	x := randomVectors(n, d, 1)
+
+	t.Run("Flat", func(t *testing.T) {
+		idx := newFlatL2(t, d, x)
+		checkRemoveIDsBatch(t, idx, n)
+	})
+	t.Run("IVFWithoutDirectMap", func(t *testing.T) {
+		idx := newIVFFlatL2(t, d, 16, x)
+		checkRemoveIDsBatch(t, idx, n)
+	})
+	t.Run("AllMissing", func(t *testing.T) {
+		idx := newFlatL2(t, d, x)
+		removed, missing, err := idx.RemoveIDsBatch([]int64{n, n + 1, -5})
+		if err != nil {
+			t.Fatalf("RemoveIDsBatch: %v", err)
+		}
+		if len(removed) != 0 || len(missing) != 3 {
+			t.Fatalf("removed %v, missing %v; want nothing removed and 3 missing", removed, missing)
+		}
+		if got := idx.Ntotal(); got != n {
+			t.Fatalf("Ntotal = %d, want %d", got, n)
+		}
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		hnsw, err := NewIndexHNSWL2(d, 16)
+		if err != nil {
+			t.Fatalf("NewIndexHNSWL2: %v", err)
+		}
+		defer hnsw.Delete()
+		if err := hnsw.Add(x); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		if _, _, err := hnsw.RemoveIDsBatch([]int64{1, 2}); err == nil {
+			t.Fatal("RemoveIDsBatch on HNSW succeeded, want an error")
+		}
+	})
+}
+
+// checkRemoveIDsBatch removes a mix of present, repeated and missing IDs
+// from idx, holding the sequential IDs [0, n), and checks the report.
+func checkRemoveIDsBatch(t *testing.T, idx Index, n int64) {
+	t.Helper()
+
+	removed, missing, err := idx.RemoveIDsBatch([]int64{3, 7, 7, 42, n, n + 10, -1})
+	if err != nil {
+		t.Fatalf("RemoveIDsBatch: %v", err)
+	}
+	if want := []int64{3, 7, 42}; !reflect.DeepEqual(removed, want) {
+		t.Fatalf("removed = %v, want %v", removed, want)
+	}
+	if want := []int64{-1, n, n + 10}; !reflect.DeepEqual(missing, want) {
+		t.Fatalf("missing = %v, want %v", missing, want)
+	}
+	if got := idx.Ntotal(); got != n-3 {
+		t.Fatalf("Ntotal = %d, want %d", got, n-3)
+	}
+}
+
+func TestComputeDistanceToIDsMatchesSearch(t *testing.T) {
+	const d, n, k = 8, 300, 10
+	x := randomVectors(n, d, 1)
+	query := randomVectors(1, d, 2)
+
+	for _, metric := range []int{MetricL2, MetricInnerProduct} {
+		idx, err := NewIndexFlat(d, metric)
+		if err != nil {
+			t.Fatalf("NewIndexFlat: %v", err)
+		}
+		defer idx.Delete()
+		if err := idx.Add(x); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+
+		distances, labels, err := idx.Search(query, k)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		got, err := idx.ComputeDistanceToIDs(query, labels)
+		if err != nil {
+			t.Fatalf("ComputeDistanceToIDs: %v", err)
+		}
+		if !approxEqual(got, distances, 1e-4) {
+			t.Errorf("metric %d: ComputeDistanceToIDs = %v, Search reported %v", metric, got, distances)
+		}
+
+		single, err := idx.ComputeDistance(query, labels[0])
+		if err != nil {
+			t.Fatalf("ComputeDistance: %v", err)
+		}
+		if !approxEqual([]float32{single}, distances[:1], 1e-4) {
+			t.Errorf("metric %d: ComputeDistance = %v, Search reported %v", metric, single, distances[0])
+		}
+	}
+}
+
+func TestCompactAfterRemovals(t *testing.T) {
+	const d, n = 8, 1000
+	x := randomVectors(n, d, 1)
+	idx := newFlatL2(t, d, x)
+
+	// Remove every other vector; the survivors keep their order
+	var removed []int64
+	var survivors []float32
+	for i := int64(0); i < n; i++ {
+		if i%2 == 0 {
+			removed = append(removed, i)
+		} else {
+			survivors = append(survivors, x[i*d:(i+1)*d]...)
+		}
+	}
+	if _, err := idx.RemoveIDsSlice(removed); err != nil {
+		t.Fatalf("RemoveIDsSlice: %v", err)
+	}
+
+	before, err := idx.FragmentationInfo()
+	if err != nil {
+		t.Fatalf("FragmentationInfo: %v", err)
+	}
+	if err := idx.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	after, err := idx.FragmentationInfo()
+	if err != nil {
+		t.Fatalf("FragmentationInfo: %v", err)
+	}
+
+	if got := idx.Ntotal(); got != n/2 {
+		t.Fatalf("Ntotal after Compact = %d, want %d", got, n/2)
+	}
+	if after.Capacity >= before.Capacity || after.FreeSlots != 0 {
+		t.Errorf("Compact kept capacity %d (%d free), was %d", after.Capacity, after.FreeSlots, before.Capacity)
+	}
+
+	reference := newFlatL2(t, d, survivors)
+	queries := randomVectors(20, d, 2)
+	wantD, wantL, err := reference.Search(queries, 5)
+	if err != nil {
+		t.Fatalf("reference Search: %v", err)
+	}
+	gotD, gotL, err := idx.Search(queries, 5)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if !reflect.DeepEqual(gotL, wantL) || !approxEqual(gotD, wantD, 1e-5) {
+		t.Errorf("Search after Compact = %v, want %v", gotL, wantL)
+	}
+}
+
+func TestCompactIVFKeepsResults(t *testing.T) {
+	const d, n, nlist = 8, 2000, 16
+	idx := newIVFFlatL2(t, d, nlist, clusteredVectors(n, d, nlist, 1))
+	if err := idx.SetNProbe(nlist); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+	if _, err := idx.RemoveIDRange(0, n/2); err != nil {
+		t.Fatalf("RemoveIDRange: %v", err)
+	}
+
+	queries := randomVectors(20, d, 2)
+	wantD, wantL, err := idx.Search(queries, 5)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if err := idx.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if got := idx.Ntotal(); got != n/2 {
+		t.Fatalf("Ntotal after Compact = %d, want %d", got, n/2)
+	}
+	if got, err := idx.GetNProbe(); err != nil || got != nlist {
+		t.Errorf("GetNProbe after Compact = %d, %v, want %d", got, err, nlist)
+	}
+
+	gotD, gotL, err := idx.Search(queries, 5)
+	if err != nil {
+		t.Fatalf("Search after Compact: %v", err)
+	}
+	if !reflect.DeepEqual(gotL, wantL) || !approxEqual(gotD, wantD, 1e-5) {
+		t.Errorf("Search after Compact = %v, want %v", gotL, wantL)
+	}
+}
+
+func TestCompactIDMapKeepsIDs(t *testing.T) {
+	const d, n = 8, 3000
+	idx, err := IndexFactory(d, "IDMap,Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory: %v", err)
+	}
+	defer idx.Delete()
+
+	x := randomVectors(n, d, 1)
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = int64(i)*7 + 100
+	}
+	if err := idx.AddWithIDs(x, ids); err != nil {
+		t.Fatalf("AddWithIDs: %v", err)
+	}
+	if _, err := idx.RemoveIDsSlice(ids[:n/3]); err != nil {
+		t.Fatalf("RemoveIDsSlice: %v", err)
+	}
+
+	queries := x[(n-10)*d:]
+	wantD, wantL, err := idx.Search(queries, 3)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if err := idx.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	gotD, gotL, err := idx.Search(queries, 3)
+	if err != nil {
+		t.Fatalf("Search after Compact: %v", err)
+	}
+	if !reflect.DeepEqual(gotL, wantL) || !approxEqual(gotD, wantD, 1e-5) {
+		t.Errorf("Search after Compact = %v, want %v", gotL, wantL)
+	}
+	for i := 0; i < 10; i++ {
+		if got, want := gotL[i*3], ids[n-10+i]; got != want {
+			t.Errorf("query %d: nearest ID %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestCompactWithConcurrentAdds(t *testing.T) {
+	const d, n, writers, adds = 8, 5000, 4, 50
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	batch := randomVectors(10, d, 2)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				if err := idx.Add(batch); err != nil {
+					t.Errorf("Add: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := idx.Compact(); err != nil {
+			t.Fatalf("Compact: %v", err)
+		}
+	}
+	wg.Wait()
+
+	// No add may be lost across a rebuild
+	if got, want := idx.Ntotal(), int64(n+writers*adds*10); got != want {
+		t.Errorf("Ntotal = %d, want %d", got, want)
+	}
+}
+
+func TestSearchEmptyIndex(t *testing.T) {
+	const d, nlist = 8, 4
+	query := randomVectors(1, d, 1)
+
+	flat := newFlatL2(t, d, nil)
+
+	ivf, err := NewIndexIVFFlatL2(d, nlist)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer ivf.Delete()
+	if err := ivf.Train(randomVectors(500, d, 2)); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+
+	for _, idx := range []Index{flat, ivf} {
+		if !idx.IsTrained() || idx.Ntotal() != 0 {
+			t.Fatalf("%T: trained %v with %d vectors, want a trained empty index", idx, idx.IsTrained(), idx.Ntotal())
+		}
+		distances, labels, err := idx.Search(query, 5)
+		if !errors.Is(err, ErrEmptyIndex) {
+			t.Errorf("%T: Search = %v, want ErrEmptyIndex", idx, err)
+		}
+		if distances != nil || labels != nil {
+			t.Errorf("%T: Search returned results for an empty index", idx)
+		}
+	}
+}
+
+func TestAddReturningIDs(t *testing.T) {
+	const d = 4
+	idx := newFlatL2(t, d, nil)
+
+	first, err := idx.AddReturningIDs(randomVectors(3, d, 1))
+	if err != nil {
+		t.Fatalf("AddReturningIDs: %v", err)
+	}
+	second, err := idx.AddReturningIDs(randomVectors(5, d, 2))
+	if err != nil {
+		t.Fatalf("AddReturningIDs: %v", err)
+	}
+
+	if want := []int64{0, 1, 2}; !reflect.DeepEqual(first, want) {
+		t.Errorf("first batch IDs = %v, want %v", first, want)
+	}
+	if want := []int64{3, 4, 5, 6, 7}; !reflect.DeepEqual(second, want) {
+		t.Errorf("second batch IDs = %v, want %v", second, want)
+	}
+}
+
+func TestAddReturningIDsConcurrent(t *testing.T) {
+	const d, writers, adds, batch = 4, 8, 50, 7
+	idx := newFlatL2(t, d, nil)
+
+	results := make(chan []int64, writers*adds)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			x := randomVectors(batch, d, int64(w))
+			for i := 0; i < adds; i++ {
+				ids, err := idx.AddReturningIDs(x)
+				if err != nil {
+					t.Errorf("AddReturningIDs: %v", err)
+					return
+				}
+				results <- ids
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(results)
+
+	// Each batch gets a contiguous range, and the ranges don't overlap
+	seen := make(map[int64]bool)
+	for ids := range results {
+		for i, id := range ids {
+			if id != ids[0]+int64(i) {
+				t.Fatalf("batch IDs %v are not contiguous", ids)
+			}
+			if seen[id] {
+				t.Fatalf("ID %d returned twice", id)
+			}
+			seen[id] = true
+		}
+	}
+	if total := int64(writers * adds * batch); int64(len(seen)) != total || idx.Ntotal() != total {
+		t.Errorf("got %d IDs and Ntotal %d, want %d", len(seen), idx.Ntotal(), total)
+	}
+}
+
+// allocatedBytes returns the bytes allocated on the Go heap by fn.
+func allocatedBytes(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestSearchBatchFuncConstantMemory(t *testing.T) {
+	const d, k, batchSize = 8, 100, 50
+	idx := newFlatL2(t, d, randomVectors(2000, d, 1))
+
+	run := func(nq int) uint64 {
+		queries := randomVectors(nq, d, 2)
+		var calls int
+		bytes := allocatedBytes(func() {
+			err := idx.SearchBatchFunc(queries, k, batchSize, func(q int, distances []float32, labels []int64) error {
+				if q != calls || len(distances) != k || len(labels) != k {
+					t.Fatalf("callback %d got query %d with %d distances and %d labels", calls, q, len(distances), len(labels))
+				}
+				calls++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("SearchBatchFunc: %v", err)
+			}
+		})
+		if calls != nq {
+			t.Fatalf("callback ran %d times for %d queries", calls, nq)
+		}
+		return bytes
+	}
+
+	small, large := run(500), run(5000)
+
+	// Only the buffers of one batch are allocated, whatever the query count;
+	// the full results of the large run would take nq*k*12 = 6 MB
+	limit := uint64(4 * batchSize * k * 12)
+	if small > limit || large > limit {
+		t.Errorf("allocated %d bytes for 500 queries and %d for 5000, want at most %d", small, large, limit)
+	}
+}
+
+func TestSearchBatchFuncCallbackAborts(t *testing.T) {
+	const d = 8
+	idx := newFlatL2(t, d, randomVectors(100, d, 1))
+
+	errStop := errors.New("stop")
+	var calls int
+	err := idx.SearchBatchFunc(randomVectors(100, d, 2), 5, 10, func(int, []float32, []int64) error {
+		calls++
+		if calls == 15 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("SearchBatchFunc = %v, want the callback error", err)
+	}
+	if calls != 15 {
+		t.Errorf("callback ran %d times after aborting at 15", calls)
+	}
+}
+
+func TestSearchThresholdCosine(t *testing.T) {
+	const d, n = 8, 500
+	const threshold = 0.9
+	x := randomVectors(n, d, 1)
+	query := randomVectors(1, d, 2)
+	for _, v := range [][]float32{x, query} {
+		if err := NormalizeVectors(v, d); err != nil {
+			t.Fatalf("NormalizeVectors: %v", err)
+		}
+	}
+
+	idx, err := NewIndexFlatIP(d)
+	if err != nil {
+		t.Fatalf("NewIndexFlatIP: %v", err)
+	}
+	defer idx.Delete()
+	if err := idx.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	want := make(map[int64]bool)
+	for i := 0; i < n; i++ {
+		var sim float32
+		for j := 0; j < d; j++ {
+			sim += query[j] * x[i*d+j]
+		}
+		if sim >= threshold {
+			want[int64(i)] = true
+		}
+	}
+	if len(want) == 0 || len(want) == n {
+		t.Fatalf("%d of %d vectors meet the threshold, the test data doesn't split", len(want), n)
+	}
+
+	similarities, labels, err := idx.SearchThreshold(query, n, threshold)
+	if err != nil {
+		t.Fatalf("SearchThreshold: %v", err)
+	}
+	if len(labels) != len(want) {
+		t.Errorf("got %d results, want %d", len(labels), len(want))
+	}
+	for i, label := range labels {
+		if similarities[i] < threshold {
+			t.Errorf("result %d has similarity %v below %v", label, similarities[i], threshold)
+		}
+		if !want[label] {
+			t.Errorf("result %d should have been dropped", label)
+		}
+		if i > 0 && similarities[i] > similarities[i-1] {
+			t.Errorf("results are not sorted by decreasing similarity: %v", similarities)
+		}
+	}
+}
+
+func TestAddVectors2D(t *testing.T) {
+	const d = 3
+	idx := newFlatL2(t, d, nil)
+
+	rows := [][]float32{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10, 11, 12}, {13, 14, 15}}
+	if err := idx.AddVectors2D(rows); err != nil {
+		t.Fatalf("AddVectors2D: %v", err)
+	}
+	if got := idx.Ntotal(); got != 5 {
+		t.Fatalf("Ntotal = %d, want 5", got)
+	}
+	vec, err := idx.Reconstruct(3)
+	if err != nil {
+		t.Fatalf("Reconstruct: %v", err)
+	}
+	if !reflect.DeepEqual(vec, rows[3]) {
+		t.Errorf("vector 3 = %v, want %v", vec, rows[3])
+	}
+
+	ragged := [][]float32{{1, 2, 3}, {4, 5, 6}, {7, 8}, {9, 10, 11}}
+	err = idx.AddVectors2D(ragged)
+	var mismatch *DimensionMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Got != 2 || !strings.Contains(err.Error(), "row 2") {
+		t.Errorf("AddVectors2D with a ragged row = %v, want a mismatch naming row 2", err)
+	}
+	if got := idx.Ntotal(); got != 5 {
+		t.Errorf("Ntotal after a rejected add = %d, want 5", got)
+	}
+}
+
+func TestSearch2DMatchesSearch(t *testing.T) {
+	const d, nq, k = 8, 20, 7
+	idx := newFlatL2(t, d, randomVectors(500, d, 1))
+	queries := randomVectors(nq, d, 2)
+
+	distances, labels, err := idx.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	rows := make([][]float32, nq)
+	for i := range rows {
+		rows[i] = queries[i*d : (i+1)*d]
+	}
+	results, err := idx.Search2D(rows, k)
+	if err != nil {
+		t.Fatalf("Search2D: %v", err)
+	}
+
+	if len(results) != nq {
+		t.Fatalf("got %d result rows, want %d", len(results), nq)
+	}
+	for q, neighbors := range results {
+		if len(neighbors) != k {
+			t.Fatalf("query %d: got %d neighbors, want %d", q, len(neighbors), k)
+		}
+		for j, nb := range neighbors {
+			if nb.Label != labels[q*k+j] || nb.Distance != distances[q*k+j] {
+				t.Errorf("query %d rank %d: got %+v, want {%d %v}", q, j, nb, labels[q*k+j], distances[q*k+j])
+			}
+		}
+	}
+}
+
+func TestSearchOneMatchesSearch(t *testing.T) {
+	const d, k = 8, 5
+	idx := newFlatL2(t, d, randomVectors(500, d, 1))
+	queries := randomVectors(3, d, 2)
+
+	distances, labels, err := idx.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	neighbors, err := idx.SearchOne(queries[:d], k)
+	if err != nil {
+		t.Fatalf("SearchOne: %v", err)
+	}
+
+	if len(neighbors) != k {
+		t.Fatalf("got %d neighbors, want %d", len(neighbors), k)
+	}
+	for j, nb := range neighbors {
+		if nb.Label != labels[j] || nb.Distance != distances[j] {
+			t.Errorf("rank %d: got %+v, want {%d %v}", j, nb, labels[j], distances[j])
+		}
+	}
+
+	// The whole batch is not a single query
+	var mismatch *DimensionMismatchError
+	if _, err := idx.SearchOne(queries, k); !errors.As(err, &mismatch) {
+		t.Errorf("SearchOne with %d floats = %v, want a DimensionMismatchError", len(queries), err)
+	}
+}
+
+func TestSearchClampsKToNtotal(t *testing.T) {
+	const d, n, nq, k = 8, 50, 3, 100000
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	queries := randomVectors(nq, d, 2)
+
+	distances, labels, err := idx.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(distances) != nq*n || len(labels) != nq*n {
+		t.Fatalf("Search returned %d distances and %d labels, want %d", len(distances), len(labels), nq*n)
+	}
+	for i, label := range labels {
+		if label < 0 {
+			t.Fatalf("Search result %d is padding", i)
+		}
+	}
+
+	batchD, batchL, err := idx.SearchBatch(queries, k, 2)
+	if err != nil {
+		t.Fatalf("SearchBatch: %v", err)
+	}
+	for q := 0; q < nq; q++ {
+		if len(batchD[q]) != n || !reflect.DeepEqual(batchL[q], labels[q*n:(q+1)*n]) {
+			t.Errorf("SearchBatch query %d = %v, want %v", q, batchL[q], labels[q*n:(q+1)*n])
+		}
+	}
+
+	all, err := idx.ComputeDistances(queries[:d])
+	if err != nil {
+		t.Fatalf("ComputeDistances: %v", err)
+	}
+	if len(all) != n {
+		t.Errorf("ComputeDistances returned %d distances, want %d", len(all), n)
+	}
+}
+
+func TestSearchBatchEmptyIndex(t *testing.T) {
+	const d = 8
+	idx := newFlatL2(t, d, nil)
+	query := randomVectors(1, d, 1)
+
+	distances, labels, err := idx.SearchBatch(query, 5, 1)
+	if !errors.Is(err, ErrEmptyIndex) {
+		t.Errorf("SearchBatch = %v, want ErrEmptyIndex", err)
+	}
+	if distances != nil || labels != nil {
+		t.Error("SearchBatch returned results for an empty index")
+	}
+	if _, err := idx.ComputeDistances(query); !errors.Is(err, ErrEmptyIndex) {
+		t.Errorf("ComputeDistances = %v, want ErrEmptyIndex", err)
+	}
+	if _, err := idx.ComputeDistancesBatch(query, 0); !errors.Is(err, ErrEmptyIndex) {
+		t.Errorf("ComputeDistancesBatch = %v, want ErrEmptyIndex", err)
+	}
+	if _, err := idx.ComputeL2Norms(); !errors.Is(err, ErrEmptyIndex) {
+		t.Errorf("ComputeL2Norms = %v, want ErrEmptyIndex", err)
+	}
+}
+
+func TestSearchDiverseCollapsesDuplicates(t *testing.T) {
+	const d, distinct, copies, k = 8, 20, 5, 10
+	base := randomVectors(distinct, d, 1)
+
+	// Every vector is stored copies times, with IDs i, i+distinct, ...
+	var x []float32
+	for c := 0; c < copies; c++ {
+		x = append(x, base...)
+	}
+	idx := newFlatL2(t, d, x)
+	query := randomVectors(1, d, 2)
+
+	plain, err := idx.SearchOne(query, k)
+	if err != nil {
+		t.Fatalf("SearchOne: %v", err)
+	}
+	if plain[0].Label%distinct != plain[1].Label%distinct {
+		t.Fatalf("plain search = %v, want the copies of the nearest vector first", plain)
+	}
+
+	diverse, err := idx.SearchDiverse(query, k, 0)
+	if err != nil {
+		t.Fatalf("SearchDiverse: %v", err)
+	}
+	if len(diverse) != k {
+		t.Fatalf("SearchDiverse returned %d neighbors, want %d", len(diverse), k)
+	}
+	seen := make(map[int64]bool)
+	for i, nb := range diverse {
+		v := nb.Label % distinct
+		if seen[v] {
+			t.Errorf("rank %d: label %d duplicates vector %d", i, nb.Label, v)
+		}
+		seen[v] = true
+		if i > 0 && nb.Distance < diverse[i-1].Distance {
+			t.Errorf("rank %d: distance %v is better than rank %d", i, nb.Distance, i-1)
+		}
+	}
+	if diverse[0] != plain[0] {
+		t.Errorf("SearchDiverse best = %+v, want %+v", diverse[0], plain[0])
+	}
+
+	// IVF indexes reconstruct the candidates through a direct map
+	ivf := newIVFFlatL2(t, d, 4, x)
+	if err := ivf.SetNProbe(4); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+	ivfDiverse, err := ivf.SearchDiverse(query, k, 0)
+	if err != nil {
+		t.Fatalf("SearchDiverse on IVF: %v", err)
+	}
+	if len(ivfDiverse) != k || ivfDiverse[0].Label%distinct != diverse[0].Label%distinct {
+		t.Errorf("SearchDiverse on IVF = %v, want %d neighbors starting with a copy of vector %d", ivfDiverse, k, diverse[0].Label%distinct)
+	}
+	if err := ivf.Add(base[:d]); err != nil {
+		t.Errorf("Add after SearchDiverse on IVF: %v", err)
+	}
+}
+
+func TestTrainingRequirements(t *testing.T) {
+	const d = 16
+	flat := newFlatL2(t, d, nil)
+
+	ivf, err := NewIndexIVFFlatL2(d, 256)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer ivf.Delete()
+
+	pq, err := NewIndexIVFPQ(d, 16, 4, 8, MetricL2)
+	if err != nil {
+		t.Fatalf("NewIndexIVFPQ: %v", err)
+	}
+	defer pq.Delete()
+
+	tests := []struct {
+		idx      Index
+		requires bool
+		min      int
+	}{
+		{flat, false, 0},
+		{ivf, true, 256},
+		{pq, true, 256}, // 2^8 PQ centroids outnumber the 16 lists
+	}
+	for _, tt := range tests {
+		if got := tt.idx.RequiresTraining(); got != tt.requires {
+			t.Errorf("%T: RequiresTraining = %v, want %v", tt.idx, got, tt.requires)
+		}
+		if got := tt.idx.MinTrainingPoints(); got != tt.min {
+			t.Errorf("%T: MinTrainingPoints = %d, want %d", tt.idx, got, tt.min)
+		}
+	}
+
+	// Training doesn't change the requirement
+	if err := ivf.Train(randomVectors(256*39, d, 1)); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	if !ivf.RequiresTraining() || ivf.MinTrainingPoints() != 256 {
+		t.Errorf("trained IVF: RequiresTraining = %v, MinTrainingPoints = %d", ivf.RequiresTraining(), ivf.MinTrainingPoints())
+	}
+}
+
+func TestSearchDistinctDuplicateLabels(t *testing.T) {
+	const d, n, copies, k = 8, 30, 4, 10
+	for _, metric := range []int{MetricL2, MetricInnerProduct} {
+		idx, err := IndexFactory(d, "IDMap,Flat", metric)
+		if err != nil {
+			t.Fatalf("IndexFactory: %v", err)
+		}
+		defer idx.Delete()
+
+		// Each ID is added copies times with different vectors
+		ids := make([]int64, n)
+		for i := range ids {
+			ids[i] = int64(i) * 10
+		}
+		for c := 0; c < copies; c++ {
+			if err := idx.AddWithIDs(randomVectors(n, d, int64(c+1)), ids); err != nil {
+				t.Fatalf("AddWithIDs: %v", err)
+			}
+		}
+
+		query := randomVectors(1, d, 99)
+		got, err := idx.SearchDistinct(query, k)
+		if err != nil {
+			t.Fatalf("metric %d: SearchDistinct: %v", metric, err)
+		}
+
+		// Reference: the best entry of each label over an exhaustive search
+		all, err := idx.SearchOne(query, n*copies)
+		if err != nil {
+			t.Fatalf("SearchOne: %v", err)
+		}
+		var want []Neighbor
+		seen := make(map[int64]bool)
+		for _, nb := range all {
+			if !seen[nb.Label] && len(want) < k {
+				want = append(want, nb)
+			}
+			seen[nb.Label] = true
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("metric %d: SearchDistinct = %v, want %v", metric, got, want)
+		}
+		for i := 1; i < len(got); i++ {
+			if IsCloser(metric, got[i].Distance, got[i-1].Distance) {
+				t.Errorf("metric %d: rank %d is closer than rank %d", metric, i, i-1)
+			}
+		}
+	}
+}
+
+func TestAllVectors(t *testing.T) {
+	const d, n = 8, 300
+	x := randomVectors(n, d, 1)
+
+	empty := newFlatL2(t, d, nil)
+	if got, err := empty.AllVectors(); err != nil || len(got) != 0 {
+		t.Errorf("AllVectors of an empty index = %v, %v", got, err)
+	}
+
+	flat := newFlatL2(t, d, x)
+	got, err := flat.AllVectors()
+	if err != nil {
+		t.Fatalf("flat AllVectors: %v", err)
+	}
+	if !reflect.DeepEqual(got, x) {
+		t.Error("flat AllVectors differs from the added vectors")
+	}
+
+	// IVFPQ decodes approximations, which must match Reconstruct in ID order
+	pq, err := NewIndexIVFPQ(d, 4, 4, 4, MetricL2)
+	if err != nil {
+		t.Fatalf("NewIndexIVFPQ: %v", err)
+	}
+	defer pq.Delete()
+	if err := pq.Train(x); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	if err := pq.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	got, err = pq.AllVectors()
+	if err != nil {
+		t.Fatalf("IVFPQ AllVectors: %v", err)
+	}
+	if len(got) != n*d {
+		t.Fatalf("IVFPQ AllVectors returned %d floats, want %d", len(got), n*d)
+	}
+	for id := int64(0); id < n; id++ {
+		want, err := pq.Reconstruct(id)
+		if err != nil {
+			t.Fatalf("Reconstruct(%d): %v", id, err)
+		}
+		if !reflect.DeepEqual(got[id*d:(id+1)*d], want) {
+			t.Fatalf("AllVectors row %d = %v, Reconstruct gave %v", id, got[id*d:(id+1)*d], want)
+		}
+	}
+}
+
+func TestMemoryUsageMatchesSerializedSize(t *testing.T) {
+	const d, n = 32, 5000
+	x := randomVectors(n, d, 1)
+
+	for _, desc := range []string{"Flat", "IVF16,Flat", "IVF16,PQ8", "HNSW16", "IDMap,Flat"} {
+		idx, err := IndexFactory(d, desc, MetricL2)
+		if err != nil {
+			t.Fatalf("IndexFactory(%q): %v", desc, err)
+		}
+		defer idx.Delete()
+		if err := idx.Train(x); err != nil {
+			t.Fatalf("%s: Train: %v", desc, err)
+		}
+		if strings.HasPrefix(desc, "IDMap") {
+			ids := make([]int64, n)
+			for i := range ids {
+				ids[i] = int64(i) * 3
+			}
+			err = idx.AddWithIDs(x, ids)
+		} else {
+			err = idx.Add(x)
+		}
+		if err != nil {
+			t.Fatalf("%s: add: %v", desc, err)
+		}
+
+		estimate, err := idx.MemoryUsage()
+		if err != nil {
+			t.Fatalf("%s: MemoryUsage: %v", desc, err)
+		}
+		exact, err := idx.ExactSerializedSize()
+		if err != nil {
+			t.Fatalf("%s: ExactSerializedSize: %v", desc, err)
+		}
+		if ratio := float64(estimate) / float64(exact); ratio < 0.8 || ratio > 1.2 {
+			t.Errorf("%s: MemoryUsage = %d, %.2f times the serialized size %d", desc, estimate, ratio, exact)
+		}
+	}
+}
+
+func TestAddWithIDsBatch(t *testing.T) {
+	const d, n = 8, 1050
+	idx, err := IndexFactory(d, "IDMap,Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory: %v", err)
+	}
+	defer idx.Delete()
+
+	x := randomVectors(n, d, 1)
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = 1_000_000 + int64(i)*3
+	}
+
+	if err := idx.AddWithIDsBatch(x, ids[:n-1], 100); err == nil {
+		t.Fatal("AddWithIDsBatch accepted fewer IDs than vectors")
+	}
+	if got := idx.Ntotal(); got != 0 {
+		t.Fatalf("Ntotal after a rejected add = %d, want 0", got)
+	}
+
+	// 11 batches, the last one partial
+	var calls []int
+	err = idx.AddWithIDsBatch(x, ids, 100, OnProgress(func(done, total int) {
+		calls = append(calls, done)
+	}))
+	if err != nil {
+		t.Fatalf("AddWithIDsBatch: %v", err)
+	}
+	checkProgress(t, calls, 11, n)
+
+	// Each stored vector is its own nearest neighbor, under its custom ID
+	_, labels, err := idx.Search(x, 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if !reflect.DeepEqual(labels, ids) {
+		t.Errorf("Search labels = %v..., want %v...", labels[:5], ids[:5])
+	}
+}
+
+func TestDefaultBatchSizes(t *testing.T) {
+	const d, n, nq = 8, 1000, 100
+	t.Cleanup(func() { SetDefaultBatchSizes(0, 0) })
+
+	if err := SetDefaultBatchSizes(250, 20); err != nil {
+		t.Fatalf("SetDefaultBatchSizes: %v", err)
+	}
+	if add, search := DefaultBatchSizes(); add != 250 || search != 20 {
+		t.Fatalf("DefaultBatchSizes = %d, %d, want 250, 20", add, search)
+	}
+
+	// A batch size of 0 picks up the configured defaults
+	idx := newFlatL2(t, d, nil)
+	var calls []int
+	progress := OnProgress(func(done, total int) { calls = append(calls, done) })
+	if err := idx.AddBatch(randomVectors(n, d, 1), 0, progress); err != nil {
+		t.Fatalf("AddBatch: %v", err)
+	}
+	checkProgress(t, calls, n/250, n)
+
+	calls = nil
+	if _, _, err := idx.SearchBatch(randomVectors(nq, d, 2), 5, 0, progress); err != nil {
+		t.Fatalf("SearchBatch: %v", err)
+	}
+	checkProgress(t, calls, nq/20, nq)
+
+	for _, sizes := range [][2]int{{-1, 10}, {10, -1}, {MaxAddBatchSize + 1, 10}, {10, MaxSearchBatchSize + 1}} {
+		if err := SetDefaultBatchSizes(sizes[0], sizes[1]); !errors.Is(err, ErrInvalidBatchSize) {
+			t.Errorf("SetDefaultBatchSizes(%d, %d) = %v, want ErrInvalidBatchSize", sizes[0], sizes[1], err)
+		}
+	}
+	if add, search := DefaultBatchSizes(); add != 250 || search != 20 {
+		t.Errorf("rejected sizes changed the defaults to %d, %d", add, search)
+	}
+
+	if err := SetDefaultBatchSizes(0, 0); err != nil {
+		t.Fatalf("SetDefaultBatchSizes(0, 0): %v", err)
+	}
+	if add, search := DefaultBatchSizes(); add != DefaultAddBatchSize || search != DefaultSearchBatchSize {
+		t.Errorf("SetDefaultBatchSizes(0, 0) left %d, %d", add, search)
+	}
+}
+
+func TestLimitErrors(t *testing.T) {
+	var limit *LimitError
+	if err := ValidateK(MaxK+1, 10); !errors.As(err, &limit) || !errors.Is(err, ErrInvalidK) {
+		t.Errorf("ValidateK(MaxK+1) = %v, want a LimitError matching ErrInvalidK", err)
+	} else if !strings.Contains(err.Error(), "holds 10 vectors") {
+		t.Errorf("ValidateK with ntotal = %q, want it to mention the index size", err)
+	}
+	if err := ValidateK(MaxK); err != nil {
+		t.Errorf("ValidateK(MaxK) = %v", err)
+	}
+
+	idx := newFlatL2(t, 4, randomVectors(10, 4, 1))
+	if _, _, err := idx.SearchBatch(randomVectors(2, 4, 2), 1, MaxSearchBatchSize+1); !errors.As(err, &limit) || limit.Limit != "MaxSearchBatchSize" || !errors.Is(err, ErrInvalidBatchSize) {
+		t.Errorf("SearchBatch above MaxSearchBatchSize = %v, want a LimitError matching ErrInvalidBatchSize", err)
+	}
+	if _, _, err := idx.SearchBatch(randomVectors(2, 4, 2), 1, MaxSearchBatchSize); err != nil {
+		t.Errorf("SearchBatch at MaxSearchBatchSize: %v", err)
+	}
+	if err := idx.AddBatch(randomVectors(2, 4, 3), MaxAddBatchSize+1); !errors.As(err, &limit) || limit.Limit != "MaxAddBatchSize" {
+		t.Errorf("AddBatch above MaxAddBatchSize = %v, want a LimitError", err)
+	}
+}
+
+func TestComputeDistancesBatchMatchesComputeDistances(t *testing.T) {
+	const d, n, nq = 8, 300, 7
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	queries := randomVectors(nq, d, 2)
+
+	all, err := idx.ComputeDistancesBatch(queries, 3)
+	if err != nil {
+		t.Fatalf("ComputeDistancesBatch: %v", err)
+	}
+	if len(all) != nq*n {
+		t.Fatalf("ComputeDistancesBatch returned %d distances, want %d", len(all), nq*n)
+	}
+	for q := 0; q < nq; q++ {
+		want, err := idx.ComputeDistances(queries[q*d : (q+1)*d])
+		if err != nil {
+			t.Fatalf("ComputeDistances: %v", err)
+		}
+		if !reflect.DeepEqual(all[q*n:(q+1)*n], want) {
+			t.Errorf("query %d: batch distances differ from ComputeDistances", q)
+		}
+	}
+}
+
+func TestFloat64MatchesFloat32(t *testing.T) {
+	const d, n, nq, k = 8, 500, 10, 5
+	x := randomVectors(n, d, 1)
+	queries := randomVectors(nq, d, 2)
+	x64 := make([]float64, len(x))
+	for i, v := range x {
+		x64[i] = float64(v)
+	}
+	queries64 := make([]float64, len(queries))
+	for i, v := range queries {
+		queries64[i] = float64(v)
+	}
+
+	want := newFlatL2(t, d, x)
+	got := newFlatL2(t, d, nil)
+	if err := got.AddFloat64(x64); err != nil {
+		t.Fatalf("AddFloat64: %v", err)
+	}
+	if got.Ntotal() != n {
+		t.Fatalf("Ntotal = %d, want %d", got.Ntotal(), n)
+	}
+
+	wantD, wantL, err := want.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	gotD, gotL, err := got.SearchFloat64(queries64, k)
+	if err != nil {
+		t.Fatalf("SearchFloat64: %v", err)
+	}
+	if !reflect.DeepEqual(gotL, wantL) {
+		t.Errorf("SearchFloat64 labels = %v, want %v", gotL, wantL)
+	}
+	if !approxEqual(gotD, wantD, 1e-5) {
+		t.Errorf("SearchFloat64 distances = %v, want %v", gotD, wantD)
+	}
+
+	if err := got.AddFloat64(x64[:d+1]); err == nil {
+		t.Error("AddFloat64 accepted a partial vector")
+	}
+}
+
+func TestRemoveIDsSlice(t *testing.T) {
+	const d, n = 4, 50
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+
+	ids := []int64{7, 3, 7, 1, 3}
+	removed, err := idx.RemoveIDsSlice(ids)
+	if err != nil {
+		t.Fatalf("RemoveIDsSlice: %v", err)
+	}
+	if removed != 3 || idx.Ntotal() != n-3 {
+		t.Errorf("removed %d, Ntotal = %d, want 3 and %d", removed, idx.Ntotal(), n-3)
+	}
+	if !reflect.DeepEqual(ids, []int64{7, 3, 7, 1, 3}) {
+		t.Errorf("RemoveIDsSlice modified its argument to %v", ids)
+	}
+
+	if removed, err := idx.RemoveIDsSlice([]int64{1000}); err != nil || removed != 0 {
+		t.Errorf("RemoveIDsSlice of a missing ID = %d, %v, want 0, nil", removed, err)
+	}
+	for _, bad := range [][]int64{nil, {2, -1}} {
+		if _, err := idx.RemoveIDsSlice(bad); err == nil {
+			t.Errorf("RemoveIDsSlice(%v) succeeded", bad)
+		}
+	}
+	if idx.Ntotal() != n-3 {
+		t.Errorf("Ntotal = %d after rejected removals, want %d", idx.Ntotal(), n-3)
+	}
+}
+
+func TestRemoveIDRange(t *testing.T) {
+	const d, n = 4, 50
+	x := randomVectors(n, d, 1)
+	idx := newFlatL2(t, d, x)
+
+	removed, err := idx.RemoveIDRange(10, 20)
+	if err != nil {
+		t.Fatalf("RemoveIDRange: %v", err)
+	}
+	if removed != 10 || idx.Ntotal() != n-10 {
+		t.Fatalf("removed %d, Ntotal = %d, want 10 and %d", removed, idx.Ntotal(), n-10)
+	}
+
+	// Survivors after the range move down to fill the gap
+	for i := 0; i < n; i++ {
+		if i >= 10 && i < 20 {
+			continue
+		}
+		want := int64(i)
+		if i >= 20 {
+			want -= 10
+		}
+		distances, labels, err := idx.Search(x[i*d:(i+1)*d], 1)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if labels[0] != want || distances[0] > 1e-5 {
+			t.Errorf("vector %d: nearest %d at %v, want %d at 0", i, labels[0], distances[0], want)
+		}
+	}
+
+	for _, r := range [][2]int64{{5, 5}, {8, 3}, {-1, 4}} {
+		if _, err := idx.RemoveIDRange(r[0], r[1]); err == nil {
+			t.Errorf("RemoveIDRange(%d, %d) succeeded", r[0], r[1])
+		}
+	}
+	if removed, err := idx.RemoveIDRange(1000, 2000); err != nil || removed != 0 {
+		t.Errorf("RemoveIDRange past the end = %d, %v, want 0, nil", removed, err)
+	}
+}
+
+func TestRangeSearchBatchWithinRadius(t *testing.T) {
+	const d, n, nq = 8, 1000, 100
+	const radius = 0.5
+	x := randomVectors(n, d, 1)
+	queries := randomVectors(nq, d, 2)
+	idx := newFlatL2(t, d, x)
+
+	results, err := idx.RangeSearchBatch(queries, radius, 7)
+	if err != nil {
+		t.Fatalf("RangeSearchBatch: %v", err)
+	}
+	if len(results) != nq {
+		t.Fatalf("got %d results, want %d", len(results), nq)
+	}
+
+	total := 0
+	for q, r := range results {
+		if len(r.Labels) != len(r.Distances) {
+			t.Fatalf("query %d: %d labels for %d distances", q, len(r.Labels), len(r.Distances))
+		}
+
+		// Every vector within the radius is found, and only those
+		want := 0
+		for i := 0; i < n; i++ {
+			if squaredDistance(queries[q*d:(q+1)*d], x[i*d:(i+1)*d]) < radius-1e-4 {
+				want++
+			}
+		}
+		if len(r.Labels) < want {
+			t.Errorf("query %d: %d results, want at least %d", q, len(r.Labels), want)
+		}
+		for j, label := range r.Labels {
+			dist := squaredDistance(queries[q*d:(q+1)*d], x[label*d:(label+1)*d])
+			if r.Distances[j] >= radius || math.Abs(dist-float64(r.Distances[j])) > 1e-4 {
+				t.Errorf("query %d: result %d at %v (computed %v), want below %v", q, label, r.Distances[j], dist, radius)
+			}
+			if j > 0 && r.Distances[j] < r.Distances[j-1] {
+				t.Errorf("query %d: results not sorted closest first", q)
+			}
+		}
+		total += len(r.Labels)
+	}
+	if total == 0 {
+		t.Fatal("no query found any neighbor; the radius is too small for the test")
+	}
+
+	// The batch size doesn't change the results
+	single, err := idx.RangeSearchBatch(queries, radius, nq)
+	if err != nil {
+		t.Fatalf("RangeSearchBatch in one batch: %v", err)
+	}
+	if !reflect.DeepEqual(single, results) {
+		t.Error("results depend on the batch size")
+	}
+
+	if _, err := idx.RangeSearchBatch(queries, -1, 10); err == nil {
+		t.Error("RangeSearchBatch accepted a negative L2 radius")
+	}
+}
+
+func TestAddBatchMatchesAdd(t *testing.T) {
+	const d, n = 8, 1000
+	x := randomVectors(n, d, 1)
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = int64(3 * i)
+	}
+
+	batched := newFlatL2(t, d, nil)
+	if err := batched.AddBatch(x, 7); err != nil {
+		t.Fatalf("AddBatch: %v", err)
+	}
+	whole := newFlatL2(t, d, x)
+	got, err := batched.AllVectors()
+	if err != nil {
+		t.Fatalf("AllVectors: %v", err)
+	}
+	want, err := whole.AllVectors()
+	if err != nil {
+		t.Fatalf("AllVectors: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("AddBatch stored different vectors than Add")
+	}
+
+	idmap, err := IndexFactory(d, "IDMap,Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory: %v", err)
+	}
+	defer idmap.Delete()
+	if err := idmap.AddWithIDsBatch(x, ids, 7); err != nil {
+		t.Fatalf("AddWithIDsBatch: %v", err)
+	}
+	_, labels, err := idmap.Search(x[500*d:501*d], 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if labels[0] != ids[500] {
+		t.Errorf("label = %d, want %d", labels[0], ids[500])
+	}
+}
+
+// BenchmarkAddSmallBatches adds vectors a few at a time, where the cgo
+// calls dominate: AddBatch makes one call per batch, a loop of Add makes
+// four.
+func BenchmarkAddSmallBatches(b *testing.B) {
+	const d, n, batch = 16, 50000, 4
+	x := randomVectors(n, d, 1)
+
+	run := func(b *testing.B, add func(idx *IndexFlat) error) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			idx, err := NewIndexFlatL2(d)
+			if err != nil {
+				b.Fatalf("NewIndexFlatL2: %v", err)
+			}
+			if err := idx.Reserve(n); err != nil {
+				b.Fatalf("Reserve: %v", err)
+			}
+			b.StartTimer()
+
+			if err := add(idx); err != nil {
+				b.Fatal(err)
+			}
+
+			b.StopTimer()
+			idx.Close()
+			b.StartTimer()
+		}
+	}
+
+	b.Run("AddBatch", func(b *testing.B) {
+		run(b, func(idx *IndexFlat) error { return idx.AddBatch(x, batch) })
+	})
+	b.Run("AddLoop", func(b *testing.B) {
+		run(b, func(idx *IndexFlat) error {
+			for j := 0; j < n; j += batch {
+				if err := idx.Add(x[j*d : (j+batch)*d]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func TestKthNeighborDistance(t *testing.T) {
+	const d, n, nq = 8, 500, 20
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	queries := randomVectors(nq, d, 2)
+
+	for _, k := range []int64{1, 5, n} {
+		kth, err := idx.KthNeighborDistance(queries, k)
+		if err != nil {
+			t.Fatalf("KthNeighborDistance(k=%d): %v", k, err)
+		}
+		distances, _, err := idx.Search(queries, k)
+		if err != nil {
+			t.Fatalf("Search(k=%d): %v", k, err)
+		}
+		if len(kth) != nq {
+			t.Fatalf("k=%d: got %d distances, want %d", k, len(kth), nq)
+		}
+		for q := 0; q < nq; q++ {
+			if want := distances[int64(q+1)*k-1]; kth[q] != want {
+				t.Errorf("k=%d, query %d: distance %v, want %v", k, q, kth[q], want)
+			}
+		}
+	}
+
+	if _, err := idx.KthNeighborDistance(queries, n+1); !errors.Is(err, ErrInvalidK) {
+		t.Errorf("KthNeighborDistance with k > Ntotal = %v, want ErrInvalidK", err)
+	}
+}
@@ -0,0 +1,395 @@
+package faiss
+
+/*
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// LabelMap maps the labels of an index to application IDs. It is maintained
+// by a MappedIndex, which keeps it in step with the index through adds,
+// removals and resets.
+//
+// Flat indexes label vectors by position, and removing vectors renumbers the
+// ones stored after them; the map follows that compaction. IVF and IDMap
+// indexes keep the labels they were given, which the map assigns itself so
+// that re-adds after removals never reuse a label.
+type LabelMap struct {
+	mu     sync.RWMutex
+	stable bool               // Labels survive removals; otherwise they are positions
+	appIDs []int64            // Application IDs in label order
+	labels []int64            // Sorted labels of appIDs, only if stable
+	next   int64              // Next label to assign, only if stable
+	known  map[int64]struct{} // Application IDs in the map
+}
+
+// labelMapState is the serialized form of a LabelMap.
+type labelMapState struct {
+	Stable bool
+	AppIDs []int64
+	Labels []int64
+	Next   int64
+}
+
+// NewLabelMap returns an empty label map.
+func NewLabelMap() *LabelMap {
+	return &LabelMap{known: make(map[int64]struct{})}
+}
+
+// Len returns the number of mapped vectors.
+func (m *LabelMap) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.appIDs)
+}
+
+// AppID returns the application ID of the vector with the given label.
+func (m *LabelMap) AppID(label int64) (int64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.lookup(label)
+}
+
+// Translate returns the application IDs of labels, as returned by a search
+// on the index. Labels that are not mapped, such as the -1 of missing
+// results, translate to -1.
+func (m *LabelMap) Translate(labels []int64) []int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]int64, len(labels))
+	m.translate(out, labels)
+	return out
+}
+
+// translate writes the application IDs of labels to out. m.mu must be held.
+func (m *LabelMap) translate(out, labels []int64) {
+	for i, label := range labels {
+		appID, ok := m.lookup(label)
+		if !ok {
+			appID = -1
+		}
+		out[i] = appID
+	}
+}
+
+// lookup returns the application ID of label. m.mu must be held.
+func (m *LabelMap) lookup(label int64) (int64, bool) {
+	if label < 0 {
+		return 0, false
+	}
+	if !m.stable {
+		if label >= int64(len(m.appIDs)) {
+			return 0, false
+		}
+		return m.appIDs[label], true
+	}
+
+	i := sort.Search(len(m.labels), func(i int) bool { return m.labels[i] >= label })
+	if i == len(m.labels) || m.labels[i] != label {
+		return 0, false
+	}
+	return m.appIDs[i], true
+}
+
+// MarshalBinary encodes the map, e.g. to store it next to a file written by
+// WriteIndex.
+func (m *LabelMap) MarshalBinary() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.marshal()
+}
+
+// marshal encodes the map. m.mu must be held.
+func (m *LabelMap) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	state := labelMapState{Stable: m.stable, AppIDs: m.appIDs, Labels: m.labels, Next: m.next}
+	if err := gob.NewEncoder(&buf).Encode(&state); err != nil {
+		return nil, wrapError(err, "encode label map")
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the content of the map with data written by
+// MarshalBinary.
+func (m *LabelMap) UnmarshalBinary(data []byte) error {
+	var state labelMapState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return wrapError(err, "decode label map")
+	}
+	if state.Stable && len(state.Labels) != len(state.AppIDs) {
+		return fmt.Errorf("label map is corrupt: %d labels for %d IDs", len(state.Labels), len(state.AppIDs))
+	}
+
+	known := make(map[int64]struct{}, len(state.AppIDs))
+	for _, appID := range state.AppIDs {
+		known[appID] = struct{}{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stable, m.appIDs, m.labels, m.next, m.known = state.Stable, state.AppIDs, state.Labels, state.Next, known
+	return nil
+}
+
+// MappedIndex is an index whose search results carry application IDs
+// instead of labels. Vectors are added with their application IDs by
+// AddMapped and removed by application ID, and the LabelMap translating
+// between the two is kept in step with the index.
+//
+// Only the methods of MappedIndex keep the map up to date: the index must not
+// be modified directly, or the map goes out of sync, which later calls
+// report as an error. Training through Index is fine. It is safe for
+// concurrent use.
+type MappedIndex struct {
+	index  Index
+	labels *LabelMap
+}
+
+// NewMappedIndex wraps idx, mapping its labels with labels. If labels is
+// nil, idx must be empty and a new map is created; otherwise labels must
+// map every vector of idx, as when both were saved together.
+func NewMappedIndex(idx Index, labels *LabelMap) (*MappedIndex, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return nil, ErrNullPointer
+	}
+
+	stable := C.goss_Index_stable_ids(idx.cPtr()) != 0
+	if labels == nil {
+		if n := idx.Ntotal(); n != 0 {
+			return nil, fmt.Errorf("index holds %d unmapped vectors", n)
+		}
+		labels = NewLabelMap()
+	}
+
+	labels.mu.Lock()
+	defer labels.mu.Unlock()
+
+	if len(labels.appIDs) == 0 {
+		labels.stable = stable
+	} else if labels.stable != stable {
+		return nil, fmt.Errorf("label map was built for a different index type")
+	}
+
+	m := &MappedIndex{index: idx, labels: labels}
+	if err := m.checkSync(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Index returns the wrapped index, e.g. to train it before the first add.
+func (m *MappedIndex) Index() Index {
+	return m.index
+}
+
+// Labels returns the label map.
+func (m *MappedIndex) Labels() *LabelMap {
+	return m.labels
+}
+
+// D returns the dimension of the vectors.
+func (m *MappedIndex) D() int {
+	return m.index.D()
+}
+
+// Ntotal returns the number of vectors in the index.
+func (m *MappedIndex) Ntotal() int64 {
+	return m.index.Ntotal()
+}
+
+// checkSync verifies that the map covers the index. m.labels.mu must be held.
+func (m *MappedIndex) checkSync() error {
+	if n := m.index.Ntotal(); n != int64(len(m.labels.appIDs)) {
+		return fmt.Errorf("label map out of sync: %d IDs for %d vectors", len(m.labels.appIDs), n)
+	}
+	return nil
+}
+
+// AddMapped adds the vectors of x, recording appIDs[i] as the application ID
+// of the i-th one. Application IDs must be unique across the index.
+func (m *MappedIndex) AddMapped(x []float32, appIDs []int64) error {
+	d := m.index.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return wrapError(err, "add mapped vectors validation")
+	}
+	n := len(x) / d
+	if len(appIDs) != n {
+		return fmt.Errorf("got %d application IDs for %d vectors", len(appIDs), n)
+	}
+
+	l := m.labels
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := m.checkSync(); err != nil {
+		return err
+	}
+
+	batch := make(map[int64]struct{}, n)
+	for _, appID := range appIDs {
+		if _, ok := l.known[appID]; ok {
+			return fmt.Errorf("application ID %d is already mapped", appID)
+		}
+		if _, ok := batch[appID]; ok {
+			return fmt.Errorf("application ID %d is repeated", appID)
+		}
+		batch[appID] = struct{}{}
+	}
+
+	if l.stable {
+		ids := make([]int64, n)
+		for i := range ids {
+			ids[i] = l.next + int64(i)
+		}
+		if err := m.index.AddWithIDs(x, ids); err != nil {
+			return wrapError(err, "add mapped vectors")
+		}
+		l.labels = append(l.labels, ids...)
+		l.next += int64(n)
+	} else if err := m.index.Add(x); err != nil {
+		return wrapError(err, "add mapped vectors")
+	}
+
+	l.appIDs = append(l.appIDs, appIDs...)
+	for appID := range batch {
+		l.known[appID] = struct{}{}
+	}
+	return nil
+}
+
+// Search is like Index.Search, returning application IDs instead of labels.
+func (m *MappedIndex) Search(x []float32, k int64) (distances []float32, appIDs []int64, err error) {
+	m.labels.mu.RLock()
+	defer m.labels.mu.RUnlock()
+
+	distances, labels, err := m.index.Search(x, k)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.labels.translate(labels, labels)
+	return distances, labels, nil
+}
+
+// SearchWithOptions is like Index.SearchWithOptions, returning application
+// IDs instead of labels. A Selector in opts selects labels, not
+// application IDs.
+func (m *MappedIndex) SearchWithOptions(x []float32, k int64, opts SearchOptions) (distances []float32, appIDs []int64, err error) {
+	m.labels.mu.RLock()
+	defer m.labels.mu.RUnlock()
+
+	distances, labels, err := m.index.SearchWithOptions(x, k, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.labels.translate(labels, labels)
+	return distances, labels, nil
+}
+
+// SearchBatch is like Index.SearchBatch, returning application IDs instead
+// of labels.
+func (m *MappedIndex) SearchBatch(queries []float32, k int64, batchSize int, opts ...BatchOption) ([][]float32, [][]int64, error) {
+	m.labels.mu.RLock()
+	defer m.labels.mu.RUnlock()
+
+	distances, labels, err := m.index.SearchBatch(queries, k, batchSize, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, row := range labels {
+		m.labels.translate(row, row)
+	}
+	return distances, labels, nil
+}
+
+// Remove removes the vectors with the given application IDs, ignoring IDs
+// that are not mapped, and returns the number of vectors removed. The labels
+// of the remaining vectors are renumbered as the index does.
+func (m *MappedIndex) Remove(appIDs []int64) (int, error) {
+	l := m.labels
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := m.checkSync(); err != nil {
+		return 0, err
+	}
+
+	remove := make(map[int64]struct{}, len(appIDs))
+	for _, appID := range appIDs {
+		if _, ok := l.known[appID]; ok {
+			remove[appID] = struct{}{}
+		}
+	}
+	if len(remove) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int64, 0, len(remove))
+	for i, appID := range l.appIDs {
+		if _, ok := remove[appID]; !ok {
+			continue
+		}
+		if l.stable {
+			ids = append(ids, l.labels[i])
+		} else {
+			ids = append(ids, int64(i))
+		}
+	}
+
+	removed, err := m.index.RemoveIDsSlice(ids)
+	if err != nil {
+		return 0, wrapError(err, "remove mapped vectors")
+	}
+	if removed != len(ids) {
+		return removed, fmt.Errorf("label map out of sync: removed %d of %d vectors", removed, len(ids))
+	}
+
+	// Drop the removed entries, keeping the order: flat indexes shift the
+	// vectors after a removed one down, so positions stay aligned.
+	kept := 0
+	for i, appID := range l.appIDs {
+		if _, ok := remove[appID]; ok {
+			delete(l.known, appID)
+			continue
+		}
+		l.appIDs[kept] = appID
+		if l.stable {
+			l.labels[kept] = l.labels[i]
+		}
+		kept++
+	}
+	l.appIDs = l.appIDs[:kept]
+	if l.stable {
+		l.labels = l.labels[:kept]
+	}
+	return removed, nil
+}
+
+// Reset removes all vectors from the index and the map.
+func (m *MappedIndex) Reset() error {
+	l := m.labels
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := m.index.Reset(); err != nil {
+		return err
+	}
+	l.appIDs, l.labels, l.next = nil, nil, 0
+	l.known = make(map[int64]struct{})
+	return nil
+}
+
+// Delete frees the index.
+func (m *MappedIndex) Delete() {
+	m.index.Delete()
+}
@@ -0,0 +1,175 @@
+package faiss
+
+import (
+	"testing"
+)
+
+// checkMapped checks that each vector of x still in the index finds itself,
+// reported under its application ID.
+func checkMapped(t *testing.T, m *MappedIndex, x []float32, appIDs []int64, removed map[int64]bool) {
+	t.Helper()
+
+	d := m.D()
+	for i, appID := range appIDs {
+		if removed[appID] {
+			continue
+		}
+		distances, got, err := m.Search(x[i*d:(i+1)*d], 1)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if got[0] != appID || distances[0] > 1e-5 {
+			t.Errorf("vector of %d: nearest %d at %v, want itself", appID, got[0], distances[0])
+		}
+	}
+}
+
+func testLabelMapRemovals(t *testing.T, idx Index) {
+	const d, n = 8, 100
+	x := randomVectors(n, d, 1)
+	appIDs := make([]int64, n)
+	for i := range appIDs {
+		appIDs[i] = 1000 + int64(i)*7
+	}
+
+	m, err := NewMappedIndex(idx, nil)
+	if err != nil {
+		t.Fatalf("NewMappedIndex: %v", err)
+	}
+	if err := m.AddMapped(x, appIDs); err != nil {
+		t.Fatalf("AddMapped: %v", err)
+	}
+
+	// Removals at the start, middle and end renumber the labels of a flat
+	// index in between
+	removed := map[int64]bool{}
+	var remove []int64
+	for _, i := range []int{0, 1, 37, 38, 50, 99} {
+		remove = append(remove, appIDs[i])
+		removed[appIDs[i]] = true
+	}
+	got, err := m.Remove(append(remove, 5))
+	if err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if got != len(remove) || m.Ntotal() != n-int64(len(remove)) {
+		t.Fatalf("removed %d, Ntotal = %d, want %d and %d", got, m.Ntotal(), len(remove), n-len(remove))
+	}
+	checkMapped(t, m, x, appIDs, removed)
+
+	// Removing again after the compaction still finds the right vectors
+	if _, err := m.Remove([]int64{appIDs[60], appIDs[2]}); err != nil {
+		t.Fatalf("second Remove: %v", err)
+	}
+	removed[appIDs[60]], removed[appIDs[2]] = true, true
+	checkMapped(t, m, x, appIDs, removed)
+
+	// Re-adding a removed application ID maps it to the new vector
+	y := randomVectors(1, d, 2)
+	if err := m.AddMapped(y, []int64{appIDs[37]}); err != nil {
+		t.Fatalf("AddMapped after Remove: %v", err)
+	}
+	checkMapped(t, m, y, []int64{appIDs[37]}, nil)
+	checkMapped(t, m, x, appIDs, removed)
+
+	if err := m.AddMapped(y, []int64{appIDs[10]}); err == nil {
+		t.Error("AddMapped accepted an application ID already mapped")
+	}
+
+	if err := m.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if m.Ntotal() != 0 || m.Labels().Len() != 0 {
+		t.Errorf("after Reset Ntotal = %d, Len = %d, want 0", m.Ntotal(), m.Labels().Len())
+	}
+	if err := m.AddMapped(x[:d], appIDs[:1]); err != nil {
+		t.Fatalf("AddMapped after Reset: %v", err)
+	}
+	checkMapped(t, m, x, appIDs[:1], nil)
+}
+
+func TestLabelMapFlatCompaction(t *testing.T) {
+	testLabelMapRemovals(t, newFlatL2(t, 8, nil))
+}
+
+func TestLabelMapIDMap(t *testing.T) {
+	idx, err := IndexFactory(8, "IDMap,Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory: %v", err)
+	}
+	defer idx.Delete()
+	testLabelMapRemovals(t, idx)
+}
+
+func TestMappedIndexDetectsDirectChanges(t *testing.T) {
+	idx := newFlatL2(t, 4, nil)
+	m, err := NewMappedIndex(idx, nil)
+	if err != nil {
+		t.Fatalf("NewMappedIndex: %v", err)
+	}
+	if err := m.AddMapped(randomVectors(3, 4, 1), []int64{10, 20, 30}); err != nil {
+		t.Fatalf("AddMapped: %v", err)
+	}
+
+	// A removal bypassing the map is reported rather than silently shifting
+	// the application IDs
+	if _, err := idx.RemoveIDsSlice([]int64{0}); err != nil {
+		t.Fatalf("RemoveIDsSlice: %v", err)
+	}
+	if _, err := m.Remove([]int64{20}); err == nil {
+		t.Error("Remove succeeded with the map out of sync")
+	}
+	if err := m.AddMapped(randomVectors(1, 4, 2), []int64{40}); err == nil {
+		t.Error("AddMapped succeeded with the map out of sync")
+	}
+	if _, err := NewMappedIndex(idx, m.Labels()); err == nil {
+		t.Error("NewMappedIndex accepted a map that doesn't cover the index")
+	}
+}
+
+func TestLabelMapPersistent(t *testing.T) {
+	const d, n = 8, 50
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBlobStore: %v", err)
+	}
+	factory := func() (Index, error) { return NewIndexFlatL2(d) }
+
+	p, err := NewPersistentIndexWithStore(store, "mapped", factory)
+	if err != nil {
+		t.Fatalf("NewPersistentIndexWithStore: %v", err)
+	}
+	defer p.Close()
+	m, err := p.Mapped()
+	if err != nil {
+		t.Fatalf("Mapped: %v", err)
+	}
+	x := randomVectors(n, d, 1)
+	appIDs := make([]int64, n)
+	for i := range appIDs {
+		appIDs[i] = int64(n - i)
+	}
+	if err := m.AddMapped(x, appIDs); err != nil {
+		t.Fatalf("AddMapped: %v", err)
+	}
+	if _, err := m.Remove([]int64{appIDs[3], appIDs[20]}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reloaded, err := NewPersistentIndexWithStore(store, "mapped", factory)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	defer reloaded.Close()
+	rm, err := reloaded.Mapped()
+	if err != nil {
+		t.Fatalf("reloaded Mapped: %v", err)
+	}
+	if rm.Labels().Len() != n-2 {
+		t.Fatalf("reloaded map has %d IDs, want %d", rm.Labels().Len(), n-2)
+	}
+	checkMapped(t, rm, x, appIDs, map[int64]bool{appIDs[3]: true, appIDs[20]: true})
+}
@@ -0,0 +1,96 @@
+package faiss
+
+/*
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// modulePath is the import path of this package's module, used to find the
+// wrapper version in the build info.
+const modulePath = "github.com/BuiDanhTung28/goss"
+
+// BuildInfo describes the FAISS library linked into the binary. It is meant
+// to be included in bug reports.
+type BuildInfo struct {
+	FAISSVersion   string   // Version of the linked FAISS, e.g. "1.8.0"
+	CompileOptions []string // FAISS compile options, e.g. "OPTIMIZE", "AVX2"
+	SIMDLevel      string   // Widest SIMD instruction set compiled in, or "generic"
+	OMPThreads     int      // Threads OpenMP currently uses for parallel regions
+	Platform       string   // GOOS_arch the binary targets, e.g. "linux_x64"
+	LibDir         string   // Directory the static libraries were linked from
+	WrapperVersion string   // Version of this Go module, or "(devel)"
+}
+
+// LibraryInfo returns version and build information for the linked FAISS
+// library and this wrapper.
+func LibraryInfo() BuildInfo {
+	options := strings.Fields(C.GoString(C.goss_compile_options()))
+
+	return BuildInfo{
+		FAISSVersion:   FaissVersion(),
+		CompileOptions: options,
+		SIMDLevel:      simdLevel(options),
+		OMPThreads:     int(C.goss_omp_max_threads()),
+		Platform:       platform(),
+		LibDir:         libDir,
+		WrapperVersion: wrapperVersion(),
+	}
+}
+
+// FaissVersion returns the version of the linked FAISS library, e.g.
+// "1.8.0", as given by the FAISS_VERSION macros it was compiled with.
+func FaissVersion() string {
+	return C.GoString(C.goss_version())
+}
+
+// simdLevel picks the widest SIMD level among FAISS compile options.
+func simdLevel(options []string) string {
+	levels := []string{"AVX512_SPR", "AVX512", "AVX2", "SVE", "NEON"}
+	for _, level := range levels {
+		for _, opt := range options {
+			if opt == level {
+				return level
+			}
+		}
+	}
+	return "generic"
+}
+
+// platform returns the platform name in the form used by internal/lib.
+func platform() string {
+	arch := runtime.GOARCH
+	if arch == "amd64" {
+		arch = "x64"
+	}
+	return runtime.GOOS + "_" + arch
+}
+
+// wrapperVersion returns the version of this module recorded in the binary's
+// build info.
+func wrapperVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		if dep.Version == "" {
+			break
+		}
+		return dep.Version
+	}
+	return "(devel)"
+}
@@ -0,0 +1,64 @@
+package faiss
+
+import (
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFaissVersion(t *testing.T) {
+	version := FaissVersion()
+	if !regexp.MustCompile(`^\d+\.\d+\.\d+$`).MatchString(version) {
+		t.Fatalf("FaissVersion = %q, want major.minor.patch", version)
+	}
+	if strings.HasPrefix(version, "0.") {
+		t.Errorf("FaissVersion = %q, want a released FAISS version", version)
+	}
+
+	info := LibraryInfo()
+	if info.FAISSVersion != version {
+		t.Errorf("LibraryInfo FAISSVersion = %q, want %q", info.FAISSVersion, version)
+	}
+	if info.OMPThreads < 1 {
+		t.Errorf("LibraryInfo OMPThreads = %d, want at least 1", info.OMPThreads)
+	}
+	if !strings.HasPrefix(info.Platform, runtime.GOOS+"_") {
+		t.Errorf("LibraryInfo Platform = %q, want a %s platform", info.Platform, runtime.GOOS)
+	}
+	if info.SIMDLevel != simdLevel(info.CompileOptions) {
+		t.Errorf("LibraryInfo SIMDLevel = %q for options %v", info.SIMDLevel, info.CompileOptions)
+	}
+}
+
+func TestSIMDLevel(t *testing.T) {
+	cases := map[string]string{
+		"":                     "generic",
+		"OPTIMIZE":             "generic",
+		"OPTIMIZE AVX2":        "AVX2",
+		"AVX2 AVX512 OPTIMIZE": "AVX512",
+		"AVX512 AVX512_SPR":    "AVX512_SPR",
+		"NEON":                 "NEON",
+	}
+	for options, want := range cases {
+		if got := simdLevel(strings.Fields(options)); got != want {
+			t.Errorf("simdLevel(%q) = %q, want %q", options, got, want)
+		}
+	}
+}
+
+func TestLibraryInfoFollowsSetNumThreads(t *testing.T) {
+	defer SetNumThreads(0)
+
+	SetNumThreads(2)
+	info := LibraryInfo()
+	if info.OMPThreads != 2 {
+		t.Errorf("LibraryInfo OMPThreads = %d after SetNumThreads(2), want 2", info.OMPThreads)
+	}
+	if info.LibDir != libDir || !strings.HasPrefix(info.LibDir, "internal/lib") {
+		t.Errorf("LibraryInfo LibDir = %q, want %q", info.LibDir, libDir)
+	}
+	if info.WrapperVersion == "" {
+		t.Error("LibraryInfo WrapperVersion is empty")
+	}
+}
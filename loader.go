@@ -0,0 +1,271 @@
+package faiss
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultCheckpointInterval is the CheckpointInterval of loaders created by
+// NewResumableLoader.
+const DefaultCheckpointInterval = time.Minute
+
+// VectorSource yields chunks of vectors for a ResumableLoader.
+// A source must yield the same chunks in the same order on every run so that
+// an interrupted load can be resumed.
+type VectorSource interface {
+	// Next returns the next chunk of vectors and their IDs.
+	// ids may be nil, in which case the vectors get sequential IDs.
+	// Next returns io.EOF once the source is exhausted.
+	Next(ctx context.Context) (vectors []float32, ids []int64, err error)
+}
+
+// loaderJournal records how much of a source has been persisted.
+type loaderJournal struct {
+	Chunks int    `json:"chunks"` // Number of chunks persisted
+	Ntotal int64  `json:"ntotal"` // Ntotal of the index after the last persisted chunk
+	Hash   string `json:"hash"`   // Chained SHA-256 of all persisted chunks
+}
+
+// ResumableLoader bulk-loads a VectorSource into an index on disk,
+// checkpointing the index and a small journal as it goes. A run that is
+// interrupted can be restarted with the same source and skips the chunks
+// already persisted. Each chunk is either fully contained in the persisted
+// index or not at all.
+//
+// Every checkpoint rewrites the whole index, so checkpointing after each
+// chunk costs I/O quadratic in the size of the load. Checkpoints are rather
+// taken every CheckpointEvery chunks and every CheckpointInterval, and at the
+// end of the source; an interrupted run redoes the chunks added since the
+// last one.
+type ResumableLoader struct {
+	IndexPath   string                // Path of the persisted index
+	JournalPath string                // Path of the progress journal
+	BatchSize   int                   // Batch size passed to AddBatch
+	NewIndex    func() (Index, error) // Creates a trained, empty index on a fresh start
+
+	// CheckpointEvery is the number of chunks after which a checkpoint is
+	// taken; 0 disables the limit.
+	CheckpointEvery int
+	// CheckpointInterval is the time after which a checkpoint is taken once
+	// the current chunk is added; 0 disables the limit. With both limits
+	// disabled, a checkpoint is taken after every chunk.
+	CheckpointInterval time.Duration
+}
+
+// NewResumableLoader creates a loader persisting to indexPath, with the
+// journal stored next to it. newIndex is only called when no previous
+// progress exists.
+func NewResumableLoader(indexPath string, newIndex func() (Index, error)) *ResumableLoader {
+	return &ResumableLoader{
+		IndexPath:   indexPath,
+		JournalPath: indexPath + ".journal",
+		BatchSize:   DefaultAddBatchSize,
+		NewIndex:    newIndex,
+
+		CheckpointInterval: DefaultCheckpointInterval,
+	}
+}
+
+// Load ingests source into the index at IndexPath, resuming from the journal
+// if one exists. If ctx is canceled, the chunks added so far are checkpointed
+// before returning. The index is freed when Load returns; use ReadIndex to
+// open the result.
+func (l *ResumableLoader) Load(ctx context.Context, source VectorSource) error {
+	if source == nil {
+		return errors.New("source is nil")
+	}
+
+	if l.IndexPath == "" || l.JournalPath == "" {
+		return errors.New("index and journal paths are required")
+	}
+
+	journal, err := l.readJournal()
+	if err != nil {
+		return wrapError(err, "read loader journal")
+	}
+
+	idx, err := l.openIndex()
+	if err != nil {
+		return err
+	}
+	defer idx.Delete()
+
+	// Skip the chunks already persisted, verifying the source didn't change.
+	hash := ""
+	for i := 0; i < journal.Chunks; i++ {
+		vectors, ids, err := source.Next(ctx)
+		if err != nil {
+			return wrapError(err, fmt.Sprintf("replay chunk %d", i))
+		}
+		hash = chainHash(hash, vectors, ids)
+	}
+	if hash != journal.Hash {
+		return errors.New("source does not match the loader journal")
+	}
+
+	// A crash between persisting the index and the journal leaves the index
+	// the chunks of one checkpoint ahead of the journal.
+	if idx.Ntotal() != journal.Ntotal {
+		for journal.Ntotal < idx.Ntotal() {
+			vectors, ids, err := source.Next(ctx)
+			if err != nil {
+				return wrapError(err, fmt.Sprintf("recover pending chunk %d", journal.Chunks))
+			}
+			journal = loaderJournal{
+				Chunks: journal.Chunks + 1,
+				Ntotal: journal.Ntotal + int64(len(vectors)/idx.D()),
+				Hash:   chainHash(journal.Hash, vectors, ids),
+			}
+		}
+		if idx.Ntotal() != journal.Ntotal {
+			return fmt.Errorf("index has %d vectors, which is not a chunk boundary of the source", idx.Ntotal())
+		}
+		if err := l.writeJournal(journal); err != nil {
+			return wrapError(err, "write loader journal")
+		}
+	}
+
+	persisted := journal
+	checkpoint := func() error {
+		if journal.Chunks == persisted.Chunks {
+			return nil
+		}
+		if err := writeIndexAtomic(idx, l.IndexPath); err != nil {
+			return wrapError(err, fmt.Sprintf("persist chunks %d-%d", persisted.Chunks, journal.Chunks-1))
+		}
+		if err := l.writeJournal(journal); err != nil {
+			return wrapError(err, "write loader journal")
+		}
+		persisted = journal
+		return nil
+	}
+
+	last := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			if cerr := checkpoint(); cerr != nil {
+				return cerr
+			}
+			return err
+		}
+
+		vectors, ids, err := source.Next(ctx)
+		if err == io.EOF {
+			return checkpoint()
+		}
+		if err != nil {
+			return wrapError(err, fmt.Sprintf("read chunk %d", journal.Chunks))
+		}
+
+		// A failed add may leave part of the chunk in the index, which must
+		// then not be persisted.
+		if ids != nil {
+			err = idx.AddWithIDs(vectors, ids)
+		} else {
+			err = idx.AddBatch(vectors, l.BatchSize)
+		}
+		if err != nil {
+			return wrapError(err, fmt.Sprintf("add chunk %d", journal.Chunks))
+		}
+		journal = advance(journal, idx, vectors, ids)
+
+		if l.checkpointDue(journal.Chunks-persisted.Chunks, time.Since(last)) {
+			if err := checkpoint(); err != nil {
+				return err
+			}
+			last = time.Now()
+		}
+	}
+}
+
+// checkpointDue reports whether a checkpoint must be taken after adding
+// pending chunks since the last one, elapsed ago.
+func (l *ResumableLoader) checkpointDue(pending int, elapsed time.Duration) bool {
+	if l.CheckpointEvery <= 0 && l.CheckpointInterval <= 0 {
+		return true
+	}
+	return l.CheckpointEvery > 0 && pending >= l.CheckpointEvery ||
+		l.CheckpointInterval > 0 && elapsed >= l.CheckpointInterval
+}
+
+// openIndex reads the persisted index, or creates a new one on a fresh start.
+func (l *ResumableLoader) openIndex() (Index, error) {
+	if _, err := os.Stat(l.IndexPath); err == nil {
+		idx, err := ReadIndex(l.IndexPath, 0)
+		if err != nil {
+			return nil, wrapError(err, "read persisted index")
+		}
+		return idx, nil
+	}
+
+	if l.NewIndex == nil {
+		return nil, errors.New("no persisted index and NewIndex is nil")
+	}
+	idx, err := l.NewIndex()
+	if err != nil {
+		return nil, wrapError(err, "create index")
+	}
+	return idx, nil
+}
+
+// advance returns the journal after persisting one more chunk.
+func advance(j loaderJournal, idx Index, vectors []float32, ids []int64) loaderJournal {
+	return loaderJournal{
+		Chunks: j.Chunks + 1,
+		Ntotal: idx.Ntotal(),
+		Hash:   chainHash(j.Hash, vectors, ids),
+	}
+}
+
+func (l *ResumableLoader) readJournal() (loaderJournal, error) {
+	var j loaderJournal
+	data, err := os.ReadFile(l.JournalPath)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return j, err
+	}
+	err = json.Unmarshal(data, &j)
+	return j, err
+}
+
+func (l *ResumableLoader) writeJournal(j loaderJournal) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	tmp := l.JournalPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.JournalPath)
+}
+
+// writeIndexAtomic writes idx to a temporary file and renames it over fname.
+func writeIndexAtomic(idx Index, fname string) error {
+	tmp := fname + ".tmp"
+	if err := WriteIndex(idx, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fname)
+}
+
+// chainHash returns SHA-256(prev || vectors || ids) as a hex string.
+func chainHash(prev string, vectors []float32, ids []int64) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	_ = binary.Write(h, binary.LittleEndian, vectors)
+	if ids != nil {
+		_ = binary.Write(h, binary.LittleEndian, ids)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
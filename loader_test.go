@@ -0,0 +1,117 @@
+package faiss
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// chunkSource yields fixed chunks, failing with errCrash once failAt chunks
+// were read if failAt is positive.
+type chunkSource struct {
+	chunks [][]float32
+	next   int
+	failAt int
+}
+
+var errCrash = errors.New("simulated crash")
+
+func (s *chunkSource) Next(context.Context) ([]float32, []int64, error) {
+	if s.failAt > 0 && s.next == s.failAt {
+		return nil, nil, errCrash
+	}
+	if s.next == len(s.chunks) {
+		return nil, nil, io.EOF
+	}
+	s.next++
+	return s.chunks[s.next-1], nil, nil
+}
+
+func loaderChunks(n, size, d int) [][]float32 {
+	chunks := make([][]float32, n)
+	for i := range chunks {
+		chunks[i] = randomVectors(size, d, int64(i))
+	}
+	return chunks
+}
+
+func newTestLoader(path string, d int) *ResumableLoader {
+	l := NewResumableLoader(path, func() (Index, error) { return NewIndexFlatL2(d) })
+	l.CheckpointEvery = 3
+	l.CheckpointInterval = 0
+	return l
+}
+
+func loadedNtotal(t *testing.T, path string) int64 {
+	t.Helper()
+
+	idx, err := ReadIndex(path, 0)
+	if err != nil {
+		t.Fatalf("ReadIndex: %v", err)
+	}
+	defer idx.Delete()
+	return idx.Ntotal()
+}
+
+func TestResumableLoaderResumesAfterCrash(t *testing.T) {
+	const d, nchunks, size = 8, 10, 50
+	chunks := loaderChunks(nchunks, size, d)
+	dir := t.TempDir()
+
+	// Uninterrupted reference run.
+	reference := filepath.Join(dir, "reference.index")
+	if err := newTestLoader(reference, d).Load(context.Background(), &chunkSource{chunks: chunks}); err != nil {
+		t.Fatalf("uninterrupted Load: %v", err)
+	}
+
+	// Crash after 7 chunks: only the 6 of the last checkpoint are persisted.
+	path := filepath.Join(dir, "resumed.index")
+	err := newTestLoader(path, d).Load(context.Background(), &chunkSource{chunks: chunks, failAt: 7})
+	if !errors.Is(err, errCrash) {
+		t.Fatalf("interrupted Load error = %v, want the simulated crash", err)
+	}
+	if got := loadedNtotal(t, path); got != 6*size {
+		t.Fatalf("persisted Ntotal after the crash = %d, want %d", got, 6*size)
+	}
+
+	if err := newTestLoader(path, d).Load(context.Background(), &chunkSource{chunks: chunks}); err != nil {
+		t.Fatalf("resumed Load: %v", err)
+	}
+	if got, want := loadedNtotal(t, path), loadedNtotal(t, reference); got != want {
+		t.Fatalf("resumed Ntotal = %d, want %d as uninterrupted", got, want)
+	}
+}
+
+func TestResumableLoaderRecoversJournalBehindIndex(t *testing.T) {
+	const d, nchunks, size = 8, 10, 50
+	chunks := loaderChunks(nchunks, size, d)
+	path := filepath.Join(t.TempDir(), "loader.index")
+
+	// Keep the journal of a checkpoint, then let a later checkpoint persist
+	// the index: restoring the old journal simulates a crash between writing
+	// the index and the journal.
+	l := newTestLoader(path, d)
+	if err := l.Load(context.Background(), &chunkSource{chunks: chunks, failAt: 4}); !errors.Is(err, errCrash) {
+		t.Fatalf("interrupted Load error = %v, want the simulated crash", err)
+	}
+	stale, err := os.ReadFile(l.JournalPath)
+	if err != nil {
+		t.Fatalf("read journal: %v", err)
+	}
+	if err := l.Load(context.Background(), &chunkSource{chunks: chunks, failAt: 8}); !errors.Is(err, errCrash) {
+		t.Fatalf("interrupted Load error = %v, want the simulated crash", err)
+	}
+	if err := os.WriteFile(l.JournalPath, stale, 0644); err != nil {
+		t.Fatalf("restore journal: %v", err)
+	}
+
+	if err := l.Load(context.Background(), &chunkSource{chunks: chunks}); err != nil {
+		t.Fatalf("resumed Load: %v", err)
+	}
+	if got := loadedNtotal(t, path); got != nchunks*size {
+		t.Fatalf("Ntotal = %d, want %d", got, nchunks*size)
+	}
+}
@@ -0,0 +1,193 @@
+package faiss
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// SearchResultSet is the result of one query on one index, as returned by
+// Search: distances and labels sorted best first, possibly padded with -1
+// labels.
+type SearchResultSet struct {
+	Distances []float32
+	Labels    []int64
+	// LabelOffset is added to every label, for partitions that each number
+	// their vectors from 0.
+	LabelOffset int64
+}
+
+// MergeOption configures MergeSearchResults.
+type MergeOption func(*mergeOptions)
+
+type mergeOptions struct {
+	dedupe bool
+}
+
+// MergeDedupe keeps a label present in several result sets once, with its
+// best distance.
+func MergeDedupe() MergeOption {
+	return func(o *mergeOptions) {
+		o.dedupe = true
+	}
+}
+
+// MergeResults merges per-shard result lists, each sorted best first as
+// returned by a search, into a global top-k. Results closer under metric come
+// first: larger distances for MetricInnerProduct, smaller for other metrics.
+// A label present in several lists is kept once, with its best distance.
+// Entries with a negative label (padding) are ignored.
+func MergeResults(metric int, k int, results ...[]Neighbor) []Neighbor {
+	if k <= 0 {
+		return nil
+	}
+
+	h := &mergeHeap{
+		metric:   metric,
+		distance: func(list, pos int) float32 { return results[list][pos].Distance },
+	}
+	for i, list := range results {
+		if len(list) > 0 {
+			h.cursors = append(h.cursors, mergeCursor{list: i})
+		}
+	}
+	heap.Init(h)
+
+	merged := make([]Neighbor, 0, k)
+	seen := make(map[int64]struct{}, k)
+	for h.Len() > 0 && len(merged) < k {
+		c := &h.cursors[0]
+		n := results[c.list][c.pos]
+
+		c.pos++
+		if c.pos < len(results[c.list]) {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+
+		if n.Label < 0 {
+			continue
+		}
+		// Lists are merged best first, so the first occurrence is the best
+		if _, ok := seen[n.Label]; ok {
+			continue
+		}
+		seen[n.Label] = struct{}{}
+		merged = append(merged, n)
+	}
+
+	return merged
+}
+
+// MergeSearchResults merges the results of the same query on several
+// indexes, for example per-day partitions, into a global top-k. Results
+// closer under metric come first: larger distances for MetricInnerProduct,
+// smaller for other metrics. Padding entries with a -1 label are skipped and
+// each set's LabelOffset is applied to its labels. With MergeDedupe, a label
+// present in several sets is kept once with its best distance.
+//
+// Unlike Search, the results are not padded: fewer than k are returned if
+// the sets hold fewer valid entries.
+func MergeSearchResults(results []SearchResultSet, k int64, metric int, opts ...MergeOption) (distances []float32, labels []int64, err error) {
+	if err := ValidateK(k); err != nil {
+		return nil, nil, err
+	}
+	if err := ValidateMetric(metric); err != nil {
+		return nil, nil, err
+	}
+
+	var o mergeOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+
+	h := &mergeHeap{
+		metric:   metric,
+		distance: func(list, pos int) float32 { return results[list].Distances[pos] },
+	}
+	total := 0
+	for i, set := range results {
+		if len(set.Distances) != len(set.Labels) {
+			return nil, nil, fmt.Errorf("result set %d has %d distances but %d labels", i, len(set.Distances), len(set.Labels))
+		}
+		if len(set.Labels) > 0 {
+			h.cursors = append(h.cursors, mergeCursor{list: i})
+			total += len(set.Labels)
+		}
+	}
+	heap.Init(h)
+
+	n := int(k)
+	if total < n {
+		n = total
+	}
+	distances = make([]float32, 0, n)
+	labels = make([]int64, 0, n)
+
+	var seen map[int64]struct{}
+	if o.dedupe {
+		seen = make(map[int64]struct{}, n)
+	}
+
+	for h.Len() > 0 && len(labels) < n {
+		c := &h.cursors[0]
+		set := &results[c.list]
+		label, distance := set.Labels[c.pos], set.Distances[c.pos]
+
+		c.pos++
+		if c.pos < len(set.Labels) {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+
+		if label < 0 {
+			continue
+		}
+		label += set.LabelOffset
+		if seen != nil {
+			// Sets are merged best first, so the first occurrence is the best
+			if _, ok := seen[label]; ok {
+				continue
+			}
+			seen[label] = struct{}{}
+		}
+		distances = append(distances, distance)
+		labels = append(labels, label)
+	}
+
+	return distances, labels, nil
+}
+
+// mergeCursor is the read position in one of the merged lists.
+type mergeCursor struct {
+	list int
+	pos  int
+}
+
+// mergeHeap orders cursors by the distance they point at, best first.
+type mergeHeap struct {
+	cursors  []mergeCursor
+	distance func(list, pos int) float32
+	metric   int
+}
+
+func (h *mergeHeap) Len() int { return len(h.cursors) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a := h.distance(h.cursors[i].list, h.cursors[i].pos)
+	b := h.distance(h.cursors[j].list, h.cursors[j].pos)
+	return IsCloser(h.metric, a, b)
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *mergeHeap) Push(x any) { h.cursors = append(h.cursors, x.(mergeCursor)) }
+
+func (h *mergeHeap) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
@@ -0,0 +1,169 @@
+package faiss
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// bruteForceMerge combines lists by keeping the best distance of each label
+// and sorting everything, breaking ties by label.
+func bruteForceMerge(metric int, k int, lists ...[]Neighbor) []Neighbor {
+	best := make(map[int64]float32)
+	for _, list := range lists {
+		for _, n := range list {
+			if n.Label < 0 {
+				continue
+			}
+			if d, ok := best[n.Label]; !ok || IsCloser(metric, n.Distance, d) {
+				best[n.Label] = n.Distance
+			}
+		}
+	}
+
+	all := make([]Neighbor, 0, len(best))
+	for label, d := range best {
+		all = append(all, Neighbor{Label: label, Distance: d})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Distance != all[j].Distance {
+			return IsCloser(metric, all[i].Distance, all[j].Distance)
+		}
+		return all[i].Label < all[j].Label
+	})
+	if len(all) > k {
+		all = all[:k]
+	}
+	return all
+}
+
+// randomShard returns n neighbors with labels drawn from [0, labels) and
+// distinct distances, sorted best first under metric.
+func randomShard(rng *rand.Rand, metric int, n, labels int) []Neighbor {
+	list := make([]Neighbor, n)
+	for i := range list {
+		list[i] = Neighbor{Label: int64(rng.Intn(labels)), Distance: rng.Float32()}
+	}
+	sort.Slice(list, func(i, j int) bool { return IsCloser(metric, list[i].Distance, list[j].Distance) })
+	return list
+}
+
+func TestMergeResultsThreeShards(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, metric := range []int{MetricL2, MetricInnerProduct} {
+		// Labels drawn from a small range overlap between shards
+		shards := [][]Neighbor{
+			randomShard(rng, metric, 20, 40),
+			randomShard(rng, metric, 20, 40),
+			randomShard(rng, metric, 20, 40),
+		}
+		shards[1] = append(shards[1], Neighbor{Label: -1, Distance: 0})
+
+		const k = 15
+		got := MergeResults(metric, k, shards...)
+		want := bruteForceMerge(metric, k, shards...)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("metric %d: MergeResults = %v, want %v", metric, got, want)
+		}
+	}
+}
+
+func TestMergeResultsFewerThanK(t *testing.T) {
+	shards := [][]Neighbor{
+		{{Label: 1, Distance: 0.1}, {Label: 2, Distance: 0.5}},
+		{{Label: 2, Distance: 0.2}},
+		nil,
+	}
+	got := MergeResults(MetricL2, 10, shards...)
+	want := []Neighbor{{Label: 1, Distance: 0.1}, {Label: 2, Distance: 0.2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeResults = %v, want %v", got, want)
+	}
+	if got := MergeResults(MetricL2, 0, shards...); len(got) != 0 {
+		t.Errorf("MergeResults with k=0 = %v, want none", got)
+	}
+}
+
+// bruteForceMergeSets sorts the concatenation of sets, after applying their
+// label offsets and dropping padding, optionally keeping each label once.
+func bruteForceMergeSets(sets []SearchResultSet, k int64, metric int, dedupe bool) ([]float32, []int64) {
+	var all []Neighbor
+	for _, set := range sets {
+		for i, label := range set.Labels {
+			if label >= 0 {
+				all = append(all, Neighbor{Label: label + set.LabelOffset, Distance: set.Distances[i]})
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return IsCloser(metric, all[i].Distance, all[j].Distance) })
+
+	distances, labels := []float32{}, []int64{}
+	seen := make(map[int64]bool)
+	for _, n := range all {
+		if int64(len(labels)) == k {
+			break
+		}
+		if dedupe && seen[n.Label] {
+			continue
+		}
+		seen[n.Label] = true
+		distances = append(distances, n.Distance)
+		labels = append(labels, n.Label)
+	}
+	return distances, labels
+}
+
+func TestMergeSearchResultsMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 200; trial++ {
+		metric := MetricL2
+		if trial%2 == 1 {
+			metric = MetricInnerProduct
+		}
+
+		// Distinct distances across all sets, so that the order is unique
+		nsets := 1 + rng.Intn(5)
+		perm := rng.Perm(nsets * 20)
+		sets := make([]SearchResultSet, nsets)
+		for s := range sets {
+			size := rng.Intn(21)
+			set := SearchResultSet{LabelOffset: int64(rng.Intn(3)) * 10}
+			for i := 0; i < size; i++ {
+				set.Distances = append(set.Distances, float32(perm[s*20+i]))
+				set.Labels = append(set.Labels, int64(rng.Intn(30)))
+			}
+			sort.Slice(set.Distances, func(i, j int) bool { return IsCloser(metric, set.Distances[i], set.Distances[j]) })
+			// Pad some sets like a search finding fewer than k neighbors
+			if rng.Intn(3) == 0 {
+				set.Distances = append(set.Distances, 0, 0)
+				set.Labels = append(set.Labels, -1, -1)
+			}
+			sets[s] = set
+		}
+
+		k := int64(1 + rng.Intn(40))
+		for _, dedupe := range []bool{false, true} {
+			var opts []MergeOption
+			if dedupe {
+				opts = append(opts, MergeDedupe())
+			}
+			gotD, gotL, err := MergeSearchResults(sets, k, metric, opts...)
+			if err != nil {
+				t.Fatalf("trial %d: MergeSearchResults: %v", trial, err)
+			}
+			wantD, wantL := bruteForceMergeSets(sets, k, metric, dedupe)
+			if !reflect.DeepEqual(gotD, wantD) || !reflect.DeepEqual(gotL, wantL) {
+				t.Fatalf("trial %d (metric %d, k %d, dedupe %v): got %v %v, want %v %v",
+					trial, metric, k, dedupe, gotD, gotL, wantD, wantL)
+			}
+		}
+	}
+}
+
+func TestMergeSearchResultsRejectsMismatchedSet(t *testing.T) {
+	sets := []SearchResultSet{{Distances: []float32{1, 2}, Labels: []int64{1}}}
+	if _, _, err := MergeSearchResults(sets, 5, MetricL2); err == nil {
+		t.Error("MergeSearchResults accepted a set with more distances than labels")
+	}
+}
@@ -0,0 +1,200 @@
+package faiss
+
+/*
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// MigrateOptions configures MigrateIndex.
+type MigrateOptions struct {
+	// ChunkSize is the number of vectors read from the source at a time.
+	// Zero means the default add batch size, see SetDefaultBatchSizes.
+	ChunkSize int
+	// Workers is the number of goroutines running the transform. Zero means
+	// runtime.GOMAXPROCS(0).
+	Workers int
+	// SkipFailures makes vectors whose transform fails be skipped and
+	// reported in MigrateResult.Failures. By default the first failure
+	// aborts the migration.
+	SkipFailures bool
+	// OnProgress, if not nil, is called after each chunk with the number of
+	// source vectors processed so far and the total.
+	OnProgress func(done, total int64)
+}
+
+// MigrateFailure is a vector that could not be migrated.
+type MigrateFailure struct {
+	ID  int64
+	Err error
+}
+
+// MigrateResult summarizes a migration.
+type MigrateResult struct {
+	Migrated int64            // Vectors added to the target
+	Failures []MigrateFailure // Skipped vectors, with SkipFailures only
+}
+
+// MigrateIndex builds a new index from the vectors of src, for example to
+// move to a new embedding model. Every vector is passed with its ID to
+// transform, which returns the vector to store in the target, created by
+// factory. The target may have a different dimension than src.
+//
+// IDs are preserved. They are taken from the positions of the vectors in
+// src, so src must hold the sequential IDs 0..Ntotal-1 assigned by Add; IDMap
+// sources, whose IDs are not positions, are rejected. Targets keeping IDs,
+// such as "IDMap,Flat" or IVF indexes, get every vector with AddWithIDs.
+// Other targets get them with Add, and fail if a skipped failure leaves a gap
+// in the IDs. The target must already be trained, or not require training.
+//
+// src is only read, so it can keep serving searches during the migration, but
+// vectors added to it meanwhile may be missed. The returned target can then be
+// swapped in, e.g. by writing it over the file of a ReloadableIndex. On error
+// the target is deleted.
+func MigrateIndex(
+	ctx context.Context,
+	src Index,
+	transform func(id int64, old []float32) ([]float32, error),
+	factory func() (Index, error),
+	opts MigrateOptions,
+) (Index, *MigrateResult, error) {
+	if src == nil || src.cPtr() == nil {
+		return nil, nil, ErrNullPointer
+	}
+	if transform == nil {
+		return nil, nil, errors.New("transform is nil")
+	}
+	if factory == nil {
+		return nil, nil, errors.New("index factory is nil")
+	}
+	if C.goss_Index_is_idmap(src.cPtr()) != 0 {
+		return nil, nil, errors.New("IDMap sources are not supported: their IDs are not positions")
+	}
+
+	chunkSize, err := addBatchSize(opts.ChunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	target, err := factory()
+	if err != nil {
+		return nil, nil, wrapError(err, "create migration target")
+	}
+
+	result, err := migrate(ctx, src, target, transform, chunkSize, workers, opts)
+	if err != nil {
+		target.Delete()
+		return nil, nil, err
+	}
+	return target, result, nil
+}
+
+func migrate(
+	ctx context.Context,
+	src, target Index,
+	transform func(id int64, old []float32) ([]float32, error),
+	chunkSize, workers int,
+	opts MigrateOptions,
+) (*MigrateResult, error) {
+	d := src.D()
+	newD := target.D()
+	ntotal := src.Ntotal()
+	keepsIDs := C.goss_Index_stable_ids(target.cPtr()) != 0
+	result := &MigrateResult{}
+
+	old := make([]float32, chunkSize*d)
+	transformed := make([][]float32, chunkSize)
+	errs := make([]error, chunkSize)
+
+	for start := int64(0); start < ntotal; start += int64(chunkSize) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n := int(ntotal - start)
+		if n > chunkSize {
+			n = chunkSize
+		}
+
+		if err := reconstructN(src, start, int64(n), old[:n*d]); err != nil {
+			return nil, wrapError(err, "migrate read source")
+		}
+
+		// Transform the chunk with a pool of workers
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers && w < n; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					vec, err := transform(start+int64(i), old[i*d:(i+1)*d])
+					if err == nil && len(vec) != newD {
+						err = &DimensionMismatchError{Got: len(vec), Want: newD}
+					}
+					transformed[i], errs[i] = vec, err
+				}
+			}()
+		}
+		for i := 0; i < n; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		vectors := make([]float32, 0, n*newD)
+		ids := make([]int64, 0, n)
+		for i := 0; i < n; i++ {
+			id := start + int64(i)
+			if errs[i] != nil {
+				if !opts.SkipFailures {
+					return nil, fmt.Errorf("migrate vector %d: %w", id, errs[i])
+				}
+				result.Failures = append(result.Failures, MigrateFailure{ID: id, Err: errs[i]})
+				continue
+			}
+			vectors = append(vectors, transformed[i]...)
+			ids = append(ids, id)
+		}
+
+		if len(ids) > 0 {
+			if err := addPreservingIDs(target, keepsIDs, vectors, ids); err != nil {
+				return nil, wrapError(err, "migrate add to target")
+			}
+			result.Migrated += int64(len(ids))
+		}
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(start+int64(n), ntotal)
+		}
+	}
+
+	return result, nil
+}
+
+// addPreservingIDs adds vectors so that they get the given IDs: with
+// AddWithIDs if target keeps IDs, and otherwise with Add, which requires the
+// IDs to be the next sequential ones of the target.
+func addPreservingIDs(target Index, keepsIDs bool, vectors []float32, ids []int64) error {
+	if keepsIDs {
+		return target.AddWithIDs(vectors, ids)
+	}
+
+	next := target.Ntotal()
+	for i, id := range ids {
+		if id != next+int64(i) {
+			return fmt.Errorf("target can't keep ID %d after a skipped failure; use a target keeping IDs, such as \"IDMap,Flat\"", id)
+		}
+	}
+	return target.Add(vectors)
+}
@@ -0,0 +1,107 @@
+package faiss
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// doubleVector migrates a vector to twice its dimension.
+func doubleVector(_ int64, old []float32) ([]float32, error) {
+	return append(append([]float32(nil), old...), old...), nil
+}
+
+func idMapFlatFactory(d int) func() (Index, error) {
+	return func() (Index, error) { return IndexFactory(d, "IDMap,Flat", MetricL2) }
+}
+
+func TestMigrateIndex(t *testing.T) {
+	const d, n = 4, 250
+	x := randomVectors(n, d, 1)
+	src := newFlatL2(t, d, x)
+
+	var progress []int64
+	target, result, err := MigrateIndex(context.Background(), src, doubleVector, idMapFlatFactory(2*d), MigrateOptions{
+		ChunkSize:  100,
+		Workers:    3,
+		OnProgress: func(done, total int64) { progress = append(progress, done) },
+	})
+	if err != nil {
+		t.Fatalf("MigrateIndex: %v", err)
+	}
+	defer target.Delete()
+
+	if result.Migrated != n || len(result.Failures) != 0 || target.Ntotal() != n {
+		t.Fatalf("migrated %d with %d failures into %d vectors, want %d", result.Migrated, len(result.Failures), target.Ntotal(), n)
+	}
+	if len(progress) != 3 || progress[2] != n {
+		t.Errorf("progress = %v, want 3 reports ending at %d", progress, n)
+	}
+
+	query, _ := doubleVector(0, x[42*d:43*d])
+	_, labels, err := target.Search(query, 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if labels[0] != 42 {
+		t.Errorf("nearest label = %d, want 42", labels[0])
+	}
+}
+
+func TestMigrateIndexFailures(t *testing.T) {
+	const d, n = 4, 50
+	x := randomVectors(n, d, 2)
+	src := newFlatL2(t, d, x)
+
+	errBad := errors.New("bad vector")
+	transform := func(id int64, old []float32) ([]float32, error) {
+		if id%10 == 3 {
+			return nil, errBad
+		}
+		return doubleVector(id, old)
+	}
+
+	if _, _, err := MigrateIndex(context.Background(), src, transform, idMapFlatFactory(2*d), MigrateOptions{}); !errors.Is(err, errBad) {
+		t.Errorf("MigrateIndex without SkipFailures = %v, want the transform error", err)
+	}
+
+	target, result, err := MigrateIndex(context.Background(), src, transform, idMapFlatFactory(2*d), MigrateOptions{SkipFailures: true, ChunkSize: 16})
+	if err != nil {
+		t.Fatalf("MigrateIndex with SkipFailures: %v", err)
+	}
+	defer target.Delete()
+	if result.Migrated != n-5 || len(result.Failures) != 5 || result.Failures[0].ID != 3 {
+		t.Fatalf("migrated %d with failures %v, want %d and 5 failures from ID 3", result.Migrated, result.Failures, n-5)
+	}
+
+	// IDs after the skipped vectors keep their source IDs
+	query, _ := doubleVector(0, x[47*d:48*d])
+	_, labels, err := target.Search(query, 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if labels[0] != 47 {
+		t.Errorf("nearest label = %d, want 47", labels[0])
+	}
+
+	flat := func() (Index, error) { return IndexFactory(2*d, "Flat", MetricL2) }
+	if _, _, err := MigrateIndex(context.Background(), src, transform, flat, MigrateOptions{SkipFailures: true}); err == nil {
+		t.Error("MigrateIndex into a flat index accepted a gap in the IDs")
+	}
+}
+
+func TestMigrateIndexRejectsIDMapSource(t *testing.T) {
+	const d = 4
+	src, err := IndexFactory(d, "IDMap,Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory: %v", err)
+	}
+	defer src.Delete()
+	if err := src.AddWithIDs(randomVectors(3, d, 3), []int64{100, 200, 300}); err != nil {
+		t.Fatalf("AddWithIDs: %v", err)
+	}
+
+	if _, _, err := MigrateIndex(context.Background(), src, doubleVector, idMapFlatFactory(2*d), MigrateOptions{}); err == nil {
+		t.Error("MigrateIndex accepted an IDMap source")
+	}
+}
@@ -0,0 +1,118 @@
+package faiss
+
+/*
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+func (idx *faissIndex) AddFromMmap(path string, offsetVectors, countVectors int64) (err error) {
+	if idx.idx == nil {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+	if offsetVectors < 0 {
+		return fmt.Errorf("negative vector offset %d", offsetVectors)
+	}
+	if !idx.IsTrained() {
+		return wrapError(ErrIndexNotTrained, "add from mmap operation")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return wrapError(err, "add from mmap")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return wrapError(err, "add from mmap")
+	}
+	size := info.Size()
+	if size == 0 {
+		return wrapError(ErrEmptyVectors, fmt.Sprintf("fvecs file %s", path))
+	}
+
+	// All records have the dimension of the first one, which must be the
+	// index's; the others are checked as they are added.
+	d := idx.D()
+	var header [4]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return wrapError(err, fmt.Sprintf("fvecs file %s", path))
+	}
+	if dim := int(int32(binary.LittleEndian.Uint32(header[:]))); dim != d {
+		return fmt.Errorf("fvecs file %s: %w", path, &DimensionMismatchError{Got: dim, Want: d})
+	}
+
+	record := int64(4 + 4*d)
+	if size%record != 0 {
+		return fmt.Errorf("fvecs file %s: size %d is not a multiple of the %d-byte record size", path, size, record)
+	}
+	total := size / record
+	if countVectors < 0 {
+		countVectors = total - offsetVectors
+	}
+	if countVectors == 0 || offsetVectors+countVectors > total {
+		return fmt.Errorf("fvecs file %s: vectors [%d, %d) out of its %d vectors", path, offsetVectors, offsetVectors+countVectors, total)
+	}
+
+	// Map only the requested records, from the page holding the first one.
+	start := offsetVectors * record
+	mapStart := start - start%int64(os.Getpagesize())
+	data, err := mapFile(f, mapStart, start+countVectors*record-mapStart)
+	if err != nil {
+		return wrapError(err, fmt.Sprintf("map fvecs file %s", path))
+	}
+	defer func() {
+		if uerr := unmapFile(data); uerr != nil && err == nil {
+			err = wrapError(uerr, fmt.Sprintf("unmap fvecs file %s", path))
+		}
+	}()
+	records := data[start-mapStart:]
+
+	batchSize, _ := addBatchSize(0)
+	for i := int64(0); i < countVectors; i += int64(batchSize) {
+		end := i + int64(batchSize)
+		if end > countVectors {
+			end = countVectors
+		}
+
+		batch := records[i*record : end*record]
+		for r := int64(0); r < end-i; r++ {
+			if dim := int(int32(binary.LittleEndian.Uint32(batch[r*record:]))); dim != d {
+				return fmt.Errorf("fvecs file %s: vector %d: %w", path, offsetVectors+i+r, &DimensionMismatchError{Got: dim, Want: d})
+			}
+		}
+
+		if err := idx.addStrided(batch[4:], end-i, d+1); err != nil {
+			return wrapError(err, fmt.Sprintf("add from mmap vectors %d-%d", offsetVectors+i, offsetVectors+end-1))
+		}
+	}
+	return nil
+}
+
+// addStrided adds the n vectors at x, placed stride floats apart, with a
+// single cgo call.
+func (idx *faissIndex) addStrided(x []byte, n int64, stride int) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.idx == nil {
+		return ErrIndexClosed
+	}
+	if err := idx.checkMutable(); err != nil {
+		return err
+	}
+
+	if c := C.goss_Index_add_strided(idx.idx, C.idx_t(n), (*C.float)(unsafe.Pointer(&x[0])), C.size_t(stride)); c != 0 {
+		return getLastExtError()
+	}
+	return nil
+}
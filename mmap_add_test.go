@@ -0,0 +1,135 @@
+//go:build unix
+// +build unix
+
+package faiss
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fvecsFile exports x to an fvecs file and returns its path.
+func fvecsFile(t testing.TB, x []float32, d int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "vectors.fvecs")
+	if err := ExportFvecs(newFlatL2(t, d, x), path); err != nil {
+		t.Fatalf("ExportFvecs: %v", err)
+	}
+	return path
+}
+
+func TestAddFromMmap(t *testing.T) {
+	// More vectors than one add batch
+	const d, n = 12, 25000
+	x := randomVectors(n, d, 1)
+	path := fvecsFile(t, x, d)
+
+	idx := newFlatL2(t, d, nil)
+	if err := idx.AddFromMmap(path, 0, -1); err != nil {
+		t.Fatalf("AddFromMmap: %v", err)
+	}
+	got, err := idx.AllVectors()
+	if err != nil {
+		t.Fatalf("AllVectors: %v", err)
+	}
+	if !reflect.DeepEqual(got, x) {
+		t.Error("AddFromMmap stored different vectors than the file holds")
+	}
+
+	// A range starting inside a page
+	part := newFlatL2(t, d, nil)
+	const offset, count = 1001, 3000
+	if err := part.AddFromMmap(path, offset, count); err != nil {
+		t.Fatalf("AddFromMmap range: %v", err)
+	}
+	got, err = part.AllVectors()
+	if err != nil {
+		t.Fatalf("AllVectors: %v", err)
+	}
+	if !reflect.DeepEqual(got, x[offset*d:(offset+count)*d]) {
+		t.Error("AddFromMmap of a range stored the wrong vectors")
+	}
+
+	for _, r := range [][2]int64{{-1, 10}, {n - 5, 10}, {n, -1}} {
+		if err := part.AddFromMmap(path, r[0], r[1]); err == nil {
+			t.Errorf("AddFromMmap(%d, %d) succeeded", r[0], r[1])
+		}
+	}
+	if part.Ntotal() != count {
+		t.Errorf("Ntotal = %d after rejected adds, want %d", part.Ntotal(), count)
+	}
+}
+
+func TestAddFromMmapDimensionMismatch(t *testing.T) {
+	const d, n = 8, 100
+	path := fvecsFile(t, randomVectors(n, d, 1), d)
+
+	var mismatch *DimensionMismatchError
+	other := newFlatL2(t, d+1, nil)
+	if err := other.AddFromMmap(path, 0, -1); !errors.As(err, &mismatch) {
+		t.Errorf("AddFromMmap into another dimension = %v, want a DimensionMismatchError", err)
+	}
+
+	// A record in the middle with a different dimension field
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	binary.LittleEndian.PutUint32(data[50*(4+4*d):], d-1)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	idx := newFlatL2(t, d, nil)
+	if err := idx.AddFromMmap(path, 0, -1); !errors.As(err, &mismatch) {
+		t.Errorf("AddFromMmap of a corrupt record = %v, want a DimensionMismatchError", err)
+	}
+	if err := idx.AddFromMmap(path, 60, 10); err != nil {
+		t.Errorf("AddFromMmap of records after the corrupt one: %v", err)
+	}
+}
+
+// BenchmarkAddFromFvecs loads an fvecs file by mapping it and by reading it
+// into memory first: B/op shows the copy of the whole file the mapping
+// avoids.
+func BenchmarkAddFromFvecs(b *testing.B) {
+	const d, n = 128, 100000
+	path := fvecsFile(b, randomVectors(n, d, 1), d)
+
+	run := func(b *testing.B, add func(idx *IndexFlat) error) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			idx, err := NewIndexFlatL2(d)
+			if err != nil {
+				b.Fatalf("NewIndexFlatL2: %v", err)
+			}
+			b.StartTimer()
+
+			if err := add(idx); err != nil {
+				b.Fatal(err)
+			}
+
+			b.StopTimer()
+			idx.Close()
+			b.StartTimer()
+		}
+	}
+
+	b.Run("Mmap", func(b *testing.B) {
+		run(b, func(idx *IndexFlat) error { return idx.AddFromMmap(path, 0, -1) })
+	})
+	b.Run("ReadFvecs", func(b *testing.B) {
+		run(b, func(idx *IndexFlat) error {
+			x, _, err := ReadFvecs(path)
+			if err != nil {
+				return err
+			}
+			return idx.Add(x)
+		})
+	})
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+// +build !unix
+
+package faiss
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func mapFile(*os.File, int64, int64) ([]byte, error) {
+	return nil, fmt.Errorf("memory mapping files is not supported on %s", runtime.GOOS)
+}
+
+func unmapFile([]byte) error {
+	return nil
+}
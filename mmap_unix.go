@@ -0,0 +1,20 @@
+//go:build unix
+// +build unix
+
+package faiss
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps length bytes of f from offset, which must be a multiple of
+// the page size, read-only. The mapping is not Go memory, so it can be passed
+// to C. It must be released with unmapFile.
+func mapFile(f *os.File, offset, length int64) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), offset, int(length), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,179 @@
+package faiss
+
+/*
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"fmt"
+	"sync"
+)
+
+// Namespace ID encoding: a namespace takes the top 24 bits of the 63
+// non-negative bits of an ID, and the local ID of a vector within its
+// namespace the remaining 39.
+const (
+	namespaceShift = 39
+
+	// MaxNamespace is the largest namespace of a NamespacedIndex.
+	MaxNamespace = 1<<24 - 1
+
+	// NamespaceIDLimit bounds the local IDs of a NamespacedIndex, which range
+	// over [0, NamespaceIDLimit). The last ID of each namespace's range is
+	// left out so that the range of MaxNamespace stays below MaxInt64.
+	NamespaceIDLimit = 1<<namespaceShift - 1
+)
+
+// NamespaceStats describes the vectors of a namespace.
+type NamespaceStats struct {
+	Namespace uint32
+	Vectors   int64 // Number of vectors added and not deleted
+}
+
+// NamespacedIndex shares one index between tenants, each in its own
+// namespace: vectors are added with IDs local to a namespace, which are
+// stored with the namespace in their top bits, and searches of a namespace
+// are filtered with an ID range selector, so they never return vectors of
+// another namespace whatever k is.
+//
+// The index must keep the IDs it is given, as IVF and IDMap indexes do, and
+// be empty when wrapped: the per-namespace counts only cover vectors added
+// through the NamespacedIndex. It is safe for concurrent use.
+type NamespacedIndex struct {
+	index Index
+
+	mu     sync.Mutex       // Keeps counts in step with adds and deletes
+	counts map[uint32]int64 // Vectors per namespace
+}
+
+// NewNamespacedIndex wraps idx, which must be empty and keep the IDs of
+// AddWithIDs.
+func NewNamespacedIndex(idx Index) (*NamespacedIndex, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return nil, ErrNullPointer
+	}
+	if C.goss_Index_stable_ids(idx.cPtr()) == 0 {
+		return nil, fmt.Errorf("namespaced index needs an index keeping IDs, such as IVF or IDMap")
+	}
+	if n := idx.Ntotal(); n != 0 {
+		return nil, fmt.Errorf("index holds %d vectors outside of any namespace", n)
+	}
+
+	return &NamespacedIndex{index: idx, counts: make(map[uint32]int64)}, nil
+}
+
+// namespaceRange returns the ID range [start, end) of namespace ns.
+func namespaceRange(ns uint32) (start, end int64, err error) {
+	if ns > MaxNamespace {
+		return 0, 0, fmt.Errorf("namespace %d exceeds the maximum %d", ns, MaxNamespace)
+	}
+	start = int64(ns) << namespaceShift
+	return start, start + NamespaceIDLimit, nil
+}
+
+// Index returns the wrapped index, e.g. to train it before the first add.
+func (n *NamespacedIndex) Index() Index {
+	return n.index
+}
+
+// D returns the dimension of the vectors.
+func (n *NamespacedIndex) D() int {
+	return n.index.D()
+}
+
+// AddToNamespace adds the vectors of x to namespace ns with the local IDs
+// ids, which must be in [0, NamespaceIDLimit). Nothing is added if an ID is
+// out of range. As in the wrapped index, adding an ID already present stores
+// another vector under it, and NamespaceStats counts both.
+func (n *NamespacedIndex) AddToNamespace(ns uint32, x []float32, ids []int64) error {
+	start, _, err := namespaceRange(ns)
+	if err != nil {
+		return err
+	}
+	d := n.index.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return wrapError(err, "add to namespace vectors validation")
+	}
+	if len(ids) != len(x)/d {
+		return fmt.Errorf("number of IDs (%d) doesn't match number of vectors (%d)", len(ids), len(x)/d)
+	}
+
+	encoded := make([]int64, len(ids))
+	for i, id := range ids {
+		if id < 0 || id >= NamespaceIDLimit {
+			return fmt.Errorf("ID %d at position %d is outside of the namespace ID range [0, %d)", id, i, int64(NamespaceIDLimit))
+		}
+		encoded[i] = start | id
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := n.index.AddWithIDs(x, encoded); err != nil {
+		return wrapError(err, fmt.Sprintf("add to namespace %d", ns))
+	}
+	n.counts[ns] += int64(len(ids))
+	return nil
+}
+
+// SearchNamespace searches the vectors of namespace ns only, returning their
+// local IDs. Missing results have label -1, as with Search.
+func (n *NamespacedIndex) SearchNamespace(ns uint32, x []float32, k int64) (distances []float32, labels []int64, err error) {
+	start, end, err := namespaceRange(ns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sel, err := NewIDSelectorRange(start, end)
+	if err != nil {
+		return nil, nil, wrapError(err, "namespace selector")
+	}
+	defer sel.Delete()
+
+	distances, labels, err = n.index.SearchWithOptions(x, k, SearchOptions{Selector: sel})
+	if err != nil {
+		return nil, nil, wrapError(err, fmt.Sprintf("search namespace %d", ns))
+	}
+	for i, label := range labels {
+		if label >= 0 {
+			labels[i] = label - start
+		}
+	}
+	return distances, labels, nil
+}
+
+// DeleteNamespace removes all the vectors of namespace ns with a single
+// range removal, and returns their number.
+func (n *NamespacedIndex) DeleteNamespace(ns uint32) (int, error) {
+	start, end, err := namespaceRange(ns)
+	if err != nil {
+		return 0, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	removed, err := n.index.RemoveIDRange(start, end)
+	if err != nil {
+		return 0, wrapError(err, fmt.Sprintf("delete namespace %d", ns))
+	}
+	delete(n.counts, ns)
+	return removed, nil
+}
+
+// NamespaceStats reports the vectors of namespace ns.
+func (n *NamespacedIndex) NamespaceStats(ns uint32) (NamespaceStats, error) {
+	if _, _, err := namespaceRange(ns); err != nil {
+		return NamespaceStats{}, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return NamespaceStats{Namespace: ns, Vectors: n.counts[ns]}, nil
+}
+
+// Delete frees the index.
+func (n *NamespacedIndex) Delete() {
+	n.index.Delete()
+}
@@ -0,0 +1,121 @@
+package faiss
+
+import (
+	"testing"
+)
+
+func newNamespaced(t *testing.T, d int) *NamespacedIndex {
+	t.Helper()
+
+	idx, err := IndexFactory(d, "IDMap,Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("IndexFactory: %v", err)
+	}
+	n, err := NewNamespacedIndex(idx)
+	if err != nil {
+		idx.Delete()
+		t.Fatalf("NewNamespacedIndex: %v", err)
+	}
+	t.Cleanup(n.Delete)
+	return n
+}
+
+func localIDs(count int) []int64 {
+	ids := make([]int64, count)
+	for i := range ids {
+		ids[i] = int64(i)
+	}
+	return ids
+}
+
+func TestNamespacedIndexRejectsOutOfRangeIDs(t *testing.T) {
+	const d = 4
+	n := newNamespaced(t, d)
+	x := randomVectors(2, d, 1)
+
+	for _, ids := range [][]int64{{0, NamespaceIDLimit}, {0, 1 << 39}, {-1, 0}} {
+		if err := n.AddToNamespace(1, x, ids); err == nil {
+			t.Errorf("AddToNamespace accepted local IDs %v", ids)
+		}
+	}
+	if err := n.AddToNamespace(MaxNamespace+1, x, localIDs(2)); err == nil {
+		t.Error("AddToNamespace accepted a namespace above MaxNamespace")
+	}
+	if got := n.Index().Ntotal(); got != 0 {
+		t.Errorf("Ntotal = %d after rejected adds, want 0", got)
+	}
+
+	// The last local ID of the last namespace still fits
+	if err := n.AddToNamespace(MaxNamespace, x[:d], []int64{NamespaceIDLimit - 1}); err != nil {
+		t.Fatalf("AddToNamespace(MaxNamespace): %v", err)
+	}
+	_, labels, err := n.SearchNamespace(MaxNamespace, x[:d], 1)
+	if err != nil {
+		t.Fatalf("SearchNamespace: %v", err)
+	}
+	if labels[0] != NamespaceIDLimit-1 {
+		t.Errorf("label = %d, want %d", labels[0], int64(NamespaceIDLimit-1))
+	}
+}
+
+func TestNamespacedIndexIsolation(t *testing.T) {
+	const d, count = 4, 10
+	n := newNamespaced(t, d)
+	x1 := randomVectors(count, d, 1)
+	x2 := randomVectors(count, d, 2)
+	if err := n.AddToNamespace(1, x1, localIDs(count)); err != nil {
+		t.Fatalf("AddToNamespace(1): %v", err)
+	}
+	if err := n.AddToNamespace(2, x2, localIDs(count)); err != nil {
+		t.Fatalf("AddToNamespace(2): %v", err)
+	}
+
+	// A query matching a vector of namespace 2 only finds namespace 1
+	// vectors in namespace 1, however large k is
+	distances, labels, err := n.SearchNamespace(1, x2[:d], 2*count)
+	if err != nil {
+		t.Fatalf("SearchNamespace: %v", err)
+	}
+	found := 0
+	for i, label := range labels {
+		if label == -1 {
+			continue
+		}
+		found++
+		if label < 0 || label >= count {
+			t.Fatalf("label %d is not a local ID of namespace 1", label)
+		}
+		if want := squaredDistance(x2[:d], x1[label*d:(label+1)*d]); !approxEqual(distances[i:i+1], []float32{float32(want)}, 1e-4) {
+			t.Errorf("distance of %d = %v, want %v from namespace 1", label, distances[i], want)
+		}
+	}
+	if found != count {
+		t.Errorf("SearchNamespace found %d vectors, want %d", found, count)
+	}
+
+	// Re-adding an ID stores another vector, counted too
+	if err := n.AddToNamespace(2, x2[:d], []int64{0}); err != nil {
+		t.Fatalf("AddToNamespace: %v", err)
+	}
+	if stats, _ := n.NamespaceStats(2); stats.Vectors != count+1 {
+		t.Errorf("namespace 2 holds %d vectors, want %d", stats.Vectors, count+1)
+	}
+
+	removed, err := n.DeleteNamespace(2)
+	if err != nil || removed != count+1 {
+		t.Fatalf("DeleteNamespace = %d, %v, want %d", removed, err, count+1)
+	}
+	if stats, _ := n.NamespaceStats(2); stats.Vectors != 0 {
+		t.Errorf("namespace 2 holds %d vectors after DeleteNamespace", stats.Vectors)
+	}
+	if stats, _ := n.NamespaceStats(1); stats.Vectors != count || n.Index().Ntotal() != count {
+		t.Errorf("namespace 1 holds %d vectors and Ntotal is %d, want %d", stats.Vectors, n.Index().Ntotal(), count)
+	}
+	_, labels, err = n.SearchNamespace(2, x2[:d], 1)
+	if err != nil {
+		t.Fatalf("SearchNamespace after DeleteNamespace: %v", err)
+	}
+	if labels[0] != -1 {
+		t.Errorf("deleted namespace returned label %d", labels[0])
+	}
+}
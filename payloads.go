@@ -0,0 +1,178 @@
+package faiss
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// PayloadResolver maps labels to application payloads, typically documents
+// kept in a key-value store next to the index. Resolve is called once per
+// search with all the labels found; labels without a payload are left out of
+// the returned map.
+type PayloadResolver interface {
+	Resolve(labels []int64) (map[int64][]byte, error)
+}
+
+// PayloadHit is a search result joined with its payload.
+type PayloadHit struct {
+	Label    int64
+	Distance float32
+	Payload  []byte // nil if the resolver has no payload for Label
+}
+
+// PayloadOption configures SearchWithPayloads.
+type PayloadOption func(*payloadOptions)
+
+type payloadOptions struct {
+	dropMissing bool
+}
+
+// DropMissingPayloads leaves hits without a payload out of the results,
+// instead of returning them with a nil Payload.
+func DropMissingPayloads() PayloadOption {
+	return func(o *payloadOptions) {
+		o.dropMissing = true
+	}
+}
+
+func (idx *faissIndex) SearchWithPayloads(x []float32, k int64, resolver PayloadResolver, opts ...PayloadOption) ([]PayloadHit, error) {
+	if resolver == nil {
+		return nil, errors.New("payload resolver is nil")
+	}
+
+	var o payloadOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+
+	neighbors, err := idx.SearchOne(x, k)
+	if err != nil {
+		return nil, err
+	}
+	if len(neighbors) == 0 {
+		return []PayloadHit{}, nil
+	}
+
+	labels := make([]int64, len(neighbors))
+	for i, n := range neighbors {
+		labels[i] = n.Label
+	}
+	payloads, err := resolver.Resolve(labels)
+	if err != nil {
+		return nil, wrapError(err, "resolve payloads")
+	}
+
+	hits := make([]PayloadHit, 0, len(neighbors))
+	for _, n := range neighbors {
+		payload, ok := payloads[n.Label]
+		if !ok && o.dropMissing {
+			continue
+		}
+		hits = append(hits, PayloadHit{Label: n.Label, Distance: n.Distance, Payload: payload})
+	}
+	return hits, nil
+}
+
+// MemoryPayloadResolver is a PayloadResolver keeping payloads in memory, for
+// tests and small deployments. It is safe for concurrent use.
+type MemoryPayloadResolver struct {
+	mu       sync.RWMutex
+	payloads map[int64][]byte
+}
+
+// NewMemoryPayloadResolver creates an empty in-memory resolver.
+func NewMemoryPayloadResolver() *MemoryPayloadResolver {
+	return &MemoryPayloadResolver{payloads: make(map[int64][]byte)}
+}
+
+// Set stores the payload of label, replacing any previous one.
+func (r *MemoryPayloadResolver) Set(label int64, payload []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.payloads[label] = payload
+}
+
+// Delete removes the payload of label.
+func (r *MemoryPayloadResolver) Delete(label int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.payloads, label)
+}
+
+func (r *MemoryPayloadResolver) Resolve(labels []int64) (map[int64][]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	resolved := make(map[int64][]byte, len(labels))
+	for _, label := range labels {
+		if payload, ok := r.payloads[label]; ok {
+			resolved[label] = payload
+		}
+	}
+	return resolved, nil
+}
+
+// BlobPayloadResolver is a PayloadResolver keeping each payload as an object
+// of a BlobStore, named after the decimal label.
+type BlobPayloadResolver struct {
+	store BlobStore
+}
+
+// NewBlobPayloadResolver creates a resolver over store.
+func NewBlobPayloadResolver(store BlobStore) (*BlobPayloadResolver, error) {
+	if store == nil {
+		return nil, errors.New("blob store is nil")
+	}
+	return &BlobPayloadResolver{store: store}, nil
+}
+
+// NewFilePayloadResolver creates a resolver keeping payloads as files in dir,
+// creating the directory if needed.
+func NewFilePayloadResolver(dir string) (*BlobPayloadResolver, error) {
+	store, err := NewFileBlobStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobPayloadResolver{store: store}, nil
+}
+
+// Set stores the payload of label, replacing any previous one.
+func (r *BlobPayloadResolver) Set(label int64, payload []byte) error {
+	return r.store.Put(strconv.FormatInt(label, 10), bytes.NewReader(payload))
+}
+
+func (r *BlobPayloadResolver) Resolve(labels []int64) (map[int64][]byte, error) {
+	resolved := make(map[int64][]byte, len(labels))
+	for _, label := range labels {
+		if _, ok := resolved[label]; ok {
+			continue
+		}
+
+		payload, err := r.get(label)
+		if errors.Is(err, ErrBlobNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		resolved[label] = payload
+	}
+	return resolved, nil
+}
+
+func (r *BlobPayloadResolver) get(label int64) ([]byte, error) {
+	rc, err := r.store.Get(strconv.FormatInt(label, 10))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
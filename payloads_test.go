@@ -0,0 +1,110 @@
+package faiss
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// countingResolver records the Resolve calls made to the resolver it wraps.
+type countingResolver struct {
+	PayloadResolver
+	calls [][]int64
+}
+
+func (r *countingResolver) Resolve(labels []int64) (map[int64][]byte, error) {
+	r.calls = append(r.calls, append([]int64(nil), labels...))
+	return r.PayloadResolver.Resolve(labels)
+}
+
+type failingResolver struct{}
+
+func (failingResolver) Resolve([]int64) (map[int64][]byte, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func TestPayloadResolvers(t *testing.T) {
+	memory := NewMemoryPayloadResolver()
+	file, err := NewFilePayloadResolver(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilePayloadResolver: %v", err)
+	}
+	for _, label := range []int64{1, 2, 5} {
+		payload := []byte(fmt.Sprintf("doc-%d", label))
+		memory.Set(label, payload)
+		if err := file.Set(label, payload); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	memory.Delete(5)
+
+	want := map[int64][]byte{1: []byte("doc-1"), 2: []byte("doc-2")}
+	if got, err := memory.Resolve([]int64{1, 2, 5, 7}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("memory Resolve = %q, %v, want %q", got, err, want)
+	}
+	want[5] = []byte("doc-5")
+	if got, err := file.Resolve([]int64{1, 2, 2, 5, 7}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("file Resolve = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestSearchWithPayloads(t *testing.T) {
+	const d, n, k = 8, 100, 5
+	x := randomVectors(n, d, 1)
+	idx := newFlatL2(t, d, x)
+	query := x[:d]
+
+	neighbors, err := idx.SearchOne(query, k)
+	if err != nil {
+		t.Fatalf("SearchOne: %v", err)
+	}
+
+	// Only the even labels among the hits have a payload
+	memory := NewMemoryPayloadResolver()
+	for _, nb := range neighbors {
+		if nb.Label%2 == 0 {
+			memory.Set(nb.Label, []byte(fmt.Sprint(nb.Label)))
+		}
+	}
+	resolver := &countingResolver{PayloadResolver: memory}
+
+	hits, err := idx.SearchWithPayloads(query, k, resolver)
+	if err != nil {
+		t.Fatalf("SearchWithPayloads: %v", err)
+	}
+	if len(resolver.calls) != 1 || len(resolver.calls[0]) != k {
+		t.Errorf("Resolve calls = %v, want one call with %d labels", resolver.calls, k)
+	}
+	if len(hits) != k {
+		t.Fatalf("got %d hits, want %d including those without payload", len(hits), k)
+	}
+	for i, hit := range hits {
+		if hit.Label != neighbors[i].Label || hit.Distance != neighbors[i].Distance {
+			t.Errorf("hit %d = %+v, want %+v", i, hit, neighbors[i])
+		}
+		if hit.Label%2 == 0 && string(hit.Payload) != fmt.Sprint(hit.Label) {
+			t.Errorf("hit %d: payload %q, want %q", i, hit.Payload, fmt.Sprint(hit.Label))
+		}
+		if hit.Label%2 != 0 && hit.Payload != nil {
+			t.Errorf("hit %d: payload %q for a label without one, want nil", i, hit.Payload)
+		}
+	}
+
+	dropped, err := idx.SearchWithPayloads(query, k, memory, DropMissingPayloads())
+	if err != nil {
+		t.Fatalf("SearchWithPayloads with DropMissingPayloads: %v", err)
+	}
+	for _, hit := range dropped {
+		if hit.Payload == nil {
+			t.Errorf("DropMissingPayloads kept hit %+v", hit)
+		}
+	}
+
+	if _, err := idx.SearchWithPayloads(query, k, failingResolver{}); err == nil {
+		t.Error("SearchWithPayloads ignored a resolver error")
+	}
+	if _, err := idx.SearchWithPayloads(query, k, nil); err == nil {
+		t.Error("SearchWithPayloads accepted a nil resolver")
+	}
+}
@@ -0,0 +1,274 @@
+package faiss
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// PersistentIndex is an Index saved to a BlobStore, so that it survives
+// restarts of processes without durable local disks.
+//
+// Each Save uploads the serialized index as a new object "<name>.<generation>"
+// and then replaces the small manifest object "<name>" pointing at it. A
+// crash during the upload leaves the manifest on the previous generation, so
+// the primary object is never corrupt. Loads verify the data against the
+// checksum recorded in the manifest.
+//
+// The LabelMap of a MappedIndex obtained with Mapped is saved with the index,
+// as a "<name>.<generation>.labels" object published by the same manifest.
+type PersistentIndex struct {
+	Index
+
+	store BlobStore
+	name  string
+
+	mu         sync.Mutex // Serializes Save
+	generation uint64
+	labels     *LabelMap // Saved with the index if not nil
+}
+
+// persistentManifest is the content of the manifest object.
+type persistentManifest struct {
+	Generation uint64 `json:"generation"` // Generation of the current data object
+	Object     string `json:"object"`     // Name of the data object
+	Size       int64  `json:"size"`       // Size of the data object in bytes
+	SHA256     string `json:"sha256"`     // Hex SHA-256 of the data object
+
+	Labels       string `json:"labels,omitempty"`        // Name of the label map object, if any
+	LabelsSize   int64  `json:"labels_size,omitempty"`   // Size of the label map object in bytes
+	LabelsSHA256 string `json:"labels_sha256,omitempty"` // Hex SHA-256 of the label map object
+}
+
+// NewPersistentIndexWithStore loads the index saved under name in store, or
+// creates a new one with factory if nothing was saved yet. The new index is
+// not saved until Save is called.
+func NewPersistentIndexWithStore(store BlobStore, name string, factory func() (Index, error)) (*PersistentIndex, error) {
+	if store == nil {
+		return nil, errors.New("blob store is nil")
+	}
+	if name == "" {
+		return nil, errors.New("index name is empty")
+	}
+	if factory == nil {
+		return nil, errors.New("index factory is nil")
+	}
+
+	p := &PersistentIndex{store: store, name: name}
+
+	exists, err := store.Exists(name)
+	if err != nil {
+		return nil, wrapError(err, "check persisted index")
+	}
+	if !exists {
+		idx, err := factory()
+		if err != nil {
+			return nil, wrapError(err, "create index")
+		}
+		p.Index = idx
+		return p, nil
+	}
+
+	manifest, err := p.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := p.load(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Labels != "" {
+		data, err := p.fetch(manifest.Labels, manifest.LabelsSize, manifest.LabelsSHA256)
+		if err != nil {
+			idx.Delete()
+			return nil, err
+		}
+		p.labels = NewLabelMap()
+		if err := p.labels.UnmarshalBinary(data); err != nil {
+			idx.Delete()
+			return nil, err
+		}
+	}
+	p.Index = idx
+	p.generation = manifest.Generation
+	return p, nil
+}
+
+func (p *PersistentIndex) readManifest() (persistentManifest, error) {
+	var manifest persistentManifest
+
+	r, err := p.store.Get(p.name)
+	if err != nil {
+		return manifest, wrapError(err, "read index manifest")
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return manifest, wrapError(err, "decode index manifest")
+	}
+	return manifest, nil
+}
+
+// load reads and verifies the data object of manifest.
+func (p *PersistentIndex) load(manifest persistentManifest) (Index, error) {
+	data, err := p.fetch(manifest.Object, manifest.Size, manifest.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	return DeserializeIndex(data)
+}
+
+// fetch reads object and verifies its size and checksum.
+func (p *PersistentIndex) fetch(object string, size int64, checksum string) ([]byte, error) {
+	r, err := p.store.Get(object)
+	if err != nil {
+		return nil, wrapError(err, "read persisted index")
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, wrapError(err, "read persisted index")
+	}
+
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != size || hex.EncodeToString(sum[:]) != checksum {
+		return nil, fmt.Errorf("persisted index %s is corrupt: size or checksum mismatch", object)
+	}
+	return data, nil
+}
+
+// Mapped returns a MappedIndex over the index, whose LabelMap is saved and
+// loaded with it. The index must be empty the first time. Further calls
+// return views sharing the same map.
+func (p *PersistentIndex) Mapped() (*MappedIndex, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Index == nil || p.cPtr() == nil {
+		return nil, ErrIndexClosed
+	}
+
+	m, err := NewMappedIndex(p.Index, p.labels)
+	if err != nil {
+		return nil, err
+	}
+	p.labels = m.Labels()
+	return m, nil
+}
+
+// Save uploads the index as a new generation and makes it the current one.
+// The previous generation is deleted if the store implements BlobDeleter.
+func (p *PersistentIndex) Save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Index == nil || p.cPtr() == nil {
+		return ErrIndexClosed
+	}
+
+	data, labels, err := p.snapshot()
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	manifest := persistentManifest{
+		Generation: p.generation + 1,
+		Object:     fmt.Sprintf("%s.%d", p.name, p.generation+1),
+		Size:       int64(len(data)),
+		SHA256:     hex.EncodeToString(sum[:]),
+	}
+
+	if err := p.store.Put(manifest.Object, bytes.NewReader(data)); err != nil {
+		return wrapError(err, "upload index")
+	}
+
+	if labels != nil {
+		sum := sha256.Sum256(labels)
+		manifest.Labels = manifest.Object + ".labels"
+		manifest.LabelsSize = int64(len(labels))
+		manifest.LabelsSHA256 = hex.EncodeToString(sum[:])
+		if err := p.store.Put(manifest.Labels, bytes.NewReader(labels)); err != nil {
+			return wrapError(err, "upload label map")
+		}
+	}
+
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return wrapError(err, "encode index manifest")
+	}
+	if err := p.store.Put(p.name, bytes.NewReader(encoded)); err != nil {
+		return wrapError(err, "publish index manifest")
+	}
+
+	previous := p.generation
+	p.generation = manifest.Generation
+
+	// The previous generation is no longer referenced.
+	if deleter, ok := p.store.(BlobDeleter); ok && previous > 0 {
+		_ = deleter.Delete(fmt.Sprintf("%s.%d", p.name, previous))
+		if labels != nil {
+			_ = deleter.Delete(fmt.Sprintf("%s.%d.labels", p.name, previous))
+		}
+	}
+	return nil
+}
+
+// snapshot serializes the index and, if there is one, the label map. The
+// map is locked meanwhile, so that both reflect the same vectors.
+func (p *PersistentIndex) snapshot() (data, labels []byte, err error) {
+	if p.labels == nil {
+		data, err = SerializeIndex(p.Index)
+		return data, nil, err
+	}
+
+	p.labels.mu.RLock()
+	defer p.labels.mu.RUnlock()
+
+	if n := p.Index.Ntotal(); n != int64(len(p.labels.appIDs)) {
+		return nil, nil, fmt.Errorf("label map out of sync: %d IDs for %d vectors", len(p.labels.appIDs), n)
+	}
+	if data, err = SerializeIndex(p.Index); err != nil {
+		return nil, nil, err
+	}
+	if labels, err = p.labels.marshal(); err != nil {
+		return nil, nil, err
+	}
+	return data, labels, nil
+}
+
+// Compact compacts the index, then saves the compacted index as a new
+// generation, so that a reload does not bring back the storage it released.
+func (p *PersistentIndex) Compact() error {
+	if p.Index == nil {
+		return ErrIndexClosed
+	}
+	if err := p.Index.Compact(); err != nil {
+		return err
+	}
+	return p.Save()
+}
+
+// Generation returns the generation last saved or loaded, 0 if none.
+func (p *PersistentIndex) Generation() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.generation
+}
+
+// Close frees the index without saving it. It is safe to call more than once.
+func (p *PersistentIndex) Close() error {
+	if p.Index != nil {
+		p.Index.Delete()
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package faiss
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPersistentIndexCompactSaves(t *testing.T) {
+	const d, n = 8, 500
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBlobStore: %v", err)
+	}
+	factory := func() (Index, error) { return NewIndexFlatL2(d) }
+
+	p, err := NewPersistentIndexWithStore(store, "vectors", factory)
+	if err != nil {
+		t.Fatalf("NewPersistentIndexWithStore: %v", err)
+	}
+	defer p.Close()
+	if err := p.Add(randomVectors(n, d, 1)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := p.RemoveIDRange(0, n/2); err != nil {
+		t.Fatalf("RemoveIDRange: %v", err)
+	}
+
+	if err := p.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if got := p.Generation(); got != 2 {
+		t.Errorf("Generation after Compact = %d, want 2", got)
+	}
+
+	// A reload sees the compacted index, not the one saved before
+	reloaded, err := NewPersistentIndexWithStore(store, "vectors", factory)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	defer reloaded.Close()
+	if got := reloaded.Ntotal(); got != n/2 {
+		t.Errorf("reloaded Ntotal = %d, want %d", got, n/2)
+	}
+}
+
+// failingStore fails uploads of objects whose name has the given suffix.
+type failingStore struct {
+	BlobStore
+	suffix string
+}
+
+func (s *failingStore) Put(name string, r io.Reader) error {
+	if strings.HasSuffix(name, s.suffix) {
+		return errors.New("upload interrupted")
+	}
+	return s.BlobStore.Put(name, r)
+}
+
+func TestPersistentIndexFailedSaveKeepsPrevious(t *testing.T) {
+	const d = 8
+	for name, store := range blobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			factory := func() (Index, error) { return NewIndexFlatL2(d) }
+			p, err := NewPersistentIndexWithStore(store, "vectors", factory)
+			if err != nil {
+				t.Fatalf("NewPersistentIndexWithStore: %v", err)
+			}
+			defer p.Close()
+			if err := p.Add(randomVectors(100, d, 1)); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if err := p.Save(); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			// Save generation 2 through a store losing its data upload
+			if err := p.Add(randomVectors(100, d, 2)); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			p.store = &failingStore{BlobStore: store, suffix: ".2"}
+			if err := p.Save(); err == nil {
+				t.Fatal("Save with a failing upload succeeded")
+			}
+
+			reloaded, err := NewPersistentIndexWithStore(store, "vectors", factory)
+			if err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+			defer reloaded.Close()
+			if got := reloaded.Generation(); got != 1 {
+				t.Errorf("reloaded Generation = %d, want 1", got)
+			}
+			if got := reloaded.Ntotal(); got != 100 {
+				t.Errorf("reloaded Ntotal = %d, want 100", got)
+			}
+		})
+	}
+}
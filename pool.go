@@ -0,0 +1,117 @@
+package faiss
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPoolClosed is returned when getting a handle from a closed IndexPool.
+var ErrPoolClosed = errors.New("index pool is closed")
+
+// IndexPool holds several handles to the same index so that concurrent
+// searches don't contend on one handle. Each handle is used by one goroutine
+// at a time: Get checks a handle out and Put returns it.
+//
+// The handles are independent copies, so a pool is meant for read-only
+// serving; adds or removes through one handle are not seen by the others.
+type IndexPool struct {
+	handles chan Index
+	all     []Index
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewIndexPool creates a pool of n handles built by factory.
+func NewIndexPool(n int, factory func() (Index, error)) (*IndexPool, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("pool size must be positive, got %d", n)
+	}
+	if factory == nil {
+		return nil, errors.New("index factory is nil")
+	}
+
+	p := &IndexPool{
+		handles: make(chan Index, n),
+		all:     make([]Index, 0, n),
+		done:    make(chan struct{}),
+	}
+	for i := 0; i < n; i++ {
+		idx, err := factory()
+		if err != nil {
+			p.Close()
+			return nil, wrapError(err, fmt.Sprintf("create pool handle %d", i))
+		}
+		p.all = append(p.all, idx)
+		p.handles <- idx
+	}
+
+	return p, nil
+}
+
+// NewIndexPoolFromFile creates a pool of n handles reading the index file
+// fname with IOFlagMmap. FAISS only maps the parts of some index types, such
+// as the inverted lists of IVF indexes, which the handles then share through
+// the page cache. Everything else, including whole flat and HNSW indexes, is
+// read into the private memory of each handle, so n handles hold n copies.
+func NewIndexPoolFromFile(fname string, n int) (*IndexPool, error) {
+	return NewIndexPool(n, func() (Index, error) {
+		return ReadIndex(fname, IOFlagMmap|IOFlagReadOnly)
+	})
+}
+
+// Get checks out a handle, blocking until one is available. It returns
+// ErrPoolClosed once Close has been called.
+func (p *IndexPool) Get() (Index, error) {
+	select {
+	case <-p.done:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	select {
+	case idx := <-p.handles:
+		return idx, nil
+	case <-p.done:
+		return nil, ErrPoolClosed
+	}
+}
+
+// Put returns a handle obtained from Get to the pool.
+func (p *IndexPool) Put(idx Index) {
+	select {
+	case p.handles <- idx:
+	default:
+		// More handles returned than the pool holds: idx didn't come from Get
+	}
+}
+
+// Do runs fn with a handle checked out of the pool and returns it afterwards.
+func (p *IndexPool) Do(fn func(Index) error) error {
+	idx, err := p.Get()
+	if err != nil {
+		return err
+	}
+	defer p.Put(idx)
+
+	return fn(idx)
+}
+
+// Size returns the number of handles in the pool.
+func (p *IndexPool) Size() int {
+	return len(p.all)
+}
+
+// Close wakes up goroutines blocked in Get, waits for the handles still
+// checked out to be returned with Put, and deletes all handles. It is safe
+// to call more than once.
+func (p *IndexPool) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		for range p.all {
+			(<-p.handles).Delete()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,104 @@
+package faiss
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPool(t testing.TB, n, d int, x []float32) *IndexPool {
+	t.Helper()
+
+	fname := filepath.Join(t.TempDir(), "pool.index")
+	idx := newFlatL2(t, d, x)
+	if err := WriteIndex(idx, fname); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	pool, err := NewIndexPoolFromFile(fname, n)
+	if err != nil {
+		t.Fatalf("NewIndexPoolFromFile: %v", err)
+	}
+	return pool
+}
+
+func TestIndexPoolCloseWaitsForHandles(t *testing.T) {
+	const d = 8
+	pool := newTestPool(t, 2, d, randomVectors(100, d, 1))
+
+	idx, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+
+	// Close must not delete the handle in use
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a handle was checked out")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, _, err := idx.Search(randomVectors(1, d, 2), 1); err != nil {
+		t.Errorf("Search on a checked out handle during Close: %v", err)
+	}
+	if _, err := pool.Get(); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Get during Close = %v, want ErrPoolClosed", err)
+	}
+
+	pool.Put(idx)
+	<-closed
+	if _, _, err := idx.Search(randomVectors(1, d, 2), 1); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Search after Close = %v, want ErrIndexClosed", err)
+	}
+}
+
+func benchmarkParallelSearch(b *testing.B, search func(q []float32) error) {
+	const d = 64
+	queries := randomVectors(100, d, 2)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if err := search(queries[(i%100)*d : (i%100+1)*d]); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkIndexPool(b *testing.B) {
+	const d, n, handles = 64, 20000, 8
+	pool := newTestPool(b, handles, d, randomVectors(n, d, 1))
+	defer pool.Close()
+
+	benchmarkParallelSearch(b, func(q []float32) error {
+		return pool.Do(func(idx Index) error {
+			_, _, err := idx.Search(q, 10)
+			return err
+		})
+	})
+}
+
+// BenchmarkSharedIndexMutex is the baseline for BenchmarkIndexPool: one
+// index shared by all goroutines under a mutex.
+func BenchmarkSharedIndexMutex(b *testing.B) {
+	const d, n = 64, 20000
+	idx := newFlatL2(b, d, randomVectors(n, d, 1))
+	var mu sync.Mutex
+
+	benchmarkParallelSearch(b, func(q []float32) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _, err := idx.Search(q, 10)
+		return err
+	})
+}
@@ -0,0 +1,88 @@
+package faiss
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrZeroQuery is returned when a composite query cancels out to the zero
+// vector, which has no meaningful nearest neighbors.
+var ErrZeroQuery = errors.New("query vector is zero")
+
+// BuildQuery builds a "more like these, less like those" query:
+//
+//	mean(positives) - negWeight*mean(negatives)
+//
+// All vectors must have the same dimension. negatives may be empty, giving
+// the centroid of the positives; a single positive is used as is. For
+// MetricInnerProduct the result is normalized to unit length, since cosine
+// similarity is only preserved for normalized queries. It returns
+// ErrZeroQuery if the result is the zero vector.
+func BuildQuery(positives [][]float32, negatives [][]float32, negWeight float32, metric int) ([]float32, error) {
+	if len(positives) == 0 {
+		return nil, wrapError(ErrEmptyVectors, "build query positives")
+	}
+	if err := ValidateMetric(metric); err != nil {
+		return nil, err
+	}
+
+	d := len(positives[0])
+	if d == 0 {
+		return nil, ErrInvalidDimension
+	}
+
+	pos, err := meanVector(positives, d)
+	if err != nil {
+		return nil, fmt.Errorf("positive %w", err)
+	}
+
+	if len(negatives) > 0 && negWeight != 0 {
+		neg, err := meanVector(negatives, d)
+		if err != nil {
+			return nil, fmt.Errorf("negative %w", err)
+		}
+		for i := range pos {
+			pos[i] -= float64(negWeight) * neg[i]
+		}
+	}
+
+	var norm float64
+	for _, v := range pos {
+		norm += v * v
+	}
+	if norm == 0 {
+		return nil, ErrZeroQuery
+	}
+
+	query := make([]float32, d)
+	scale := 1.0
+	if metric == MetricInnerProduct {
+		scale = 1 / math.Sqrt(norm)
+	}
+	for i, v := range pos {
+		query[i] = float32(v * scale)
+	}
+
+	return query, nil
+}
+
+// meanVector averages vectors of dimension d in float64.
+func meanVector(vectors [][]float32, d int) ([]float64, error) {
+	mean := make([]float64, d)
+	for i, v := range vectors {
+		if len(v) != d {
+			return nil, fmt.Errorf("vector %d: %w", i, &DimensionMismatchError{Got: len(v), Want: d})
+		}
+		for j, x := range v {
+			mean[j] += float64(x)
+		}
+	}
+
+	if len(vectors) > 1 {
+		for j := range mean {
+			mean[j] /= float64(len(vectors))
+		}
+	}
+	return mean, nil
+}
@@ -0,0 +1,70 @@
+package faiss
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestBuildQuery(t *testing.T) {
+	positives := [][]float32{{2, 0, 4}, {0, 2, 4}}
+	negatives := [][]float32{{1, 0, 0}}
+
+	query, err := BuildQuery(positives, negatives, 0.5, MetricL2)
+	if err != nil {
+		t.Fatalf("BuildQuery: %v", err)
+	}
+	if want := []float32{0.5, 1, 4}; !approxEqual(query, want, 1e-6) {
+		t.Errorf("BuildQuery = %v, want %v", query, want)
+	}
+
+	// A single positive without negatives is used as is
+	if query, err := BuildQuery(positives[:1], nil, 1, MetricL2); err != nil || !approxEqual(query, positives[0], 0) {
+		t.Errorf("BuildQuery of one positive = %v, %v, want %v", query, err, positives[0])
+	}
+
+	// Inner product queries are normalized
+	query, err = BuildQuery(positives, negatives, 0.5, MetricInnerProduct)
+	if err != nil {
+		t.Fatalf("BuildQuery for inner product: %v", err)
+	}
+	norm := math.Sqrt(0.25 + 1 + 16)
+	if want := []float32{float32(0.5 / norm), float32(1 / norm), float32(4 / norm)}; !approxEqual(query, want, 1e-6) {
+		t.Errorf("BuildQuery for inner product = %v, want %v", query, want)
+	}
+}
+
+func TestBuildQueryErrors(t *testing.T) {
+	if _, err := BuildQuery([][]float32{{1, 2}}, [][]float32{{1, 2}}, 1, MetricL2); !errors.Is(err, ErrZeroQuery) {
+		t.Errorf("BuildQuery cancelling out = %v, want ErrZeroQuery", err)
+	}
+	if _, err := BuildQuery(nil, nil, 1, MetricL2); !errors.Is(err, ErrEmptyVectors) {
+		t.Errorf("BuildQuery without positives = %v, want ErrEmptyVectors", err)
+	}
+	var mismatch *DimensionMismatchError
+	if _, err := BuildQuery([][]float32{{1, 2}}, [][]float32{{1, 2, 3}}, 1, MetricL2); !errors.As(err, &mismatch) {
+		t.Errorf("BuildQuery with a 3-dimensional negative = %v, want a DimensionMismatchError", err)
+	}
+}
+
+func TestSearchComposite(t *testing.T) {
+	idx := newFlatL2(t, 2, []float32{
+		0, 0,
+		1, 0,
+		0, 1,
+		1, 1,
+	})
+
+	// Near (1, 1) but pushed away from (0, 1): (1, 0.5) - 0.5*(0, 1) = (1, 0)
+	neighbors, err := idx.SearchComposite([][]float32{{1, 1}, {1, 0}}, [][]float32{{0, 1}}, 0.5, 1)
+	if err != nil {
+		t.Fatalf("SearchComposite: %v", err)
+	}
+	if len(neighbors) != 1 || neighbors[0].Label != 1 {
+		t.Errorf("SearchComposite = %v, want label 1", neighbors)
+	}
+
+	if _, err := idx.SearchComposite([][]float32{{1, 1}}, [][]float32{{1, 1}}, 1, 1); !errors.Is(err, ErrZeroQuery) {
+		t.Errorf("SearchComposite cancelling out = %v, want ErrZeroQuery", err)
+	}
+}
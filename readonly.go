@@ -0,0 +1,60 @@
+package faiss
+
+// readOnlyIndex is returned by ReadOnly.
+type readOnlyIndex struct {
+	Index
+}
+
+// ReadOnly returns a view of idx whose mutating methods (Train, the Add
+// family including AddFloat64 and AddFloat16, Reset, the RemoveIDs family,
+// Compact and SetMetricArg) fail with ErrReadOnly, while searches and
+// reconstruction pass through. It guards against accidental mutation by
+// code handed the view; idx itself can still be modified through other
+// references. Delete frees idx.
+//
+// Unlike Frozen, it doesn't make searches safe to run concurrently with
+// mutations made through idx.
+func ReadOnly(idx Index) Index {
+	if ro, ok := idx.(*readOnlyIndex); ok {
+		return ro
+	}
+	return &readOnlyIndex{Index: idx}
+}
+
+func (*readOnlyIndex) SetMetricArg(float32) error { return ErrReadOnly }
+
+func (*readOnlyIndex) Train([]float32) error { return ErrReadOnly }
+
+func (*readOnlyIndex) Add([]float32) error { return ErrReadOnly }
+
+func (*readOnlyIndex) AddReturningIDs([]float32) ([]int64, error) { return nil, ErrReadOnly }
+
+func (*readOnlyIndex) AddVectors2D([][]float32) error { return ErrReadOnly }
+
+func (*readOnlyIndex) AddFloat64([]float64) error { return ErrReadOnly }
+
+func (*readOnlyIndex) AddFloat16([]uint16) error { return ErrReadOnly }
+
+func (*readOnlyIndex) AddFromMmap(string, int64, int64) error { return ErrReadOnly }
+
+func (*readOnlyIndex) AddWithIDs([]float32, []int64) error { return ErrReadOnly }
+
+func (*readOnlyIndex) AddBatch([]float32, int, ...BatchOption) error { return ErrReadOnly }
+
+func (*readOnlyIndex) AddWithIDsBatch([]float32, []int64, int, ...BatchOption) error {
+	return ErrReadOnly
+}
+
+func (*readOnlyIndex) Reset() error { return ErrReadOnly }
+
+func (*readOnlyIndex) RemoveIDs(*IDSelector) (int, error) { return 0, ErrReadOnly }
+
+func (*readOnlyIndex) RemoveIDsSlice([]int64) (int, error) { return 0, ErrReadOnly }
+
+func (*readOnlyIndex) RemoveIDRange(int64, int64) (int, error) { return 0, ErrReadOnly }
+
+func (*readOnlyIndex) RemoveIDsBatch([]int64) ([]int64, []int64, error) {
+	return nil, nil, ErrReadOnly
+}
+
+func (*readOnlyIndex) Compact() error { return ErrReadOnly }
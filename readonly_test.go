@@ -0,0 +1,59 @@
+package faiss
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	const d, n = 8, 100
+	x := randomVectors(n, d, 1)
+	idx := newFlatL2(t, d, x)
+	ro := ReadOnly(idx)
+
+	if ReadOnly(ro) != ro {
+		t.Error("ReadOnly wrapped a read-only view again")
+	}
+
+	queries := randomVectors(5, d, 2)
+	wantD, wantL, err := idx.Search(queries, 3)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	gotD, gotL, err := ro.Search(queries, 3)
+	if err != nil {
+		t.Fatalf("read-only Search: %v", err)
+	}
+	if !reflect.DeepEqual(gotD, wantD) || !reflect.DeepEqual(gotL, wantL) {
+		t.Errorf("read-only Search = %v, want %v", gotL, wantL)
+	}
+	if got, err := ro.Reconstruct(7); err != nil || !reflect.DeepEqual(got, x[7*d:8*d]) {
+		t.Errorf("read-only Reconstruct(7) = %v, %v", got, err)
+	}
+
+	mutations := map[string]func() error{
+		"Train":      func() error { return ro.Train(x) },
+		"Add":        func() error { return ro.Add(x[:d]) },
+		"AddWithIDs": func() error { return ro.AddWithIDs(x[:d], []int64{1000}) },
+		"AddBatch":   func() error { return ro.AddBatch(x[:d], 0) },
+		"Reset":      ro.Reset,
+		"Compact":    ro.Compact,
+		"RemoveIDsSlice": func() error {
+			_, err := ro.RemoveIDsSlice([]int64{0})
+			return err
+		},
+		"RemoveIDRange": func() error {
+			_, err := ro.RemoveIDRange(0, 10)
+			return err
+		},
+	}
+	for name, mutate := range mutations {
+		if err := mutate(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s = %v, want ErrReadOnly", name, err)
+		}
+	}
+	if got := idx.Ntotal(); got != n {
+		t.Errorf("Ntotal = %d after rejected mutations, want %d", got, n)
+	}
+}
@@ -0,0 +1,224 @@
+package faiss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadableIndex serves searches from an index file and can swap in a new
+// version of the file without interrupting them. Searches never observe a
+// half-loaded index: the new index is fully read before the swap, and the old
+// one is freed only after the searches using it have returned.
+//
+// The file should be replaced atomically (written elsewhere, then renamed
+// over path), or a reload may read a partially written file and fail.
+type ReloadableIndex struct {
+	path    string
+	ioflags int
+
+	reloadMu sync.Mutex // Serializes Reload and Close
+
+	mu           sync.RWMutex // Held for reading by searches, for writing by swaps
+	current      Index
+	generation   uint64
+	loadedAt     time.Time
+	loadDuration time.Duration
+	modTime      time.Time
+}
+
+// ReloadStats describes the index currently served by a ReloadableIndex.
+type ReloadStats struct {
+	Generation   uint64        // 1 for the initial load, incremented by each reload
+	LoadedAt     time.Time     // When the current index finished loading
+	LoadDuration time.Duration // How long reading the current index took
+	Ntotal       int64         // Number of vectors in the current index
+}
+
+// NewReloadableIndex loads the index at path with ReadIndex and ioflags.
+func NewReloadableIndex(path string, ioflags int) (*ReloadableIndex, error) {
+	r := &ReloadableIndex{path: path, ioflags: ioflags}
+
+	idx, modTime, took, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	r.current = idx
+	r.generation = 1
+	r.loadedAt = time.Now()
+	r.loadDuration = took
+	r.modTime = modTime
+	return r, nil
+}
+
+// load reads the index file, returning its modification time and how long
+// reading took.
+func (r *ReloadableIndex) load() (Index, time.Time, time.Duration, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return nil, time.Time{}, 0, wrapError(err, "stat index file")
+	}
+
+	start := time.Now()
+	idx, err := ReadIndex(r.path, r.ioflags)
+	if err != nil {
+		return nil, time.Time{}, 0, err
+	}
+	return idx, info.ModTime(), time.Since(start), nil
+}
+
+// Reload reads the index file again and swaps it in. The new index must have
+// the same dimension and metric as the current one. On any error the current
+// index keeps serving.
+func (r *ReloadableIndex) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	r.mu.RLock()
+	current := r.current
+	r.mu.RUnlock()
+	if current == nil {
+		return ErrIndexClosed
+	}
+
+	idx, modTime, took, err := r.load()
+	if err != nil {
+		return wrapError(err, "reload")
+	}
+
+	if d := idx.D(); d != current.D() {
+		idx.Delete()
+		return fmt.Errorf("reload: %w", &DimensionMismatchError{Got: d, Want: current.D()})
+	}
+	if idx.MetricType() != current.MetricType() {
+		metric := idx.MetricType()
+		idx.Delete()
+		return fmt.Errorf("reload: index metric changed from %d to %d", current.MetricType(), metric)
+	}
+
+	// Taking the write lock waits for in-flight searches on the old index.
+	r.mu.Lock()
+	old := r.current
+	r.current = idx
+	r.generation++
+	r.loadedAt = time.Now()
+	r.loadDuration = took
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	old.Delete()
+	return nil
+}
+
+// WatchFile polls the index file every interval and reloads it when its
+// modification time changes, until ctx is done. onReload, if not nil, is
+// called after each reload attempt with its error, nil on success.
+func (r *ReloadableIndex) WatchFile(ctx context.Context, interval time.Duration, onReload func(error)) error {
+	if interval <= 0 {
+		return fmt.Errorf("watch interval must be positive, got %v", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(r.path)
+		if err != nil {
+			continue // The file may be in the middle of being replaced
+		}
+
+		r.mu.RLock()
+		changed := !info.ModTime().Equal(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		err = r.Reload()
+		if errors.Is(err, ErrIndexClosed) {
+			return err
+		}
+		if err != nil {
+			// Don't retry the same broken file on every tick.
+			r.mu.Lock()
+			r.modTime = info.ModTime()
+			r.mu.Unlock()
+		}
+		if onReload != nil {
+			onReload(err)
+		}
+	}
+}
+
+// Do runs fn with the current index. The index stays valid until fn returns,
+// even if a reload happens meanwhile; fn must not keep it afterwards.
+func (r *ReloadableIndex) Do(fn func(Index) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.current == nil {
+		return ErrIndexClosed
+	}
+	return fn(r.current)
+}
+
+// Search searches the current index. See Index.Search.
+func (r *ReloadableIndex) Search(x []float32, k int64) (distances []float32, labels []int64, err error) {
+	err = r.Do(func(idx Index) error {
+		distances, labels, err = idx.Search(x, k)
+		return err
+	})
+	return distances, labels, err
+}
+
+// SearchBatch searches the current index in batches. See Index.SearchBatch.
+// The whole batch is served by the same index.
+func (r *ReloadableIndex) SearchBatch(queries []float32, k int64, batchSize int, opts ...BatchOption) (distances [][]float32, labels [][]int64, err error) {
+	err = r.Do(func(idx Index) error {
+		distances, labels, err = idx.SearchBatch(queries, k, batchSize, opts...)
+		return err
+	})
+	return distances, labels, err
+}
+
+// Stats returns information about the index currently served.
+func (r *ReloadableIndex) Stats() ReloadStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := ReloadStats{
+		Generation:   r.generation,
+		LoadedAt:     r.loadedAt,
+		LoadDuration: r.loadDuration,
+	}
+	if r.current != nil {
+		stats.Ntotal = r.current.Ntotal()
+	}
+	return stats
+}
+
+// Close frees the current index after in-flight searches have returned.
+// Later calls fail with ErrIndexClosed. It is safe to call more than once.
+func (r *ReloadableIndex) Close() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil {
+		r.current.Delete()
+		r.current = nil
+	}
+	return nil
+}
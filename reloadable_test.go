@@ -0,0 +1,108 @@
+package faiss
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeIndexFile atomically replaces path with a flat index holding x.
+func writeIndexFile(t *testing.T, path string, d int, x []float32) {
+	t.Helper()
+
+	tmp := path + ".tmp"
+	if err := WriteIndex(newFlatL2(t, d, x), tmp); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+}
+
+func TestReloadableIndexReload(t *testing.T) {
+	const d = 4
+	path := filepath.Join(t.TempDir(), "flat.index")
+	writeIndexFile(t, path, d, randomVectors(10, d, 1))
+
+	r, err := NewReloadableIndex(path, 0)
+	if err != nil {
+		t.Fatalf("NewReloadableIndex: %v", err)
+	}
+	defer r.Close()
+	if stats := r.Stats(); stats.Generation != 1 || stats.Ntotal != 10 {
+		t.Fatalf("initial Stats = %+v, want generation 1 with 10 vectors", stats)
+	}
+
+	x := randomVectors(20, d, 2)
+	writeIndexFile(t, path, d, x)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if stats := r.Stats(); stats.Generation != 2 || stats.Ntotal != 20 {
+		t.Errorf("Stats after Reload = %+v, want generation 2 with 20 vectors", stats)
+	}
+	_, labels, err := r.Search(x[15*d:16*d], 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if labels[0] != 15 {
+		t.Errorf("nearest label = %d, want 15 from the reloaded index", labels[0])
+	}
+}
+
+func TestReloadableIndexRejectsDimensionChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flat.index")
+	writeIndexFile(t, path, 4, randomVectors(10, 4, 1))
+
+	r, err := NewReloadableIndex(path, 0)
+	if err != nil {
+		t.Fatalf("NewReloadableIndex: %v", err)
+	}
+	defer r.Close()
+
+	writeIndexFile(t, path, 8, randomVectors(10, 8, 2))
+	err = r.Reload()
+	var mismatch *DimensionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Reload of an 8-dimensional index = %v, want a DimensionMismatchError", err)
+	}
+	if mismatch.Got != 8 || mismatch.Want != 4 {
+		t.Errorf("got Got=%d Want=%d, want Got=8 Want=4", mismatch.Got, mismatch.Want)
+	}
+
+	// The old index keeps serving
+	if stats := r.Stats(); stats.Generation != 1 || stats.Ntotal != 10 {
+		t.Errorf("Stats after a rejected Reload = %+v, want generation 1 with 10 vectors", stats)
+	}
+	if _, _, err := r.Search(randomVectors(1, 4, 3), 1); err != nil {
+		t.Errorf("Search after a rejected Reload: %v", err)
+	}
+}
+
+func TestReloadableIndexClose(t *testing.T) {
+	const d = 4
+	path := filepath.Join(t.TempDir(), "flat.index")
+	writeIndexFile(t, path, d, randomVectors(10, d, 1))
+
+	r, err := NewReloadableIndex(path, 0)
+	if err != nil {
+		t.Fatalf("NewReloadableIndex: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	if _, _, err := r.Search(randomVectors(1, d, 2), 1); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Search after Close = %v, want ErrIndexClosed", err)
+	}
+	if err := r.Reload(); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Reload after Close = %v, want ErrIndexClosed", err)
+	}
+	if stats := r.Stats(); stats.Ntotal != 0 {
+		t.Errorf("Stats after Close = %+v, want no vectors", stats)
+	}
+}
@@ -0,0 +1,177 @@
+package faiss
+
+/*
+#include <faiss/c_api/Index_c.h>
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"sort"
+)
+
+// rerankFlatThreshold is the number of candidates above which RerankIDs ranks
+// them with a temporary flat index, whose SIMD distance kernels beat the Go
+// loop on large sets.
+const rerankFlatThreshold = 1024
+
+func (idx *faissIndex) RerankIDs(query []float32, candidateIDs []int64, k int64) (labels []int64, distances []float32, missing []int64, err error) {
+	if idx.idx == nil {
+		return nil, nil, nil, ErrIndexClosed
+	}
+
+	d := idx.D()
+	if len(query) != d {
+		return nil, nil, nil, &DimensionMismatchError{Got: len(query), Want: d}
+	}
+	if err := ValidateK(k); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := enableDirectMap(idx); err != nil {
+		return nil, nil, nil, wrapError(err, "rerank")
+	}
+
+	// Keep the first occurrence of duplicates and set invalid IDs aside.
+	seen := make(map[int64]struct{}, len(candidateIDs))
+	unique := make([]int64, 0, len(candidateIDs))
+	for _, id := range candidateIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		if id < 0 {
+			missing = append(missing, id)
+			continue
+		}
+		unique = append(unique, id)
+	}
+
+	ids, absent, err := idx.splitStored(unique)
+	if err != nil {
+		return nil, nil, nil, wrapError(err, "rerank")
+	}
+	missing = append(missing, absent...)
+
+	// Only stored vectors are reconstructed, so any failure is an error.
+	vectors := make([]float32, len(ids)*d)
+	if err := reconstructBatch(idx, ids, vectors); err != nil {
+		return nil, nil, nil, wrapError(err, "rerank")
+	}
+
+	if len(ids) == 0 {
+		return []int64{}, []float32{}, missing, nil
+	}
+	if k > int64(len(ids)) {
+		k = int64(len(ids))
+	}
+
+	metric := idx.MetricType()
+	if len(ids) <= rerankFlatThreshold {
+		labels, distances, err = rerankLoop(metric, query, ids, vectors, int(k))
+		if err == nil {
+			return labels, distances, missing, nil
+		}
+		// Metrics computeDistance doesn't implement fall back to FAISS.
+	}
+
+	labels, distances, err = idx.rerankFlat(query, ids, vectors, k)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return labels, distances, missing, nil
+}
+
+// splitStored splits ids, which are not negative, into those stored in idx
+// and the others, keeping their order. Index types goss_Index_contains
+// doesn't support assign sequential IDs, so the stored ones are those below
+// Ntotal.
+func (idx *faissIndex) splitStored(ids []int64) (stored, absent []int64, err error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	found := make([]uint8, len(ids))
+	if C.goss_Index_contains(
+		idx.idx,
+		C.idx_t(len(ids)),
+		(*C.idx_t)(&ids[0]),
+		(*C.uint8_t)(&found[0]),
+	) != 0 {
+		if C.goss_Index_stable_ids(idx.idx) != 0 {
+			return nil, nil, wrapError(getLastExtError(), "membership")
+		}
+		ntotal := idx.Ntotal()
+		for i, id := range ids {
+			if id < ntotal {
+				found[i] = 1
+			}
+		}
+	}
+
+	stored = make([]int64, 0, len(ids))
+	for i, id := range ids {
+		if found[i] != 0 {
+			stored = append(stored, id)
+		} else {
+			absent = append(absent, id)
+		}
+	}
+	return stored, absent, nil
+}
+
+// rerankLoop ranks the candidates by computing their distances in Go.
+func rerankLoop(metric int, query []float32, ids []int64, vectors []float32, k int) ([]int64, []float32, error) {
+	d := len(query)
+	neighbors := make([]Neighbor, len(ids))
+	for i, id := range ids {
+		dist, err := computeDistance(metric, query, vectors[i*d:(i+1)*d])
+		if err != nil {
+			return nil, nil, err
+		}
+		neighbors[i] = Neighbor{Label: id, Distance: dist}
+	}
+
+	sort.SliceStable(neighbors, func(i, j int) bool {
+		return IsCloser(metric, neighbors[i].Distance, neighbors[j].Distance)
+	})
+
+	labels := make([]int64, k)
+	distances := make([]float32, k)
+	for i := range labels {
+		labels[i] = neighbors[i].Label
+		distances[i] = neighbors[i].Distance
+	}
+	return labels, distances, nil
+}
+
+// rerankFlat ranks the candidates with a temporary flat index using the
+// metric of idx.
+func (idx *faissIndex) rerankFlat(query []float32, ids []int64, vectors []float32, k int64) ([]int64, []float32, error) {
+	metric := idx.MetricType()
+	flat, err := NewIndexFlat(idx.D(), metric)
+	if err != nil {
+		return nil, nil, wrapError(err, "rerank index creation")
+	}
+	defer flat.Delete()
+
+	if metric == MetricLp {
+		if err := flat.SetMetricArg(idx.MetricArg()); err != nil {
+			return nil, nil, wrapError(err, "rerank index creation")
+		}
+	}
+	if err := flat.Add(vectors); err != nil {
+		return nil, nil, wrapError(err, "rerank add")
+	}
+
+	distances, positions, err := flat.Search(query, k)
+	if err != nil {
+		return nil, nil, wrapError(err, "rerank search")
+	}
+
+	labels := make([]int64, len(positions))
+	for i, pos := range positions {
+		labels[i] = ids[pos]
+	}
+	return labels, distances, nil
+}
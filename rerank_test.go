@@ -0,0 +1,128 @@
+package faiss
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// filteredSearch searches the whole index and keeps the first k results
+// among candidates.
+func filteredSearch(t *testing.T, idx Index, query []float32, candidates []int64, k int) ([]int64, []float32) {
+	t.Helper()
+
+	distances, labels, err := idx.Search(query, idx.Ntotal())
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	allowed := make(map[int64]bool)
+	for _, id := range candidates {
+		allowed[id] = true
+	}
+
+	var gotL []int64
+	var gotD []float32
+	for i, label := range labels {
+		if allowed[label] && len(gotL) < k {
+			gotL = append(gotL, label)
+			gotD = append(gotD, distances[i])
+		}
+	}
+	return gotL, gotD
+}
+
+func TestRerankIDsMatchesFilteredSearch(t *testing.T) {
+	const d, n, k = 16, 5000, 20
+	rng := rand.New(rand.NewSource(1))
+	query := randomVectors(1, d, 2)
+
+	for _, metric := range []int{MetricL2, MetricInnerProduct} {
+		idx, err := NewIndexFlat(d, metric)
+		if err != nil {
+			t.Fatalf("NewIndexFlat: %v", err)
+		}
+		defer idx.Delete()
+		if err := idx.Add(randomVectors(n, d, 1)); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+
+		// Below and above rerankFlatThreshold, to cover the Go loop and
+		// the temporary flat index
+		for _, count := range []int{200, 2 * rerankFlatThreshold} {
+			candidates := make([]int64, count)
+			for i, p := range rng.Perm(n)[:count] {
+				candidates[i] = int64(p)
+			}
+
+			labels, distances, missing, err := idx.RerankIDs(query, candidates, k)
+			if err != nil {
+				t.Fatalf("RerankIDs: %v", err)
+			}
+			if len(missing) != 0 {
+				t.Errorf("RerankIDs reported %v missing", missing)
+			}
+			wantL, wantD := filteredSearch(t, idx, query, candidates, k)
+			if !reflect.DeepEqual(labels, wantL) || !approxEqual(distances, wantD, 1e-4) {
+				t.Errorf("metric %d, %d candidates: RerankIDs = %v, want %v", metric, count, labels, wantL)
+			}
+		}
+	}
+}
+
+func TestRerankIDsMissingAndSmallSets(t *testing.T) {
+	const d, n = 8, 100
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	query := randomVectors(1, d, 2)
+
+	candidates := []int64{5, 500, 7, 5, -3, 42}
+	labels, distances, missing, err := idx.RerankIDs(query, candidates, 10)
+	if err != nil {
+		t.Fatalf("RerankIDs: %v", err)
+	}
+
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	if want := []int64{-3, 500}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing = %v, want %v", missing, want)
+	}
+	// k above the candidates found returns all of them ranked, once each
+	wantL, wantD := filteredSearch(t, idx, query, candidates, 10)
+	if len(wantL) != 3 || !reflect.DeepEqual(labels, wantL) || !approxEqual(distances, wantD, 1e-4) {
+		t.Errorf("RerankIDs = %v %v, want %v %v", labels, distances, wantL, wantD)
+	}
+
+	labels, _, missing, err = idx.RerankIDs(query, []int64{1000}, 5)
+	if err != nil || len(labels) != 0 || !reflect.DeepEqual(missing, []int64{1000}) {
+		t.Errorf("RerankIDs with only missing candidates = %v, %v, %v", labels, missing, err)
+	}
+}
+
+func TestRerankIDsMembership(t *testing.T) {
+	const d, n = 8, 200
+	x := randomVectors(n, d, 1)
+	query := x[3*d : 4*d]
+
+	// HNSW has no membership test; its IDs are positions
+	hnsw, err := NewIndexHNSW(d, 16, MetricL2)
+	if err != nil {
+		t.Fatalf("NewIndexHNSW: %v", err)
+	}
+	defer hnsw.Delete()
+	if err := hnsw.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	labels, _, missing, err := hnsw.RerankIDs(query, []int64{n + 1, 3, 9}, 1)
+	if err != nil || !reflect.DeepEqual(missing, []int64{n + 1}) || labels[0] != 3 {
+		t.Errorf("RerankIDs on HNSW = %v, missing %v, %v, want label 3 and %d missing", labels, missing, err, n+1)
+	}
+
+	// A frozen IVF index without a direct map can't reconstruct stored
+	// vectors, which is an error rather than missing candidates
+	ivf := newIVFFlatL2(t, d, 4, x)
+	if _, err := ivf.Frozen(); err != nil {
+		t.Fatalf("Frozen: %v", err)
+	}
+	if _, _, missing, err := ivf.RerankIDs(query, []int64{3, 9}, 1); err == nil {
+		t.Errorf("RerankIDs without a direct map reported %v missing, want an error", missing)
+	}
+}
@@ -0,0 +1,159 @@
+package faiss
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// TrainingSampler selects a uniform random subset of a vector stream using
+// reservoir sampling, so that an index can be trained on a representative
+// sample without holding the whole dataset in memory.
+type TrainingSampler struct {
+	d          int
+	maxSamples int
+	seen       int64
+	reservoir  []float32
+	rng        *rand.Rand
+}
+
+// NewTrainingSampler creates a sampler for d-dimensional vectors that keeps
+// at most maxSamples vectors.
+func NewTrainingSampler(d int, maxSamples int) (*TrainingSampler, error) {
+	if d <= 0 {
+		return nil, ErrInvalidDimension
+	}
+	if maxSamples <= 0 {
+		return nil, fmt.Errorf("maxSamples must be positive, got %d", maxSamples)
+	}
+
+	return &TrainingSampler{
+		d:          d,
+		maxSamples: maxSamples,
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// SetSeed reseeds the sampler's random source for reproducible samples.
+func (s *TrainingSampler) SetSeed(seed int64) *TrainingSampler {
+	s.rng = rand.New(rand.NewSource(seed))
+	return s
+}
+
+// Offer passes a chunk of the stream to the sampler. The chunk length must be
+// a multiple of d; otherwise the chunk is rejected and the sample is unchanged.
+func (s *TrainingSampler) Offer(vectors []float32) error {
+	if err := ValidateVectors(vectors, s.d); err != nil {
+		return wrapError(err, "sampler vectors validation")
+	}
+
+	n := len(vectors) / s.d
+	for i := 0; i < n; i++ {
+		vec := vectors[i*s.d : (i+1)*s.d]
+
+		if len(s.reservoir) < s.maxSamples*s.d {
+			s.grow()
+			s.reservoir = append(s.reservoir, vec...)
+		} else if j := s.rng.Int63n(s.seen + 1); j < int64(s.maxSamples) {
+			copy(s.reservoir[int(j)*s.d:(int(j)+1)*s.d], vec)
+		}
+		s.seen++
+	}
+
+	return nil
+}
+
+// grow makes room for one more vector in the reservoir. Capacity doubles as
+// the stream fills the sample, but never exceeds maxSamples vectors, so a
+// large maxSamples costs nothing until that many vectors are offered.
+func (s *TrainingSampler) grow() {
+	if len(s.reservoir)+s.d <= cap(s.reservoir) {
+		return
+	}
+	n := 2 * cap(s.reservoir)
+	if n < 64*s.d {
+		n = 64 * s.d
+	}
+	if limit := s.maxSamples * s.d; n > limit {
+		n = limit
+	}
+	reservoir := make([]float32, len(s.reservoir), n)
+	copy(reservoir, s.reservoir)
+	s.reservoir = reservoir
+}
+
+// Add is equivalent to Offer.
+//
+// Deprecated: Use Offer.
+func (s *TrainingSampler) Add(vectors []float32) error {
+	return s.Offer(vectors)
+}
+
+// Sample returns a copy of the sampled vectors, ready to be passed to Train.
+func (s *TrainingSampler) Sample() []float32 {
+	result := make([]float32, len(s.reservoir))
+	copy(result, s.reservoir)
+	return result
+}
+
+// Count returns the number of vectors currently in the sample.
+func (s *TrainingSampler) Count() int {
+	return len(s.reservoir) / s.d
+}
+
+// Seen returns the number of vectors offered to the sampler so far.
+func (s *TrainingSampler) Seen() int64 {
+	return s.seen
+}
+
+// Reset discards the sample and the count of seen vectors.
+func (s *TrainingSampler) Reset() {
+	s.reservoir = s.reservoir[:0]
+	s.seen = 0
+}
+
+// TrainFromStream trains idx on a uniform sample of at most sampleSize
+// vectors drawn from source. source is called until it returns io.EOF,
+// possibly along with a final chunk; any other error aborts training. The
+// sample is reproducible when a seed was set with SetRandomSeed. It returns
+// the number of vectors seen in the stream.
+func TrainFromStream(idx Index, source func() ([]float32, error), sampleSize int) (int64, error) {
+	if idx == nil || idx.cPtr() == nil {
+		return 0, ErrNullPointer
+	}
+
+	sampler, err := NewTrainingSampler(idx.D(), sampleSize)
+	if err != nil {
+		return 0, err
+	}
+	if seed, ok := currentRandomSeed(); ok {
+		sampler.SetSeed(seed)
+	}
+
+	for {
+		chunk, err := source()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return sampler.Seen(), wrapError(err, "read training stream")
+		}
+		if len(chunk) > 0 {
+			if err := sampler.Offer(chunk); err != nil {
+				return sampler.Seen(), err
+			}
+		}
+		if err != nil {
+			break // io.EOF
+		}
+	}
+
+	if sampler.Count() == 0 {
+		return 0, wrapError(ErrEmptyVectors, "train from stream")
+	}
+
+	if err := idx.Train(sampler.Sample()); err != nil {
+		return sampler.Seen(), wrapError(err, "train from stream")
+	}
+
+	return sampler.Seen(), nil
+}
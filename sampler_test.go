@@ -0,0 +1,174 @@
+package faiss
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestTrainingSamplerReservoir(t *testing.T) {
+	const d, n, maxSamples, chunk = 2, 100000, 1000, 4096
+
+	sampler, err := NewTrainingSampler(d, maxSamples)
+	if err != nil {
+		t.Fatalf("NewTrainingSampler: %v", err)
+	}
+	sampler.SetSeed(1)
+
+	// Vector i is {i, i}, so the sample tells which vectors were kept
+	x := make([]float32, n*d)
+	for i := 0; i < n; i++ {
+		x[i*d], x[i*d+1] = float32(i), float32(i)
+	}
+	for start := 0; start < n; start += chunk {
+		end := start + chunk
+		if end > n {
+			end = n
+		}
+		if err := sampler.Offer(x[start*d : end*d]); err != nil {
+			t.Fatalf("Offer: %v", err)
+		}
+		if c := cap(sampler.reservoir); c > maxSamples*d {
+			t.Fatalf("reservoir capacity %d exceeds %d floats", c, maxSamples*d)
+		}
+	}
+
+	if got := sampler.Seen(); got != n {
+		t.Errorf("Seen = %d, want %d", got, n)
+	}
+	if got := sampler.Count(); got != maxSamples {
+		t.Fatalf("Count = %d, want %d", got, maxSamples)
+	}
+	sample := sampler.Sample()
+	if len(sample) != maxSamples*d {
+		t.Fatalf("len(Sample()) = %d, want %d", len(sample), maxSamples*d)
+	}
+
+	// Each tenth of the stream should hold about a tenth of the sample
+	const buckets = 10
+	var counts [buckets]int
+	seen := make(map[float32]bool, maxSamples)
+	for i := 0; i < maxSamples; i++ {
+		v := sample[i*d]
+		if sample[i*d+1] != v {
+			t.Fatalf("sampled vector %d is torn: %v", i, sample[i*d:(i+1)*d])
+		}
+		if seen[v] {
+			t.Fatalf("vector %v sampled twice", v)
+		}
+		seen[v] = true
+		counts[int(v)*buckets/n]++
+	}
+	for b, c := range counts {
+		if c < 70 || c > 130 {
+			t.Errorf("bucket %d holds %d samples, want about %d", b, c, maxSamples/buckets)
+		}
+	}
+}
+
+func TestTrainingSamplerGrowsLazily(t *testing.T) {
+	sampler, err := NewTrainingSampler(768, 4096*256)
+	if err != nil {
+		t.Fatalf("NewTrainingSampler: %v", err)
+	}
+	if c := cap(sampler.reservoir); c != 0 {
+		t.Errorf("new sampler reserved %d floats", c)
+	}
+
+	if err := sampler.Offer(randomVectors(10, 768, 1)); err != nil {
+		t.Fatalf("Offer: %v", err)
+	}
+	if got := sampler.Count(); got != 10 {
+		t.Errorf("Count = %d, want 10", got)
+	}
+	if c := cap(sampler.reservoir); c > 64*768 {
+		t.Errorf("reservoir holds %d floats for 10 vectors", c)
+	}
+}
+
+func TestTrainingSamplerSeedIsDeterministic(t *testing.T) {
+	const d = 4
+	x := randomVectors(5000, d, 1)
+
+	sample := func(seed int64) []float32 {
+		s, err := NewTrainingSampler(d, 100)
+		if err != nil {
+			t.Fatalf("NewTrainingSampler: %v", err)
+		}
+		s.SetSeed(seed)
+		for start := 0; start < len(x); start += 300 * d {
+			end := start + 300*d
+			if end > len(x) {
+				end = len(x)
+			}
+			if err := s.Offer(x[start:end]); err != nil {
+				t.Fatalf("Offer: %v", err)
+			}
+		}
+		return s.Sample()
+	}
+
+	if !reflect.DeepEqual(sample(7), sample(7)) {
+		t.Error("the same seed produced different samples")
+	}
+	if reflect.DeepEqual(sample(7), sample(8)) {
+		t.Error("different seeds produced the same sample")
+	}
+}
+
+func TestTrainingSamplerRejectsPartialVectors(t *testing.T) {
+	s, err := NewTrainingSampler(4, 10)
+	if err != nil {
+		t.Fatalf("NewTrainingSampler: %v", err)
+	}
+	if err := s.Offer(randomVectors(3, 4, 1)); err != nil {
+		t.Fatalf("Offer: %v", err)
+	}
+	before := s.Sample()
+
+	err = s.Offer(make([]float32, 10))
+	var mismatch *DimensionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("Offer of 10 floats = %v, want a DimensionMismatchError", err)
+	}
+	if s.Count() != 3 || s.Seen() != 3 || !reflect.DeepEqual(s.Sample(), before) {
+		t.Errorf("rejected chunk changed the sample: count %d, seen %d", s.Count(), s.Seen())
+	}
+}
+
+func TestTrainFromStream(t *testing.T) {
+	const d, nlist, n, chunk = 8, 4, 4000, 512
+	x := clusteredVectors(n, d, nlist, 1)
+
+	idx, err := NewIndexIVFFlatL2(d, nlist)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer idx.Delete()
+
+	next := 0
+	source := func() ([]float32, error) {
+		if next >= n {
+			return nil, io.EOF
+		}
+		end := next + chunk
+		if end > n {
+			end = n
+		}
+		c := x[next*d : end*d]
+		next = end
+		return c, nil
+	}
+
+	seen, err := TrainFromStream(idx, source, 1000)
+	if err != nil {
+		t.Fatalf("TrainFromStream: %v", err)
+	}
+	if seen != n {
+		t.Errorf("seen %d vectors, want %d", seen, n)
+	}
+	if !idx.IsTrained() {
+		t.Error("index not trained")
+	}
+}
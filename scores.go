@@ -0,0 +1,104 @@
+package faiss
+
+import (
+	"fmt"
+)
+
+// ScoreTransform converts raw search distances into scores.
+type ScoreTransform int
+
+const (
+	// ScoreIdentity returns the distances unchanged.
+	ScoreIdentity ScoreTransform = iota
+	// ScoreNegate returns -d, turning distances into similarities (larger is
+	// closer) and inner products into distances (smaller is closer).
+	ScoreNegate
+	// ScoreInverse returns 1/(1+d), a score in (0, 1] where 1 is an exact
+	// match. It requires a distance metric, not MetricInnerProduct.
+	ScoreInverse
+	// ScoreCosine returns the cosine similarity in [-1, 1]. It requires
+	// MetricInnerProduct over normalized vectors, where it equals the inner
+	// product. Use ScoreCosineFromL2 for an L2 index over normalized vectors.
+	ScoreCosine
+	// ScoreCosineFromL2 returns 1 - d/2, the cosine similarity of normalized
+	// vectors from their squared L2 distance. It requires MetricL2, and the
+	// result is only meaningful if the vectors are normalized.
+	ScoreCosineFromL2
+)
+
+func (t ScoreTransform) String() string {
+	switch t {
+	case ScoreIdentity:
+		return "identity"
+	case ScoreNegate:
+		return "negate"
+	case ScoreInverse:
+		return "inverse"
+	case ScoreCosine:
+		return "cosine"
+	case ScoreCosineFromL2:
+		return "cosine from L2"
+	default:
+		return fmt.Sprintf("ScoreTransform(%d)", int(t))
+	}
+}
+
+// TransformScores applies transform to distances returned by a search on an
+// index with the given metric. The input is not modified. It returns an error
+// if the transform doesn't make sense for the metric, e.g. ScoreCosine on an
+// L2 index, whose distances can't give cosines without the vector norms.
+func TransformScores(distances []float32, metric int, transform ScoreTransform) ([]float32, error) {
+	if err := ValidateMetric(metric); err != nil {
+		return nil, err
+	}
+
+	switch transform {
+	case ScoreIdentity, ScoreNegate:
+	case ScoreInverse:
+		if isSimilarity(metric) {
+			return nil, fmt.Errorf("score transform %s requires a distance metric, got %d", transform, metric)
+		}
+	case ScoreCosine:
+		if metric != MetricInnerProduct {
+			return nil, fmt.Errorf("score transform %s requires MetricInnerProduct, got %d", transform, metric)
+		}
+	case ScoreCosineFromL2:
+		if metric != MetricL2 {
+			return nil, fmt.Errorf("score transform %s requires MetricL2, got %d", transform, metric)
+		}
+	default:
+		return nil, fmt.Errorf("unknown score transform %d", int(transform))
+	}
+
+	scores := make([]float32, len(distances))
+	for i, d := range distances {
+		switch transform {
+		case ScoreIdentity, ScoreCosine:
+			scores[i] = d
+		case ScoreNegate:
+			scores[i] = -d
+		case ScoreInverse:
+			scores[i] = 1 / (1 + d)
+		case ScoreCosineFromL2:
+			scores[i] = L2ToCosine(d)
+		}
+	}
+
+	return scores, nil
+}
+
+// L2ToCosine converts a squared L2 distance, as reported by MetricL2, into a
+// cosine similarity. It assumes both vectors have unit length, for which
+// ||x-y||² = 2 - 2cos(x,y): 0 maps to 1 (same direction), 2 to 0
+// (orthogonal) and 4 to -1 (opposite). For vectors that are not normalized
+// the result is meaningless.
+func L2ToCosine(l2sq float32) float32 {
+	return 1 - l2sq/2
+}
+
+// CosineToL2 is the inverse of L2ToCosine: it converts a cosine similarity
+// into the squared L2 distance between unit vectors, e.g. to turn a cosine
+// threshold into a radius for SearchThreshold on an L2 index.
+func CosineToL2(cos float32) float32 {
+	return 2 - 2*cos
+}
@@ -0,0 +1,110 @@
+package faiss
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTransformScores(t *testing.T) {
+	tests := []struct {
+		metric    int
+		transform ScoreTransform
+		in, want  []float32
+	}{
+		{MetricL2, ScoreIdentity, []float32{0, 1, 3}, []float32{0, 1, 3}},
+		{MetricL2, ScoreNegate, []float32{0, 1, 3}, []float32{0, -1, -3}},
+		{MetricL2, ScoreInverse, []float32{0, 1, 3}, []float32{1, 0.5, 0.25}},
+		{MetricL2, ScoreCosineFromL2, []float32{0, 1, 2, 4}, []float32{1, 0.5, 0, -1}},
+		{MetricInnerProduct, ScoreIdentity, []float32{0.75, -0.5}, []float32{0.75, -0.5}},
+		{MetricInnerProduct, ScoreNegate, []float32{0.75, -0.5}, []float32{-0.75, 0.5}},
+		{MetricInnerProduct, ScoreCosine, []float32{1, 0.5, -1}, []float32{1, 0.5, -1}},
+		{MetricL1, ScoreInverse, []float32{1, 7}, []float32{0.5, 0.125}},
+	}
+	for _, tt := range tests {
+		in := append([]float32(nil), tt.in...)
+		got, err := TransformScores(in, tt.metric, tt.transform)
+		if err != nil {
+			t.Errorf("TransformScores(%v, %d, %s): %v", tt.in, tt.metric, tt.transform, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TransformScores(%v, %d, %s) = %v, want %v", tt.in, tt.metric, tt.transform, got, tt.want)
+		}
+		if !reflect.DeepEqual(in, tt.in) {
+			t.Errorf("TransformScores modified its input to %v", in)
+		}
+	}
+}
+
+func TestTransformScoresMetricMismatch(t *testing.T) {
+	tests := []struct {
+		metric    int
+		transform ScoreTransform
+	}{
+		{MetricL2, ScoreCosine},
+		{MetricInnerProduct, ScoreInverse},
+		{MetricInnerProduct, ScoreCosineFromL2},
+		{MetricL2, ScoreTransform(99)},
+		{42, ScoreIdentity},
+	}
+	for _, tt := range tests {
+		if _, err := TransformScores([]float32{1}, tt.metric, tt.transform); err == nil {
+			t.Errorf("TransformScores(metric %d, %s) succeeded, want an error", tt.metric, tt.transform)
+		}
+	}
+}
+
+func TestTransformScoresKeepsOrder(t *testing.T) {
+	// 2-d points at squared distances 0, 1, 4 and 25 from the origin
+	idx := newFlatL2(t, 2, []float32{3, 4, 0, 0, 1, 0, 0, 2})
+	distances, labels, err := idx.Search([]float32{0, 0}, 4)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if want := []int64{1, 2, 3, 0}; !reflect.DeepEqual(labels, want) {
+		t.Fatalf("labels = %v, want %v", labels, want)
+	}
+
+	scores, err := TransformScores(distances, MetricL2, ScoreInverse)
+	if err != nil {
+		t.Fatalf("TransformScores: %v", err)
+	}
+	if want := []float32{1, 0.5, 0.2, 1.0 / 26}; !approxEqual(scores, want, 1e-7) {
+		t.Errorf("scores = %v, want %v", scores, want)
+	}
+	for i := 1; i < len(scores); i++ {
+		if scores[i] > scores[i-1] {
+			t.Errorf("scores %v are not best first", scores)
+		}
+	}
+}
+
+func TestL2CosineConversions(t *testing.T) {
+	tests := []struct {
+		degrees float64
+		cos     float32
+		l2sq    float32
+	}{
+		{0, 1, 0},
+		{90, 0, 2},
+		{180, -1, 4},
+	}
+	for _, tt := range tests {
+		// Unit vectors at the given angle
+		rad := tt.degrees * math.Pi / 180
+		a := []float32{1, 0}
+		b := []float32{float32(math.Cos(rad)), float32(math.Sin(rad))}
+		l2sq := (a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1])
+
+		if got := L2ToCosine(l2sq); math.Abs(float64(got-tt.cos)) > 1e-6 {
+			t.Errorf("%v°: L2ToCosine(%v) = %v, want %v", tt.degrees, l2sq, got, tt.cos)
+		}
+		if got := CosineToL2(tt.cos); got != tt.l2sq {
+			t.Errorf("%v°: CosineToL2(%v) = %v, want %v", tt.degrees, tt.cos, got, tt.l2sq)
+		}
+		if got := L2ToCosine(CosineToL2(tt.cos)); got != tt.cos {
+			t.Errorf("%v°: round trip of cosine %v gave %v", tt.degrees, tt.cos, got)
+		}
+	}
+}
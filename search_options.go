@@ -0,0 +1,119 @@
+package faiss
+
+/*
+#include <faiss/c_api/Index_c.h>
+#include <faiss/c_api/IndexIVF_c.h>
+#include <faiss/c_api/impl/AuxIndexStructures_c.h>
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"errors"
+	"runtime"
+)
+
+// SearchOptions are search parameters applied to a single call, leaving the
+// index settings untouched. Zero values keep the index's current setting.
+type SearchOptions struct {
+	NProbe   int         // Number of inverted lists visited, IVF indexes only
+	EfSearch int         // Size of the candidate list, HNSW indexes only
+	Selector *IDSelector // Only return vectors whose ID the selector accepts
+}
+
+func (idx *faissIndex) SearchWithOptions(x []float32, k int64, opts SearchOptions) (distances []float32, labels []int64, err error) {
+	if idx.idx == nil {
+		return nil, nil, ErrIndexClosed
+	}
+
+	d := idx.D()
+	if err := ValidateVectors(x, d); err != nil {
+		return nil, nil, wrapError(err, "search vectors validation")
+	}
+	if err := ValidateK(k, idx.Ntotal()); err != nil {
+		return nil, nil, wrapError(err, "search k validation")
+	}
+	if opts.NProbe < 0 || opts.EfSearch < 0 {
+		return nil, nil, errors.New("search options must not be negative")
+	}
+
+	if !idx.IsTrained() {
+		return nil, nil, wrapError(ErrIndexNotTrained, "search operation")
+	}
+
+	ntotal := idx.Ntotal()
+	if ntotal == 0 {
+		return nil, nil, wrapError(ErrEmptyIndex, "search operation")
+	}
+	k = clampK(k, ntotal)
+
+	params, err := idx.newSearchParameters(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer C.faiss_SearchParameters_free(params)
+
+	n := len(x) / d
+	distances = make([]float32, int64(n)*k)
+	labels = make([]int64, int64(n)*k)
+
+	c := C.goss_Index_search_with_params(
+		idx.idx,
+		C.idx_t(n),
+		(*C.float)(&x[0]),
+		C.idx_t(k),
+		params,
+		(*C.float)(&distances[0]),
+		(*C.idx_t)(&labels[0]),
+	)
+	runtime.KeepAlive(opts.Selector)
+	if c != 0 {
+		return nil, nil, wrapError(getLastError(), "search with options")
+	}
+	return distances, labels, nil
+}
+
+// newSearchParameters creates the FAISS search parameters matching the index
+// type, filled with the current index settings where opts leaves them unset.
+func (idx *faissIndex) newSearchParameters(opts SearchOptions) (*C.FaissSearchParameters, error) {
+	var sel *C.FaissIDSelector
+	if opts.Selector != nil {
+		if opts.Selector.sel == nil {
+			return nil, wrapError(ErrNullPointer, "search selector")
+		}
+		sel = opts.Selector.sel
+	}
+
+	ivf := C.faiss_IndexIVF_cast(idx.idx)
+	hnsw := C.goss_IndexHNSW_check(idx.idx) == 0
+	if opts.NProbe > 0 && ivf == nil {
+		return nil, errors.New("NProbe only applies to IVF indexes")
+	}
+	if opts.EfSearch > 0 && !hnsw {
+		return nil, errors.New("EfSearch only applies to HNSW indexes")
+	}
+
+	var params *C.FaissSearchParameters
+	switch {
+	case ivf != nil:
+		nprobe := C.size_t(opts.NProbe)
+		if nprobe == 0 {
+			nprobe = C.faiss_IndexIVF_nprobe(ivf)
+		}
+		if c := C.faiss_SearchParametersIVF_new_with(&params, sel, nprobe, 0); c != 0 {
+			return nil, wrapError(getLastError(), "search parameters creation")
+		}
+	case hnsw:
+		efSearch := C.int(opts.EfSearch)
+		if efSearch == 0 {
+			efSearch = C.goss_IndexHNSW_efSearch(idx.idx)
+		}
+		if c := C.goss_SearchParametersHNSW_new(&params, sel, efSearch); c != 0 {
+			return nil, wrapError(getLastExtError(), "search parameters creation")
+		}
+	default:
+		if c := C.faiss_SearchParameters_new(&params, sel); c != 0 {
+			return nil, wrapError(getLastError(), "search parameters creation")
+		}
+	}
+	return params, nil
+}
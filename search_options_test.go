@@ -0,0 +1,89 @@
+package faiss
+
+import (
+	"sync"
+	"testing"
+)
+
+// recallOf returns the fraction of the exact top k labels found in labels,
+// both holding k labels per query.
+func recallOf(labels, exact []int64, k int) float64 {
+	found := 0
+	for q := 0; q < len(exact)/k; q++ {
+		want := make(map[int64]bool, k)
+		for _, l := range exact[q*k : (q+1)*k] {
+			want[l] = true
+		}
+		for _, l := range labels[q*k : (q+1)*k] {
+			if want[l] {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(len(exact))
+}
+
+func TestSearchWithOptionsConcurrentNProbe(t *testing.T) {
+	const d, nlist, n, nq, k = 16, 64, 5000, 100, 10
+	x := randomVectors(n, d, 1)
+	queries := randomVectors(nq, d, 2)
+	idx := newIVFFlatL2(t, d, nlist, x)
+	if err := idx.SetNProbe(8); err != nil {
+		t.Fatalf("SetNProbe: %v", err)
+	}
+
+	_, exact, err := newFlatL2(t, d, x).Search(queries, k)
+	if err != nil {
+		t.Fatalf("flat Search: %v", err)
+	}
+
+	// Each goroutine keeps its own nprobe however the calls interleave
+	var wg sync.WaitGroup
+	recalls := make([][]float64, 2)
+	for g, nprobe := range []int{1, nlist} {
+		wg.Add(1)
+		go func(g, nprobe int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				_, labels, err := idx.SearchWithOptions(queries, k, SearchOptions{NProbe: nprobe})
+				if err != nil {
+					t.Errorf("SearchWithOptions(nprobe %d): %v", nprobe, err)
+					return
+				}
+				recalls[g] = append(recalls[g], recallOf(labels, exact, k))
+			}
+		}(g, nprobe)
+	}
+	wg.Wait()
+
+	first := recalls[0][0]
+	for _, r := range recalls[0] {
+		if r != first {
+			t.Errorf("nprobe 1 recall varied between %v and %v", first, r)
+			break
+		}
+	}
+	if first > 0.9 {
+		t.Errorf("nprobe 1 recall = %v, want it well below an exhaustive search", first)
+	}
+	for _, r := range recalls[1] {
+		if r != 1 {
+			t.Errorf("nprobe %d recall = %v, want 1", nlist, r)
+			break
+		}
+	}
+
+	if nprobe, err := idx.GetNProbe(); err != nil || nprobe != 8 {
+		t.Errorf("GetNProbe after SearchWithOptions = %d, %v, want 8", nprobe, err)
+	}
+}
+
+func TestSearchWithOptionsRejectsInvalidOptions(t *testing.T) {
+	flat := newFlatL2(t, 4, randomVectors(10, 4, 1))
+	if _, _, err := flat.SearchWithOptions(randomVectors(1, 4, 2), 1, SearchOptions{NProbe: 2}); err == nil {
+		t.Error("SearchWithOptions accepted NProbe on a flat index")
+	}
+	if _, _, err := flat.SearchWithOptions(randomVectors(1, 4, 2), 1, SearchOptions{EfSearch: -1}); err == nil {
+		t.Error("SearchWithOptions accepted a negative EfSearch")
+	}
+}
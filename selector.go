@@ -8,12 +8,23 @@ import (
 	"fmt"
 	"runtime"
 	"sort"
+	"sync"
+	"unsafe"
 )
 
 // IDSelector represents a set of IDs to remove from an index.
 // It provides different strategies for selecting which vectors to remove.
 type IDSelector struct {
 	sel *C.FaissIDSelector
+	mu  sync.Mutex // Serializes Delete
+}
+
+// newIDSelector wraps sel, registering the finalizer and leak tracking.
+func newIDSelector(sel *C.FaissIDSelector) *IDSelector {
+	selector := &IDSelector{sel: sel}
+	runtime.SetFinalizer(selector, (*IDSelector).finalize)
+	trackObject(unsafe.Pointer(selector), "IDSelector")
+	return selector
 }
 
 // NewIDSelectorRange creates a selector that removes IDs in the range [imin, imax).
@@ -32,9 +43,7 @@ func NewIDSelectorRange(imin, imax int64) (*IDSelector, error) {
 		return nil, wrapError(getLastError(), "IDSelectorRange creation")
 	}
 
-	selector := &IDSelector{(*C.FaissIDSelector)(sel)}
-	runtime.SetFinalizer(selector, (*IDSelector).Delete)
-	return selector, nil
+	return newIDSelector((*C.FaissIDSelector)(sel)), nil
 }
 
 // NewIDSelectorBatch creates a selector that removes specific IDs from a batch.
@@ -60,9 +69,7 @@ func NewIDSelectorBatch(indices []int64) (*IDSelector, error) {
 		return nil, wrapError(getLastError(), "IDSelectorBatch creation")
 	}
 
-	selector := &IDSelector{(*C.FaissIDSelector)(sel)}
-	runtime.SetFinalizer(selector, (*IDSelector).Delete)
-	return selector, nil
+	return newIDSelector((*C.FaissIDSelector)(sel)), nil
 }
 
 // NewIDSelectorAnd creates a selector that removes IDs that match ALL of the provided selectors.
@@ -118,10 +125,23 @@ func NewIDSelectorNot(selector *IDSelector, ntotal int64) (*IDSelector, error) {
 }
 
 // Delete frees the memory associated with the selector.
+// It is idempotent and safe for concurrent use.
 func (s *IDSelector) Delete() {
+	s.free(false)
+}
+
+func (s *IDSelector) finalize() {
+	s.free(true)
+}
+
+func (s *IDSelector) free(finalized bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.sel != nil {
 		C.faiss_IDSelector_free(s.sel)
 		s.sel = nil
+		untrackObject(unsafe.Pointer(s), finalized)
 	}
 	runtime.SetFinalizer(s, nil)
 }
@@ -158,9 +178,7 @@ func RemoveDuplicateIDs(ids []int64) []int64 {
 	}
 
 	// Sort first
-	sort.Slice(ids, func(i, j int) bool {
-		return ids[i] < ids[j]
-	})
+	sortIDs(ids)
 
 	// Remove duplicates
 	result := make([]int64, 0, len(ids))
@@ -175,6 +193,13 @@ func RemoveDuplicateIDs(ids []int64) []int64 {
 	return result
 }
 
+// sortIDs sorts a slice of IDs in ascending order
+func sortIDs(ids []int64) {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+}
+
 // CreateBatchSelector creates a batch selector with duplicate removal and validation
 func CreateBatchSelector(ids []int64, maxID int64) (*IDSelector, error) {
 	if len(ids) == 0 {
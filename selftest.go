@@ -0,0 +1,57 @@
+package faiss
+
+import (
+	"fmt"
+	"math"
+)
+
+// Size of the index built by SelfTest.
+const (
+	selfTestD = 8
+	selfTestN = 16
+)
+
+// SelfTest checks that FAISS is linked and works, e.g. as a startup probe of
+// a service. It builds a small flat index, searches it for each of its
+// vectors, and verifies that every vector is its own nearest neighbor at
+// distance ~0. Failed checks return an error matching ErrSelfTestFailed;
+// errors of the FAISS calls are returned as they are.
+func SelfTest() error {
+	idx, err := NewIndexFlatL2(selfTestD)
+	if err != nil {
+		return wrapError(err, "self test")
+	}
+	defer idx.Delete()
+
+	// Vectors far apart from each other, so that each has a single exact
+	// match.
+	x := make([]float32, selfTestN*selfTestD)
+	for i := range x {
+		x[i] = float32(i)
+	}
+	if err := idx.Add(x); err != nil {
+		return wrapError(err, "self test")
+	}
+	if n := idx.Ntotal(); n != selfTestN {
+		return fmt.Errorf("%w: index holds %d vectors, added %d", ErrSelfTestFailed, n, selfTestN)
+	}
+
+	const k = 2
+	distances, labels, err := idx.Search(x, k)
+	if err != nil {
+		return wrapError(err, "self test")
+	}
+	for i := 0; i < selfTestN; i++ {
+		label, dist := labels[i*k], distances[i*k]
+		if label != int64(i) {
+			return fmt.Errorf("%w: nearest neighbor of vector %d is %d", ErrSelfTestFailed, i, label)
+		}
+		if math.IsNaN(float64(dist)) || dist > 1e-4 {
+			return fmt.Errorf("%w: vector %d is at distance %g from itself", ErrSelfTestFailed, i, dist)
+		}
+		if labels[i*k+1] == int64(i) || distances[i*k+1] <= dist {
+			return fmt.Errorf("%w: unexpected second neighbor %d of vector %d", ErrSelfTestFailed, labels[i*k+1], i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package faiss
+
+/*
+#include "faiss_ext.h"
+*/
+import "C"
+
+// SetNumThreads caps the number of OpenMP threads FAISS uses for searches,
+// adds and training run through this package; by default it uses all cores.
+// n <= 0 restores the default. It applies to the whole process, and to calls
+// already running only once they return.
+//
+// OpenMP keeps its thread count per OS thread, so unlike a direct call to
+// omp_set_num_threads the limit also holds for the other threads the Go
+// runtime makes cgo calls on.
+func SetNumThreads(n int) {
+	if n < 0 {
+		n = 0
+	}
+	C.goss_omp_set_num_threads(C.int(n))
+}
+
+// GetNumThreads returns the number of OpenMP threads FAISS uses, as set by
+// SetNumThreads or the OpenMP default.
+func GetNumThreads() int {
+	return int(C.goss_omp_max_threads())
+}
@@ -0,0 +1,60 @@
+package faiss
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetNumThreads(t *testing.T) {
+	const d, n, nq, k = 32, 20000, 200, 10
+	defaultThreads := GetNumThreads()
+	defer SetNumThreads(0)
+
+	idx := newFlatL2(t, d, randomVectors(n, d, 1))
+	queries := randomVectors(nq, d, 2)
+
+	start := time.Now()
+	wantD, wantL, err := idx.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	parallel := time.Since(start)
+
+	SetNumThreads(1)
+	if got := GetNumThreads(); got != 1 {
+		t.Fatalf("GetNumThreads = %d after SetNumThreads(1), want 1", got)
+	}
+
+	// The limit holds on whatever OS threads cgo calls run on
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			if got := GetNumThreads(); got != 1 {
+				t.Errorf("GetNumThreads = %d on another thread, want 1", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	start = time.Now()
+	gotD, gotL, err := idx.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search with 1 thread: %v", err)
+	}
+	t.Logf("search took %v with %d threads, %v with 1", parallel, defaultThreads, time.Since(start))
+	if !reflect.DeepEqual(gotL, wantL) || !approxEqual(gotD, wantD, 1e-5) {
+		t.Error("search results changed with the thread count")
+	}
+
+	SetNumThreads(0)
+	if got := GetNumThreads(); got != defaultThreads {
+		t.Errorf("GetNumThreads = %d after SetNumThreads(0), want the default %d", got, defaultThreads)
+	}
+}
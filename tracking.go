@@ -0,0 +1,122 @@
+package faiss
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// LiveObject describes a tracked C-backed object that has not been deleted.
+type LiveObject struct {
+	Kind  string // "Index", "IDSelector" or "VectorTransform"
+	Stack string // Stack trace at creation
+	// Finalized reports that the object was freed by the garbage collector
+	// instead of an explicit Delete.
+	Finalized bool
+}
+
+var tracker struct {
+	sync.Mutex
+	enabled   bool
+	live      map[uintptr]LiveObject
+	finalized []LiveObject
+}
+
+// EnableLeakTracking starts recording the creation stack of every Index,
+// IDSelector and VectorTransform so that objects never explicitly deleted can
+// be reported by LiveObjects and CheckLeaks. Tracking has a cost and is meant for tests.
+func EnableLeakTracking() {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	tracker.enabled = true
+	if tracker.live == nil {
+		tracker.live = make(map[uintptr]LiveObject)
+	}
+}
+
+// DisableLeakTracking stops tracking and discards all records.
+func DisableLeakTracking() {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	tracker.enabled = false
+	tracker.live = nil
+	tracker.finalized = nil
+}
+
+// LiveObjects returns the tracked objects that were not deleted explicitly,
+// including those freed by a finalizer. It returns nil if tracking is disabled.
+func LiveObjects() []LiveObject {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	if !tracker.enabled {
+		return nil
+	}
+
+	objects := make([]LiveObject, 0, len(tracker.live)+len(tracker.finalized))
+	for _, obj := range tracker.live {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Stack < objects[j].Stack
+	})
+	return append(objects, tracker.finalized...)
+}
+
+// CheckLeaks returns an error listing every tracked object that was not
+// deleted explicitly. It is suitable for calling from TestMain.
+func CheckLeaks() error {
+	objects := LiveObjects()
+	if len(objects) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d FAISS object(s) not deleted:", len(objects))
+	for _, obj := range objects {
+		state := "live"
+		if obj.Finalized {
+			state = "freed by finalizer"
+		}
+		fmt.Fprintf(&b, "\n%s (%s) created at:\n%s", obj.Kind, state, obj.Stack)
+	}
+	return fmt.Errorf("%s", b.String())
+}
+
+// trackObject records the creation of ptr if tracking is enabled.
+func trackObject(ptr unsafe.Pointer, kind string) {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	if !tracker.enabled {
+		return
+	}
+	tracker.live[uintptr(ptr)] = LiveObject{Kind: kind, Stack: string(debug.Stack())}
+}
+
+// untrackObject records the release of ptr. finalized is true when the
+// release comes from a finalizer rather than an explicit Delete.
+func untrackObject(ptr unsafe.Pointer, finalized bool) {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	if !tracker.enabled {
+		return
+	}
+
+	obj, ok := tracker.live[uintptr(ptr)]
+	if !ok {
+		return
+	}
+	delete(tracker.live, uintptr(ptr))
+
+	if finalized {
+		obj.Finalized = true
+		tracker.finalized = append(tracker.finalized, obj)
+	}
+}
@@ -0,0 +1,119 @@
+package faiss
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func trackLeaks(t *testing.T) {
+	t.Helper()
+	EnableLeakTracking()
+	t.Cleanup(DisableLeakTracking)
+}
+
+func TestLeakTrackingReportsUndeletedObjects(t *testing.T) {
+	trackLeaks(t)
+
+	flat, err := NewIndexFlatL2(4)
+	if err != nil {
+		t.Fatalf("NewIndexFlatL2: %v", err)
+	}
+	ivf, err := NewIndexIVFFlatL2(4, 2)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	sel, err := CreateBatchSelector([]int64{1, 2, 3}, -1)
+	if err != nil {
+		t.Fatalf("CreateBatchSelector: %v", err)
+	}
+
+	objects := LiveObjects()
+	if len(objects) != 3 {
+		t.Fatalf("LiveObjects returned %d objects, want 3", len(objects))
+	}
+	for _, obj := range objects {
+		if obj.Finalized || !strings.Contains(obj.Stack, "TestLeakTrackingReportsUndeletedObjects") {
+			t.Errorf("unexpected record %+v", obj)
+		}
+	}
+	if err := CheckLeaks(); err == nil || !strings.Contains(err.Error(), "3 FAISS object(s)") {
+		t.Errorf("CheckLeaks = %v, want 3 leaked objects", err)
+	}
+
+	flat.Close()
+	ivf.Close()
+	sel.Delete()
+	if err := CheckLeaks(); err != nil {
+		t.Errorf("CheckLeaks after Close: %v", err)
+	}
+}
+
+func TestLeakTrackingReportsFinalizedObjects(t *testing.T) {
+	trackLeaks(t)
+
+	func() {
+		if _, err := NewIndexFlatL2(4); err != nil {
+			t.Fatalf("NewIndexFlatL2: %v", err)
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runtime.GC()
+		objects := LiveObjects()
+		if len(objects) == 1 && objects[0].Finalized {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("index not reported as finalized: %+v", objects)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseDetachesWrappers(t *testing.T) {
+	trackLeaks(t)
+
+	const d = 8
+	x := randomVectors(1000, d, 1)
+
+	flat := newFlatL2(t, d, x)
+	ivf := newIVFFlatL2(t, d, 4, x)
+	pq, err := NewIndexIVFPQ(d, 4, 2, 8, MetricL2)
+	if err != nil {
+		t.Fatalf("NewIndexIVFPQ: %v", err)
+	}
+	hnsw, err := NewIndexHNSW(d, 16, MetricL2)
+	if err != nil {
+		t.Fatalf("NewIndexHNSW: %v", err)
+	}
+
+	indexes := []Index{flat, ivf, pq, hnsw}
+	for _, idx := range indexes {
+		idx.Delete()
+		idx.Delete()
+
+		if _, _, err := idx.Search(x[:d], 1); !errors.Is(err, ErrIndexClosed) {
+			t.Errorf("%T: Search after Close = %v, want ErrIndexClosed", idx, err)
+		}
+		if err := idx.Add(x[:d]); !errors.Is(err, ErrIndexClosed) {
+			t.Errorf("%T: Add after Close = %v, want ErrIndexClosed", idx, err)
+		}
+		if n := idx.Ntotal(); n != 0 {
+			t.Errorf("%T: Ntotal after Close = %d", idx, n)
+		}
+	}
+
+	if _, err := ivf.GetNProbe(); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("GetNProbe after Close = %v, want ErrIndexClosed", err)
+	}
+	if _, err := hnsw.GetEfSearch(); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("GetEfSearch after Close = %v, want ErrIndexClosed", err)
+	}
+	if err := CheckLeaks(); err != nil {
+		t.Errorf("CheckLeaks: %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package faiss
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DefaultDuplicateTolerance is the duplicate tolerance used by
+// AnalyzeTrainingData, see TrainingAnalyzer.SetDuplicateTolerance.
+const DefaultDuplicateTolerance = 1e-6
+
+const (
+	// maxTrackedVectors bounds the memory used to detect duplicates. Beyond
+	// this many distinct vectors, duplicates are counted on a hash-selected
+	// sample and extrapolated.
+	maxTrackedVectors = 1 << 22
+	// deadDimensionRatio is the fraction of the mean variance below which a
+	// dimension is considered dead.
+	deadDimensionRatio = 1e-6
+)
+
+// TrainingReport summarizes the quality of a training set, as computed by
+// AnalyzeTrainingData or a TrainingAnalyzer.
+type TrainingReport struct {
+	D             int   // Vector dimension
+	NList         int   // Number of clusters the data is meant to train
+	Vectors       int64 // Vectors analyzed
+	NonFinite     int64 // Vectors with NaN or Inf components, excluded from the other statistics
+	NaNComponents int64 // NaN components
+	InfComponents int64 // Inf components
+	ZeroVectors   int64 // Vectors whose components are all zero
+	// Duplicates is the number of vectors equal, within the tolerance, to an
+	// earlier vector. It is an estimate if DuplicatesEstimated is set.
+	Duplicates          int64
+	DuplicatesEstimated bool
+	Variance            []float64 // Per-dimension variance of the finite vectors
+	DeadDimensions      []int     // Dimensions with (near) zero variance
+	// MinRecommended and MaxUseful are the FAISS bounds on training points for
+	// NList clusters: k-means warns below 39 points per cluster and subsamples
+	// above 256.
+	MinRecommended int64
+	MaxUseful      int64
+}
+
+// Distinct returns the number of finite vectors that are not duplicates.
+func (r TrainingReport) Distinct() int64 {
+	return r.Vectors - r.NonFinite - r.Duplicates
+}
+
+// Sufficient reports whether the training set has at least MinRecommended
+// distinct vectors.
+func (r TrainingReport) Sufficient() bool {
+	return r.Distinct() >= r.MinRecommended
+}
+
+// Problems returns the issues that make training fail or produce unusable
+// centroids: non-finite components, fewer distinct vectors than clusters, or
+// no dimension with any variance.
+func (r TrainingReport) Problems() []string {
+	var problems []string
+	if r.NonFinite > 0 {
+		problems = append(problems, fmt.Sprintf(
+			"%d vectors have non-finite components (%d NaN, %d Inf)",
+			r.NonFinite, r.NaNComponents, r.InfComponents))
+	}
+	if r.Distinct() < int64(r.NList) {
+		problems = append(problems, fmt.Sprintf(
+			"%d distinct vectors for %d clusters", r.Distinct(), r.NList))
+	}
+	if r.D > 0 && len(r.DeadDimensions) == r.D {
+		problems = append(problems, "all dimensions have zero variance")
+	}
+	return problems
+}
+
+// Warnings returns the issues that degrade the trained index without
+// preventing training.
+func (r TrainingReport) Warnings() []string {
+	var warnings []string
+	if r.Duplicates > 0 {
+		approx := ""
+		if r.DuplicatesEstimated {
+			approx = "about "
+		}
+		warnings = append(warnings, fmt.Sprintf("%s%d duplicate vectors", approx, r.Duplicates))
+	}
+	if r.ZeroVectors > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d zero vectors", r.ZeroVectors))
+	}
+	if n := len(r.DeadDimensions); n > 0 && n < r.D {
+		warnings = append(warnings, fmt.Sprintf("%d dead dimensions", n))
+	}
+	if !r.Sufficient() && r.Distinct() >= int64(r.NList) {
+		warnings = append(warnings, fmt.Sprintf(
+			"%d distinct vectors, at least %d recommended for %d clusters",
+			r.Distinct(), r.MinRecommended, r.NList))
+	}
+	return warnings
+}
+
+// TrainingDataError is returned by TrainChecked when the training set has
+// problems, see TrainingReport.Problems.
+type TrainingDataError struct {
+	Report TrainingReport
+}
+
+func (e *TrainingDataError) Error() string {
+	return "training data rejected: " + strings.Join(e.Report.Problems(), "; ")
+}
+
+// TrainingAnalyzer computes a TrainingReport over a training set passed in
+// chunks, so that sets too large to hold in memory can be checked. Memory
+// use is bounded independently of the number of vectors.
+type TrainingAnalyzer struct {
+	d         int
+	tolerance float32
+	report    TrainingReport
+
+	// Running per-dimension mean and sum of squared deviations (Welford).
+	finite int64
+	mean   []float64
+	m2     []float64
+
+	// Occurrences of vector hashes whose top shift bits are zero.
+	seen  map[uint64]uint32
+	shift uint
+}
+
+// NewTrainingAnalyzer creates an analyzer for d-dimensional vectors meant to
+// train nlist clusters.
+func NewTrainingAnalyzer(d int, nlist int) (*TrainingAnalyzer, error) {
+	if d <= 0 {
+		return nil, ErrInvalidDimension
+	}
+	if nlist <= 0 {
+		return nil, fmt.Errorf("nlist must be positive, got %d", nlist)
+	}
+
+	return &TrainingAnalyzer{
+		d:         d,
+		tolerance: DefaultDuplicateTolerance,
+		report: TrainingReport{
+			D:              d,
+			NList:          nlist,
+			MinRecommended: int64(nlist) * minPointsPerCentroid,
+			MaxUseful:      int64(nlist) * maxPointsPerCentroid,
+		},
+		mean: make([]float64, d),
+		m2:   make([]float64, d),
+		seen: make(map[uint64]uint32),
+	}, nil
+}
+
+// SetDuplicateTolerance sets the tolerance under which vectors count as
+// duplicates: two vectors are duplicates when all their components round to
+// the same multiple of tol. Zero only counts bit-identical vectors. It must
+// be called before the first Offer.
+func (a *TrainingAnalyzer) SetDuplicateTolerance(tol float32) *TrainingAnalyzer {
+	if tol < 0 {
+		tol = 0
+	}
+	a.tolerance = tol
+	return a
+}
+
+// Offer analyzes a chunk of the training set. The chunk length must be a
+// multiple of d; otherwise the chunk is rejected and the report is unchanged.
+func (a *TrainingAnalyzer) Offer(vectors []float32) error {
+	if err := ValidateVectors(vectors, a.d); err != nil {
+		return wrapError(err, "training data validation")
+	}
+
+	n := len(vectors) / a.d
+	for i := 0; i < n; i++ {
+		a.offerOne(vectors[i*a.d : (i+1)*a.d])
+	}
+	return nil
+}
+
+func (a *TrainingAnalyzer) offerOne(vec []float32) {
+	a.report.Vectors++
+
+	finite, zero := true, true
+	for _, v := range vec {
+		switch {
+		case math.IsNaN(float64(v)):
+			a.report.NaNComponents++
+			finite = false
+		case math.IsInf(float64(v), 0):
+			a.report.InfComponents++
+			finite = false
+		case v != 0:
+			zero = false
+		}
+	}
+	if !finite {
+		a.report.NonFinite++
+		return
+	}
+	if zero {
+		a.report.ZeroVectors++
+	}
+
+	a.finite++
+	for j, v := range vec {
+		delta := float64(v) - a.mean[j]
+		a.mean[j] += delta / float64(a.finite)
+		a.m2[j] += delta * (float64(v) - a.mean[j])
+	}
+
+	h := a.hash(vec)
+	if h>>(64-a.shift) != 0 {
+		return
+	}
+	a.seen[h]++
+	if len(a.seen) > maxTrackedVectors {
+		// Halve the sample, keeping the counts of the hashes that remain.
+		a.shift++
+		for k := range a.seen {
+			if k>>(64-a.shift) != 0 {
+				delete(a.seen, k)
+			}
+		}
+	}
+}
+
+// hash hashes the components of vec rounded to the tolerance.
+func (a *TrainingAnalyzer) hash(vec []float32) uint64 {
+	h := uint64(14695981039346656037)
+	for _, v := range vec {
+		var q uint64
+		if a.tolerance > 0 {
+			q = uint64(int64(math.Round(float64(v) / float64(a.tolerance))))
+		} else if v != 0 {
+			q = uint64(math.Float32bits(v))
+		}
+		h ^= q
+		h *= 1099511628211
+	}
+	// Final mix, so the top bits used for sampling are well distributed.
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h
+}
+
+// Report returns the report for the vectors offered so far.
+func (a *TrainingAnalyzer) Report() TrainingReport {
+	r := a.report
+
+	var dups int64
+	for _, count := range a.seen {
+		dups += int64(count) - 1
+	}
+	r.Duplicates = dups << a.shift
+	r.DuplicatesEstimated = a.shift > 0
+
+	r.Variance = make([]float64, a.d)
+	var total float64
+	if a.finite > 0 {
+		for j := range r.Variance {
+			r.Variance[j] = a.m2[j] / float64(a.finite)
+			total += r.Variance[j]
+		}
+	}
+	threshold := deadDimensionRatio * total / float64(a.d)
+	for j, v := range r.Variance {
+		if v <= threshold {
+			r.DeadDimensions = append(r.DeadDimensions, j)
+		}
+	}
+	return r
+}
+
+// AnalyzeTrainingData checks x, a training set of d-dimensional vectors for
+// nlist clusters, for duplicates within DefaultDuplicateTolerance, zero
+// vectors, NaN and Inf components and dead dimensions, and compares its size
+// with the FAISS guidance for nlist. Use a TrainingAnalyzer to check sets
+// that don't fit in memory.
+func AnalyzeTrainingData(x []float32, d int, nlist int) (TrainingReport, error) {
+	a, err := NewTrainingAnalyzer(d, nlist)
+	if err != nil {
+		return TrainingReport{}, err
+	}
+	if err := a.Offer(x); err != nil {
+		return TrainingReport{}, err
+	}
+	return a.Report(), nil
+}
+
+// TrainCheckOption configures TrainChecked.
+type TrainCheckOption func(*trainCheckOptions)
+
+type trainCheckOptions struct {
+	allowProblems bool
+}
+
+// AllowTrainingProblems makes TrainChecked train even when the analysis
+// finds problems.
+func AllowTrainingProblems() TrainCheckOption {
+	return func(o *trainCheckOptions) {
+		o.allowProblems = true
+	}
+}
+
+// trainChecked analyzes x for the clusters idx trains and trains idx unless
+// problems are found.
+func trainChecked(idx *faissIndex, x []float32, opts []TrainCheckOption) error {
+	var o trainCheckOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+
+	report, err := AnalyzeTrainingData(x, idx.D(), idx.MinTrainingPoints())
+	if err != nil {
+		return err
+	}
+	if len(report.Problems()) > 0 && !o.allowProblems {
+		return &TrainingDataError{Report: report}
+	}
+	return idx.Train(x)
+}
@@ -0,0 +1,53 @@
+package faiss
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTrainCheckedRejectsDegenerateData(t *testing.T) {
+	const d, nlist = 8, 16
+
+	constant := make([]float32, 1000*d)
+	for i := range constant {
+		constant[i] = 0.5
+	}
+
+	for _, tc := range []struct {
+		name    string
+		x       []float32
+		problem string
+	}{
+		{"constant vectors", constant, "all dimensions have zero variance"},
+		{"too few points", randomVectors(nlist/2, d, 1), "8 distinct vectors for 16 clusters"},
+	} {
+		idx, err := NewIndexIVFFlatL2(d, nlist)
+		if err != nil {
+			t.Fatalf("NewIndexIVFFlatL2: %v", err)
+		}
+		defer idx.Delete()
+
+		err = idx.TrainChecked(tc.x)
+		var dataErr *TrainingDataError
+		if !errors.As(err, &dataErr) {
+			t.Errorf("%s: TrainChecked = %v, want a TrainingDataError", tc.name, err)
+			continue
+		}
+		if !strings.Contains(strings.Join(dataErr.Report.Problems(), "; "), tc.problem) {
+			t.Errorf("%s: problems %q, want %q", tc.name, dataErr.Report.Problems(), tc.problem)
+		}
+		if idx.IsTrained() {
+			t.Errorf("%s: the index was trained on rejected data", tc.name)
+		}
+	}
+
+	idx, err := NewIndexIVFFlatL2(d, nlist)
+	if err != nil {
+		t.Fatalf("NewIndexIVFFlatL2: %v", err)
+	}
+	defer idx.Delete()
+	if err := idx.TrainChecked(clusteredVectors(50*nlist, d, nlist, 2)); err != nil || !idx.IsTrained() {
+		t.Errorf("TrainChecked on sound data = %v, trained %v", err, idx.IsTrained())
+	}
+}
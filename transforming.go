@@ -0,0 +1,335 @@
+package faiss
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Transform is a vector transformation applied by a TransformingIndex. Apply
+// transforms the vectors of x, of dimension d, and returns the result and
+// its dimension. It must not modify x.
+type Transform interface {
+	Apply(x []float32, d int) ([]float32, int, error)
+}
+
+// DimensionTransform is implemented by transforms changing the dimension.
+// InputDim is the dimension of the vectors the transform accepts.
+type DimensionTransform interface {
+	Transform
+	InputDim() int
+}
+
+// NormalizeTransform scales vectors to unit L2 length. Zero vectors are kept.
+type NormalizeTransform struct{}
+
+func (NormalizeTransform) Apply(x []float32, d int) ([]float32, int, error) {
+	out := make([]float32, len(x))
+	copy(out, x)
+	if err := NormalizeVectors(out, d); err != nil {
+		return nil, 0, err
+	}
+	return out, d, nil
+}
+
+// CenteringTransform subtracts Mean from vectors, typically the mean of the
+// training data.
+type CenteringTransform struct {
+	Mean []float32
+}
+
+func (t CenteringTransform) Apply(x []float32, d int) ([]float32, int, error) {
+	if d != len(t.Mean) {
+		return nil, 0, fmt.Errorf("centering: %w", &DimensionMismatchError{Got: d, Want: len(t.Mean)})
+	}
+	if err := ValidateVectors(x, d); err != nil {
+		return nil, 0, err
+	}
+
+	out := make([]float32, len(x))
+	for i, v := range x {
+		out[i] = v - t.Mean[i%d]
+	}
+	return out, d, nil
+}
+
+// PCATransform projects vectors of dimension DIn onto DOut components.
+// Matrix holds the components as DOut rows of DIn values. Vectors are
+// projected as is, so a CenteringTransform usually precedes it.
+type PCATransform struct {
+	Matrix []float32
+	DIn    int
+	DOut   int
+}
+
+func (t PCATransform) InputDim() int { return t.DIn }
+
+func (t PCATransform) Apply(x []float32, d int) ([]float32, int, error) {
+	if t.DIn <= 0 || t.DOut <= 0 || len(t.Matrix) != t.DIn*t.DOut {
+		return nil, 0, fmt.Errorf("pca: matrix of %d values doesn't match %dx%d", len(t.Matrix), t.DOut, t.DIn)
+	}
+	if d != t.DIn {
+		return nil, 0, fmt.Errorf("pca: %w", &DimensionMismatchError{Got: d, Want: t.DIn})
+	}
+	if err := ValidateVectors(x, d); err != nil {
+		return nil, 0, err
+	}
+
+	n := len(x) / d
+	out := make([]float32, n*t.DOut)
+	for i := 0; i < n; i++ {
+		vec := x[i*d : (i+1)*d]
+		for j := 0; j < t.DOut; j++ {
+			var dot float32
+			for k, c := range t.Matrix[j*d : (j+1)*d] {
+				dot += c * vec[k]
+			}
+			out[i*t.DOut+j] = dot
+		}
+	}
+	return out, t.DOut, nil
+}
+
+// TransformingIndex applies the same pipeline of transforms to the vectors
+// passed to Train, Add and AddWithIDs and to the queries passed to Search
+// and SearchBatch, so that vectors and queries can't be transformed
+// inconsistently. Only those operations are exposed; Inner gives access to
+// the underlying index, which holds transformed vectors.
+type TransformingIndex struct {
+	inner      Index
+	transforms []Transform
+	d          int
+}
+
+// TransformSidecarSuffix is appended to the index file name to get the file
+// storing the transforms of a TransformingIndex.
+const TransformSidecarSuffix = ".transforms.json"
+
+// NewTransformingIndex wraps inner, applying transforms in order. The output
+// dimension of the pipeline must be inner.D(); its input dimension, reported
+// by D, differs when a DimensionTransform is used.
+func NewTransformingIndex(inner Index, transforms ...Transform) (*TransformingIndex, error) {
+	if inner == nil || inner.cPtr() == nil {
+		return nil, ErrNullPointer
+	}
+
+	d := inner.D()
+	for i := len(transforms) - 1; i >= 0; i-- {
+		switch t := transforms[i].(type) {
+		case nil:
+			return nil, fmt.Errorf("transform %d is nil", i)
+		case DimensionTransform:
+			d = t.InputDim()
+		}
+	}
+
+	t := &TransformingIndex{inner: inner, transforms: transforms, d: d}
+
+	// Check that the pipeline ends at the dimension of inner.
+	if _, err := t.Transform(make([]float32, d)); err != nil {
+		return nil, wrapError(err, "transform pipeline")
+	}
+	return t, nil
+}
+
+// Transform applies the pipeline to x, vectors of dimension D, returning
+// vectors of dimension Inner().D().
+func (t *TransformingIndex) Transform(x []float32) ([]float32, error) {
+	if err := ValidateVectors(x, t.d); err != nil {
+		return nil, err
+	}
+
+	d := t.d
+	for i, tr := range t.transforms {
+		var err error
+		x, d, err = tr.Apply(x, d)
+		if err != nil {
+			return nil, fmt.Errorf("transform %d: %w", i, err)
+		}
+	}
+	if want := t.inner.D(); d != want {
+		return nil, fmt.Errorf("transforms output %w", &DimensionMismatchError{Got: d, Want: want})
+	}
+	return x, nil
+}
+
+// D returns the dimension of the vectors accepted, before the transforms.
+func (t *TransformingIndex) D() int { return t.d }
+
+// Ntotal returns the number of vectors in the index.
+func (t *TransformingIndex) Ntotal() int64 { return t.inner.Ntotal() }
+
+// MetricType returns the metric of the underlying index.
+func (t *TransformingIndex) MetricType() int { return t.inner.MetricType() }
+
+// Inner returns the underlying index.
+func (t *TransformingIndex) Inner() Index { return t.inner }
+
+// Train transforms x and trains the underlying index on it.
+func (t *TransformingIndex) Train(x []float32) error {
+	xt, err := t.Transform(x)
+	if err != nil {
+		return wrapError(err, "train")
+	}
+	return t.inner.Train(xt)
+}
+
+// Add transforms x and adds it to the underlying index.
+func (t *TransformingIndex) Add(x []float32) error {
+	xt, err := t.Transform(x)
+	if err != nil {
+		return wrapError(err, "add")
+	}
+	return t.inner.Add(xt)
+}
+
+// AddWithIDs transforms x and adds it with the given IDs.
+func (t *TransformingIndex) AddWithIDs(x []float32, xids []int64) error {
+	xt, err := t.Transform(x)
+	if err != nil {
+		return wrapError(err, "add_with_ids")
+	}
+	return t.inner.AddWithIDs(xt, xids)
+}
+
+// Search transforms the queries x and searches the underlying index.
+func (t *TransformingIndex) Search(x []float32, k int64) (distances []float32, labels []int64, err error) {
+	xt, err := t.Transform(x)
+	if err != nil {
+		return nil, nil, wrapError(err, "search")
+	}
+	return t.inner.Search(xt, k)
+}
+
+// SearchBatch transforms the queries and searches the underlying index in
+// batches. See Index.SearchBatch.
+func (t *TransformingIndex) SearchBatch(queries []float32, k int64, batchSize int, opts ...BatchOption) (distances [][]float32, labels [][]int64, err error) {
+	qt, err := t.Transform(queries)
+	if err != nil {
+		return nil, nil, wrapError(err, "search batch")
+	}
+	return t.inner.SearchBatch(qt, k, batchSize, opts...)
+}
+
+// Coercion returns the dimension coercion of the pipeline, if any.
+func (t *TransformingIndex) Coercion() (CoerceTransform, bool) {
+	for _, tr := range t.transforms {
+		if c, ok := tr.(CoerceTransform); ok {
+			return c, true
+		}
+	}
+	return CoerceTransform{}, false
+}
+
+// AddCoerced adds x, vectors of dimension fromD that the caller expects to
+// be coerced with policy. It fails with ErrCoercionMismatch unless the
+// pipeline coerces fromD-dimensional vectors with the same policy, so that
+// vectors coerced differently are never mixed in the index.
+func (t *TransformingIndex) AddCoerced(x []float32, fromD int, policy CoercePolicy) error {
+	c, ok := t.Coercion()
+	if !ok {
+		return fmt.Errorf("%w: the index doesn't coerce dimensions", ErrCoercionMismatch)
+	}
+	if c.FromD != fromD || c.Policy != policy {
+		return fmt.Errorf("%w: index coerces %d dimensions with %s, got %d with %s", ErrCoercionMismatch, c.FromD, c.Policy, fromD, policy)
+	}
+	return t.Add(x)
+}
+
+// Delete frees the underlying index.
+func (t *TransformingIndex) Delete() {
+	t.inner.Delete()
+}
+
+// transformSpec is the sidecar encoding of a transform.
+type transformSpec struct {
+	Type   string    `json:"type"`
+	Mean   []float32 `json:"mean,omitempty"`
+	Matrix []float32 `json:"matrix,omitempty"`
+	DIn    int       `json:"d_in,omitempty"`
+	DOut   int       `json:"d_out,omitempty"`
+	Policy string    `json:"policy,omitempty"`
+	Seed   int64     `json:"seed,omitempty"`
+}
+
+// Write writes the underlying index to fname with WriteIndex and the
+// transforms to fname+TransformSidecarSuffix. Only the transforms of this
+// package can be written.
+func (t *TransformingIndex) Write(fname string) error {
+	specs := make([]transformSpec, len(t.transforms))
+	for i, tr := range t.transforms {
+		switch tr := tr.(type) {
+		case NormalizeTransform:
+			specs[i] = transformSpec{Type: "normalize"}
+		case CenteringTransform:
+			specs[i] = transformSpec{Type: "centering", Mean: tr.Mean}
+		case PCATransform:
+			specs[i] = transformSpec{Type: "pca", Matrix: tr.Matrix, DIn: tr.DIn, DOut: tr.DOut}
+		case CoerceTransform:
+			specs[i] = transformSpec{Type: "coerce", DIn: tr.FromD, DOut: tr.ToD, Policy: tr.Policy.String(), Seed: tr.Seed}
+		default:
+			return fmt.Errorf("transform %d: type %T can't be written", i, tr)
+		}
+	}
+
+	data, err := json.Marshal(specs)
+	if err != nil {
+		return wrapError(err, "encode transforms")
+	}
+
+	if err := WriteIndex(t.inner, fname); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fname+TransformSidecarSuffix, data, 0644); err != nil {
+		return wrapError(err, "write transforms")
+	}
+	return nil
+}
+
+// ReadTransformingIndex reads an index written by TransformingIndex.Write,
+// with ReadIndex and ioflags.
+func ReadTransformingIndex(fname string, ioflags int) (*TransformingIndex, error) {
+	data, err := os.ReadFile(fname + TransformSidecarSuffix)
+	if err != nil {
+		return nil, wrapError(err, "read transforms")
+	}
+
+	var specs []transformSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, wrapError(err, "decode transforms")
+	}
+
+	transforms := make([]Transform, len(specs))
+	for i, spec := range specs {
+		switch spec.Type {
+		case "normalize":
+			transforms[i] = NormalizeTransform{}
+		case "centering":
+			transforms[i] = CenteringTransform{Mean: spec.Mean}
+		case "pca":
+			transforms[i] = PCATransform{Matrix: spec.Matrix, DIn: spec.DIn, DOut: spec.DOut}
+		case "coerce":
+			policy, err := parseCoercePolicy(spec.Policy)
+			if err != nil {
+				return nil, fmt.Errorf("transform %d: %w", i, err)
+			}
+			if transforms[i], err = NewCoerceTransform(spec.DIn, spec.DOut, policy, spec.Seed); err != nil {
+				return nil, fmt.Errorf("transform %d: %w", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("transform %d: unknown type %q", i, spec.Type)
+		}
+	}
+
+	inner, err := ReadIndex(fname, ioflags)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := NewTransformingIndex(inner, transforms...)
+	if err != nil {
+		inner.Delete()
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,99 @@
+package faiss
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// transformPipeline returns centering, a PCA keeping 4 of 8 dimensions and
+// normalization.
+func transformPipeline(x []float32, d int) []Transform {
+	mean := make([]float32, d)
+	n := len(x) / d
+	for i, v := range x {
+		mean[i%d] += v / float32(n)
+	}
+	matrix := randomVectors(4, d, 7)
+	return []Transform{
+		CenteringTransform{Mean: mean},
+		PCATransform{Matrix: matrix, DIn: d, DOut: 4},
+		NormalizeTransform{},
+	}
+}
+
+// checkSelfMatches checks that each of the first vectors of x, as a query,
+// finds itself at distance about 0.
+func checkSelfMatches(t *testing.T, idx *TransformingIndex, x []float32, d int) {
+	t.Helper()
+
+	const nq = 20
+	distances, labels, err := idx.Search(x[:nq*d], 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	for i := 0; i < nq; i++ {
+		if labels[i] != int64(i) || distances[i] > 1e-5 {
+			t.Errorf("query %d: nearest %d at %v, want itself at about 0", i, labels[i], distances[i])
+		}
+	}
+
+	batchD, batchL, err := idx.SearchBatch(x[:nq*d], 1, 7)
+	if err != nil {
+		t.Fatalf("SearchBatch: %v", err)
+	}
+	for i := 0; i < nq; i++ {
+		if batchL[i][0] != int64(i) || batchD[i][0] > 1e-5 {
+			t.Errorf("batch query %d: nearest %d at %v, want itself at about 0", i, batchL[i][0], batchD[i][0])
+		}
+	}
+}
+
+func TestTransformingIndexQueriesMatchStored(t *testing.T) {
+	const d, n = 8, 500
+	x := randomVectors(n, d, 1)
+
+	inner := newFlatL2(t, 4, nil)
+	idx, err := NewTransformingIndex(inner, transformPipeline(x, d)...)
+	if err != nil {
+		t.Fatalf("NewTransformingIndex: %v", err)
+	}
+	if idx.D() != d || inner.D() != 4 {
+		t.Fatalf("D = %d over an inner index of %d, want %d over 4", idx.D(), inner.D(), d)
+	}
+
+	if err := idx.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, _, err := idx.Search(randomVectors(1, 4, 2), 1); err == nil {
+		t.Error("Search accepted a query of the inner dimension")
+	}
+	checkSelfMatches(t, idx, x, d)
+
+	// A reloaded index transforms queries identically
+	fname := filepath.Join(t.TempDir(), "transforming.index")
+	if err := idx.Write(fname); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	loaded, err := ReadTransformingIndex(fname, 0)
+	if err != nil {
+		t.Fatalf("ReadTransformingIndex: %v", err)
+	}
+	defer loaded.Delete()
+	if loaded.D() != d || loaded.Ntotal() != n {
+		t.Fatalf("loaded D = %d, Ntotal = %d, want %d, %d", loaded.D(), loaded.Ntotal(), d, n)
+	}
+	checkSelfMatches(t, loaded, x, d)
+}
+
+func TestTransformingIndexRejectsBadPipeline(t *testing.T) {
+	inner := newFlatL2(t, 4, nil)
+
+	// PCA to 3 dimensions doesn't end at the inner dimension
+	pca := PCATransform{Matrix: make([]float32, 3*8), DIn: 8, DOut: 3}
+	if _, err := NewTransformingIndex(inner, pca); err == nil {
+		t.Error("NewTransformingIndex accepted a pipeline ending at the wrong dimension")
+	}
+	if _, err := NewTransformingIndex(inner, nil); err == nil {
+		t.Error("NewTransformingIndex accepted a nil transform")
+	}
+}
@@ -0,0 +1,61 @@
+package faiss
+
+/*
+#include <faiss/c_api/Index_c.h>
+#include <faiss/c_api/IndexFlat_c.h>
+#include <faiss/c_api/IndexIVF_c.h>
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+)
+
+// ValidateIndex checks the internal invariants of idx, for example after
+// loading it from disk following a crash:
+//   - every index: positive dimension and non-negative Ntotal
+//   - flat indexes: the vector storage holds exactly Ntotal*D floats
+//   - IVF indexes: the inverted list sizes sum to Ntotal
+func ValidateIndex(idx Index) error {
+	if idx == nil || idx.cPtr() == nil {
+		return ErrNullPointer
+	}
+
+	d := idx.D()
+	if d <= 0 {
+		return wrapError(ErrInvalidDimension, "validate index")
+	}
+
+	ntotal := idx.Ntotal()
+	if ntotal < 0 {
+		return fmt.Errorf("validate index: negative ntotal %d", ntotal)
+	}
+
+	if flat := C.faiss_IndexFlat_cast(idx.cPtr()); flat != nil {
+		var size C.size_t
+		var ptr *C.float
+		C.faiss_IndexFlat_xb(flat, &ptr, &size)
+
+		if int64(size) != ntotal*int64(d) {
+			return fmt.Errorf("validate index: flat storage holds %d floats, expected ntotal*d = %d", int64(size), ntotal*int64(d))
+		}
+	}
+
+	if ivf := C.faiss_IndexIVF_cast(idx.cPtr()); ivf != nil {
+		nlist := int(C.faiss_IndexIVF_nlist(ivf))
+		if nlist <= 0 {
+			return errors.New("validate index: IVF index has no inverted lists")
+		}
+
+		var sum int64
+		for l := 0; l < nlist; l++ {
+			sum += int64(C.faiss_IndexIVF_get_list_size(ivf, C.size_t(l)))
+		}
+
+		if sum != ntotal {
+			return fmt.Errorf("validate index: inverted lists hold %d vectors, ntotal is %d", sum, ntotal)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package faiss
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateIndexHealthy(t *testing.T) {
+	const d = 8
+	x := clusteredVectors(1000, d, 8, 1)
+
+	flat := newFlatL2(t, d, x)
+	if err := ValidateIndex(flat); err != nil {
+		t.Errorf("ValidateIndex(flat): %v", err)
+	}
+
+	ivf := newIVFFlatL2(t, d, 8, x)
+	if err := ValidateIndex(ivf); err != nil {
+		t.Errorf("ValidateIndex(ivf): %v", err)
+	}
+
+	// Removals must keep the list sizes in line with Ntotal
+	if _, err := ivf.RemoveIDsSlice([]int64{1, 10, 100}); err != nil {
+		t.Fatalf("RemoveIDsSlice: %v", err)
+	}
+	if err := ValidateIndex(ivf); err != nil {
+		t.Errorf("ValidateIndex(ivf) after removal: %v", err)
+	}
+}
+
+func TestValidateIndexClosed(t *testing.T) {
+	idx, err := NewIndexFlatL2(4)
+	if err != nil {
+		t.Fatalf("NewIndexFlatL2: %v", err)
+	}
+	idx.Delete()
+
+	if err := ValidateIndex(idx); !errors.Is(err, ErrNullPointer) {
+		t.Errorf("ValidateIndex on a deleted index = %v, want ErrNullPointer", err)
+	}
+}
@@ -0,0 +1,152 @@
+package faiss
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// The *vecs formats of the FAISS benchmark datasets (SIFT1M, GIST1M, ...)
+// store each vector as its dimension, a little-endian int32, followed by its
+// components: little-endian float32 for .fvecs, uint8 for .bvecs and
+// little-endian int32 for .ivecs, used for ground-truth neighbor IDs.
+
+// ExportFvecs writes all vectors of idx to path in the .fvecs format, in ID
+// order. idx must use sequential IDs and support reconstruction.
+func ExportFvecs(idx Index, path string) (err error) {
+	if idx == nil || idx.cPtr() == nil {
+		return errors.New("index is nil")
+	}
+	if path == "" {
+		return errors.New("filename is empty")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return wrapError(err, "could not create directory")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return wrapError(err, "export fvecs")
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = wrapError(cerr, "export fvecs")
+		}
+	}()
+
+	d := idx.D()
+	ntotal := idx.Ntotal()
+	w := bufio.NewWriter(f)
+	chunk := make([]float32, DefaultAddBatchSize*d)
+	record := make([]byte, 4+4*d)
+	binary.LittleEndian.PutUint32(record, uint32(d))
+
+	for start := int64(0); start < ntotal; start += DefaultAddBatchSize {
+		n := ntotal - start
+		if n > DefaultAddBatchSize {
+			n = DefaultAddBatchSize
+		}
+		if err := reconstructN(idx, start, n, chunk[:n*int64(d)]); err != nil {
+			return wrapError(err, "export fvecs")
+		}
+
+		for i := 0; i < int(n); i++ {
+			for j, v := range chunk[i*d : (i+1)*d] {
+				binary.LittleEndian.PutUint32(record[4+4*j:], math.Float32bits(v))
+			}
+			if _, err := w.Write(record); err != nil {
+				return wrapError(err, "export fvecs")
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return wrapError(err, "export fvecs")
+	}
+	return nil
+}
+
+// ReadFvecs reads a .fvecs file, returning its vectors concatenated and their
+// dimension, which must be the same for all of them.
+func ReadFvecs(path string) (vectors []float32, d int, err error) {
+	err = readVecs(path, 4, func(components []byte) {
+		for i := 0; i < len(components); i += 4 {
+			vectors = append(vectors, math.Float32frombits(binary.LittleEndian.Uint32(components[i:])))
+		}
+	}, &d)
+	if err != nil {
+		return nil, 0, wrapError(err, "read fvecs")
+	}
+	return vectors, d, nil
+}
+
+// ReadBvecs reads a .bvecs file such as the SIFT1B base vectors, converting
+// the components to float32.
+func ReadBvecs(path string) (vectors []float32, d int, err error) {
+	err = readVecs(path, 1, func(components []byte) {
+		for _, b := range components {
+			vectors = append(vectors, float32(b))
+		}
+	}, &d)
+	if err != nil {
+		return nil, 0, wrapError(err, "read bvecs")
+	}
+	return vectors, d, nil
+}
+
+// ReadIvecs reads a .ivecs file, typically the ground truth of a benchmark
+// dataset: d neighbor IDs per query, usable with recall computations.
+func ReadIvecs(path string) (data []int32, d int, err error) {
+	err = readVecs(path, 4, func(components []byte) {
+		for i := 0; i < len(components); i += 4 {
+			data = append(data, int32(binary.LittleEndian.Uint32(components[i:])))
+		}
+	}, &d)
+	if err != nil {
+		return nil, 0, wrapError(err, "read ivecs")
+	}
+	return data, d, nil
+}
+
+// readVecs reads a file in the *vecs layout with components of size bytes,
+// passing the components of each vector to fn and setting *d to the common
+// dimension.
+func readVecs(path string, size int, fn func(components []byte), d *int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var header [4]byte
+	var components []byte
+	for n := 0; ; n++ {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("vector %d: %w", n, err)
+		}
+
+		dim := int(int32(binary.LittleEndian.Uint32(header[:])))
+		if dim <= 0 {
+			return fmt.Errorf("vector %d: %w: %d", n, ErrInvalidDimension, dim)
+		}
+		if n == 0 {
+			*d = dim
+			components = make([]byte, dim*size)
+		} else if dim != *d {
+			return fmt.Errorf("vector %d: %w", n, &DimensionMismatchError{Got: dim, Want: *d})
+		}
+
+		if _, err := io.ReadFull(r, components); err != nil {
+			return fmt.Errorf("vector %d: %w", n, err)
+		}
+		fn(components)
+	}
+}
@@ -0,0 +1,114 @@
+package faiss
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFvecsRoundTrip(t *testing.T) {
+	// More vectors than one reconstruction chunk
+	const d, n = 12, 2500
+	x := randomVectors(n, d, 1)
+	idx := newFlatL2(t, d, x)
+
+	path := filepath.Join(t.TempDir(), "sub", "base.fvecs")
+	if err := ExportFvecs(idx, path); err != nil {
+		t.Fatalf("ExportFvecs: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if want := int64(n * (4 + 4*d)); info.Size() != want {
+		t.Errorf("file size = %d, want %d", info.Size(), want)
+	}
+
+	vectors, gotD, err := ReadFvecs(path)
+	if err != nil {
+		t.Fatalf("ReadFvecs: %v", err)
+	}
+	if gotD != d {
+		t.Errorf("ReadFvecs dimension = %d, want %d", gotD, d)
+	}
+	if !reflect.DeepEqual(vectors, x) {
+		t.Error("ReadFvecs returned different vectors than were exported")
+	}
+
+	// A truncated last vector is an error, not a silently shorter result
+	if err := os.Truncate(path, info.Size()-2); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	if _, _, err := ReadFvecs(path); err == nil {
+		t.Error("ReadFvecs accepted a truncated file")
+	}
+}
+
+func TestReadFvecsDimensionMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mixed.fvecs")
+	data := []byte{
+		2, 0, 0, 0, 0, 0, 0x80, 0x3f, 0, 0, 0, 0x40, // d=2: 1, 2
+		1, 0, 0, 0, 0, 0, 0x40, 0x40, // d=1: 3
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	var mismatch *DimensionMismatchError
+	if _, _, err := ReadFvecs(path); !errors.As(err, &mismatch) {
+		t.Errorf("ReadFvecs with mixed dimensions = %v, want a DimensionMismatchError", err)
+	}
+}
+
+func TestReadBvecsAndIvecs(t *testing.T) {
+	dir := t.TempDir()
+	bvecs := filepath.Join(dir, "base.bvecs")
+	data := []byte{
+		3, 0, 0, 0, 0, 128, 255,
+		3, 0, 0, 0, 1, 2, 3,
+	}
+	if err := os.WriteFile(bvecs, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	vectors, d, err := ReadBvecs(bvecs)
+	if err != nil {
+		t.Fatalf("ReadBvecs: %v", err)
+	}
+	if d != 3 {
+		t.Errorf("ReadBvecs dimension = %d, want 3", d)
+	}
+	if want := []float32{0, 128, 255, 1, 2, 3}; !reflect.DeepEqual(vectors, want) {
+		t.Errorf("ReadBvecs = %v, want %v", vectors, want)
+	}
+
+	ivecs := filepath.Join(dir, "groundtruth.ivecs")
+	data = []byte{
+		2, 0, 0, 0, 7, 0, 0, 0, 0xff, 0xff, 0xff, 0xff,
+		2, 0, 0, 0, 0, 1, 0, 0, 42, 0, 0, 0,
+	}
+	if err := os.WriteFile(ivecs, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	ids, d, err := ReadIvecs(ivecs)
+	if err != nil {
+		t.Fatalf("ReadIvecs: %v", err)
+	}
+	if d != 2 {
+		t.Errorf("ReadIvecs dimension = %d, want 2", d)
+	}
+	if want := []int32{7, -1, 256, 42}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ReadIvecs = %v, want %v", ids, want)
+	}
+
+	// An empty file holds no vectors
+	empty := filepath.Join(dir, "empty.bvecs")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if vectors, _, err := ReadBvecs(empty); err != nil || len(vectors) != 0 {
+		t.Errorf("ReadBvecs of an empty file = %v, %v", vectors, err)
+	}
+}
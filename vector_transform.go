@@ -0,0 +1,241 @@
+package faiss
+
+/*
+#include <stdlib.h>
+#include <faiss/c_api/Index_c.h>
+#include <faiss/c_api/VectorTransform_c.h>
+#include <faiss/c_api/IndexPreTransform_c.h>
+#include "faiss_ext.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// VectorTransform is a transformation applied to vectors before indexing,
+// such as a PCA dimensionality reduction or an OPQ rotation.
+type VectorTransform struct {
+	vt *C.FaissVectorTransform
+	mu sync.Mutex // Serializes Delete
+}
+
+func newVectorTransform(vt *C.FaissVectorTransform) *VectorTransform {
+	t := &VectorTransform{vt: vt}
+	runtime.SetFinalizer(t, (*VectorTransform).finalize)
+	trackObject(unsafe.Pointer(t), "VectorTransform")
+	return t
+}
+
+// NewPCAMatrix creates a PCA transform reducing dIn dimensions to dOut.
+// It must be trained before use.
+func NewPCAMatrix(dIn, dOut int) (*VectorTransform, error) {
+	if dIn <= 0 || dOut <= 0 {
+		return nil, fmt.Errorf("dimensions must be positive, got dIn=%d dOut=%d", dIn, dOut)
+	}
+	if dOut > dIn {
+		return nil, fmt.Errorf("dOut (%d) cannot be greater than dIn (%d)", dOut, dIn)
+	}
+
+	var vt *C.FaissVectorTransform
+	if c := C.faiss_PCAMatrix_new_with(&vt, C.int(dIn), C.int(dOut), 0, 0); c != 0 {
+		return nil, wrapError(getLastError(), "PCAMatrix creation")
+	}
+	return newVectorTransform(vt), nil
+}
+
+// NewOPQMatrix creates an OPQ rotation for d-dimensional vectors, optimized
+// for a product quantizer with M sub-vectors. It must be trained before use.
+func NewOPQMatrix(d, M int) (*VectorTransform, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("dimension must be positive, got %d", d)
+	}
+	if M <= 0 || d%M != 0 {
+		return nil, fmt.Errorf("M must be a positive divisor of dimension %d, got %d", d, M)
+	}
+
+	var vt *C.FaissVectorTransform
+	if c := C.faiss_OPQMatrix_new_with(&vt, C.int(d), C.int(M), C.int(d)); c != 0 {
+		return nil, wrapError(getLastError(), "OPQMatrix creation")
+	}
+	return newVectorTransform(vt), nil
+}
+
+// DIn returns the input dimension
+func (t *VectorTransform) DIn() int {
+	if t.vt == nil {
+		return 0
+	}
+	return int(C.faiss_VectorTransform_d_in(t.vt))
+}
+
+// DOut returns the output dimension
+func (t *VectorTransform) DOut() int {
+	if t.vt == nil {
+		return 0
+	}
+	return int(C.faiss_VectorTransform_d_out(t.vt))
+}
+
+// IsTrained returns true if the transform has been trained
+func (t *VectorTransform) IsTrained() bool {
+	if t.vt == nil {
+		return false
+	}
+	return C.faiss_VectorTransform_is_trained(t.vt) != 0
+}
+
+// Train trains the transform on a representative set of vectors
+func (t *VectorTransform) Train(x []float32) error {
+	if t.vt == nil {
+		return ErrNullPointer
+	}
+
+	dIn := t.DIn()
+	if err := ValidateVectors(x, dIn); err != nil {
+		return wrapError(err, "train vectors validation")
+	}
+
+	n := len(x) / dIn
+	if c := C.faiss_VectorTransform_train(t.vt, C.idx_t(n), (*C.float)(&x[0])); c != 0 {
+		return wrapError(getLastError(), "vector transform train operation")
+	}
+	return nil
+}
+
+// Apply transforms vectors of dimension DIn into vectors of dimension DOut
+func (t *VectorTransform) Apply(x []float32) ([]float32, error) {
+	if t.vt == nil {
+		return nil, ErrNullPointer
+	}
+
+	// The output buffer is sized from DOut and FAISS writes n*d_out floats
+	// without checking it, so both dimensions must be sound.
+	dIn, dOut := t.DIn(), t.DOut()
+	if err := ValidateVectors(x, dIn); err != nil {
+		return nil, wrapError(err, "apply vectors validation")
+	}
+	if dOut <= 0 {
+		return nil, wrapError(ErrInvalidDimension, "apply output dimension")
+	}
+
+	if !t.IsTrained() {
+		return nil, wrapError(ErrIndexNotTrained, "vector transform apply")
+	}
+
+	n := len(x) / dIn
+	xt := make([]float32, n*dOut)
+	if c := C.goss_VectorTransform_apply_noalloc(t.vt, C.idx_t(n), (*C.float)(&x[0]), (*C.float)(&xt[0])); c != 0 {
+		return nil, wrapError(getLastExtError(), "vector transform apply")
+	}
+	return xt, nil
+}
+
+// ReverseTransform maps vectors of dimension DOut back to dimension DIn.
+// Only some transforms support it, e.g. orthonormal linear transforms.
+func (t *VectorTransform) ReverseTransform(xt []float32) ([]float32, error) {
+	if t.vt == nil {
+		return nil, ErrNullPointer
+	}
+
+	dOut := t.DOut()
+	if err := ValidateVectors(xt, dOut); err != nil {
+		return nil, wrapError(err, "reverse transform vectors validation")
+	}
+
+	if !t.IsTrained() {
+		return nil, wrapError(ErrIndexNotTrained, "vector transform reverse")
+	}
+
+	n := len(xt) / dOut
+	x := make([]float32, n*t.DIn())
+	if c := C.goss_VectorTransform_reverse_transform(t.vt, C.idx_t(n), (*C.float)(&xt[0]), (*C.float)(&x[0])); c != 0 {
+		return nil, wrapError(getLastExtError(), "vector transform reverse")
+	}
+	return x, nil
+}
+
+// Delete frees the transform. It is idempotent and safe for concurrent use.
+func (t *VectorTransform) Delete() {
+	t.free(false)
+}
+
+func (t *VectorTransform) finalize() {
+	t.free(true)
+}
+
+func (t *VectorTransform) free(finalized bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.vt != nil {
+		C.faiss_VectorTransform_free(t.vt)
+		t.vt = nil
+		untrackObject(unsafe.Pointer(t), finalized)
+	}
+	runtime.SetFinalizer(t, nil)
+}
+
+// IndexPreTransform applies a VectorTransform to vectors before passing them
+// to a sub-index, both when adding and when searching. Training trains the
+// transform and then the sub-index on transformed vectors.
+type IndexPreTransform struct {
+	Index
+	vt  *VectorTransform // Kept alive for as long as the index references it
+	sub Index            // Kept alive for as long as the index references it
+}
+
+// NewIndexPreTransform composes vt and sub. The new index does not take
+// ownership of vt or sub: both must outlive it and be deleted separately,
+// after it. Indexes read back with ReadIndex own their whole chain.
+func NewIndexPreTransform(vt *VectorTransform, sub Index) (*IndexPreTransform, error) {
+	if vt == nil || vt.vt == nil {
+		return nil, errors.New("vector transform is nil")
+	}
+	if sub == nil || sub.cPtr() == nil {
+		return nil, errors.New("sub-index is nil")
+	}
+	if vt.DOut() != sub.D() {
+		return nil, fmt.Errorf("transform output dimension %d doesn't match sub-index dimension %d", vt.DOut(), sub.D())
+	}
+
+	var cIdx *C.FaissIndex
+	if c := C.faiss_IndexPreTransform_new_with_transform(&cIdx, vt.vt, sub.cPtr()); c != 0 {
+		return nil, wrapError(getLastError(), "IndexPreTransform creation")
+	}
+	C.faiss_IndexPreTransform_set_own_fields(cIdx, 0)
+
+	return &IndexPreTransform{Index: newFaissIndex(cIdx), vt: vt, sub: sub}, nil
+}
+
+// Transform returns the vector transform
+func (idx *IndexPreTransform) Transform() *VectorTransform {
+	return idx.vt
+}
+
+// SubIndex returns the index receiving the transformed vectors
+func (idx *IndexPreTransform) SubIndex() Index {
+	return idx.sub
+}
+
+// Close frees the pre-transform index and detaches it from idx; afterwards
+// its methods return ErrIndexClosed. The transform and sub-index are not
+// freed. It is safe to call more than once, but not concurrently with other
+// methods.
+func (idx *IndexPreTransform) Close() error {
+	if idx.Index != nil {
+		idx.Index.Delete()
+	}
+	idx.Index = closedIndex
+	idx.vt = nil
+	idx.sub = nil
+	return nil
+}
+
+// Delete frees the pre-transform index. It is equivalent to Close.
+func (idx *IndexPreTransform) Delete() {
+	idx.Close()
+}
@@ -0,0 +1,75 @@
+package faiss
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIndexPreTransformClose(t *testing.T) {
+	const dIn, dOut = 16, 8
+	x := randomVectors(1000, dIn, 1)
+
+	pca, err := NewPCAMatrix(dIn, dOut)
+	if err != nil {
+		t.Fatalf("NewPCAMatrix: %v", err)
+	}
+	defer pca.Delete()
+	sub := newFlatL2(t, dOut, nil)
+
+	idx, err := NewIndexPreTransform(pca, sub)
+	if err != nil {
+		t.Fatalf("NewIndexPreTransform: %v", err)
+	}
+	if err := idx.Train(x); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	if err := idx.Add(x); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	idx.Close()
+	idx.Close()
+
+	if _, _, err := idx.Search(x[:dIn], 1); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Search after Close = %v, want ErrIndexClosed", err)
+	}
+	if n := idx.Ntotal(); n != 0 {
+		t.Errorf("Ntotal after Close = %d", n)
+	}
+
+	// The transform and sub-index are left alive
+	if got := sub.Ntotal(); got != 1000 {
+		t.Errorf("sub-index Ntotal = %d, want 1000", got)
+	}
+	if _, err := pca.Apply(x[:dIn]); err != nil {
+		t.Errorf("Apply after Close: %v", err)
+	}
+}
+
+func TestVectorTransformApplyChecksDimensions(t *testing.T) {
+	pca, err := NewPCAMatrix(16, 8)
+	if err != nil {
+		t.Fatalf("NewPCAMatrix: %v", err)
+	}
+	defer pca.Delete()
+
+	if _, err := pca.Apply(randomVectors(1, 16, 1)); !errors.Is(err, ErrIndexNotTrained) {
+		t.Errorf("Apply before Train = %v, want ErrIndexNotTrained", err)
+	}
+	if err := pca.Train(randomVectors(500, 16, 2)); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+
+	var mismatch *DimensionMismatchError
+	if _, err := pca.Apply(randomVectors(1, 15, 3)); !errors.As(err, &mismatch) {
+		t.Errorf("Apply with 15 floats = %v, want a DimensionMismatchError", err)
+	}
+
+	xt, err := pca.Apply(randomVectors(3, 16, 4))
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(xt) != 3*8 {
+		t.Errorf("Apply returned %d floats, want %d", len(xt), 3*8)
+	}
+}
@@ -0,0 +1,329 @@
+package faiss
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// VectorStore is a small vector database on top of a FAISS index: vectors are
+// addressed by string keys and carry string metadata.
+// It is safe for concurrent use.
+type VectorStore struct {
+	mu     sync.RWMutex
+	saveMu sync.Mutex // Serializes Save, which only read-locks mu
+	index  Index
+	closed bool
+	keys   map[string]int64
+	ids    map[int64]string
+	meta   map[string]map[string]string
+	nextID int64
+}
+
+// SearchHit is a single result of VectorStore.Query.
+type SearchHit struct {
+	Key      string            // Key of the stored vector
+	Distance float32           // Distance under the index metric
+	Meta     map[string]string // Metadata stored with the vector
+}
+
+// vectorStoreState is the sidecar persisted next to the index.
+type vectorStoreState struct {
+	Keys   map[string]int64
+	Meta   map[string]map[string]string
+	NextID int64
+}
+
+// NewVectorStore creates an empty store for d-dimensional vectors.
+// description is an IndexFactory description, "Flat" if empty; indexes
+// without native ID support are wrapped in an IDMap. Deleting keys requires
+// an index type that supports RemoveIDs, such as Flat or IVF.
+func NewVectorStore(d int, description string, metric int) (*VectorStore, error) {
+	if description == "" {
+		description = "Flat"
+	}
+	if !strings.HasPrefix(description, "IVF") && !strings.HasPrefix(description, "IDMap") {
+		description = "IDMap," + description
+	}
+
+	idx, err := IndexFactory(d, description, metric)
+	if err != nil {
+		return nil, wrapError(err, "vector store index")
+	}
+
+	return newVectorStore(idx, vectorStoreState{}), nil
+}
+
+func newVectorStore(idx Index, state vectorStoreState) *VectorStore {
+	s := &VectorStore{
+		index:  idx,
+		keys:   state.Keys,
+		ids:    make(map[int64]string, len(state.Keys)),
+		meta:   state.Meta,
+		nextID: state.NextID,
+	}
+	if s.keys == nil {
+		s.keys = make(map[string]int64)
+	}
+	if s.meta == nil {
+		s.meta = make(map[string]map[string]string)
+	}
+	for key, id := range s.keys {
+		s.ids[id] = key
+	}
+	return s
+}
+
+// Index returns the underlying index, e.g. to train it before the first Put.
+func (s *VectorStore) Index() Index {
+	return s.index
+}
+
+// Len returns the number of stored keys.
+func (s *VectorStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.keys)
+}
+
+// Put stores vector and meta under key, replacing any previous value. A
+// replacement is atomic: if it fails, the previous value is kept.
+func (s *VectorStore) Put(key string, vector []float32, meta map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrIndexClosed
+	}
+	if len(vector) != s.index.D() {
+		return &DimensionMismatchError{Got: len(vector), Want: s.index.D()}
+	}
+
+	// Add the new vector before removing the old one, so that a failure
+	// leaves the previous value in place.
+	id := s.nextID
+	if err := s.index.AddWithIDs(vector, []int64{id}); err != nil {
+		return wrapError(err, "vector store put")
+	}
+	s.nextID++
+
+	if oldID, ok := s.keys[key]; ok {
+		if err := s.removeID(oldID); err != nil {
+			if rollbackErr := s.removeID(id); rollbackErr != nil {
+				return fmt.Errorf("vector store upsert: %w (rollback: %v)", err, rollbackErr)
+			}
+			return wrapError(err, "vector store upsert")
+		}
+		delete(s.ids, oldID)
+		delete(s.meta, key)
+	}
+
+	s.keys[key] = id
+	s.ids[id] = key
+	if meta != nil {
+		s.meta[key] = copyMeta(meta)
+	}
+	return nil
+}
+
+// Delete removes key from the store. It returns ErrKeyNotFound if key is absent.
+func (s *VectorStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrIndexClosed
+	}
+	id, ok := s.keys[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if err := s.removeID(id); err != nil {
+		return wrapError(err, "vector store delete")
+	}
+
+	delete(s.keys, key)
+	delete(s.ids, id)
+	delete(s.meta, key)
+	return nil
+}
+
+// removeID deletes the vector with the given ID from the index, leaving the
+// mappings untouched. s.mu must be held.
+func (s *VectorStore) removeID(id int64) error {
+	sel, err := NewIDSelectorBatch([]int64{id})
+	if err != nil {
+		return err
+	}
+	defer sel.Delete()
+
+	_, err = s.index.RemoveIDs(sel)
+	return err
+}
+
+// Query returns the k stored vectors closest to vector.
+func (s *VectorStore) Query(vector []float32, k int64) ([]SearchHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrIndexClosed
+	}
+	if len(s.keys) == 0 {
+		return nil, nil
+	}
+
+	distances, labels, err := s.index.Search(vector, k)
+	if err != nil {
+		return nil, wrapError(err, "vector store query")
+	}
+
+	hits := make([]SearchHit, 0, len(labels))
+	for i, label := range labels {
+		key, ok := s.ids[label]
+		if !ok {
+			continue
+		}
+		hits = append(hits, SearchHit{
+			Key:      key,
+			Distance: distances[i],
+			Meta:     copyMeta(s.meta[key]),
+		})
+	}
+	return hits, nil
+}
+
+// Save persists the store into dir. The index and the key mappings are
+// written as a new generation and published together by atomically
+// replacing a CURRENT pointer file, so a crash never leaves a mismatched pair.
+// Queries may run during Save; concurrent Saves are serialized.
+func (s *VectorStore) Save(dir string) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrIndexClosed
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return wrapError(err, "could not create directory")
+	}
+
+	gen := 1
+	if cur, err := readCurrentGeneration(dir); err == nil {
+		gen = cur + 1
+	}
+
+	if err := WriteIndex(s.index, filepath.Join(dir, indexFileName(gen))); err != nil {
+		return wrapError(err, "vector store save index")
+	}
+
+	f, err := os.Create(filepath.Join(dir, stateFileName(gen)))
+	if err != nil {
+		return wrapError(err, "vector store save mappings")
+	}
+	state := vectorStoreState{Keys: s.keys, Meta: s.meta, NextID: s.nextID}
+	if err := gob.NewEncoder(f).Encode(&state); err != nil {
+		f.Close()
+		return wrapError(err, "vector store encode mappings")
+	}
+	if err := f.Close(); err != nil {
+		return wrapError(err, "vector store save mappings")
+	}
+
+	tmp := filepath.Join(dir, "CURRENT.tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(gen)), 0644); err != nil {
+		return wrapError(err, "vector store save pointer")
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "CURRENT")); err != nil {
+		return wrapError(err, "vector store publish")
+	}
+
+	// The previous generation is no longer referenced.
+	os.Remove(filepath.Join(dir, indexFileName(gen-1)))
+	os.Remove(filepath.Join(dir, stateFileName(gen-1)))
+	return nil
+}
+
+// LoadVectorStore opens a store previously saved into dir.
+func LoadVectorStore(dir string) (*VectorStore, error) {
+	gen, err := readCurrentGeneration(dir)
+	if err != nil {
+		return nil, wrapError(err, "vector store load pointer")
+	}
+
+	f, err := os.Open(filepath.Join(dir, stateFileName(gen)))
+	if err != nil {
+		return nil, wrapError(err, "vector store load mappings")
+	}
+	defer f.Close()
+
+	var state vectorStoreState
+	if err := gob.NewDecoder(f).Decode(&state); err != nil {
+		return nil, wrapError(err, "vector store decode mappings")
+	}
+
+	idx, err := ReadIndex(filepath.Join(dir, indexFileName(gen)), 0)
+	if err != nil {
+		return nil, wrapError(err, "vector store load index")
+	}
+
+	if idx.Ntotal() != int64(len(state.Keys)) {
+		idx.Delete()
+		return nil, fmt.Errorf("vector store index holds %d vectors but mappings hold %d keys", idx.Ntotal(), len(state.Keys))
+	}
+
+	return newVectorStore(idx, state), nil
+}
+
+// Close frees the underlying index. Afterwards the store methods return
+// ErrIndexClosed. It is safe to call more than once.
+func (s *VectorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.index.Delete()
+		s.closed = true
+	}
+	return nil
+}
+
+func readCurrentGeneration(dir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "CURRENT"))
+	if err != nil {
+		return 0, err
+	}
+	gen, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || gen <= 0 {
+		return 0, errors.New("invalid CURRENT file")
+	}
+	return gen, nil
+}
+
+func indexFileName(gen int) string {
+	return fmt.Sprintf("index.%d.faiss", gen)
+}
+
+func stateFileName(gen int) string {
+	return fmt.Sprintf("mappings.%d.gob", gen)
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	result := make(map[string]string, len(meta))
+	for k, v := range meta {
+		result[k] = v
+	}
+	return result
+}
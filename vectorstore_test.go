@@ -0,0 +1,133 @@
+package faiss
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func newTestStore(t *testing.T, d int) *VectorStore {
+	t.Helper()
+
+	s, err := NewVectorStore(d, "Flat", MetricL2)
+	if err != nil {
+		t.Fatalf("NewVectorStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestVectorStorePutQueryDelete(t *testing.T) {
+	s := newTestStore(t, 2)
+
+	if err := s.Put("a", []float32{0, 0}, map[string]string{"n": "1"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("b", []float32{5, 5}, nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// Replacing moves a next to b
+	if err := s.Put("a", []float32{5, 6}, map[string]string{"n": "2"}); err != nil {
+		t.Fatalf("Put replace: %v", err)
+	}
+	if got := s.Len(); got != 2 {
+		t.Errorf("Len = %d, want 2", got)
+	}
+
+	hits, err := s.Query([]float32{5, 6}, 2)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(hits) != 2 || hits[0].Key != "a" || hits[0].Meta["n"] != "2" || hits[1].Key != "b" {
+		t.Errorf("Query = %+v", hits)
+	}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete("a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("second Delete = %v, want ErrKeyNotFound", err)
+	}
+	if hits, err := s.Query([]float32{5, 6}, 2); err != nil || len(hits) != 1 || hits[0].Key != "b" {
+		t.Errorf("Query after Delete = %+v, %v", hits, err)
+	}
+}
+
+func TestVectorStoreFailedReplaceKeepsOldValue(t *testing.T) {
+	s := newTestStore(t, 2)
+
+	if err := s.Put("a", []float32{1, 1}, map[string]string{"v": "old"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := s.Index().Frozen(); err != nil {
+		t.Fatalf("Frozen: %v", err)
+	}
+
+	if err := s.Put("a", []float32{9, 9}, map[string]string{"v": "new"}); err == nil {
+		t.Fatal("Put on a frozen index succeeded")
+	}
+
+	hits, err := s.Query([]float32{1, 1}, 1)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Key != "a" || hits[0].Distance != 0 || hits[0].Meta["v"] != "old" {
+		t.Errorf("Query after failed replace = %+v, want the old value", hits)
+	}
+}
+
+func TestVectorStoreConcurrentSave(t *testing.T) {
+	s := newTestStore(t, 4)
+	x := randomVectors(100, 4, 1)
+	for i := 0; i < 100; i++ {
+		if err := s.Put(fmt.Sprintf("key%d", i), x[i*4:(i+1)*4], nil); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Save(dir); err != nil {
+				t.Errorf("Save: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	loaded, err := LoadVectorStore(dir)
+	if err != nil {
+		t.Fatalf("LoadVectorStore: %v", err)
+	}
+	defer loaded.Close()
+	if got := loaded.Len(); got != 100 {
+		t.Errorf("loaded Len = %d, want 100", got)
+	}
+}
+
+func TestVectorStoreClose(t *testing.T) {
+	s := newTestStore(t, 2)
+	if err := s.Put("a", []float32{1, 1}, nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	s.Close()
+	s.Close()
+
+	if err := s.Put("b", []float32{1, 1}, nil); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Put after Close = %v, want ErrIndexClosed", err)
+	}
+	if _, err := s.Query([]float32{1, 1}, 1); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Query after Close = %v, want ErrIndexClosed", err)
+	}
+	if err := s.Delete("a"); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Delete after Close = %v, want ErrIndexClosed", err)
+	}
+	if err := s.Save(t.TempDir()); !errors.Is(err, ErrIndexClosed) {
+		t.Errorf("Save after Close = %v, want ErrIndexClosed", err)
+	}
+}
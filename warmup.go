@@ -0,0 +1,123 @@
+package faiss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// warmupReadSize is the chunk size used to read mapped index files
+const warmupReadSize = 1 << 20
+
+// WarmupStats reports the work done by Warmup.
+type WarmupStats struct {
+	BytesTouched int64         // Bytes of the index file read into the page cache
+	Queries      int           // Number of throwaway queries run
+	Duration     time.Duration // Total warm-up time
+}
+
+// WarmupStrategy selects how Warmup populates the page cache.
+type WarmupStrategy interface {
+	warmup(ctx context.Context, idx *faissIndex, stats *WarmupStats) error
+	// needsMmap reports whether the strategy only applies to mapped indexes.
+	needsMmap() bool
+}
+
+type touchAll struct{}
+
+// TouchAll returns a strategy that sequentially reads the whole mapped index
+// file, so every page is resident before serving.
+func TouchAll() WarmupStrategy {
+	return touchAll{}
+}
+
+func (touchAll) needsMmap() bool { return true }
+
+func (touchAll) warmup(ctx context.Context, idx *faissIndex, stats *WarmupStats) error {
+	f, err := os.Open(idx.mmapPath)
+	if err != nil {
+		return wrapError(err, "open mapped index file")
+	}
+	defer f.Close()
+
+	buf := make([]byte, warmupReadSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := f.Read(buf)
+		stats.BytesTouched += int64(n)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return wrapError(err, "read mapped index file")
+		}
+	}
+}
+
+type sampleQueries struct {
+	queries []float32
+	k       int64
+}
+
+// SampleQueries returns a strategy that runs throwaway searches with queries,
+// which faults in the pages those searches touch as well as any precomputed
+// tables FAISS builds lazily. Queries should resemble production traffic.
+// Unlike TouchAll it also applies to indexes fully held in memory, whose
+// first searches pay for cold CPU caches and lazy initialization.
+func SampleQueries(queries []float32, k int64) WarmupStrategy {
+	return sampleQueries{queries: queries, k: k}
+}
+
+func (sampleQueries) needsMmap() bool { return false }
+
+func (s sampleQueries) warmup(ctx context.Context, idx *faissIndex, stats *WarmupStats) error {
+	d := idx.D()
+	if err := ValidateVectors(s.queries, d); err != nil {
+		return wrapError(err, "warmup queries validation")
+	}
+
+	batchSize, _ := searchBatchSize(0)
+	n := len(s.queries) / d
+	for i := 0; i < n; i += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch := GetVectorBatch(s.queries, d, i, batchSize)
+		if _, _, err := idx.Search(batch, s.k); err != nil {
+			return wrapError(err, fmt.Sprintf("warmup queries %d-%d", i, i+len(batch)/d-1))
+		}
+		stats.Queries += len(batch) / d
+	}
+	return nil
+}
+
+func (idx *faissIndex) Warmup(strategy WarmupStrategy) (WarmupStats, error) {
+	return idx.WarmupContext(context.Background(), strategy)
+}
+
+func (idx *faissIndex) WarmupContext(ctx context.Context, strategy WarmupStrategy) (WarmupStats, error) {
+	var stats WarmupStats
+	if idx.idx == nil {
+		return stats, ErrIndexClosed
+	}
+
+	if strategy == nil {
+		return stats, errors.New("warmup strategy is nil")
+	}
+
+	if idx.mmapPath == "" && strategy.needsMmap() {
+		return stats, nil
+	}
+
+	start := time.Now()
+	err := strategy.warmup(ctx, idx, &stats)
+	stats.Duration = time.Since(start)
+	return stats, err
+}
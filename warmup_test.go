@@ -0,0 +1,113 @@
+package faiss
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWarmupMmapIndex(t *testing.T) {
+	const d, nlist, n, k = 16, 16, 2000, 5
+	x := clusteredVectors(n, d, nlist, 1)
+	queries := randomVectors(20, d, 2)
+
+	mem := newIVFFlatL2(t, d, nlist, x)
+	fname := filepath.Join(t.TempDir(), "ivf.index")
+	if err := WriteIndex(mem, fname); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	info, err := os.Stat(fname)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	idx, err := ReadIndex(fname, IOFlagMmap)
+	if err != nil {
+		t.Fatalf("ReadIndex: %v", err)
+	}
+	defer idx.Delete()
+
+	stats, err := idx.Warmup(TouchAll())
+	if err != nil {
+		t.Fatalf("Warmup(TouchAll): %v", err)
+	}
+	if stats.BytesTouched != info.Size() {
+		t.Errorf("BytesTouched = %d, want the file size %d", stats.BytesTouched, info.Size())
+	}
+
+	stats, err = idx.Warmup(SampleQueries(queries, k))
+	if err != nil {
+		t.Fatalf("Warmup(SampleQueries): %v", err)
+	}
+	if stats.Queries != 20 {
+		t.Errorf("Queries = %d, want 20", stats.Queries)
+	}
+
+	// Warming up doesn't change what a search returns
+	wantD, wantL, err := mem.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	gotD, gotL, err := idx.Search(queries, k)
+	if err != nil {
+		t.Fatalf("Search after Warmup: %v", err)
+	}
+	if !reflect.DeepEqual(gotL, wantL) || !approxEqual(gotD, wantD, 1e-5) {
+		t.Error("search after Warmup differs from the in-memory index")
+	}
+}
+
+func TestWarmupInMemoryIndex(t *testing.T) {
+	idx := newFlatL2(t, 4, randomVectors(10, 4, 1))
+
+	// TouchAll only applies to mapped indexes
+	stats, err := idx.Warmup(TouchAll())
+	if err != nil || stats.BytesTouched != 0 {
+		t.Errorf("Warmup(TouchAll) on a memory index = %+v, %v, want a no-op", stats, err)
+	}
+	if _, err := idx.Warmup(nil); err == nil {
+		t.Error("Warmup accepted a nil strategy")
+	}
+	if _, err := idx.Warmup(SampleQueries(randomVectors(1, 4, 2)[:3], 1)); err == nil {
+		t.Error("Warmup accepted queries of the wrong dimension")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := idx.WarmupContext(ctx, SampleQueries(randomVectors(2, 4, 2), 1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("WarmupContext with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestWarmupTouchAllCancelled(t *testing.T) {
+	const d, nlist = 8, 4
+	fname := filepath.Join(t.TempDir(), "ivf.index")
+	if err := WriteIndex(newIVFFlatL2(t, d, nlist, clusteredVectors(500, d, nlist, 1)), fname); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	idx, err := ReadIndex(fname, IOFlagMmap)
+	if err != nil {
+		t.Fatalf("ReadIndex: %v", err)
+	}
+	defer idx.Delete()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err := idx.WarmupContext(ctx, TouchAll())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WarmupContext(TouchAll) with a cancelled context = %v, want context.Canceled", err)
+	}
+	if stats.BytesTouched != 0 {
+		t.Errorf("BytesTouched = %d after cancellation, want 0", stats.BytesTouched)
+	}
+
+	stats, err = idx.Warmup(TouchAll())
+	if err != nil {
+		t.Fatalf("Warmup(TouchAll): %v", err)
+	}
+	if stats.Duration <= 0 || stats.Queries != 0 {
+		t.Errorf("Warmup(TouchAll) stats = %+v, want a duration and no queries", stats)
+	}
+}